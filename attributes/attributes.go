@@ -25,7 +25,10 @@
 // later release.
 package attributes
 
-import "fmt"
+import (
+	"fmt"
+	"reflect"
+)
 
 // Attributes is an immutable struct for storing and retrieving generic
 // key/value pairs.  Keys must be hashable, and users should define their own
@@ -77,3 +80,41 @@ func (a *Attributes) Value(key interface{}) interface{} {
 	}
 	return a.m[key]
 }
+
+// Equal returns whether a and o are equivalent. If 'Equal(o interface{})
+// bool' is implemented for a value in the attributes, it is called to
+// determine if the value matches the one stored in the other attributes. If
+// Equal is not implemented, reflect.DeepEqual is used to determine if the
+// two values are equal, so values of types that are not comparable with ==
+// (e.g. maps) are compared by their contents.
+func (a *Attributes) Equal(o interface{}) bool {
+	oa, ok := o.(*Attributes)
+	if !ok {
+		return false
+	}
+	if a == nil && oa == nil {
+		return true
+	}
+	if a == nil || oa == nil {
+		return false
+	}
+	if len(a.m) != len(oa.m) {
+		return false
+	}
+	for k, v := range a.m {
+		ov, ok := oa.m[k]
+		if !ok {
+			// o missing element of a
+			return false
+		}
+		if eq, ok := v.(interface{ Equal(o interface{}) bool }); ok {
+			if !eq.Equal(ov) {
+				return false
+			}
+		} else if !reflect.DeepEqual(v, ov) {
+			// Fallback to reflect.DeepEqual if Equal is unimplemented.
+			return false
+		}
+	}
+	return true
+}
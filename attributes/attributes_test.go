@@ -58,3 +58,49 @@ func TestDeepEqual(t *testing.T) {
 		t.Fatalf("reflect.DeepEqual(%+v, %+v), want true, got false", a1, a2)
 	}
 }
+
+type equalableValue struct {
+	val int
+}
+
+func (e equalableValue) Equal(o interface{}) bool {
+	oe, ok := o.(equalableValue)
+	return ok && e.val == oe.val
+}
+
+func TestEqual(t *testing.T) {
+	type keyOne struct{}
+	type keyTwo struct{}
+	testCases := []struct {
+		name string
+		a1   *attributes.Attributes
+		a2   *attributes.Attributes
+		want bool
+	}{
+		{name: "both nil", a1: nil, a2: nil, want: true},
+		{name: "one nil", a1: attributes.New(keyOne{}, 1), a2: nil, want: false},
+		{name: "different lengths", a1: attributes.New(keyOne{}, 1), a2: attributes.New(keyOne{}, 1, keyTwo{}, 2), want: false},
+		{name: "different keys", a1: attributes.New(keyOne{}, 1), a2: attributes.New(keyTwo{}, 1), want: false},
+		{name: "different values", a1: attributes.New(keyOne{}, 1), a2: attributes.New(keyOne{}, 2), want: false},
+		{name: "same values", a1: attributes.New(keyOne{}, 1), a2: attributes.New(keyOne{}, 1), want: true},
+		{
+			name: "values implementing Equal",
+			a1:   attributes.New(keyOne{}, equalableValue{val: 1}),
+			a2:   attributes.New(keyOne{}, equalableValue{val: 1}),
+			want: true,
+		},
+		{
+			name: "values implementing Equal, not equal",
+			a1:   attributes.New(keyOne{}, equalableValue{val: 1}),
+			a2:   attributes.New(keyOne{}, equalableValue{val: 2}),
+			want: false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.a1.Equal(tc.a2); got != tc.want {
+				t.Fatalf("%+v.Equal(%+v) = %v, want %v", tc.a1, tc.a2, got, tc.want)
+			}
+		})
+	}
+}
@@ -20,6 +20,7 @@
 package weightedroundrobin
 
 import (
+	orcapb "github.com/cncf/udpa/go/udpa/data/orca/v1"
 	"google.golang.org/grpc/resolver"
 )
 
@@ -59,3 +60,25 @@ func GetAddrInfo(addr resolver.Address) AddrInfo {
 	ai, _ := v.(AddrInfo)
 	return ai
 }
+
+// ORCAReportListener can be implemented by a weighted_round_robin child
+// balancer that wants to adjust its per-address weights based on measured
+// backend utilization, instead of relying only on the static weight learned
+// from EDS. A caller that owns the picker (e.g. the eds balancer) parses the
+// per-RPC ORCA load report out of balancer.DoneInfo.ServerLoad and invokes
+// OnLoadReport once per completed RPC, identifying the backend by the
+// resolver.Address that was used for the pick.
+//
+// This package does not yet provide an implementation of this interface:
+// weighted_round_robin here only stores the static per-address weight
+// learned from EDS (see AddrInfo) and has no dynamic-weight picker of its
+// own, so there is currently nothing in this tree that turns a load report
+// into an adjusted weight.
+//
+// Experimental
+//
+// Notice: This API is EXPERIMENTAL and may be changed or removed in a
+// later release.
+type ORCAReportListener interface {
+	OnLoadReport(addr resolver.Address, report *orcapb.OrcaLoadReport)
+}
@@ -17,6 +17,10 @@ type xdsClientInterface interface {
 	RDSCache() (string, map[string]client.RouteConfigUpdate)
 	CDSCache() (string, map[string]client.ClusterUpdate)
 	EDSCache() (string, map[string]client.EndpointsUpdate)
+	DumpLDS() (string, map[string]client.UpdateWithMD)
+	DumpRDS() (string, map[string]client.UpdateWithMD)
+	DumpCDS() (string, map[string]client.UpdateWithMD)
+	DumpEDS() (string, map[string]client.UpdateWithMD)
 	BootstrapConfig() *bootstrap.Config
 	Close()
 }
@@ -62,6 +66,10 @@ func (s *ClientConfigCache) buildClientCacheRespForReq() (*UpdateCache, error) {
 	ret.RDSVersion, ret.RDSCache = s.buildRDSCache()
 	ret.CDSVersion, ret.CDSCache = s.buildCDSCache()
 	ret.EDSVersion, ret.EDSCache = s.buildEDSCache()
+	ret.LDSMetadata = s.buildMetadata(s.xdsClient.DumpLDS)
+	ret.RDSMetadata = s.buildMetadata(s.xdsClient.DumpRDS)
+	ret.CDSMetadata = s.buildMetadata(s.xdsClient.DumpCDS)
+	ret.EDSMetadata = s.buildMetadata(s.xdsClient.DumpEDS)
 	return &ret, nil
 }
 
@@ -70,6 +78,27 @@ func (s *ClientConfigCache) Close() {
 	s.xdsClient.Close()
 }
 
+// Counts returns the number of resources currently cached per resource
+// type, for dashboards/alerting that want to notice a resource type
+// unexpectedly emptying out (e.g. the control plane dropped everything).
+func (s *ClientConfigCache) Counts() map[client.ResourceType]int {
+	_, lds := s.buildLDSCache()
+	_, rds := s.buildRDSCache()
+	_, cds := s.buildCDSCache()
+	_, eds := s.buildEDSCache()
+	return map[client.ResourceType]int{
+		client.ListenerResource:    len(lds),
+		client.RouteConfigResource: len(rds),
+		client.ClusterResource:     len(cds),
+		client.EndpointsResource:   len(eds),
+	}
+}
+
+// buildLDSCache, like buildRDSCache/buildCDSCache/buildEDSCache below, just
+// forwards to the xdsClient. The xdsClient's LDSCache (etc.) methods already
+// return an independent copy of its internal cache rather than the live map
+// it goes on mutating in place, so the UpdateCache these build into never
+// aliases state xdsClient can still be writing to.
 func (s *ClientConfigCache) buildLDSCache() (string, map[string]client.ListenerUpdate) {
 	return s.xdsClient.LDSCache()
 }
@@ -85,3 +114,15 @@ func (s *ClientConfigCache) buildCDSCache() (string, map[string]client.ClusterUp
 func (s *ClientConfigCache) buildEDSCache() (string, map[string]client.EndpointsUpdate) {
 	return s.xdsClient.EDSCache()
 }
+
+// buildMetadata extracts just the UpdateMetadata out of a Dump* method's
+// result, discarding the raw resource (already captured by the
+// corresponding *Cache map).
+func (s *ClientConfigCache) buildMetadata(dump func() (string, map[string]client.UpdateWithMD)) map[string]client.UpdateMetadata {
+	_, d := dump()
+	ret := make(map[string]client.UpdateMetadata, len(d))
+	for name, u := range d {
+		ret[name] = u.MD
+	}
+	return ret
+}
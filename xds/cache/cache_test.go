@@ -207,7 +207,7 @@ func TestClientCache(t *testing.T) {
 			}}},
 		},
 		Clusters: []*v3clusterpb.Cluster{
-			{Name: cdsTargets[nackResourceIdx], ClusterDiscoveryType: &v3clusterpb.Cluster_Type{Type: v3clusterpb.Cluster_STATIC}},
+			{Name: cdsTargets[nackResourceIdx], ClusterDiscoveryType: &v3clusterpb.Cluster_Type{Type: v3clusterpb.Cluster_ORIGINAL_DST}},
 		},
 		Endpoints: []*v3endpointpb.ClusterLoadAssignment{
 			{ClusterName: edsTargets[nackResourceIdx], Endpoints: []*v3endpointpb.LocalityLbEndpoints{{}}},
@@ -276,7 +276,128 @@ func TestClientCache(t *testing.T) {
 	t.Logf("%+v", le)
 }
 
+func TestFindEndpointsByListenerName_InlineEndpoints(t *testing.T) {
+	const (
+		listenerName = "listener"
+		routeName    = "route"
+		clusterName  = "cluster"
+	)
+	inlineEndpoints := &client.EndpointsUpdate{
+		Localities: []client.Locality{
+			{Endpoints: []client.Endpoint{{Address: "192.168.0.1:80"}}},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		clusterType client.ClusterType
+	}{
+		{name: "static", clusterType: client.ClusterTypeStatic},
+		{name: "logical-dns", clusterType: client.ClusterTypeLogicalDNS},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u := &UpdateCache{
+				LDSCache: map[string]client.ListenerUpdate{
+					listenerName: {RouteConfigName: routeName},
+				},
+				RDSCache: map[string]client.RouteConfigUpdate{
+					routeName: {
+						VirtualHosts: []*client.VirtualHost{
+							{Routes: []*client.Route{{WeightedClusters: map[string]client.WeightedCluster{clusterName: {}}}}},
+						},
+					},
+				},
+				CDSCache: map[string]client.ClusterUpdate{
+					clusterName: {
+						ClusterType:           test.clusterType,
+						InlineEndpointsUpdate: inlineEndpoints,
+					},
+				},
+			}
+
+			got, err := u.FindEndpointsByListenerName(listenerName)
+			if err != nil {
+				t.Fatalf("FindEndpointsByListenerName() failed: %v", err)
+			}
+			if got != inlineEndpoints {
+				t.Errorf("FindEndpointsByListenerName() = %+v, want the cluster's InlineEndpointsUpdate", got)
+			}
+		})
+	}
+}
+
+func TestFindWeightedEndpointsByListenerName(t *testing.T) {
+	const (
+		listenerName = "listener"
+		routeName    = "route"
+		clusterAName = "cluster-a"
+		clusterBName = "cluster-b"
+	)
+	endpointsA := client.EndpointsUpdate{
+		Localities: []client.Locality{
+			{Endpoints: []client.Endpoint{{Address: "192.168.0.1:80"}}},
+		},
+	}
+	endpointsB := client.EndpointsUpdate{
+		Localities: []client.Locality{
+			{Endpoints: []client.Endpoint{{Address: "192.168.0.2:80"}}},
+		},
+	}
 
+	u := &UpdateCache{
+		LDSCache: map[string]client.ListenerUpdate{
+			listenerName: {RouteConfigName: routeName},
+		},
+		RDSCache: map[string]client.RouteConfigUpdate{
+			routeName: {
+				VirtualHosts: []*client.VirtualHost{
+					{Routes: []*client.Route{{WeightedClusters: map[string]client.WeightedCluster{
+						clusterAName: {Weight: 80},
+						clusterBName: {Weight: 20},
+					}}}},
+				},
+			},
+		},
+		CDSCache: map[string]client.ClusterUpdate{
+			clusterAName: {ServiceName: clusterAName},
+			clusterBName: {ServiceName: clusterBName},
+		},
+		EDSCache: map[string]client.EndpointsUpdate{
+			clusterAName: endpointsA,
+			clusterBName: endpointsB,
+		},
+	}
+
+	got, err := u.FindWeightedEndpointsByListenerName(listenerName)
+	if err != nil {
+		t.Fatalf("FindWeightedEndpointsByListenerName() failed: %v", err)
+	}
+	want := map[string]WeightedEndpoints{
+		clusterAName: {Weight: 80, Endpoints: &endpointsA},
+		clusterBName: {Weight: 20, Endpoints: &endpointsB},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("FindWeightedEndpointsByListenerName() = %+v, want %+v", got, want)
+	}
+	for name, w := range want {
+		g, ok := got[name]
+		if !ok {
+			t.Errorf("FindWeightedEndpointsByListenerName() missing cluster %q", name)
+			continue
+		}
+		if g.Weight != w.Weight || !g.Endpoints.Equal(*w.Endpoints) {
+			t.Errorf("FindWeightedEndpointsByListenerName()[%q] = %+v, want %+v", name, g, w)
+		}
+	}
+}
+
+func TestFindWeightedEndpointsByListenerName_NotFound(t *testing.T) {
+	u := &UpdateCache{}
+	if _, err := u.FindWeightedEndpointsByListenerName("missing"); err == nil {
+		t.Errorf("FindWeightedEndpointsByListenerName() succeeded for a listener not in the cache, want an error")
+	}
+}
 
 func commonSetup(t *testing.T) (xdsClientInterfaceWithWatch, *e2e.ManagementServer, string, v3statuspb.ClientStatusDiscoveryService_StreamClientStatusClient, func()) {
 	t.Helper()
@@ -663,4 +784,3 @@ func protoToJSON(p proto.Message) string {
 	ret, _ := mm.MarshalToString(p)
 	return ret
 }
-
@@ -0,0 +1,79 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/xds/pkg/client"
+	"google.golang.org/grpc/xds/pkg/client/bootstrap"
+)
+
+// fakeXDSClientForCounts implements xdsClientInterface with canned
+// per-type caches of a fixed size, so tests can assert Counts() tallies
+// them correctly.
+type fakeXDSClientForCounts struct {
+	xdsClientInterface
+
+	lds map[string]client.ListenerUpdate
+	rds map[string]client.RouteConfigUpdate
+	cds map[string]client.ClusterUpdate
+	eds map[string]client.EndpointsUpdate
+}
+
+func (f *fakeXDSClientForCounts) LDSCache() (string, map[string]client.ListenerUpdate) {
+	return "", f.lds
+}
+func (f *fakeXDSClientForCounts) RDSCache() (string, map[string]client.RouteConfigUpdate) {
+	return "", f.rds
+}
+func (f *fakeXDSClientForCounts) CDSCache() (string, map[string]client.ClusterUpdate) {
+	return "", f.cds
+}
+func (f *fakeXDSClientForCounts) EDSCache() (string, map[string]client.EndpointsUpdate) {
+	return "", f.eds
+}
+func (f *fakeXDSClientForCounts) DumpLDS() (string, map[string]client.UpdateWithMD) { return "", nil }
+func (f *fakeXDSClientForCounts) DumpRDS() (string, map[string]client.UpdateWithMD) { return "", nil }
+func (f *fakeXDSClientForCounts) DumpCDS() (string, map[string]client.UpdateWithMD) { return "", nil }
+func (f *fakeXDSClientForCounts) DumpEDS() (string, map[string]client.UpdateWithMD) { return "", nil }
+func (f *fakeXDSClientForCounts) BootstrapConfig() *bootstrap.Config                { return nil }
+func (f *fakeXDSClientForCounts) Close()                                            {}
+
+func TestCounts(t *testing.T) {
+	cc := &ClientConfigCache{
+		xdsClient: &fakeXDSClientForCounts{
+			lds: map[string]client.ListenerUpdate{"l1": {}, "l2": {}},
+			rds: map[string]client.RouteConfigUpdate{"r1": {}},
+			cds: map[string]client.ClusterUpdate{},
+			eds: map[string]client.EndpointsUpdate{"e1": {}, "e2": {}, "e3": {}},
+		},
+	}
+
+	want := map[client.ResourceType]int{
+		client.ListenerResource:    2,
+		client.RouteConfigResource: 1,
+		client.ClusterResource:     0,
+		client.EndpointsResource:   3,
+	}
+	if diff := cmp.Diff(cc.Counts(), want); diff != "" {
+		t.Errorf("Counts() mismatch (-got +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,171 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	v3adminpb "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc/xds/pkg/client"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ConfigDump returns the xds client's cached resources as an Envoy admin
+// envoy.admin.v3.ConfigDump, for interop with tooling built around Envoy's
+// config_dump endpoint. Each resource type (listeners, routes, clusters,
+// endpoints) is packed as one entry of the returned ConfigDump's Configs
+// field.
+func (s *ClientConfigCache) ConfigDump() (*v3adminpb.ConfigDump, error) {
+	lds, err := ptypes.MarshalAny(s.buildLDSConfigDump())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ListenersConfigDump: %v", err)
+	}
+	rds, err := ptypes.MarshalAny(s.buildRDSConfigDump())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal RoutesConfigDump: %v", err)
+	}
+	cds, err := ptypes.MarshalAny(s.buildCDSConfigDump())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ClustersConfigDump: %v", err)
+	}
+	eds, err := ptypes.MarshalAny(s.buildEDSConfigDump())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal EndpointsConfigDump: %v", err)
+	}
+	return &v3adminpb.ConfigDump{Configs: []*anypb.Any{lds, rds, cds, eds}}, nil
+}
+
+func (s *ClientConfigCache) buildLDSConfigDump() *v3adminpb.ListenersConfigDump {
+	version, dump := s.xdsClient.DumpLDS()
+	var resources []*v3adminpb.ListenersConfigDump_DynamicListener
+	for name, d := range dump {
+		configDump := &v3adminpb.ListenersConfigDump_DynamicListener{
+			Name:         name,
+			ClientStatus: serviceStatusToProto(d.MD.Status),
+		}
+		if (d.MD.Timestamp != time.Time{}) {
+			configDump.ActiveState = &v3adminpb.ListenersConfigDump_DynamicListenerState{
+				VersionInfo: d.MD.Version,
+				Listener:    d.Raw,
+				LastUpdated: timestamppb.New(d.MD.Timestamp),
+			}
+		}
+		if errState := d.MD.ErrState; errState != nil {
+			configDump.ErrorState = &v3adminpb.UpdateFailureState{
+				LastUpdateAttempt: timestamppb.New(errState.Timestamp),
+				Details:           errState.Err.Error(),
+				VersionInfo:       errState.Version,
+			}
+		}
+		resources = append(resources, configDump)
+	}
+	return &v3adminpb.ListenersConfigDump{VersionInfo: version, DynamicListeners: resources}
+}
+
+func (s *ClientConfigCache) buildRDSConfigDump() *v3adminpb.RoutesConfigDump {
+	_, dump := s.xdsClient.DumpRDS()
+	var resources []*v3adminpb.RoutesConfigDump_DynamicRouteConfig
+	for _, d := range dump {
+		configDump := &v3adminpb.RoutesConfigDump_DynamicRouteConfig{
+			VersionInfo:  d.MD.Version,
+			ClientStatus: serviceStatusToProto(d.MD.Status),
+		}
+		if (d.MD.Timestamp != time.Time{}) {
+			configDump.RouteConfig = d.Raw
+			configDump.LastUpdated = timestamppb.New(d.MD.Timestamp)
+		}
+		if errState := d.MD.ErrState; errState != nil {
+			configDump.ErrorState = &v3adminpb.UpdateFailureState{
+				LastUpdateAttempt: timestamppb.New(errState.Timestamp),
+				Details:           errState.Err.Error(),
+				VersionInfo:       errState.Version,
+			}
+		}
+		resources = append(resources, configDump)
+	}
+	return &v3adminpb.RoutesConfigDump{DynamicRouteConfigs: resources}
+}
+
+func (s *ClientConfigCache) buildCDSConfigDump() *v3adminpb.ClustersConfigDump {
+	version, dump := s.xdsClient.DumpCDS()
+	var resources []*v3adminpb.ClustersConfigDump_DynamicCluster
+	for _, d := range dump {
+		configDump := &v3adminpb.ClustersConfigDump_DynamicCluster{
+			VersionInfo:  d.MD.Version,
+			ClientStatus: serviceStatusToProto(d.MD.Status),
+		}
+		if (d.MD.Timestamp != time.Time{}) {
+			configDump.Cluster = d.Raw
+			configDump.LastUpdated = timestamppb.New(d.MD.Timestamp)
+		}
+		if errState := d.MD.ErrState; errState != nil {
+			configDump.ErrorState = &v3adminpb.UpdateFailureState{
+				LastUpdateAttempt: timestamppb.New(errState.Timestamp),
+				Details:           errState.Err.Error(),
+				VersionInfo:       errState.Version,
+			}
+		}
+		resources = append(resources, configDump)
+	}
+	return &v3adminpb.ClustersConfigDump{VersionInfo: version, DynamicActiveClusters: resources}
+}
+
+func (s *ClientConfigCache) buildEDSConfigDump() *v3adminpb.EndpointsConfigDump {
+	_, dump := s.xdsClient.DumpEDS()
+	var resources []*v3adminpb.EndpointsConfigDump_DynamicEndpointConfig
+	for _, d := range dump {
+		configDump := &v3adminpb.EndpointsConfigDump_DynamicEndpointConfig{
+			VersionInfo:  d.MD.Version,
+			ClientStatus: serviceStatusToProto(d.MD.Status),
+		}
+		if (d.MD.Timestamp != time.Time{}) {
+			configDump.EndpointConfig = d.Raw
+			configDump.LastUpdated = timestamppb.New(d.MD.Timestamp)
+		}
+		if errState := d.MD.ErrState; errState != nil {
+			configDump.ErrorState = &v3adminpb.UpdateFailureState{
+				LastUpdateAttempt: timestamppb.New(errState.Timestamp),
+				Details:           errState.Err.Error(),
+				VersionInfo:       errState.Version,
+			}
+		}
+		resources = append(resources, configDump)
+	}
+	return &v3adminpb.EndpointsConfigDump{DynamicEndpointConfigs: resources}
+}
+
+func serviceStatusToProto(serviceStatus client.ServiceStatus) v3adminpb.ClientResourceStatus {
+	switch serviceStatus {
+	case client.ServiceStatusUnknown:
+		return v3adminpb.ClientResourceStatus_UNKNOWN
+	case client.ServiceStatusRequested:
+		return v3adminpb.ClientResourceStatus_REQUESTED
+	case client.ServiceStatusNotExist:
+		return v3adminpb.ClientResourceStatus_DOES_NOT_EXIST
+	case client.ServiceStatusACKed:
+		return v3adminpb.ClientResourceStatus_ACKED
+	case client.ServiceStatusNACKed:
+		return v3adminpb.ClientResourceStatus_NACKED
+	default:
+		return v3adminpb.ClientResourceStatus_UNKNOWN
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	v3adminpb "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	"google.golang.org/grpc/xds/pkg/client"
+	"google.golang.org/grpc/xds/pkg/client/bootstrap"
+)
+
+// fakeXDSClientForDump implements xdsClientInterface with canned Dump*
+// results, for unit testing ConfigDump without a management server.
+type fakeXDSClientForDump struct {
+	xdsClientInterface
+	ldsDump map[string]client.UpdateWithMD
+}
+
+func (f *fakeXDSClientForDump) DumpLDS() (string, map[string]client.UpdateWithMD) {
+	return "1", f.ldsDump
+}
+func (f *fakeXDSClientForDump) DumpRDS() (string, map[string]client.UpdateWithMD) { return "", nil }
+func (f *fakeXDSClientForDump) DumpCDS() (string, map[string]client.UpdateWithMD) { return "", nil }
+func (f *fakeXDSClientForDump) DumpEDS() (string, map[string]client.UpdateWithMD) { return "", nil }
+func (f *fakeXDSClientForDump) BootstrapConfig() *bootstrap.Config                { return nil }
+func (f *fakeXDSClientForDump) Close()                                            {}
+
+func TestConfigDump(t *testing.T) {
+	const listenerName = "lds.target.good:0000"
+	now := time.Now()
+	cc := &ClientConfigCache{
+		xdsClient: &fakeXDSClientForDump{
+			ldsDump: map[string]client.UpdateWithMD{
+				listenerName: {
+					MD: client.UpdateMetadata{
+						Status:    client.ServiceStatusACKed,
+						Version:   "1",
+						Timestamp: now,
+					},
+				},
+			},
+		},
+	}
+
+	dump, err := cc.ConfigDump()
+	if err != nil {
+		t.Fatalf("ConfigDump() failed: %v", err)
+	}
+	if n := len(dump.Configs); n != 4 {
+		t.Fatalf("ConfigDump() returned %d configs, want 4 (lds, rds, cds, eds)", n)
+	}
+
+	var lc v3adminpb.ListenersConfigDump
+	if err := dump.Configs[0].UnmarshalTo(&lc); err != nil {
+		t.Fatalf("failed to unmarshal ListenersConfigDump: %v", err)
+	}
+	if lc.VersionInfo != "1" {
+		t.Errorf("ListenersConfigDump.VersionInfo = %q, want %q", lc.VersionInfo, "1")
+	}
+	if n := len(lc.DynamicListeners); n != 1 {
+		t.Fatalf("ListenersConfigDump has %d dynamic listeners, want 1", n)
+	}
+	got := lc.DynamicListeners[0]
+	if got.Name != listenerName {
+		t.Errorf("DynamicListener.Name = %q, want %q", got.Name, listenerName)
+	}
+	if got.ClientStatus != v3adminpb.ClientResourceStatus_ACKED {
+		t.Errorf("DynamicListener.ClientStatus = %v, want ACKED", got.ClientStatus)
+	}
+	if got.ActiveState == nil || got.ActiveState.VersionInfo != "1" {
+		t.Errorf("DynamicListener.ActiveState = %+v, want VersionInfo %q", got.ActiveState, "1")
+	}
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	v2corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	v3corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+
+	"google.golang.org/grpc/xds/pkg"
+)
+
+// NodeID returns the id of the bootstrap node this client identifies as to
+// the management server. It returns the empty string if no bootstrap config
+// is available, e.g. before the xds client has been created.
+func (s *ClientConfigCache) NodeID() string {
+	switch n := s.nodeProto().(type) {
+	case *v2corepb.Node:
+		return n.GetId()
+	case *v3corepb.Node:
+		return n.GetId()
+	}
+	return ""
+}
+
+// NodeMetadata returns the opaque metadata extending the bootstrap node's
+// identifier, or nil if none is configured.
+func (s *ClientConfigCache) NodeMetadata() *structpb.Struct {
+	switch n := s.nodeProto().(type) {
+	case *v2corepb.Node:
+		return n.GetMetadata()
+	case *v3corepb.Node:
+		return n.GetMetadata()
+	}
+	return nil
+}
+
+// NodeLocality returns the locality of the bootstrap node this client
+// identifies as. It returns the zero value if no bootstrap config is
+// available, or the bootstrap node has no locality configured.
+func (s *ClientConfigCache) NodeLocality() pkg.LocalityID {
+	switch n := s.nodeProto().(type) {
+	case *v2corepb.Node:
+		l := n.GetLocality()
+		return pkg.LocalityID{Region: l.GetRegion(), Zone: l.GetZone(), SubZone: l.GetSubZone()}
+	case *v3corepb.Node:
+		l := n.GetLocality()
+		return pkg.LocalityID{Region: l.GetRegion(), Zone: l.GetZone(), SubZone: l.GetSubZone()}
+	}
+	return pkg.LocalityID{}
+}
+
+// nodeProto returns the bootstrap Node proto (either *v2corepb.Node or
+// *v3corepb.Node, depending on the transport API version in use), or nil if
+// no bootstrap config is available.
+func (s *ClientConfigCache) nodeProto() interface{} {
+	cfg := s.xdsClient.BootstrapConfig()
+	if cfg == nil {
+		return nil
+	}
+	return cfg.NodeProto
+}
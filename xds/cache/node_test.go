@@ -0,0 +1,100 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package cache
+
+import (
+	"testing"
+
+	v2corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	v3corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"google.golang.org/grpc/xds/pkg"
+	"google.golang.org/grpc/xds/pkg/client/bootstrap"
+)
+
+// fakeXDSClientForNode implements xdsClientInterface with a canned
+// BootstrapConfig, for unit testing the node accessors without a management
+// server.
+type fakeXDSClientForNode struct {
+	xdsClientInterface
+	cfg *bootstrap.Config
+}
+
+func (f *fakeXDSClientForNode) BootstrapConfig() *bootstrap.Config { return f.cfg }
+
+func TestNodeAccessorsV3(t *testing.T) {
+	md := &structpb.Struct{Fields: map[string]*structpb.Value{
+		"region": {Kind: &structpb.Value_StringValue{StringValue: "us-east"}},
+	}}
+	cc := &ClientConfigCache{
+		xdsClient: &fakeXDSClientForNode{
+			cfg: &bootstrap.Config{
+				NodeProto: &v3corepb.Node{
+					Id:       "node-1",
+					Metadata: md,
+					Locality: &v3corepb.Locality{Region: "r1", Zone: "z1", SubZone: "sz1"},
+				},
+			},
+		},
+	}
+
+	if got, want := cc.NodeID(), "node-1"; got != want {
+		t.Errorf("NodeID() = %q, want %q", got, want)
+	}
+	if got := cc.NodeMetadata(); got != md {
+		t.Errorf("NodeMetadata() = %v, want %v", got, md)
+	}
+	if got, want := cc.NodeLocality(), (pkg.LocalityID{Region: "r1", Zone: "z1", SubZone: "sz1"}); got != want {
+		t.Errorf("NodeLocality() = %+v, want %+v", got, want)
+	}
+}
+
+func TestNodeAccessorsV2(t *testing.T) {
+	cc := &ClientConfigCache{
+		xdsClient: &fakeXDSClientForNode{
+			cfg: &bootstrap.Config{
+				NodeProto: &v2corepb.Node{
+					Id:       "node-2",
+					Locality: &v2corepb.Locality{Region: "r2", Zone: "z2", SubZone: "sz2"},
+				},
+			},
+		},
+	}
+
+	if got, want := cc.NodeID(), "node-2"; got != want {
+		t.Errorf("NodeID() = %q, want %q", got, want)
+	}
+	if got, want := cc.NodeLocality(), (pkg.LocalityID{Region: "r2", Zone: "z2", SubZone: "sz2"}); got != want {
+		t.Errorf("NodeLocality() = %+v, want %+v", got, want)
+	}
+}
+
+func TestNodeAccessorsNoBootstrapConfig(t *testing.T) {
+	cc := &ClientConfigCache{xdsClient: &fakeXDSClientForNode{cfg: nil}}
+
+	if got := cc.NodeID(); got != "" {
+		t.Errorf("NodeID() = %q, want empty string", got)
+	}
+	if got := cc.NodeMetadata(); got != nil {
+		t.Errorf("NodeMetadata() = %v, want nil", got)
+	}
+	if got, want := cc.NodeLocality(), (pkg.LocalityID{}); got != want {
+		t.Errorf("NodeLocality() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package cache
+
+import "time"
+
+// subscribePollInterval is how often Subscribe checks the xds client for a
+// changed snapshot. Overridden in tests.
+//
+// xdsClientInterface only exposes pull-based Cache methods (mirroring the
+// csds package's xdsClientInterface, kept narrow for testability), so there's
+// no hook into the client's update path to push changes directly; polling
+// and diffing versions is the next best thing.
+var subscribePollInterval = time.Second
+
+// Subscribe starts watching for changes to any cached xDS resource type, and
+// returns a channel that receives a fresh snapshot whenever one of the
+// LDS/RDS/CDS/EDS versions changes. Rapid updates are coalesced: if the
+// previous snapshot hasn't been received yet, it's replaced by the latest
+// one rather than queued. The returned cancel function stops the
+// subscription; callers must call it to release resources.
+func (s *ClientConfigCache) Subscribe() (<-chan *UpdateCache, func()) {
+	ch := make(chan *UpdateCache, 1)
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(subscribePollInterval)
+		defer ticker.Stop()
+
+		var lastVersions [4]string
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				snap, err := s.FetchAll()
+				if err != nil {
+					continue
+				}
+				versions := [4]string{snap.LDSVersion, snap.RDSVersion, snap.CDSVersion, snap.EDSVersion}
+				if versions == lastVersions {
+					continue
+				}
+				lastVersions = versions
+
+				select {
+				case ch <- snap:
+				default:
+					// A previous snapshot is still unread; replace it with
+					// this fresher one instead of blocking or queueing.
+					select {
+					case <-ch:
+					default:
+					}
+					ch <- snap
+				}
+			}
+		}
+	}()
+
+	return ch, func() { close(done) }
+}
@@ -0,0 +1,112 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/xds/pkg/client"
+	"google.golang.org/grpc/xds/pkg/client/bootstrap"
+)
+
+// fakeXDSClientForSubscribe implements xdsClientInterface with a
+// mutable LDS version/cache, so tests can simulate the client observing a
+// new xDS update.
+type fakeXDSClientForSubscribe struct {
+	xdsClientInterface
+
+	mu      sync.Mutex
+	version string
+	cache   map[string]client.ListenerUpdate
+}
+
+func (f *fakeXDSClientForSubscribe) LDSCache() (string, map[string]client.ListenerUpdate) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.version, f.cache
+}
+func (f *fakeXDSClientForSubscribe) RDSCache() (string, map[string]client.RouteConfigUpdate) {
+	return "", nil
+}
+func (f *fakeXDSClientForSubscribe) CDSCache() (string, map[string]client.ClusterUpdate) {
+	return "", nil
+}
+func (f *fakeXDSClientForSubscribe) EDSCache() (string, map[string]client.EndpointsUpdate) {
+	return "", nil
+}
+func (f *fakeXDSClientForSubscribe) DumpLDS() (string, map[string]client.UpdateWithMD) {
+	return "", nil
+}
+func (f *fakeXDSClientForSubscribe) DumpRDS() (string, map[string]client.UpdateWithMD) {
+	return "", nil
+}
+func (f *fakeXDSClientForSubscribe) DumpCDS() (string, map[string]client.UpdateWithMD) {
+	return "", nil
+}
+func (f *fakeXDSClientForSubscribe) DumpEDS() (string, map[string]client.UpdateWithMD) {
+	return "", nil
+}
+func (f *fakeXDSClientForSubscribe) BootstrapConfig() *bootstrap.Config { return nil }
+func (f *fakeXDSClientForSubscribe) Close()                             {}
+
+func (f *fakeXDSClientForSubscribe) update(version string, cache map[string]client.ListenerUpdate) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.version = version
+	f.cache = cache
+}
+
+func TestSubscribe(t *testing.T) {
+	oldInterval := subscribePollInterval
+	subscribePollInterval = 10 * time.Millisecond
+	defer func() { subscribePollInterval = oldInterval }()
+
+	const listenerName = "lds.target.good:0000"
+	fake := &fakeXDSClientForSubscribe{version: "1", cache: map[string]client.ListenerUpdate{}}
+	cc := &ClientConfigCache{xdsClient: fake}
+
+	ch, cancel := cc.Subscribe()
+	defer cancel()
+
+	// The first poll should deliver a snapshot of the initial state.
+	select {
+	case snap := <-ch:
+		if snap.LDSVersion != "1" {
+			t.Fatalf("got initial LDSVersion %q, want %q", snap.LDSVersion, "1")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for initial snapshot")
+	}
+
+	fake.update("2", map[string]client.ListenerUpdate{listenerName: {}})
+
+	select {
+	case snap := <-ch:
+		if snap.LDSVersion != "2" {
+			t.Fatalf("got updated LDSVersion %q, want %q", snap.LDSVersion, "2")
+		}
+		if _, ok := snap.LDSCache[listenerName]; !ok {
+			t.Fatalf("updated snapshot missing listener %q: %+v", listenerName, snap.LDSCache)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for updated snapshot")
+	}
+}
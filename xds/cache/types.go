@@ -3,8 +3,17 @@ package cache
 import (
 	"errors"
 	"fmt"
-	"google.golang.org/grpc/xds/pkg/client"
 	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"google.golang.org/grpc/xds/pkg/client"
+	"google.golang.org/grpc/xds/pkg/resolver"
 )
 
 var (
@@ -12,24 +21,381 @@ var (
 )
 
 // UpdateCache - xds cache content
+//
+// A *UpdateCache returned by ClientConfigCache.FetchAll is a point-in-time
+// snapshot: the xdsClient hands FetchAll an independent copy of each
+// resource map rather than the live map it keeps mutating in place, so the
+// maps below are never written to again after construction. That makes u
+// itself safe to share across goroutines for reading. mu exists to guard
+// against the remaining way a caller could race with that: mutating the
+// exported map fields directly (e.g. patching in a single resource) while
+// another goroutine is in the middle of a Find* call, StaleResources,
+// ForEach, or Validate. All of those take mu for reading; a caller that
+// mutates the maps in place should hold mu for writing first.
 type UpdateCache struct {
-	LDSVersion string
-	LDSCache   map[string]client.ListenerUpdate
-	RDSVersion string
-	RDSCache   map[string]client.RouteConfigUpdate
-	CDSVersion string
-	CDSCache   map[string]client.ClusterUpdate
-	EDSVersion string
-	EDSCache   map[string]client.EndpointsUpdate
+	mu sync.RWMutex
+
+	LDSVersion  string
+	LDSCache    map[string]client.ListenerUpdate
+	LDSMetadata map[string]client.UpdateMetadata
+	RDSVersion  string
+	RDSCache    map[string]client.RouteConfigUpdate
+	RDSMetadata map[string]client.UpdateMetadata
+	CDSVersion  string
+	CDSCache    map[string]client.ClusterUpdate
+	CDSMetadata map[string]client.UpdateMetadata
+	EDSVersion  string
+	EDSCache    map[string]client.EndpointsUpdate
+	EDSMetadata map[string]client.UpdateMetadata
+}
+
+// StaleResources returns the name of every resource (across all four
+// resource types) whose UpdateMetadata.Timestamp is older than threshold, or
+// that has no timestamp at all (i.e. it's never been updated, only
+// requested). It's meant to help operators notice a control plane that has
+// gone silent for some subset of resources.
+func (u *UpdateCache) StaleResources(threshold time.Duration) []string {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	now := time.Now()
+	var stale []string
+	for _, mds := range []map[string]client.UpdateMetadata{u.LDSMetadata, u.RDSMetadata, u.CDSMetadata, u.EDSMetadata} {
+		for name, md := range mds {
+			if md.Timestamp.IsZero() || now.Sub(md.Timestamp) > threshold {
+				stale = append(stale, name)
+			}
+		}
+	}
+	return stale
+}
+
+// ForEach walks every resource in the cache, in LDS, RDS, CDS, EDS order, and
+// within each resource type in ascending order by name. It supports building
+// generic exporters and validators that don't want to know about the four
+// typed maps.
+func (u *UpdateCache) ForEach(fn func(typ client.ResourceType, name string, resource interface{})) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	var ldsNames, rdsNames, cdsNames, edsNames []string
+	for name := range u.LDSCache {
+		ldsNames = append(ldsNames, name)
+	}
+	for name := range u.RDSCache {
+		rdsNames = append(rdsNames, name)
+	}
+	for name := range u.CDSCache {
+		cdsNames = append(cdsNames, name)
+	}
+	for name := range u.EDSCache {
+		edsNames = append(edsNames, name)
+	}
+	sort.Strings(ldsNames)
+	sort.Strings(rdsNames)
+	sort.Strings(cdsNames)
+	sort.Strings(edsNames)
+
+	for _, name := range ldsNames {
+		fn(client.ListenerResource, name, u.LDSCache[name])
+	}
+	for _, name := range rdsNames {
+		fn(client.RouteConfigResource, name, u.RDSCache[name])
+	}
+	for _, name := range cdsNames {
+		fn(client.ClusterResource, name, u.CDSCache[name])
+	}
+	for _, name := range edsNames {
+		fn(client.EndpointsResource, name, u.EDSCache[name])
+	}
+}
+
+// Validate walks LDS->RDS->CDS->EDS and returns one error per dangling
+// reference found: a listener pointing at a route config that isn't in the
+// cache, a route pointing at a cluster that isn't in the cache, or a cluster
+// pointing at an EDS resource that isn't in the cache. It's meant to help
+// operators diagnose a partial control-plane push. A cache with no dangling
+// references returns nil.
+func (u *UpdateCache) Validate() []error {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	var ldsNames, rdsNames, cdsNames []string
+	for name := range u.LDSCache {
+		ldsNames = append(ldsNames, name)
+	}
+	for name := range u.RDSCache {
+		rdsNames = append(rdsNames, name)
+	}
+	for name := range u.CDSCache {
+		cdsNames = append(cdsNames, name)
+	}
+	sort.Strings(ldsNames)
+	sort.Strings(rdsNames)
+	sort.Strings(cdsNames)
+
+	var errs []error
+	for _, name := range ldsNames {
+		l := u.LDSCache[name]
+		if l.RouteConfigName == "" {
+			// No RDS reference, e.g. a server-side listener.
+			continue
+		}
+		if _, ok := u.RDSCache[l.RouteConfigName]; !ok {
+			errs = append(errs, fmt.Errorf("listener %q references route config %q, which is not in the cache", name, l.RouteConfigName))
+		}
+	}
+	for _, name := range rdsNames {
+		r := u.RDSCache[name]
+		for _, vh := range r.VirtualHosts {
+			for _, rt := range vh.Routes {
+				for cluster := range rt.WeightedClusters {
+					if _, ok := u.CDSCache[cluster]; !ok {
+						errs = append(errs, fmt.Errorf("route config %q references cluster %q, which is not in the cache", name, cluster))
+					}
+				}
+			}
+		}
+	}
+	for _, name := range cdsNames {
+		c := u.CDSCache[name]
+		if c.ClusterType == client.ClusterTypeLogicalDNS || c.ClusterType == client.ClusterTypeStatic {
+			// Endpoints are inline, not a separate EDS resource.
+			continue
+		}
+		if _, ok := u.EDSCache[c.ServiceName]; !ok {
+			errs = append(errs, fmt.Errorf("cluster %q references endpoints %q, which is not in the cache", name, c.ServiceName))
+		}
+	}
+	return errs
+}
+
+// FindFilterChain selects the best-matching filter chain from the named
+// listener's inbound filter chains, following Envoy's filter chain matching
+// precedence: destination IP, source type, source IP, then source port, with
+// a chain that specifies more of these criteria taking priority over one
+// that specifies fewer. This is the resolution step a server-side xDS
+// listener needs once a connection has arrived; FindListenerByName alone
+// cannot pick among several filter chains attached to one listener. If no
+// filter chain matches, the listener's DefaultFilterChain is returned.
+//
+// conn describes the incoming connection being matched, not a candidate
+// chain's own match criteria: its DestPrefixRanges/SourcePrefixRanges are
+// expected to each hold the connection's single actual destination/source
+// address, and SourcePorts the connection's single actual source port.
+// Destination port, transport protocol and application protocol are part of
+// Envoy's matching algorithm too, but gRPC's FilterChainMatch doesn't carry
+// them (see the comment on that type), so they play no part here. SNI is
+// carried (FilterChainMatch.ServerNames), but is matched separately by
+// FindListenerByAddress when disambiguating listeners sharing an address,
+// not by this function.
+func (u *UpdateCache) FindFilterChain(name string, conn client.FilterChainMatch) (*client.FilterChain, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	lis, ok := u.LDSCache[name]
+	if !ok {
+		return nil, errResourceNotFound
+	}
+	cfg := lis.InboundListenerCfg
+	if cfg == nil {
+		return nil, fmt.Errorf("listener %q has no inbound listener configuration", name)
+	}
+
+	var destIP, srcIP net.IP
+	if len(conn.DestPrefixRanges) > 0 {
+		destIP = conn.DestPrefixRanges[0]
+	}
+	if len(conn.SourcePrefixRanges) > 0 {
+		srcIP = conn.SourcePrefixRanges[0]
+	}
+	var srcPort uint32
+	if len(conn.SourcePorts) > 0 {
+		srcPort = conn.SourcePorts[0]
+	}
+
+	var best *client.FilterChain
+	var bestScore int
+	for _, fc := range cfg.FilterChains {
+		score, ok := filterChainMatchScore(fc.Match, destIP, conn.SourceType, srcIP, srcPort)
+		if !ok {
+			continue
+		}
+		if best == nil || score > bestScore {
+			best, bestScore = fc, score
+		}
+	}
+	if best != nil {
+		return best, nil
+	}
+	if cfg.DefaultFilterChain != nil {
+		return cfg.DefaultFilterChain, nil
+	}
+	return nil, fmt.Errorf("no filter chain (or default filter chain) matches the incoming connection on listener %q", name)
+}
+
+// filterChainMatchScore reports whether m matches the given connection
+// characteristics, and if so, how specific the match is: each matched
+// criterion contributes more weight than all the criteria after it combined,
+// so a chain matching on a higher-precedence criterion always outranks one
+// that only matches on lower-precedence criteria.
+func filterChainMatchScore(m *client.FilterChainMatch, destIP net.IP, srcType client.SourceType, srcIP net.IP, srcPort uint32) (int, bool) {
+	if m == nil {
+		return 0, true
+	}
+	score := 0
+	if len(m.DestPrefixRanges) > 0 {
+		if !containsIP(m.DestPrefixRanges, destIP) {
+			return 0, false
+		}
+		score += 8
+	}
+	if m.SourceType != client.SourceTypeAny {
+		if m.SourceType != srcType {
+			return 0, false
+		}
+		score += 4
+	}
+	if len(m.SourcePrefixRanges) > 0 {
+		if !containsIP(m.SourcePrefixRanges, srcIP) {
+			return 0, false
+		}
+		score += 2
+	}
+	if len(m.SourcePorts) > 0 {
+		if !containsPort(m.SourcePorts, srcPort) {
+			return 0, false
+		}
+		score++
+	}
+	return score, true
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, candidate := range ips {
+		if candidate.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsPort(ports []uint32, port uint32) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+// FindListenerByAddress finds the listener whose InboundListenerCfg is bound
+// to addr. serverName disambiguates between listeners that share an address
+// by SNI: a listener only matches if one of its filter chains (or its
+// default filter chain) has no ServerNames restriction, or has a
+// ServerNames list containing serverName. serverName may be empty, in which
+// case only listeners with an unrestricted (or absent) filter chain match.
+// If no listener matches on both address and SNI, errResourceNotFound is
+// returned.
+func (u *UpdateCache) FindListenerByAddress(addr net.Addr, serverName string) (*client.ListenerUpdate, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil, fmt.Errorf("xds: failed to parse address %q: %v", addr, err)
+	}
+
+	// listenersAtAddress already returns candidates in sorted name order, so
+	// that when more than one listener matches (which shouldn't normally
+	// happen once SNI disambiguates them), the result is deterministic
+	// rather than depending on map order.
+	for _, lis := range listenersAtAddress(u.LDSCache, host, port) {
+		if listenerMatchesServerName(lis.InboundListenerCfg, serverName) {
+			l := lis
+			return &l, nil
+		}
+	}
+	return nil, errResourceNotFound
+}
+
+// FindListenersByAddress finds every listener whose InboundListenerCfg is
+// bound to addr, in ascending name order, for callers that need to see all
+// candidates sharing an address (e.g. to apply match criteria beyond SNI)
+// rather than have FindListenerByAddress pick the best SNI match for them.
+// errResourceNotFound is returned if no listener is bound to addr.
+func (u *UpdateCache) FindListenersByAddress(addr net.Addr) ([]*client.ListenerUpdate, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil, fmt.Errorf("xds: failed to parse address %q: %v", addr, err)
+	}
+
+	lises := listenersAtAddress(u.LDSCache, host, port)
+	if len(lises) == 0 {
+		return nil, errResourceNotFound
+	}
+	matches := make([]*client.ListenerUpdate, len(lises))
+	for i, lis := range lises {
+		l := lis
+		matches[i] = &l
+	}
+	return matches, nil
 }
 
-// FindListenerByAddress - find listener by address
-func (u *UpdateCache) FindListenerByAddress(addr net.Addr) (*client.ListenerUpdate, error) {
-	return nil, fmt.Errorf("method not implement")
+// listenersAtAddress returns, in ascending name order, every listener in
+// ldsCache whose InboundListenerCfg is bound to host:port.
+func listenersAtAddress(ldsCache map[string]client.ListenerUpdate, host, port string) []client.ListenerUpdate {
+	names := make([]string, 0, len(ldsCache))
+	for name := range ldsCache {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var matches []client.ListenerUpdate
+	for _, name := range names {
+		lis := ldsCache[name]
+		cfg := lis.InboundListenerCfg
+		if cfg == nil || cfg.Address != host || cfg.Port != port {
+			continue
+		}
+		matches = append(matches, lis)
+	}
+	return matches
+}
+
+// listenerMatchesServerName reports whether one of cfg's filter chains (or
+// its default filter chain) would accept serverName: either the chain has
+// no ServerNames restriction, or serverName is one of them.
+func listenerMatchesServerName(cfg *client.InboundListenerConfig, serverName string) bool {
+	chains := cfg.FilterChains
+	if cfg.DefaultFilterChain != nil {
+		chains = append(chains, cfg.DefaultFilterChain)
+	}
+	for _, fc := range chains {
+		var names []string
+		if fc.Match != nil {
+			names = fc.Match.ServerNames
+		}
+		if len(names) == 0 {
+			return true
+		}
+		for _, n := range names {
+			if n == serverName {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // FindListenerByName - find listener by name
 func (u *UpdateCache) FindListenerByName(name string) (*client.ListenerUpdate, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
 	lis, ok := u.LDSCache[name]
 	if !ok {
 		return nil, errResourceNotFound
@@ -40,6 +406,9 @@ func (u *UpdateCache) FindListenerByName(name string) (*client.ListenerUpdate, e
 
 // FindRouteByName - find route by name
 func (u *UpdateCache) FindRouteByName(name string) (*client.RouteConfigUpdate, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
 	rt, ok := u.RDSCache[name]
 	if !ok {
 		return nil, errResourceNotFound
@@ -47,8 +416,36 @@ func (u *UpdateCache) FindRouteByName(name string) (*client.RouteConfigUpdate, e
 	return &rt, nil
 }
 
+// FindRouteByDomain finds the route config named routeName, selects its
+// best matching virtual host for host using the same domain-matching
+// precedence xds/pkg/resolver applies when resolving the xds:// scheme, and
+// returns that virtual host's first route — the one a server handling a
+// request for host would apply. errResourceNotFound is returned if
+// routeName isn't in the cache or no virtual host's domains match host, or
+// if the matching virtual host has no routes.
+func (u *UpdateCache) FindRouteByDomain(routeName, host string) (*client.Route, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	rt, ok := u.RDSCache[routeName]
+	if !ok {
+		return nil, errResourceNotFound
+	}
+	vh, err := resolver.FindBestMatchingVirtualHost(host, rt.VirtualHosts)
+	if err != nil {
+		return nil, errResourceNotFound
+	}
+	if len(vh.Routes) == 0 {
+		return nil, errResourceNotFound
+	}
+	return vh.Routes[0], nil
+}
+
 // FindClusterByName - find cluster by name
 func (u *UpdateCache) FindClusterByName(name string) (*client.ClusterUpdate, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
 	ct, ok := u.CDSCache[name]
 	if !ok {
 		return nil, errResourceNotFound
@@ -58,6 +455,9 @@ func (u *UpdateCache) FindClusterByName(name string) (*client.ClusterUpdate, err
 
 // FindEndpointsByName - find endpoint by name
 func (u *UpdateCache) FindEndpointsByName(name string) (*client.EndpointsUpdate, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
 	es, ok := u.EDSCache[name]
 	if !ok {
 		return nil, errResourceNotFound
@@ -67,6 +467,9 @@ func (u *UpdateCache) FindEndpointsByName(name string) (*client.EndpointsUpdate,
 
 // FindEndpointsByListenerName - find endpoints by listener name
 func (u *UpdateCache) FindEndpointsByListenerName(name string) (*client.EndpointsUpdate, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
 	ls, ok := u.LDSCache[name]
 	if !ok {
 		return nil, errResourceNotFound
@@ -88,11 +491,73 @@ func (u *UpdateCache) FindEndpointsByListenerName(name string) (*client.Endpoint
 		break
 	}
 
+	return u.findEndpointsByClusterName(cluster)
+}
+
+// WeightedEndpoints pairs the resolved endpoints of a weighted-route cluster
+// with the relative weight it was given in the route.
+type WeightedEndpoints struct {
+	Weight    uint32
+	Endpoints *client.EndpointsUpdate
+}
+
+// FindWeightedEndpointsByListenerName resolves the same
+// listener->route->cluster->endpoints chain as FindEndpointsByListenerName,
+// but instead of picking a single cluster off the first route, it returns
+// every cluster referenced by that route's WeightedClusters, keyed by
+// cluster name, along with each one's weight and resolved endpoints.
+func (u *UpdateCache) FindWeightedEndpointsByListenerName(name string) (map[string]WeightedEndpoints, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	ls, ok := u.LDSCache[name]
+	if !ok {
+		return nil, errResourceNotFound
+	}
+
+	rt, ok := u.RDSCache[ls.RouteConfigName]
+	if !ok {
+		return nil, errResourceNotFound
+	}
+
+	if len(rt.VirtualHosts) <= 0 || len(rt.VirtualHosts[0].Routes) <= 0 {
+		return nil, errResourceNotFound
+	}
+
+	weightedClusters := rt.VirtualHosts[0].Routes[0].WeightedClusters
+	if len(weightedClusters) == 0 {
+		return nil, errResourceNotFound
+	}
+
+	result := make(map[string]WeightedEndpoints, len(weightedClusters))
+	for cluster, wc := range weightedClusters {
+		es, err := u.findEndpointsByClusterName(cluster)
+		if err != nil {
+			return nil, err
+		}
+		result[cluster] = WeightedEndpoints{Weight: wc.Weight, Endpoints: es}
+	}
+	return result, nil
+}
+
+// findEndpointsByClusterName resolves cluster to its endpoints, following
+// the inline-vs-EDS split that CDS clusters allow. The caller must already
+// hold u.mu for reading.
+func (u *UpdateCache) findEndpointsByClusterName(cluster string) (*client.EndpointsUpdate, error) {
 	cs, ok := u.CDSCache[cluster]
 	if !ok {
 		return nil, errResourceNotFound
 	}
 
+	// LOGICAL_DNS and STATIC clusters carry their endpoints inline in CDS,
+	// rather than via a separate EDS resource.
+	if cs.ClusterType == client.ClusterTypeLogicalDNS || cs.ClusterType == client.ClusterTypeStatic {
+		if cs.InlineEndpointsUpdate == nil {
+			return nil, errResourceNotFound
+		}
+		return cs.InlineEndpointsUpdate, nil
+	}
+
 	// pick eds
 	es, ok := u.EDSCache[cs.ServiceName]
 	if !ok {
@@ -102,3 +567,123 @@ func (u *UpdateCache) FindEndpointsByListenerName(name string) (*client.Endpoint
 	return &es, nil
 }
 
+// ResourceDiff reports which resource names (within a single resource type)
+// were added, removed, or modified between two cache snapshots. Modified
+// means the name is present in both snapshots but its content differs.
+type ResourceDiff struct {
+	Added    []string
+	Removed  []string
+	Modified []string
+}
+
+// CacheDiff reports, per resource type, what changed between two UpdateCache
+// snapshots.
+type CacheDiff struct {
+	LDS ResourceDiff
+	RDS ResourceDiff
+	CDS ResourceDiff
+	EDS ResourceDiff
+}
+
+// DiffCache compares old and new, reporting added/removed/modified resource
+// names for each of LDS/RDS/CDS/EDS. It's meant for tooling that polls
+// ClientConfigCache.FetchAll and wants to alert on config churn without
+// diffing the full snapshots itself. A nil old or new is treated as an empty
+// cache, so DiffCache(nil, new) reports every resource in new as added.
+func DiffCache(old, new *UpdateCache) CacheDiff {
+	if old == nil {
+		old = &UpdateCache{}
+	}
+	if new == nil {
+		new = &UpdateCache{}
+	}
+	return CacheDiff{
+		LDS: diffLDS(old.LDSCache, new.LDSCache),
+		RDS: diffRDS(old.RDSCache, new.RDSCache),
+		CDS: diffCDS(old.CDSCache, new.CDSCache),
+		EDS: diffEDS(old.EDSCache, new.EDSCache),
+	}
+}
+
+func diffLDS(old, new map[string]client.ListenerUpdate) ResourceDiff {
+	var diff ResourceDiff
+	for name, newVal := range new {
+		oldVal, ok := old[name]
+		if !ok {
+			diff.Added = append(diff.Added, name)
+		} else if !cmp.Equal(oldVal, newVal, cmpopts.EquateEmpty(), protocmp.Transform()) {
+			diff.Modified = append(diff.Modified, name)
+		}
+	}
+	for name := range old {
+		if _, ok := new[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sortDiff(&diff)
+	return diff
+}
+
+func diffRDS(old, new map[string]client.RouteConfigUpdate) ResourceDiff {
+	var diff ResourceDiff
+	for name, newVal := range new {
+		oldVal, ok := old[name]
+		if !ok {
+			diff.Added = append(diff.Added, name)
+		} else if !cmp.Equal(oldVal, newVal, cmpopts.EquateEmpty(), protocmp.Transform()) {
+			diff.Modified = append(diff.Modified, name)
+		}
+	}
+	for name := range old {
+		if _, ok := new[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sortDiff(&diff)
+	return diff
+}
+
+func diffCDS(old, new map[string]client.ClusterUpdate) ResourceDiff {
+	var diff ResourceDiff
+	for name, newVal := range new {
+		oldVal, ok := old[name]
+		if !ok {
+			diff.Added = append(diff.Added, name)
+		} else if !cmp.Equal(oldVal, newVal, cmpopts.EquateEmpty(), protocmp.Transform()) {
+			diff.Modified = append(diff.Modified, name)
+		}
+	}
+	for name := range old {
+		if _, ok := new[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sortDiff(&diff)
+	return diff
+}
+
+func diffEDS(old, new map[string]client.EndpointsUpdate) ResourceDiff {
+	var diff ResourceDiff
+	for name, newVal := range new {
+		oldVal, ok := old[name]
+		if !ok {
+			diff.Added = append(diff.Added, name)
+		} else if !oldVal.Equal(newVal) {
+			diff.Modified = append(diff.Modified, name)
+		}
+	}
+	for name := range old {
+		if _, ok := new[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sortDiff(&diff)
+	return diff
+}
+
+// sortDiff sorts each of diff's name lists for deterministic output.
+func sortDiff(diff *ResourceDiff) {
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Modified)
+}
@@ -0,0 +1,529 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package cache
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/xds/pkg"
+	"google.golang.org/grpc/xds/pkg/client"
+)
+
+func TestStaleResources(t *testing.T) {
+	now := time.Now()
+	u := &UpdateCache{
+		LDSMetadata: map[string]client.UpdateMetadata{
+			"fresh-listener": {Timestamp: now},
+			"stale-listener": {Timestamp: now.Add(-time.Hour)},
+		},
+		CDSMetadata: map[string]client.UpdateMetadata{
+			"never-updated-cluster": {}, // zero Timestamp: requested, never ACKed/NACKed.
+		},
+	}
+
+	got := u.StaleResources(time.Minute)
+	sort.Strings(got)
+	want := []string{"never-updated-cluster", "stale-listener"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("StaleResources() returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cache   *UpdateCache
+		wantLen int
+	}{
+		{
+			name: "fully consistent",
+			cache: &UpdateCache{
+				LDSCache: map[string]client.ListenerUpdate{
+					"listener": {RouteConfigName: "route"},
+				},
+				RDSCache: map[string]client.RouteConfigUpdate{
+					"route": {VirtualHosts: []*client.VirtualHost{{
+						Routes: []*client.Route{{WeightedClusters: map[string]client.WeightedCluster{"cluster": {}}}},
+					}}},
+				},
+				CDSCache: map[string]client.ClusterUpdate{
+					"cluster": {ServiceName: "endpoints"},
+				},
+				EDSCache: map[string]client.EndpointsUpdate{
+					"endpoints": {},
+				},
+			},
+			wantLen: 0,
+		},
+		{
+			name: "listener references missing route config",
+			cache: &UpdateCache{
+				LDSCache: map[string]client.ListenerUpdate{
+					"listener": {RouteConfigName: "missing-route"},
+				},
+			},
+			wantLen: 1,
+		},
+		{
+			name: "route references missing cluster",
+			cache: &UpdateCache{
+				RDSCache: map[string]client.RouteConfigUpdate{
+					"route": {VirtualHosts: []*client.VirtualHost{{
+						Routes: []*client.Route{{WeightedClusters: map[string]client.WeightedCluster{"missing-cluster": {}}}},
+					}}},
+				},
+			},
+			wantLen: 1,
+		},
+		{
+			name: "cluster references missing endpoints",
+			cache: &UpdateCache{
+				CDSCache: map[string]client.ClusterUpdate{
+					"cluster": {ServiceName: "missing-endpoints"},
+				},
+			},
+			wantLen: 1,
+		},
+		{
+			name: "logical DNS cluster needs no EDS resource",
+			cache: &UpdateCache{
+				CDSCache: map[string]client.ClusterUpdate{
+					"cluster": {ClusterType: client.ClusterTypeLogicalDNS, ServiceName: "missing-endpoints"},
+				},
+			},
+			wantLen: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cache.Validate(); len(got) != tt.wantLen {
+				t.Errorf("Validate() = %v, want %d error(s)", got, tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestFindFilterChain(t *testing.T) {
+	destMatch := net.ParseIP("10.0.0.1")
+	otherDest := net.ParseIP("10.0.0.2")
+	specific := &client.FilterChain{Match: &client.FilterChainMatch{DestPrefixRanges: []net.IP{destMatch}}}
+	defaultChain := &client.FilterChain{}
+
+	u := &UpdateCache{
+		LDSCache: map[string]client.ListenerUpdate{
+			"listener": {
+				InboundListenerCfg: &client.InboundListenerConfig{
+					FilterChains:       []*client.FilterChain{specific},
+					DefaultFilterChain: defaultChain,
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+		conn client.FilterChainMatch
+		want *client.FilterChain
+	}{
+		{
+			name: "destination prefix matches the specific chain",
+			conn: client.FilterChainMatch{DestPrefixRanges: []net.IP{destMatch}},
+			want: specific,
+		},
+		{
+			name: "destination prefix matches nothing, falls back to default",
+			conn: client.FilterChainMatch{DestPrefixRanges: []net.IP{otherDest}},
+			want: defaultChain,
+		},
+		{
+			name: "no match criteria on the connection, falls back to default",
+			conn: client.FilterChainMatch{},
+			want: defaultChain,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := u.FindFilterChain("listener", tt.conn)
+			if err != nil {
+				t.Fatalf("FindFilterChain() returned unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("FindFilterChain() = %p, want %p", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := u.FindFilterChain("missing", client.FilterChainMatch{}); err == nil {
+		t.Error("FindFilterChain() for a missing listener returned a nil error")
+	}
+}
+
+func TestFindRouteByDomain(t *testing.T) {
+	exactRoute := &client.Route{}
+	wildcardRoute := &client.Route{}
+	universalRoute := &client.Route{}
+
+	u := &UpdateCache{
+		RDSCache: map[string]client.RouteConfigUpdate{
+			"route": {
+				VirtualHosts: []*client.VirtualHost{
+					{Domains: []string{"*"}, Routes: []*client.Route{universalRoute}},
+					{Domains: []string{"*.example.com"}, Routes: []*client.Route{wildcardRoute}},
+					{Domains: []string{"foo.example.com"}, Routes: []*client.Route{exactRoute}},
+					{Domains: []string{"empty.example.com"}},
+				},
+			},
+			"no-universal-route": {
+				VirtualHosts: []*client.VirtualHost{
+					{Domains: []string{"foo.example.com"}, Routes: []*client.Route{exactRoute}},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+		host string
+		want *client.Route
+	}{
+		{name: "exact domain wins over wildcard and universal", host: "foo.example.com", want: exactRoute},
+		{name: "wildcard domain wins over universal", host: "bar.example.com", want: wildcardRoute},
+		{name: "falls back to universal domain", host: "unrelated.org", want: universalRoute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := u.FindRouteByDomain("route", tt.host)
+			if err != nil {
+				t.Fatalf("FindRouteByDomain() returned unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("FindRouteByDomain() = %p, want %p", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := u.FindRouteByDomain("missing", "foo.example.com"); err == nil {
+		t.Error("FindRouteByDomain() for a missing route config returned a nil error")
+	}
+	if _, err := u.FindRouteByDomain("no-universal-route", "no.match.possible"); err == nil {
+		t.Error("FindRouteByDomain() for a host matching no domain returned a nil error")
+	}
+	if _, err := u.FindRouteByDomain("route", "empty.example.com"); err == nil {
+		t.Error("FindRouteByDomain() for a matching virtual host with no routes returned a nil error")
+	}
+}
+
+func TestFindListenerByAddress(t *testing.T) {
+	fooListener := client.ListenerUpdate{
+		RouteConfigName: "foo-route",
+		InboundListenerCfg: &client.InboundListenerConfig{
+			Address: "10.0.0.1",
+			Port:    "443",
+			FilterChains: []*client.FilterChain{
+				{Match: &client.FilterChainMatch{ServerNames: []string{"foo.example.com"}}},
+			},
+		},
+	}
+	barListener := client.ListenerUpdate{
+		RouteConfigName: "bar-route",
+		InboundListenerCfg: &client.InboundListenerConfig{
+			Address: "10.0.0.1",
+			Port:    "443",
+			FilterChains: []*client.FilterChain{
+				{Match: &client.FilterChainMatch{ServerNames: []string{"bar.example.com"}}},
+			},
+		},
+	}
+	openListener := client.ListenerUpdate{
+		RouteConfigName: "open-route",
+		InboundListenerCfg: &client.InboundListenerConfig{
+			Address:      "10.0.0.2",
+			Port:         "443",
+			FilterChains: []*client.FilterChain{{Match: &client.FilterChainMatch{}}},
+		},
+	}
+
+	u := &UpdateCache{
+		LDSCache: map[string]client.ListenerUpdate{
+			"foo":  fooListener,
+			"bar":  barListener,
+			"open": openListener,
+		},
+	}
+
+	tests := []struct {
+		name       string
+		addr       net.Addr
+		serverName string
+		want       *client.ListenerUpdate
+	}{
+		{
+			name:       "SNI disambiguates listeners sharing an address",
+			addr:       &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443},
+			serverName: "foo.example.com",
+			want:       &fooListener,
+		},
+		{
+			name:       "a different SNI on the same address picks the other listener",
+			addr:       &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443},
+			serverName: "bar.example.com",
+			want:       &barListener,
+		},
+		{
+			name:       "a listener with no ServerNames restriction matches any SNI",
+			addr:       &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 443},
+			serverName: "anything.example.com",
+			want:       &openListener,
+		},
+		{
+			name:       "a listener with no ServerNames restriction matches no SNI",
+			addr:       &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 443},
+			serverName: "",
+			want:       &openListener,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := u.FindListenerByAddress(tt.addr, tt.serverName)
+			if err != nil {
+				t.Fatalf("FindListenerByAddress() returned unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("FindListenerByAddress() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if _, err := u.FindListenerByAddress(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443}, "unknown.example.com"); err != errResourceNotFound {
+		t.Errorf("FindListenerByAddress() with a non-matching SNI = %v, want errResourceNotFound", err)
+	}
+	if _, err := u.FindListenerByAddress(&net.TCPAddr{IP: net.ParseIP("10.0.0.9"), Port: 443}, ""); err != errResourceNotFound {
+		t.Errorf("FindListenerByAddress() with a non-matching address = %v, want errResourceNotFound", err)
+	}
+}
+
+func TestFindListenersByAddress(t *testing.T) {
+	fooListener := client.ListenerUpdate{
+		RouteConfigName: "foo-route",
+		InboundListenerCfg: &client.InboundListenerConfig{
+			Address: "10.0.0.1",
+			Port:    "443",
+			FilterChains: []*client.FilterChain{
+				{Match: &client.FilterChainMatch{ServerNames: []string{"foo.example.com"}}},
+			},
+		},
+	}
+	barListener := client.ListenerUpdate{
+		RouteConfigName: "bar-route",
+		InboundListenerCfg: &client.InboundListenerConfig{
+			Address: "10.0.0.1",
+			Port:    "443",
+			FilterChains: []*client.FilterChain{
+				{Match: &client.FilterChainMatch{ServerNames: []string{"bar.example.com"}}},
+			},
+		},
+	}
+	openListener := client.ListenerUpdate{
+		RouteConfigName: "open-route",
+		InboundListenerCfg: &client.InboundListenerConfig{
+			Address:      "10.0.0.2",
+			Port:         "443",
+			FilterChains: []*client.FilterChain{{Match: &client.FilterChainMatch{}}},
+		},
+	}
+
+	u := &UpdateCache{
+		LDSCache: map[string]client.ListenerUpdate{
+			"foo":  fooListener,
+			"bar":  barListener,
+			"open": openListener,
+		},
+	}
+
+	got, err := u.FindListenersByAddress(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443})
+	if err != nil {
+		t.Fatalf("FindListenersByAddress() returned unexpected error: %v", err)
+	}
+	want := []*client.ListenerUpdate{&barListener, &fooListener} // sorted by name: "bar" < "foo"
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("FindListenersByAddress() mismatch (-want +got):\n%s", diff)
+	}
+
+	got, err = u.FindListenersByAddress(&net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 443})
+	if err != nil {
+		t.Fatalf("FindListenersByAddress() returned unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]*client.ListenerUpdate{&openListener}, got); diff != "" {
+		t.Errorf("FindListenersByAddress() mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := u.FindListenersByAddress(&net.TCPAddr{IP: net.ParseIP("10.0.0.9"), Port: 443}); err != errResourceNotFound {
+		t.Errorf("FindListenersByAddress() with a non-matching address = %v, want errResourceNotFound", err)
+	}
+}
+
+func TestForEach(t *testing.T) {
+	u := &UpdateCache{
+		LDSCache: map[string]client.ListenerUpdate{"listener": {}},
+		RDSCache: map[string]client.RouteConfigUpdate{"route": {}},
+		CDSCache: map[string]client.ClusterUpdate{"cluster": {}},
+		EDSCache: map[string]client.EndpointsUpdate{"endpoints": {}},
+	}
+
+	type visit struct {
+		Typ  client.ResourceType
+		Name string
+	}
+	var got []visit
+	u.ForEach(func(typ client.ResourceType, name string, _ interface{}) {
+		got = append(got, visit{typ, name})
+	})
+
+	want := []visit{
+		{client.ListenerResource, "listener"},
+		{client.RouteConfigResource, "route"},
+		{client.ClusterResource, "cluster"},
+		{client.EndpointsResource, "endpoints"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ForEach() visited unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestDiffCache(t *testing.T) {
+	old := &UpdateCache{
+		LDSCache: map[string]client.ListenerUpdate{
+			"removed-listener":   {RouteConfigName: "route-1"},
+			"unchanged-listener": {RouteConfigName: "route-1"},
+			"modified-listener":  {RouteConfigName: "route-1"},
+		},
+		RDSCache: map[string]client.RouteConfigUpdate{
+			"removed-route":   {},
+			"unchanged-route": {},
+			"modified-route":  {VirtualHosts: []*client.VirtualHost{{Domains: []string{"a.example.com"}}}},
+		},
+		CDSCache: map[string]client.ClusterUpdate{
+			"removed-cluster":   {ServiceName: "eds-1"},
+			"unchanged-cluster": {ServiceName: "eds-1"},
+			"modified-cluster":  {ServiceName: "eds-1"},
+		},
+		EDSCache: map[string]client.EndpointsUpdate{
+			"removed-eds":   {},
+			"unchanged-eds": {},
+			"modified-eds":  {Localities: []client.Locality{{ID: pkg.LocalityID{Region: "r1"}, Weight: 1}}},
+		},
+	}
+	new := &UpdateCache{
+		LDSCache: map[string]client.ListenerUpdate{
+			"unchanged-listener": {RouteConfigName: "route-1"},
+			"modified-listener":  {RouteConfigName: "route-2"},
+			"added-listener":     {RouteConfigName: "route-1"},
+		},
+		RDSCache: map[string]client.RouteConfigUpdate{
+			"unchanged-route": {},
+			"modified-route":  {VirtualHosts: []*client.VirtualHost{{Domains: []string{"b.example.com"}}}},
+			"added-route":     {},
+		},
+		CDSCache: map[string]client.ClusterUpdate{
+			"unchanged-cluster": {ServiceName: "eds-1"},
+			"modified-cluster":  {ServiceName: "eds-2"},
+			"added-cluster":     {ServiceName: "eds-1"},
+		},
+		EDSCache: map[string]client.EndpointsUpdate{
+			"unchanged-eds": {},
+			"modified-eds":  {Localities: []client.Locality{{ID: pkg.LocalityID{Region: "r1"}, Weight: 2}}},
+			"added-eds":     {},
+		},
+	}
+
+	got := DiffCache(old, new)
+	want := CacheDiff{
+		LDS: ResourceDiff{Added: []string{"added-listener"}, Removed: []string{"removed-listener"}, Modified: []string{"modified-listener"}},
+		RDS: ResourceDiff{Added: []string{"added-route"}, Removed: []string{"removed-route"}, Modified: []string{"modified-route"}},
+		CDS: ResourceDiff{Added: []string{"added-cluster"}, Removed: []string{"removed-cluster"}, Modified: []string{"modified-cluster"}},
+		EDS: ResourceDiff{Added: []string{"added-eds"}, Removed: []string{"removed-eds"}, Modified: []string{"modified-eds"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("DiffCache() returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestDiffCacheNilCache(t *testing.T) {
+	new := &UpdateCache{
+		LDSCache: map[string]client.ListenerUpdate{"listener": {}},
+	}
+	got := DiffCache(nil, new)
+	want := CacheDiff{LDS: ResourceDiff{Added: []string{"listener"}}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("DiffCache(nil, new) returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+// TestFindConcurrentWithMutation races Find* (and the other mu.RLock'd
+// readers) against a writer mutating the cache's exported maps directly, the
+// way a caller holding u.mu for writing is expected to refresh a single
+// resource in place. Run with -race: without mu, this is a concurrent
+// map read/write.
+func TestFindConcurrentWithMutation(t *testing.T) {
+	u := &UpdateCache{
+		LDSCache: map[string]client.ListenerUpdate{"listener": {}},
+		RDSCache: map[string]client.RouteConfigUpdate{"route": {}},
+		CDSCache: map[string]client.ClusterUpdate{"cluster": {}},
+		EDSCache: map[string]client.EndpointsUpdate{"endpoints": {}},
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		i := 0
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			u.mu.Lock()
+			u.LDSCache[fmt.Sprintf("listener-%d", i)] = client.ListenerUpdate{}
+			u.RDSCache["route"] = client.RouteConfigUpdate{}
+			u.mu.Unlock()
+			i++
+		}
+	}()
+
+	for i := 0; i < 1000; i++ {
+		u.FindListenerByName("listener")
+		u.FindRouteByName("route")
+		u.FindClusterByName("cluster")
+		u.FindEndpointsByName("endpoints")
+		u.StaleResources(time.Hour)
+		u.ForEach(func(client.ResourceType, string, interface{}) {})
+		u.Validate()
+	}
+
+	close(stop)
+	wg.Wait()
+}
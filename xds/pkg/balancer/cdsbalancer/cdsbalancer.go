@@ -340,8 +340,10 @@ func (b *cdsBalancer) handleWatchUpdate(update *watchUpdate) {
 		b.logger.Infof("Created child policy %p of type %s", b.edsLB, edsName)
 	}
 	lbCfg := &edsbalancer.EDSConfig{
-		EDSServiceName:        update.cds.ServiceName,
-		MaxConcurrentRequests: update.cds.MaxRequests,
+		EDSServiceName:           update.cds.ServiceName,
+		MaxConcurrentRequests:    update.cds.MaxRequests,
+		EnableHealthCheck:        update.cds.EnableHealthCheck,
+		EnableLocalityWeightedLB: update.cds.EnableLocalityWeightedLB,
 	}
 	if update.cds.EnableLRS {
 		// An empty string here indicates that the edsBalancer should use the
@@ -107,7 +107,7 @@ type clusterImplBalancer struct {
 	// is the only goroutine that sends picker to the parent ClientConn. All
 	// requests to update picker need to be sent to pickerUpdateCh.
 	childState      balancer.State
-	drops           []*dropper
+	drops           []dropEntry
 	requestCounter  *xdsclient.ServiceRequestsCounter
 	requestCountMax uint32
 	pickerUpdateCh  *buffer.Unbounded
@@ -193,9 +193,15 @@ func (cib *clusterImplBalancer) UpdateClientConnState(s balancer.ClientConnState
 	// Compare new drop config. And update picker if it's changed.
 	var updatePicker bool
 	if cib.config == nil || !equalDropCategories(cib.config.DropCategories, newConfig.DropCategories) {
-		cib.drops = make([]*dropper, 0, len(newConfig.DropCategories))
+		cib.drops = make([]dropEntry, 0, len(newConfig.DropCategories))
 		for _, c := range newConfig.DropCategories {
-			cib.drops = append(cib.drops, newDropper(c))
+			var decider DropDecider
+			if c.AdaptiveThrottling {
+				decider = newAdaptiveThrottlingDropDecider(c.ThrottlingRatio)
+			} else {
+				decider = newDropper(c)
+			}
+			cib.drops = append(cib.drops, dropEntry{category: c.Category, decider: decider})
 		}
 		updatePicker = true
 	}
@@ -291,7 +297,7 @@ func (cib *clusterImplBalancer) UpdateState(state balancer.State) {
 }
 
 type dropConfigs struct {
-	drops           []*dropper
+	drops           []dropEntry
 	requestCounter  *xdsclient.ServiceRequestsCounter
 	requestCountMax uint32
 }
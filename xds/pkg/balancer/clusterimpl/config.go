@@ -28,6 +28,16 @@ import (
 type dropCategory struct {
 	Category           string
 	RequestsPerMillion uint32
+
+	// AdaptiveThrottling, if set, drops requests in this category using the
+	// adaptive client-side throttling DropDecider instead of the default
+	// WRR-based one, ignoring RequestsPerMillion.
+	AdaptiveThrottling bool
+	// ThrottlingRatio is the K factor in the adaptive throttling formula
+	// (requests - K*accepts)/(requests+1); see newAdaptiveThrottlingDropDecider.
+	// Ignored unless AdaptiveThrottling is set. Defaults to
+	// defaultThrottlingRatio if zero.
+	ThrottlingRatio float64
 }
 
 // lbConfig is the balancer config for weighted_target.
@@ -19,22 +19,47 @@
 package clusterimpl
 
 import (
+	"context"
+	"sync"
+
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/internal/grpcrand"
 	"google.golang.org/grpc/internal/wrr"
 	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/xds/pkg/client"
 	"google.golang.org/grpc/xds/pkg/client/load"
 )
 
-var newRandomWRR = wrr.NewRandom
+var (
+	newRandomWRR             = wrr.NewRandom
+	adaptiveThrottlingRandom = grpcrand.Float64
+)
 
 const million = 1000000
 
+// defaultThrottlingRatio is the K factor used by newAdaptiveThrottlingDropDecider
+// when a dropCategory doesn't specify one.
+const defaultThrottlingRatio = 2.0
+
+// DropDecider decides whether an RPC falling under category should be
+// dropped. On every READY pick, the configured drop categories' deciders are
+// called in order until one of them returns true; the deciders after that
+// one are not called for that pick. The WRR-based dropper below is the default implementation, built
+// from the EDS policy's drop_overloads; callers with custom drop logic
+// (e.g. adaptive throttling based on a downstream's reported error rate,
+// à la https://grpc.io/docs/guides/retry/#throttling-policy) can implement
+// this interface instead and have it reported under the same category.
+type DropDecider interface {
+	Drop(category string) bool
+}
+
+// dropper is the default, WRR-based DropDecider: it drops a fixed fraction
+// of requests, as configured by EDS policy drop_overloads, irrespective of
+// the category passed to Drop (it was built for exactly one category).
 type dropper struct {
-	category string
-	w        wrr.WRR
+	w wrr.WRR
 }
 
 // greatest common divisor (GCD) via Euclidean algorithm
@@ -54,23 +79,85 @@ func newDropper(c dropCategory) *dropper {
 	w.Add(true, int64(c.RequestsPerMillion/gcdv))
 	w.Add(false, int64((million-c.RequestsPerMillion)/gcdv))
 
-	return &dropper{
-		category: c.Category,
-		w:        w,
-	}
+	return &dropper{w: w}
 }
 
-func (d *dropper) drop() (ret bool) {
+func (d *dropper) Drop(category string) bool {
 	return d.w.Next().(bool)
 }
 
+// dropEntry pairs a DropDecider with the category it was registered for, so
+// dropPicker can report a drop under the right category without requiring
+// DropDecider itself to expose one.
+type dropEntry struct {
+	category string
+	decider  DropDecider
+}
+
+// ResultRecorder is an optional interface a DropDecider may implement to
+// observe the outcome of RPCs that it let through (i.e. that it didn't
+// drop). When a DropDecider implements ResultRecorder, dropPicker invokes
+// RecordResult from the pick's Done callback, reporting the same category
+// the decider was registered under and the RPC's final error (nil on
+// success). adaptiveThrottlingDropDecider uses this to track the recent
+// request/accept counts its drop probability is computed from.
+type ResultRecorder interface {
+	RecordResult(category string, err error)
+}
+
+// adaptiveThrottlingDropDecider is a DropDecider that implements the
+// client-side throttling formula from gRFC A6
+// (https://github.com/grpc/proposal/blob/master/A6-client-retries.md#throttling-policy):
+// it drops with probability (requests - ratio*accepts)/(requests+1), where
+// requests and accepts are cumulative counts of completed (non-dropped)
+// RPCs fed back in via RecordResult. As a backend's failure rate climbs,
+// the probability rises and sheds a proportional share of traffic at the
+// client; as successes return, accepts catches up and the probability
+// falls back toward zero.
+type adaptiveThrottlingDropDecider struct {
+	ratio float64
+
+	mu       sync.Mutex
+	requests float64
+	accepts  float64
+}
+
+// newAdaptiveThrottlingDropDecider creates an adaptiveThrottlingDropDecider
+// with the given ratio (the K factor above). A ratio <= 0 is replaced with
+// defaultThrottlingRatio.
+func newAdaptiveThrottlingDropDecider(ratio float64) *adaptiveThrottlingDropDecider {
+	if ratio <= 0 {
+		ratio = defaultThrottlingRatio
+	}
+	return &adaptiveThrottlingDropDecider{ratio: ratio}
+}
+
+func (d *adaptiveThrottlingDropDecider) Drop(category string) bool {
+	d.mu.Lock()
+	p := (d.requests - d.ratio*d.accepts) / (d.requests + 1)
+	d.mu.Unlock()
+	if p <= 0 {
+		return false
+	}
+	return adaptiveThrottlingRandom() < p
+}
+
+func (d *adaptiveThrottlingDropDecider) RecordResult(category string, err error) {
+	d.mu.Lock()
+	d.requests++
+	if err == nil {
+		d.accepts++
+	}
+	d.mu.Unlock()
+}
+
 // loadReporter wraps the methods from the loadStore that are used here.
 type loadReporter interface {
-	CallDropped(locality string)
+	CallDropped(ctx context.Context, method, category string)
 }
 
 type dropPicker struct {
-	drops     []*dropper
+	drops     []dropEntry
 	s         balancer.State
 	loadStore loadReporter
 	counter   *client.ServiceRequestsCounter
@@ -94,10 +181,10 @@ func (d *dropPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
 		return d.s.Picker.Pick(info)
 	}
 
-	for _, dp := range d.drops {
-		if dp.drop() {
+	for _, de := range d.drops {
+		if de.decider.Drop(de.category) {
 			if d.loadStore != nil {
-				d.loadStore.CallDropped(dp.category)
+				d.loadStore.CallDropped(info.Ctx, info.FullMethodName, de.category)
 			}
 			return balancer.PickResult{}, status.Errorf(codes.Unavailable, "RPC is dropped")
 		}
@@ -108,24 +195,33 @@ func (d *dropPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
 			// Drops by circuit breaking are reported with empty category. They
 			// will be reported only in total drops, but not in per category.
 			if d.loadStore != nil {
-				d.loadStore.CallDropped("")
+				d.loadStore.CallDropped(info.Ctx, info.FullMethodName, "")
 			}
 			return balancer.PickResult{}, status.Errorf(codes.Unavailable, err.Error())
 		}
-		pr, err := d.s.Picker.Pick(info)
-		if err != nil {
+	}
+
+	pr, err := d.s.Picker.Pick(info)
+	if err != nil {
+		if d.counter != nil {
 			d.counter.EndRequest()
-			return pr, err
 		}
-		oldDone := pr.Done
-		pr.Done = func(doneInfo balancer.DoneInfo) {
+		return pr, err
+	}
+
+	oldDone := pr.Done
+	pr.Done = func(doneInfo balancer.DoneInfo) {
+		if d.counter != nil {
 			d.counter.EndRequest()
-			if oldDone != nil {
-				oldDone(doneInfo)
+		}
+		for _, de := range d.drops {
+			if tr, ok := de.decider.(ResultRecorder); ok {
+				tr.RecordResult(de.category, doneInfo.Err)
 			}
 		}
-		return pr, err
+		if oldDone != nil {
+			oldDone(doneInfo)
+		}
 	}
-
-	return d.s.Picker.Pick(info)
+	return pr, err
 }
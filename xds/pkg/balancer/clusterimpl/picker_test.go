@@ -0,0 +1,162 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package clusterimpl
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/xds/pkg/testutils"
+)
+
+// fixedPicker always returns the same SubConn, with no error.
+type fixedPicker struct {
+	sc balancer.SubConn
+}
+
+func (p fixedPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	return balancer.PickResult{SubConn: p.sc}, nil
+}
+
+// alwaysDropDecider is a DropDecider that drops every RPC, regardless of
+// category.
+type alwaysDropDecider struct{}
+
+func (alwaysDropDecider) Drop(category string) bool { return true }
+
+// adaptiveThrottlingDecider is a DropDecider modeled on gRPC's client-side
+// adaptive throttling: it tracks accepts and drops per category, drops every
+// request for a category while that category's drops don't exceed its
+// accepts, and once they do, lets every other request through, so traffic
+// is backed off without being cut entirely.
+type adaptiveThrottlingDecider struct {
+	mu       sync.Mutex
+	accepts  map[string]int
+	drops    map[string]int
+	nextDrop map[string]bool // deterministic stand-in for a random threshold check
+}
+
+func newAdaptiveThrottlingDecider() *adaptiveThrottlingDecider {
+	return &adaptiveThrottlingDecider{
+		accepts:  make(map[string]int),
+		drops:    make(map[string]int),
+		nextDrop: make(map[string]bool),
+	}
+}
+
+func (d *adaptiveThrottlingDecider) Drop(category string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Once a category has accumulated more drops than accepts, start
+	// dropping every other request for it rather than every request, to
+	// simulate throttling that backs off without cutting traffic entirely.
+	if d.drops[category] > d.accepts[category] && !d.nextDrop[category] {
+		d.nextDrop[category] = true
+		return false
+	}
+	d.nextDrop[category] = false
+	d.drops[category]++
+	return true
+}
+
+func (d *adaptiveThrottlingDecider) recordAccept(category string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.accepts[category]++
+}
+
+// TestAdaptiveThrottlingDropDecider verifies that the drop probability rises
+// as RecordResult sees a run of failures, then falls back as successes
+// return, per the (requests - ratio*accepts)/(requests+1) formula.
+func TestAdaptiveThrottlingDropDecider(t *testing.T) {
+	oldRandom := adaptiveThrottlingRandom
+	defer func() { adaptiveThrottlingRandom = oldRandom }()
+	adaptiveThrottlingRandom = func() float64 { return 0 }
+
+	d := newAdaptiveThrottlingDropDecider(2)
+	const category = "overload"
+
+	if d.Drop(category) {
+		t.Error("Drop() = true with no history, want false")
+	}
+
+	failure := errors.New("backend unavailable")
+	for i := 0; i < 20; i++ {
+		d.RecordResult(category, failure)
+	}
+	if !d.Drop(category) {
+		t.Error("Drop() = false after a run of failures, want true")
+	}
+
+	for i := 0; i < 40; i++ {
+		d.RecordResult(category, nil)
+	}
+	if d.Drop(category) {
+		t.Error("Drop() = true after successes caught up with failures, want false")
+	}
+}
+
+func TestDropPicker_CustomDropDecider(t *testing.T) {
+	sc := testutils.TestSubConns[0]
+	readyState := balancer.State{ConnectivityState: connectivity.Ready, Picker: fixedPicker{sc: sc}}
+
+	t.Run("always-drop decider drops every pick", func(t *testing.T) {
+		p := newDropPicker(readyState, &dropConfigs{
+			drops: []dropEntry{{category: "custom-always-drop", decider: alwaysDropDecider{}}},
+		}, nil)
+
+		for i := 0; i < 3; i++ {
+			_, err := p.Pick(balancer.PickInfo{})
+			if err == nil || !strings.Contains(err.Error(), "dropped") {
+				t.Fatalf("Pick() = _, %v; want an RPC-is-dropped error", err)
+			}
+		}
+	})
+
+	t.Run("adaptive throttling decider backs off once drops exceed accepts", func(t *testing.T) {
+		const category = "custom-adaptive"
+		decider := newAdaptiveThrottlingDecider()
+		p := newDropPicker(readyState, &dropConfigs{
+			drops: []dropEntry{{category: category, decider: decider}},
+		}, nil)
+
+		// First pick: no history yet, so the decider drops (establishing
+		// drops > accepts), then immediately allows the next one through.
+		if _, err := p.Pick(balancer.PickInfo{}); err == nil || !strings.Contains(err.Error(), "dropped") {
+			t.Fatalf("Pick() #1 = _, %v; want an RPC-is-dropped error", err)
+		}
+		res, err := p.Pick(balancer.PickInfo{})
+		if err != nil {
+			t.Fatalf("Pick() #2 = _, %v; want no error (decider should have backed off)", err)
+		}
+		if res.SubConn != sc {
+			t.Errorf("Pick() #2 SubConn = %v, want %v", res.SubConn, sc)
+		}
+		decider.recordAccept(category)
+
+		// Accepts now equal drops (1-1), so the decider resumes dropping.
+		if _, err := p.Pick(balancer.PickInfo{}); err == nil || !strings.Contains(err.Error(), "dropped") {
+			t.Fatalf("Pick() #3 = _, %v; want an RPC-is-dropped error", err)
+		}
+	})
+}
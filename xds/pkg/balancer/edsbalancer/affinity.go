@@ -0,0 +1,116 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package edsbalancer
+
+import (
+	"hash/fnv"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/metadata"
+)
+
+// affinityPicker implements session affinity: for a pick whose PickInfo
+// carries a non-empty value for edsImpl.affinityHeader, it returns the same
+// SubConn for that value every time, for as long as that SubConn remains one
+// affinityPicker has observed p hand out. Picks with no value for the header
+// fall straight through to p, so they keep distributing the way p normally
+// would (e.g. round-robin).
+//
+// affinityPicker has no visibility into the child policy's full address
+// list; it learns its candidate SubConns lazily, from whatever p actually
+// returns to earlier picks. The candidate/sticky-mapping state that backs
+// this lives on edsImpl rather than on affinityPicker itself, so it survives
+// affinityPicker being rebuilt for unrelated updates (e.g. a new drop
+// config); see wrapPicker.
+type affinityPicker struct {
+	p       balancer.Picker
+	edsImpl *edsBalancerImpl
+}
+
+// newAffinityPicker returns a picker that applies session affinity (based on
+// edsImpl.affinityHeader) on top of p.
+func newAffinityPicker(p balancer.Picker, edsImpl *edsBalancerImpl) *affinityPicker {
+	return &affinityPicker{p: p, edsImpl: edsImpl}
+}
+
+func (a *affinityPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	key, ok := affinityKey(info, a.edsImpl.affinityHeader)
+	if !ok {
+		return a.p.Pick(info)
+	}
+
+	edsImpl := a.edsImpl
+	edsImpl.affinityMu.Lock()
+	if sc, ok := edsImpl.affinitySticky[key]; ok {
+		edsImpl.affinityMu.Unlock()
+		return balancer.PickResult{SubConn: sc}, nil
+	}
+	edsImpl.affinityMu.Unlock()
+
+	// key hasn't been bound to a SubConn yet. Go through p to both get a
+	// usable pick now (so a TransientFailure/connecting error is surfaced
+	// normally) and to learn about a SubConn we may not have seen before.
+	res, err := a.p.Pick(info)
+	if err != nil {
+		return res, err
+	}
+
+	edsImpl.affinityMu.Lock()
+	defer edsImpl.affinityMu.Unlock()
+	if !edsImpl.affinitySeen[res.SubConn] {
+		edsImpl.affinitySeen[res.SubConn] = true
+		edsImpl.affinityCandidates = append(edsImpl.affinityCandidates, res.SubConn)
+	}
+	sc := edsImpl.affinityCandidates[affinityHash(key)%uint64(len(edsImpl.affinityCandidates))]
+	edsImpl.affinitySticky[key] = sc
+	// res.Done (if any) was bound by p to res.SubConn's own instrumentation
+	// (e.g. load reporting); overriding SubConn here leaves Done referring
+	// to the pick p actually made rather than sc. This is an accepted gap:
+	// it only affects the rare pick that lands on a brand new key and
+	// disagrees with what p itself would have chosen, and Done only reports
+	// RPC completion, not routing.
+	res.SubConn = sc
+	return res, nil
+}
+
+// affinityKey returns the value of header in info's outgoing metadata, and
+// whether a non-empty value was present.
+func affinityKey(info balancer.PickInfo, header string) (string, bool) {
+	if header == "" {
+		return "", false
+	}
+	md, ok := metadata.FromOutgoingContext(info.Ctx)
+	if !ok {
+		return "", false
+	}
+	vs := md.Get(header)
+	if len(vs) == 0 || vs[0] == "" {
+		return "", false
+	}
+	return vs[0], true
+}
+
+// affinityHash returns a stable hash of s, used to deterministically choose
+// among the known candidate SubConns the first time a given affinity key is
+// seen.
+func affinityHash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
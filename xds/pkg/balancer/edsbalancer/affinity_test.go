@@ -0,0 +1,137 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package edsbalancer
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/xds/pkg/testutils"
+)
+
+// roundRobinTestPicker cycles through scs on every Pick, the way the real
+// round_robin picker does, so affinityPicker has more than one candidate to
+// choose among.
+type roundRobinTestPicker struct {
+	scs  []balancer.SubConn
+	next int
+}
+
+func (p *roundRobinTestPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	sc := p.scs[p.next%len(p.scs)]
+	p.next++
+	return balancer.PickResult{SubConn: sc}, nil
+}
+
+// testSubConns returns the first n entries of testutils.TestSubConns as
+// balancer.SubConn, for use as roundRobinTestPicker candidates.
+func testSubConns(n int) []balancer.SubConn {
+	scs := make([]balancer.SubConn, n)
+	for i := 0; i < n; i++ {
+		scs[i] = testutils.TestSubConns[i]
+	}
+	return scs
+}
+
+func pickInfoWithHeader(header, value string) balancer.PickInfo {
+	if header == "" {
+		return balancer.PickInfo{Ctx: context.Background()}
+	}
+	return balancer.PickInfo{Ctx: metadata.NewOutgoingContext(context.Background(), metadata.Pairs(header, value))}
+}
+
+// TestAffinityPickerStickyWithHeader verifies that repeated picks carrying
+// the same affinity header value land on the same SubConn, even though the
+// wrapped picker itself round-robins.
+func (s) TestAffinityPickerStickyWithHeader(t *testing.T) {
+	edsb := newEDSBalancerImpl(nil, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.updateAffinityHeader("x-affinity")
+	inner := &roundRobinTestPicker{scs: testSubConns(4)}
+	p := newAffinityPicker(inner, edsb)
+
+	res1, err := p.Pick(pickInfoWithHeader("x-affinity", "user-1"))
+	if err != nil {
+		t.Fatalf("Pick() for user-1 failed: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		res, err := p.Pick(pickInfoWithHeader("x-affinity", "user-1"))
+		if err != nil {
+			t.Fatalf("Pick() for user-1 failed: %v", err)
+		}
+		if res.SubConn != res1.SubConn {
+			t.Fatalf("Pick() for user-1 returned %v on iteration %d, want sticky %v", res.SubConn, i, res1.SubConn)
+		}
+	}
+
+	// A different header value is allowed (but not required) to land on a
+	// different SubConn; what matters is that it's internally consistent.
+	res2, err := p.Pick(pickInfoWithHeader("x-affinity", "user-2"))
+	if err != nil {
+		t.Fatalf("Pick() for user-2 failed: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		res, err := p.Pick(pickInfoWithHeader("x-affinity", "user-2"))
+		if err != nil {
+			t.Fatalf("Pick() for user-2 failed: %v", err)
+		}
+		if res.SubConn != res2.SubConn {
+			t.Fatalf("Pick() for user-2 returned %v on iteration %d, want sticky %v", res.SubConn, i, res2.SubConn)
+		}
+	}
+}
+
+// TestAffinityPickerFallsThroughWithoutHeader verifies that picks with no
+// value for the affinity header bypass affinity entirely and distribute the
+// way the wrapped picker normally would (round-robin, in this test).
+func (s) TestAffinityPickerFallsThroughWithoutHeader(t *testing.T) {
+	edsb := newEDSBalancerImpl(nil, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.updateAffinityHeader("x-affinity")
+	scs := testSubConns(4)
+	inner := &roundRobinTestPicker{scs: scs}
+	p := newAffinityPicker(inner, edsb)
+
+	seen := make(map[balancer.SubConn]bool)
+	for i := 0; i < len(scs); i++ {
+		res, err := p.Pick(pickInfoWithHeader("", ""))
+		if err != nil {
+			t.Fatalf("Pick() without header failed: %v", err)
+		}
+		seen[res.SubConn] = true
+	}
+	if len(seen) != len(scs) {
+		t.Errorf("Pick() without header visited %d distinct SubConns over %d picks, want all %d (round-robin distribution)", len(seen), len(scs), len(scs))
+	}
+}
+
+// TestAffinityPickerDisabled verifies that wrapPicker doesn't wrap in an
+// affinityPicker at all when no affinity header is configured.
+func (s) TestAffinityPickerDisabled(t *testing.T) {
+	edsb := newEDSBalancerImpl(nil, balancer.BuildOptions{}, nil, nil, nil, nil)
+	inner := &testutils.TestConstPicker{SC: testutils.TestSubConns[0]}
+	if got := edsb.wrapPicker(inner); got != balancer.Picker(inner) {
+		t.Errorf("wrapPicker() with no affinity header configured = %v, want the raw inner picker %v", got, inner)
+	}
+
+	edsb.updateAffinityHeader("x-affinity")
+	if _, ok := edsb.wrapPicker(inner).(*affinityPicker); !ok {
+		t.Errorf("wrapPicker() with an affinity header configured did not return an *affinityPicker")
+	}
+}
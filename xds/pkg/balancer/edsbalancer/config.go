@@ -20,8 +20,10 @@ package edsbalancer
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/serviceconfig"
 )
 
@@ -32,6 +34,14 @@ type EDSConfig struct {
 	// ChildPolicy represents the load balancing config for the child
 	// policy.
 	ChildPolicy *loadBalancingConfig
+	// ChildPolicyByPriority, if non-empty, overrides ChildPolicy for
+	// specific EDS priorities (0 is the highest priority). A priority
+	// absent from this map uses ChildPolicy (or round_robin, if that's
+	// unset too). Keyed by the EDS priority number, after the balancer's
+	// own compaction of sparse priorities into a contiguous 0-based range
+	// (see parseEDSRespProto); this matches the wire priority for the
+	// common case of already-contiguous priorities.
+	ChildPolicyByPriority map[uint32]*loadBalancingConfig
 	// FallBackPolicy represents the load balancing config for the
 	// fallback.
 	FallBackPolicy *loadBalancingConfig
@@ -47,21 +57,166 @@ type EDSConfig struct {
 	// should be fine to add this extra field here, because EDS is only used in
 	// CDS today, so we have full control.
 	MaxConcurrentRequests *uint32
+	// MaxGlobalConcurrentRequests is the max number of concurrent requests
+	// allowed across every xDS-managed cluster in the process, in addition
+	// to each cluster's own MaxConcurrentRequests. Unlike
+	// MaxConcurrentRequests, there's a single counter shared by all
+	// clusters, so this protects a resource pool common to more than one
+	// service rather than any one service's own backends. If unset or
+	// zero, no global limit is enforced.
+	MaxGlobalConcurrentRequests *uint32
+	// MaxConnections is the max number of active connections (SubConns)
+	// allowed for this service. If unset, default value 1024 is used.
+	//
+	// As with MaxConcurrentRequests, this isn't defined in the service
+	// config proto; it's added here for the same reason.
+	MaxConnections *uint32
 	// LRS server to send load reports to.  If not present, load reporting
 	// will be disabled.  If set to the empty string, load reporting will
 	// be sent to the same server that we obtained CDS data from.
 	LrsLoadReportingServerName *string
+	// LocalityPickingPolicy selects the WRR algorithm used to pick across
+	// localities within a priority. Supported values are "random" (the
+	// default) and "deterministic" (EDF scheduling, for a smoother
+	// distribution over short windows). Unrecognized values fall back to
+	// "random".
+	LocalityPickingPolicy string
+	// EnableHealthCheck indicates whether SubConns for this cluster's
+	// endpoints should use gRPC client-side health checking, as configured
+	// by a grpc_health_check entry in the CDS cluster's health_checks field.
+	EnableHealthCheck bool
+	// QueueOnCircuitBreaking indicates whether a pick that would otherwise
+	// be rejected because the cluster's max concurrent requests has been
+	// reached should instead wait (bounded by the RPC's own context
+	// deadline) for a slot to free up.
+	QueueOnCircuitBreaking bool
+	// EnableLocalityWeightedLB indicates whether locality weighted load
+	// balancing, as configured by the CDS cluster's common_lb_config, is
+	// enabled. When false, EDS localities with a weight of 0 are treated as
+	// equally weighted instead of being excluded.
+	EnableLocalityWeightedLB bool
+	// EnablePriorityFailoverBackoff indicates whether a flapping priority
+	// (one that keeps reporting TransientFailure rather than getting stuck)
+	// should be given a bounded, exponentially extended grace window before
+	// failing over to the next priority, instead of failing over
+	// immediately on the first TransientFailure.
+	EnablePriorityFailoverBackoff bool
+	// ReResolutionInterval is how long, in seconds, the balancer waits after
+	// its lowest priority fails with nowhere lower to fail over to before
+	// asking the parent resolver for fresh addresses. If unset or zero,
+	// re-resolution on sustained failure is disabled.
+	ReResolutionInterval *uint32
+	// AffinityHeader, if non-empty, is the metadata header used for session
+	// affinity: picks whose outgoing metadata carries a value for this
+	// header consistently land on the same SubConn, instead of going
+	// through the child policy's normal picker. Picks with no value for the
+	// header are unaffected. If unset, affinity is disabled.
+	AffinityHeader string
+	// FaultInjection configures Envoy-style client-side fault injection
+	// (delay and/or abort), enforced by the balancer's picker against every
+	// pick made through this balancer. Nil disables fault injection.
+	FaultInjection *FaultInjectionConfig
+	// SubConnBatchSize caps how many of a single locality's addresses are
+	// applied at a time. A locality address update longer than it is not
+	// applied by handleEDSResponsePerPriority at all, but deferred in full to
+	// edsBalancer's run loop, which applies it one batch at a time.
+	// This keeps a locality with thousands of endpoints from blocking the
+	// run loop (and therefore every other priority's update) until all of
+	// its SubConns exist. Zero, the default, disables batching: the full
+	// address list is always applied at once, as before.
+	SubConnBatchSize uint32
+	// WarmUp, if true, holds back forwarding a picker update to the
+	// parent ClientConn until the first priority reaches Ready or
+	// defaultWarmUpTimeout elapses, whichever happens first. This avoids
+	// a brief window, right after the balancer starts, where a picker
+	// reporting Connecting (or a flapping TransientFailure) is forwarded
+	// and then immediately replaced by the Ready one: RPCs made during
+	// that window queue against the ClientConn's own default picker
+	// instead of racing the child policy's early, short-lived states.
+	WarmUp bool
+	// MinHealthyPercentage, if nonzero, is the minimum percentage (0-100) of
+	// priorityInUse's weighted localities that must be Ready for it to keep
+	// being used. If its weighted healthy fraction (computed the same way as
+	// localityWeightStateSnapshot) drops below this threshold, the eds impl
+	// fails over to the next lower priority even though priorityInUse is
+	// still technically Ready, mirroring Envoy's panic threshold: a priority
+	// with only a sliver of its localities healthy is usually overloaded
+	// rather than actually serving well. Zero disables the check, so
+	// priorityInUse is only abandoned once it's fully TransientFailure, as
+	// before.
+	MinHealthyPercentage uint32
+	// PanicThreshold, if nonzero, is the minimum percentage (0-100) of a
+	// priority's endpoints that must be EDS-healthy (see
+	// handleEDSResponsePerPriority) before that priority's unhealthy
+	// endpoints are excluded from its addresses as usual. If the healthy
+	// fraction drops below this threshold, the eds impl enters Envoy-style
+	// "panic mode" for that priority: every endpoint, healthy or not, is
+	// kept, on the theory that routing to an overloaded-but-reachable
+	// endpoint beats concentrating all traffic onto a sliver of survivors
+	// (or, if none at all are healthy, failing every RPC outright). Zero
+	// disables panic mode, so unhealthy endpoints are always excluded, as
+	// before. Unrelated to MinHealthyPercentage, which fails a priority
+	// over to the next lower one instead of widening its own pick set.
+	PanicThreshold uint32
+}
+
+// FaultInjectionConfig holds one cluster's Envoy-style fault injection
+// settings, as enforced by faultInjectionPicker.
+type FaultInjectionConfig struct {
+	// DelayPercentage is the probability, in [0, 100], that Delay is
+	// injected before a pick is allowed to proceed. Zero disables delay
+	// injection.
+	DelayPercentage float64
+	// Delay is the fixed delay injected when the delay fault hits.
+	Delay time.Duration
+	// AbortPercentage is the probability, in [0, 100], that a pick is
+	// aborted with AbortCode instead of being allowed to proceed. Zero
+	// disables abort injection.
+	AbortPercentage float64
+	// AbortCode is the status code returned for an aborted pick.
+	AbortCode codes.Code
+	// MaxActiveFaults caps the number of delay and abort faults allowed to
+	// be in flight at once, across every pick made through this balancer.
+	// Picks beyond the cap are passed through unfaulted, the same as if no
+	// fault had been selected for them. Zero means unbounded.
+	MaxActiveFaults uint32
 }
 
 // edsConfigJSON is the intermediate unmarshal result of EDSConfig. ChildPolicy
 // and Fallbackspolicy are post-processed, and for each, the first installed
 // policy is kept.
 type edsConfigJSON struct {
-	ChildPolicy                []*loadBalancingConfig
-	FallbackPolicy             []*loadBalancingConfig
-	EDSServiceName             string
-	MaxConcurrentRequests      *uint32
-	LRSLoadReportingServerName *string
+	ChildPolicy                   []*loadBalancingConfig
+	ChildPolicyByPriority         map[uint32][]*loadBalancingConfig
+	FallbackPolicy                []*loadBalancingConfig
+	EDSServiceName                string
+	MaxConcurrentRequests         *uint32
+	MaxGlobalConcurrentRequests   *uint32
+	MaxConnections                *uint32
+	LRSLoadReportingServerName    *string
+	LocalityPickingPolicy         string
+	EnableHealthCheck             bool
+	QueueOnCircuitBreaking        bool
+	EnableLocalityWeightedLB      bool
+	EnablePriorityFailoverBackoff bool
+	ReResolutionInterval          *uint32
+	AffinityHeader                string
+	FaultInjection                *faultInjectionConfigJSON
+	SubConnBatchSize              uint32
+	WarmUp                        bool
+	MinHealthyPercentage          uint32
+	PanicThreshold                uint32
+}
+
+// faultInjectionConfigJSON is the intermediate unmarshal result of
+// FaultInjectionConfig. DelayMillis is split out from Delay because
+// time.Duration has no natural JSON encoding in the service config format.
+type faultInjectionConfigJSON struct {
+	DelayPercentage float64
+	DelayMillis     int64
+	AbortPercentage float64
+	AbortCode       uint32
+	MaxActiveFaults uint32
 }
 
 // UnmarshalJSON parses the JSON-encoded byte slice in data and stores it in l.
@@ -75,7 +230,29 @@ func (l *EDSConfig) UnmarshalJSON(data []byte) error {
 
 	l.EDSServiceName = configJSON.EDSServiceName
 	l.MaxConcurrentRequests = configJSON.MaxConcurrentRequests
+	l.MaxGlobalConcurrentRequests = configJSON.MaxGlobalConcurrentRequests
+	l.MaxConnections = configJSON.MaxConnections
 	l.LrsLoadReportingServerName = configJSON.LRSLoadReportingServerName
+	l.LocalityPickingPolicy = configJSON.LocalityPickingPolicy
+	l.EnableHealthCheck = configJSON.EnableHealthCheck
+	l.QueueOnCircuitBreaking = configJSON.QueueOnCircuitBreaking
+	l.EnableLocalityWeightedLB = configJSON.EnableLocalityWeightedLB
+	l.EnablePriorityFailoverBackoff = configJSON.EnablePriorityFailoverBackoff
+	l.ReResolutionInterval = configJSON.ReResolutionInterval
+	l.AffinityHeader = configJSON.AffinityHeader
+	l.SubConnBatchSize = configJSON.SubConnBatchSize
+	l.WarmUp = configJSON.WarmUp
+	l.MinHealthyPercentage = configJSON.MinHealthyPercentage
+	l.PanicThreshold = configJSON.PanicThreshold
+	if fj := configJSON.FaultInjection; fj != nil {
+		l.FaultInjection = &FaultInjectionConfig{
+			DelayPercentage: fj.DelayPercentage,
+			Delay:           time.Duration(fj.DelayMillis) * time.Millisecond,
+			AbortPercentage: fj.AbortPercentage,
+			AbortCode:       codes.Code(fj.AbortCode),
+			MaxActiveFaults: fj.MaxActiveFaults,
+		}
+	}
 
 	for _, lbcfg := range configJSON.ChildPolicy {
 		if balancer.Get(lbcfg.Name) != nil {
@@ -84,6 +261,18 @@ func (l *EDSConfig) UnmarshalJSON(data []byte) error {
 		}
 	}
 
+	if len(configJSON.ChildPolicyByPriority) > 0 {
+		l.ChildPolicyByPriority = make(map[uint32]*loadBalancingConfig, len(configJSON.ChildPolicyByPriority))
+		for priority, lbcfgs := range configJSON.ChildPolicyByPriority {
+			for _, lbcfg := range lbcfgs {
+				if balancer.Get(lbcfg.Name) != nil {
+					l.ChildPolicyByPriority[priority] = lbcfg
+					break
+				}
+			}
+		}
+	}
+
 	for _, lbcfg := range configJSON.FallbackPolicy {
 		if balancer.Get(lbcfg.Name) != nil {
 			l.FallBackPolicy = lbcfg
@@ -0,0 +1,107 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package edsbalancer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// dnsResolveFunc resolves a DNS-derived locality's current set of addresses.
+// It's called once per re-resolution tick; see dnsReResolver.
+type dnsResolveFunc func() ([]resolver.Address, error)
+
+// dnsReResolver periodically calls resolve and, whenever the addresses it
+// returns differ from the last known set, invokes onUpdate with the new set.
+// A failed resolve attempt (non-nil error) is ignored, without being
+// logged: the last known addresses stay in effect until a later tick
+// succeeds.
+//
+// It uses the same clock abstraction as the priority failover and
+// re-resolution timers (clock.go), so tests can drive it deterministically
+// instead of depending on real sleeps.
+type dnsReResolver struct {
+	resolve  dnsResolveFunc
+	onUpdate func([]resolver.Address)
+	interval time.Duration
+	clock    clock
+
+	mu        sync.Mutex
+	timer     clockTimer
+	lastAddrs []resolver.Address
+	stopped   bool
+}
+
+// newDNSReResolver creates a dnsReResolver and arms its first tick, due
+// after interval.
+func newDNSReResolver(resolve dnsResolveFunc, onUpdate func([]resolver.Address), interval time.Duration, c clock) *dnsReResolver {
+	r := &dnsReResolver{
+		resolve:  resolve,
+		onUpdate: onUpdate,
+		interval: interval,
+		clock:    c,
+	}
+	r.mu.Lock()
+	r.armLocked()
+	r.mu.Unlock()
+	return r
+}
+
+// armLocked schedules the next tick, unless stop has been called.
+//
+// Caller must hold mu.
+func (r *dnsReResolver) armLocked() {
+	if r.stopped {
+		return
+	}
+	r.timer = r.clock.NewTimer(r.interval, r.tick)
+}
+
+func (r *dnsReResolver) tick() {
+	addrs, err := r.resolve()
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return
+	}
+	r.armLocked()
+	changed := err == nil && !cmp.Equal(r.lastAddrs, addrs)
+	if changed {
+		r.lastAddrs = addrs
+	}
+	r.mu.Unlock()
+	if changed {
+		r.onUpdate(addrs)
+	}
+}
+
+// stop prevents any further re-resolution ticks.
+func (r *dnsReResolver) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopped = true
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package edsbalancer
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/xds/pkg"
+	"google.golang.org/grpc/xds/pkg/testutils"
+)
+
+// TestDNSReResolution covers a locality whose endpoints originate from a DNS
+// name instead of EDS: once startDNSReResolution's interval elapses, it
+// should re-resolve the name and, if the addresses changed, push the new
+// set to the locality's child balancer without a new EDS response.
+func (s) TestDNSReResolution(t *testing.T) {
+	const reResolutionInterval = 30 * time.Second
+
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+
+	<-cc.NewSubConnAddrsCh
+	sc0 := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc0, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc0, connectivity.Ready)
+
+	// Fake resolver that starts out returning the address already in use,
+	// then flips to a different one, as a DNS name's answer changing over
+	// time.
+	addrs := []resolver.Address{{Addr: testEndpointAddrs[0]}}
+	resolve := func() ([]resolver.Address, error) {
+		return addrs, nil
+	}
+
+	lid := pkg.LocalityID{SubZone: testSubZones[0]}
+	bgwc := edsb.priorityToLocalities[newPriorityType(0)]
+	clock := &fakeClock{}
+	edsb.clock = clock
+	edsb.startDNSReResolution(bgwc, lid, resolve, reResolutionInterval)
+
+	// No change in the resolved address yet: no new SubConn activity.
+	clock.advance(reResolutionInterval)
+	select {
+	case a := <-cc.NewSubConnAddrsCh:
+		t.Fatalf("Got unexpected NewSubConn for %v before the resolved address changed", a)
+	case <-time.After(defaultTestShortTimeout):
+	}
+
+	// The DNS name now resolves to a different address.
+	addrs = []resolver.Address{{Addr: testEndpointAddrs[1]}}
+	clock.advance(reResolutionInterval)
+
+	select {
+	case got := <-cc.NewSubConnAddrsCh:
+		if got[0].Addr != testEndpointAddrs[1] {
+			t.Fatalf("NewSubConn called with address %v, want %v", got[0].Addr, testEndpointAddrs[1])
+		}
+	case <-time.After(defaultTestTimeout):
+		t.Fatalf("timed out waiting for NewSubConn with the re-resolved address")
+	}
+	select {
+	case <-cc.RemoveSubConnCh:
+	case <-time.After(defaultTestTimeout):
+		t.Fatalf("timed out waiting for the SubConn of the stale address to be removed")
+	}
+}
@@ -39,6 +39,12 @@ import (
 
 const edsName = "eds_experimental"
 
+// localityPickingPolicyDeterministic is the EDSConfig.LocalityPickingPolicy
+// value that selects the deterministic (EDF) WRR scheduler for picking
+// across localities within a priority, instead of the default weighted
+// random algorithm.
+const localityPickingPolicyDeterministic = "deterministic"
+
 // xdsClientInterface contains only the xds_client methods needed by EDS
 // balancer. It's defined so we can override xdsclient.New function in tests.
 type xdsClientInterface interface {
@@ -49,7 +55,7 @@ type xdsClientInterface interface {
 
 var (
 	newEDSBalancer = func(cc balancer.ClientConn, opts balancer.BuildOptions, enqueueState func(priorityType, balancer.State), lw load.PerClusterReporter, logger *grpclog.PrefixLogger) edsBalancerImplInterface {
-		return newEDSBalancerImpl(cc, opts, enqueueState, lw, logger)
+		return newEDSBalancerImpl(cc, opts, enqueueState, lw, logger, nil)
 	}
 	newXDSClient = func() (xdsClientInterface, error) { return xdsclient.New() }
 )
@@ -109,6 +115,12 @@ type edsBalancerImplInterface interface {
 	// handleChildPolicy updates the eds balancer the intra-cluster load
 	// balancing policy to use.
 	handleChildPolicy(name string, config json.RawMessage)
+	// handleChildPolicyByPriority updates, for each priority present in
+	// configs, the intra-cluster load balancing policy used for localities
+	// within that priority, overriding the policy set by handleChildPolicy.
+	// A priority absent from configs falls back to the policy set by
+	// handleChildPolicy.
+	handleChildPolicyByPriority(configs map[uint32]*loadBalancingConfig)
 	// handleSubConnStateChange handles state change for SubConn.
 	handleSubConnStateChange(sc balancer.SubConn, state connectivity.State)
 	// updateState handle a balancer state update from the priority.
@@ -116,6 +128,63 @@ type edsBalancerImplInterface interface {
 	// updateServiceRequestsConfig updates the service requests counter to the
 	// one for the given service name.
 	updateServiceRequestsConfig(serviceName string, max *uint32)
+	// updateGlobalRequestsConfig updates the process-wide request limit
+	// shared across every xDS-managed cluster. A nil or zero max disables
+	// it.
+	updateGlobalRequestsConfig(max *uint32)
+	// updateServiceConnectionsConfig updates the service connections counter
+	// to the one for the given service name, and the max_connections value
+	// enforced against it.
+	updateServiceConnectionsConfig(serviceName string, max *uint32)
+	// updateLocalityPickingPolicy updates the WRR algorithm used to pick
+	// across localities within a priority.
+	updateLocalityPickingPolicy(deterministic bool)
+	// updateHealthCheckConfig updates whether SubConns created for this
+	// cluster's endpoints should have gRPC client-side health checking
+	// enabled.
+	updateHealthCheckConfig(enable bool)
+	// updateCircuitBreakingQueueing updates whether a pick rejected by
+	// circuit breaking should instead queue for a free slot.
+	updateCircuitBreakingQueueing(enable bool)
+	// updateLocalityWeightedLBConfig updates whether locality weighted load
+	// balancing, as configured by CDS, is enabled.
+	updateLocalityWeightedLBConfig(enable bool)
+	// updatePriorityFailoverBackoff updates whether a flapping priority is
+	// given a bounded, extended grace window before failing over.
+	updatePriorityFailoverBackoff(enable bool)
+	// updateReResolutionConfig updates how long the balancer waits, after
+	// its lowest priority fails with nowhere lower to fail over to, before
+	// requesting re-resolution from the parent. A nil or zero
+	// intervalSeconds disables it.
+	updateReResolutionConfig(intervalSeconds *uint32)
+	// updateAffinityHeader updates the metadata header used for session
+	// affinity. An empty header disables affinity.
+	updateAffinityHeader(header string)
+	// updateFaultInjection updates the fault injection settings enforced
+	// against every pick. A nil cfg disables fault injection.
+	updateFaultInjection(cfg *FaultInjectionConfig)
+	// updateSubConnBatchSize updates the batch size used to bound how many
+	// SubConns are created synchronously for one locality's address
+	// update. Zero disables batching.
+	updateSubConnBatchSize(size uint32)
+	// pendingLocalityBatches returns the queue of deferred per-locality
+	// address-update continuations that run must drain via
+	// processLocalityBatch; see updateSubConnBatchSize.
+	pendingLocalityBatches() *buffer.Unbounded
+	// processLocalityBatch applies the next batch of one pending
+	// localityBatchUpdate returned by pendingLocalityBatches.
+	processLocalityBatch(item interface{})
+	// updateWarmUp updates whether picker updates are held back until the
+	// first priority reaches Ready or a timeout elapses. See
+	// EDSConfig.WarmUp.
+	updateWarmUp(enabled bool)
+	// updateMinHealthyPercentage updates the panic threshold for failing a
+	// Ready priority over to the next lower one. See
+	// EDSConfig.MinHealthyPercentage.
+	updateMinHealthyPercentage(pct uint32)
+	// updatePanicThreshold updates the threshold below which a priority's
+	// unhealthy endpoints stop being excluded. See EDSConfig.PanicThreshold.
+	updatePanicThreshold(pct uint32)
 	// close closes the eds balancer.
 	close()
 }
@@ -163,6 +232,9 @@ func (x *edsBalancer) run() {
 			x.childPolicyUpdate.Load()
 			u := update.(*balancerStateWithPriority)
 			x.edsImpl.updateState(u.priority, u.s)
+		case update := <-x.edsImpl.pendingLocalityBatches().Get():
+			x.edsImpl.pendingLocalityBatches().Load()
+			x.edsImpl.processLocalityBatch(update)
 		case <-x.closed.Done():
 			x.cancelWatch()
 			x.xdsClient.Close()
@@ -216,6 +288,20 @@ func (x *edsBalancer) handleGRPCUpdate(update interface{}) {
 		}
 
 		x.edsImpl.updateServiceRequestsConfig(cfg.EDSServiceName, cfg.MaxConcurrentRequests)
+		x.edsImpl.updateGlobalRequestsConfig(cfg.MaxGlobalConcurrentRequests)
+		x.edsImpl.updateServiceConnectionsConfig(cfg.EDSServiceName, cfg.MaxConnections)
+		x.edsImpl.updateLocalityPickingPolicy(cfg.LocalityPickingPolicy == localityPickingPolicyDeterministic)
+		x.edsImpl.updateHealthCheckConfig(cfg.EnableHealthCheck)
+		x.edsImpl.updateCircuitBreakingQueueing(cfg.QueueOnCircuitBreaking)
+		x.edsImpl.updateLocalityWeightedLBConfig(cfg.EnableLocalityWeightedLB)
+		x.edsImpl.updatePriorityFailoverBackoff(cfg.EnablePriorityFailoverBackoff)
+		x.edsImpl.updateReResolutionConfig(cfg.ReResolutionInterval)
+		x.edsImpl.updateAffinityHeader(cfg.AffinityHeader)
+		x.edsImpl.updateFaultInjection(cfg.FaultInjection)
+		x.edsImpl.updateSubConnBatchSize(cfg.SubConnBatchSize)
+		x.edsImpl.updateWarmUp(cfg.WarmUp)
+		x.edsImpl.updateMinHealthyPercentage(cfg.MinHealthyPercentage)
+		x.edsImpl.updatePanicThreshold(cfg.PanicThreshold)
 
 		// We will update the edsImpl with the new child policy, if we got a
 		// different one.
@@ -226,6 +312,9 @@ func (x *edsBalancer) handleGRPCUpdate(update interface{}) {
 				x.edsImpl.handleChildPolicy(roundrobin.Name, nil)
 			}
 		}
+		if !cmp.Equal(cfg.ChildPolicyByPriority, x.config.ChildPolicyByPriority, cmpopts.EquateEmpty()) {
+			x.edsImpl.handleChildPolicyByPriority(cfg.ChildPolicyByPriority)
+		}
 		x.config = cfg
 	case error:
 		x.handleErrorFromUpdate(u, true)
@@ -367,6 +456,14 @@ type balancerStateWithPriority struct {
 }
 
 func (x *edsBalancer) enqueueChildBalancerState(p priorityType, s balancer.State) {
+	// edsImpl.close() doesn't wait for its child balancers to finish closing,
+	// so a child can still call this (via edsBalancerWrapperCC.UpdateState)
+	// after Close() has fired. childPolicyUpdate is never drained once run()
+	// returns, so without this guard a late update would sit in its backlog
+	// forever instead of panicking outright; drop it instead.
+	if x.closed.HasFired() {
+		return
+	}
 	x.childPolicyUpdate.Put(&balancerStateWithPriority{
 		priority: p,
 		s:        s,
@@ -17,12 +17,17 @@
 package edsbalancer
 
 import (
+	"context"
 	"encoding/json"
 	"reflect"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	orcapb "github.com/cncf/udpa/go/udpa/data/orca/v1"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/base"
@@ -30,7 +35,9 @@ import (
 	"google.golang.org/grpc/balancer/weightedroundrobin"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/internal/buffer"
 	"google.golang.org/grpc/internal/grpclog"
+	"google.golang.org/grpc/internal/wrr"
 	"google.golang.org/grpc/internal/xds/env"
 	"google.golang.org/grpc/resolver"
 	"google.golang.org/grpc/status"
@@ -45,8 +52,43 @@ import (
 // TODO: make this a environment variable?
 var defaultPriorityInitTimeout = 10 * time.Second
 
+// defaultPriorityInitBackoffMultiplier and defaultPriorityInitMaxBackoff
+// bound the extended grace window given to a flapping priority when
+// priorityFailoverBackoffEnabled is set (see armPriorityFailoverTimer):
+// each time the priority reports TransientFailure while its init timer or
+// window is still running, the window is multiplied by defaultPriorityInitBackoffMultiplier, up to
+// defaultPriorityInitMaxBackoff.
+var (
+	defaultPriorityInitBackoffMultiplier = 2
+	defaultPriorityInitMaxBackoff        = 8 * defaultPriorityInitTimeout
+)
+
+// defaultWarmUpTimeout bounds how long updateWarmUp(true) holds back
+// picker updates waiting for the first priority to reach Ready, see
+// startPriority and endWarmUp.
+var defaultWarmUpTimeout = 10 * time.Second
+
 const defaultServiceRequestCountMax = 1024
 
+const defaultServiceConnectionCountMax = 1024
+
+// defaultMaxTotalEndpoints bounds the total number of endpoints (summed
+// across all localities and priorities) that handleEDSResponse will act on
+// in a single EDS response. A response exceeding this is rejected in its
+// entirety — the balancer keeps whatever state it already had — instead of
+// being partially applied, since a misbehaving or compromised control plane
+// sending hundreds of thousands of endpoints could otherwise exhaust memory
+// and SubConns.
+//
+// TODO: make this an environment variable?
+var defaultMaxTotalEndpoints = 1 << 16
+
+// defaultLocalityWeight is the weight given to a locality with an explicit
+// weight of 0 when locality weighted load balancing is disabled (see
+// edsBalancerImpl.localityWeightedLBEnabled), so that it's treated as
+// equally weighted rather than excluded.
+const defaultLocalityWeight = 1
+
 type localityConfig struct {
 	weight uint32
 	addrs  []resolver.Address
@@ -58,6 +100,10 @@ type balancerGroupWithConfig struct {
 	bg              *balancergroup.BalancerGroup
 	stateAggregator *weightedaggregator.Aggregator
 	configs         map[pkg.LocalityID]*localityConfig
+	// builder is the child policy used for localities in this priority. It's
+	// subBalancerBuilder by default, or an override from
+	// childPolicyByPriority (see edsBalancerImpl.builderForPriority).
+	builder balancer.Builder
 }
 
 // edsBalancerImpl does load balancing based on the EDS responses. Note that it
@@ -78,6 +124,97 @@ type edsBalancerImpl struct {
 	priorityToLocalities map[priorityType]*balancerGroupWithConfig
 	respReceived         bool
 
+	// childPolicyByPriority overrides subBalancerBuilder for specific
+	// priorities, keyed by priorityType.p (see builderForPriority). Set by
+	// handleChildPolicyByPriority.
+	childPolicyByPriority map[uint32]balancer.Builder
+	// childPolicyByPriorityCfg is the raw config last applied by
+	// handleChildPolicyByPriority, kept around so a repeat update with the
+	// same config can be skipped.
+	childPolicyByPriorityCfg map[uint32]*loadBalancingConfig
+
+	// localityPickingWRR builds the WRR implementation used by the
+	// weightedaggregator to pick across localities within a priority. It's
+	// random by default; set to wrr.NewEDF by updateLocalityPickingPolicy to
+	// get a deterministic (EDF) interleaving instead.
+	localityPickingWRR func() wrr.WRR
+
+	// healthCheckEnabled is set by updateHealthCheckConfig based on the CDS
+	// cluster's health_checks config. When true, newSubConn turns on gRPC
+	// client-side health checking for SubConns of this cluster, regardless
+	// of whether the configured child policy enables it by default.
+	healthCheckEnabled bool
+
+	// localityWeightedLBEnabled is set by updateLocalityWeightedLBConfig
+	// based on the CDS cluster's common_lb_config. It defaults to true,
+	// since without the guarantee that CDS is always sent, we assume
+	// locality weighted load balancing is enabled unless told otherwise.
+	// When true, EDS localities with a weight of 0 are excluded; when
+	// false, they're included at defaultLocalityWeight.
+	localityWeightedLBEnabled bool
+
+	// queueOnCircuitBreaking is set by updateCircuitBreakingQueueing. When
+	// true, dropPicker waits for a circuit breaking slot to free up (bounded
+	// by the RPC's own context deadline) instead of rejecting the pick
+	// immediately.
+	queueOnCircuitBreaking bool
+
+	// affinityHeader is set by updateAffinityHeader. When non-empty, picks
+	// whose PickInfo carries a value for this metadata header are routed by
+	// affinityPicker instead of going straight to the child policy's picker,
+	// giving the same header value the same SubConn across picks (session
+	// affinity). Empty disables affinity.
+	affinityHeader string
+
+	// faultInjection is set by updateFaultInjection. When non-nil, picks are
+	// routed through a faultInjectionPicker that may delay or abort them per
+	// the configured percentages. Nil disables fault injection.
+	faultInjection *FaultInjectionConfig
+
+	// subConnBatchSize is set by updateSubConnBatchSize. Zero disables
+	// batching: updateLocalityAddrs always applies a locality's full
+	// address list to its child balancer in one synchronous call, as
+	// before. See localityBatchQueue.
+	subConnBatchSize uint32
+	// localityBatchQueue holds localityBatchUpdate continuations queued by
+	// updateLocalityAddrs when subConnBatchSize splits a locality's address
+	// list into batches. edsBalancer.run() drains it one batch at a time
+	// via pendingLocalityBatches/processLocalityBatch, interleaved with
+	// every other balancer event, so creating SubConns for one huge
+	// locality can't monopolize the run loop.
+	localityBatchQueue *buffer.Unbounded
+
+	// affinityMu guards affinitySeen/affinityCandidates/affinitySticky. These
+	// live on edsBalancerImpl, not on affinityPicker, so that a header's
+	// sticky SubConn survives the picker being rewrapped for unrelated
+	// updates (e.g. a new drop config).
+	affinityMu sync.Mutex
+	// affinitySeen and affinityCandidates together track, in first-seen
+	// order, every SubConn affinityPicker has observed the child policy's
+	// picker hand out. affinityCandidates is what affinityHash indexes into.
+	affinitySeen       map[balancer.SubConn]bool
+	affinityCandidates []balancer.SubConn
+	// affinitySticky maps an affinity header value to the SubConn chosen for
+	// it the first time that value was seen.
+	affinitySticky map[string]balancer.SubConn
+
+	// priorityFailoverBackoffEnabled is set by updatePriorityFailoverBackoff.
+	// When true, a TransientFailure from priorityInUse doesn't immediately
+	// fail over to the next priority; instead a bounded, exponentially
+	// growing grace window is given, extended each time priorityInUse
+	// reports TransientFailure again before the window elapses (a sign
+	// it's flapping/retrying rather than permanently stuck). See
+	// handlePriorityWithNewStateTransientFailure.
+	priorityFailoverBackoffEnabled bool
+
+	// reResolveInterval is set by updateReResolutionConfig. When non-zero,
+	// reaching the state handled by armReResolveTimerLocked (the lowest
+	// priority has failed, with nowhere lower to fail over to) starts
+	// reResolveTimer, which asks the parent resolver for fresh addresses via
+	// cc.ResolveNow if the failure is still ongoing once it fires. Zero
+	// disables re-resolution on sustained failure.
+	reResolveInterval time.Duration
+
 	// There's no need to hold any mutexes at the same time. The order to take
 	// mutex should be: priorityMu > subConnMu, but this is implicit via
 	// balancers (starting balancer with next priority while holding priorityMu,
@@ -93,10 +230,106 @@ type edsBalancerImpl struct {
 	//
 	// One timer is enough because there can be at most one priority in init
 	// state.
-	priorityInitTimer *time.Timer
+	priorityInitTimer clockTimer
+	// priorityInitBackoff counts how many times priorityInitTimer has been
+	// extended for the current priorityInUse, used to compute the next
+	// exponential backoff window (see armPriorityFailoverTimer). Reset
+	// whenever a priority is (re)started or reaches Ready.
+	priorityInitBackoff int
+	// reResolveTimer is armed by armReResolveTimerLocked once the lowest
+	// priority fails with nowhere lower to go, and stopped once any priority
+	// reaches Ready (handlePriorityWithNewStateReady) or it fires. A single
+	// timer is enough for the same reason priorityInitTimer's is: there's at
+	// most one such failure episode in progress at a time.
+	reResolveTimer clockTimer
+	// priorityInitTimeoutCount counts how many times priorityInitTimer (or
+	// armPriorityFailoverTimer's reuse of it) has actually fired and forced
+	// a failover to the next lower priority, as opposed to being stopped
+	// first because the priority went Ready or was superseded. A high count
+	// relative to the balancer's uptime suggests defaultPriorityInitTimeout
+	// is too short for the deployment. Read via PriorityInitTimeoutCount;
+	// accessed atomically since PriorityInitTimeoutCount may be called from
+	// outside priorityMu.
+	priorityInitTimeoutCount uint64
+	// dropConfigOverlapCount counts how many times updateDrops has seen a new
+	// drop config where a category is repeated or the categories' configured
+	// probabilities sum beyond 100%, either of which is usually a
+	// misconfiguration: see validateDropConfig. Read via
+	// DropConfigOverlapCount; accessed atomically for the same reason as
+	// priorityInitTimeoutCount.
+	dropConfigOverlapCount uint64
+	// pinnedPriority is set by PinPriority and cleared by UnpinPriority. When
+	// set, the normal health-based priority selection in handlePriorityChange
+	// and handlePriorityWithNewState is bypassed in favor of always using
+	// this priority, e.g. for canarying a low-priority locality regardless
+	// of the health of higher ones.
+	pinnedPriority priorityType
+	// clock creates priorityInitTimer and reResolveTimer (see startPriority,
+	// armPriorityFailoverTimer and armReResolveTimerLocked). It defaults to
+	// systemClock; tests substitute a fake to fire priority failover and
+	// re-resolution deterministically instead of depending on real sleeps.
+	clock clock
+	// warmUp is set by updateWarmUp. When true, updateState holds back
+	// forwarding a non-Ready state computed while warmingUp is true,
+	// relying on the parent ClientConn's own pre-UpdateState picker (which
+	// queues picks rather than failing them) to cover the startup window
+	// instead of a freshly-Connecting or flapping child picker.
+	warmUp bool
+	// warmingUp is true from the first startPriority call until endWarmUp
+	// runs, either because a priority reached Ready or because
+	// warmUpTimer fired first.
+	warmingUp bool
+	// warmUpDone is set by endWarmUp so a later startPriority call (e.g.
+	// for a subsequent failover) never re-arms warm-up for the lifetime
+	// of this edsBalancerImpl.
+	warmUpDone bool
+	// warmUpTimer ends warm-up after defaultWarmUpTimeout if no priority
+	// has reached Ready by then, armed once by startPriority.
+	warmUpTimer clockTimer
+	// minHealthyPercentage is set by updateMinHealthyPercentage. See
+	// EDSConfig.MinHealthyPercentage.
+	minHealthyPercentage uint32
+	// panicThreshold is set by updatePanicThreshold. See
+	// EDSConfig.PanicThreshold.
+	panicThreshold uint32
+
+	subConnMu                 sync.Mutex
+	subConnToPriority         map[balancer.SubConn]priorityType
+	subConnToAddrs            map[balancer.SubConn][]resolver.Address
+	serviceConnectionsCounter *client.ServiceConnectionsCounter
+	serviceConnectionCountMax uint32
+
+	// globalRequestsCounter and globalRequestCountMax mirror
+	// serviceRequestsCounter/serviceRequestCountMax, but against the single
+	// process-wide client.GlobalRequestsCounter instead of a per-service
+	// one, for a cap shared across every xDS-managed cluster. Set by
+	// updateGlobalRequestsConfig; globalRequestsCounter is nil unless a
+	// non-zero max has been configured.
+	globalRequestsCounter *client.GlobalRequestsCounter
+	globalRequestCountMax uint32
+
+	// orcaListener, if set, is notified with the per-RPC ORCA load report
+	// for every completed RPC. This only forwards reports to the listener;
+	// it does not itself adjust any weights. Nothing in this tree currently
+	// implements weightedroundrobin.ORCAReportListener or consumes these
+	// reports to turn them into WRR weight adjustments, so setting this
+	// (currently only reachable from tests) has no effect on picking.
+	orcaListener weightedroundrobin.ORCAReportListener
 
-	subConnMu         sync.Mutex
-	subConnToPriority map[balancer.SubConn]priorityType
+	// addressTransformer, if set, is applied to every resolver.Address built
+	// from an EDS endpoint in handleEDSResponsePerPriority, before it's
+	// compared against the previous update and handed to the locality's
+	// child balancer. This lets a deployment rewrite or annotate addresses
+	// (e.g. mapping a service-mesh VIP to a sidecar proxy address) without
+	// teaching the xDS client parsing layer about the rewrite. Defaults to
+	// identity when nil.
+	addressTransformer func(resolver.Address) resolver.Address
+
+	// dnsMu guards dnsReResolvers, which holds one periodic re-resolver per
+	// locality whose endpoints come from a DNS name (e.g. a LOGICAL_DNS
+	// cluster) rather than from EDS pushes. See startDNSReResolution.
+	dnsMu          sync.Mutex
+	dnsReResolvers map[pkg.LocalityID]*dnsReResolver
 
 	pickerMu               sync.Mutex
 	dropConfig             []xdsclient.OverloadDropConfig
@@ -104,23 +337,68 @@ type edsBalancerImpl struct {
 	innerState             balancer.State // The state of the picker without drop support.
 	serviceRequestsCounter *client.ServiceRequestsCounter
 	serviceRequestCountMax uint32
+	dropStats              *dropCategoryStats
+
+	// priorityChangeCb, if set, is invoked every time handlePriorityChange or
+	// handlePriorityWithNewState switches priorityInUse. It's called while
+	// priorityMu is held, so it must not block or call back into this
+	// balancer.
+	priorityChangeCb func(priorityChangeEvent)
+
+	// subConnFailureCb, if set, is invoked every time cc.NewSubConn fails in
+	// newSubConn, in addition to the existing logger.Warningf call. It's
+	// called synchronously from the child balancer's goroutine, so it must
+	// not block or call back into this balancer.
+	subConnFailureCb func(subConnFailureEvent)
+
+	// localityChangeCb, if set, is invoked every time a locality is added to,
+	// updated in, or removed from a priority's balancer group in
+	// handleEDSResponsePerPriority, in addition to the existing logKV calls.
+	// It's called synchronously from the run goroutine's handling of the EDS
+	// response, so it must not block or call back into this balancer.
+	localityChangeCb func(localityChangeEvent)
+
+	// inFlight tracks RPCs picked through dropPicker that haven't completed
+	// yet, so that closeWithDrain can wait for them before tearing down.
+	inFlight sync.WaitGroup
+	// draining is set by closeWithDrain to make dropPicker reject new picks
+	// with ErrNoSubConnAvailable, while letting in-flight RPCs finish.
+	// Accessed atomically.
+	draining int32
 }
 
-// newEDSBalancerImpl create a new edsBalancerImpl.
-func newEDSBalancerImpl(cc balancer.ClientConn, bOpts balancer.BuildOptions, enqueueState func(priorityType, balancer.State), lr load.PerClusterReporter, logger *grpclog.PrefixLogger) *edsBalancerImpl {
+// newEDSBalancerImpl create a new edsBalancerImpl. initialSubBalancerBuilder
+// is the builder used for child balancers until an EDS response (or the
+// wrapping eds_experimental policy's config) overrides it via
+// handleChildPolicy; if nil, it defaults to round_robin.
+func newEDSBalancerImpl(cc balancer.ClientConn, bOpts balancer.BuildOptions, enqueueState func(priorityType, balancer.State), lr load.PerClusterReporter, logger *grpclog.PrefixLogger, initialSubBalancerBuilder balancer.Builder) *edsBalancerImpl {
+	if initialSubBalancerBuilder == nil {
+		initialSubBalancerBuilder = balancer.Get(roundrobin.Name)
+	}
 	edsImpl := &edsBalancerImpl{
-		cc:                 cc,
-		buildOpts:          bOpts,
-		logger:             logger,
-		subBalancerBuilder: balancer.Get(roundrobin.Name),
-		loadReporter:       lr,
+		cc:                        cc,
+		buildOpts:                 bOpts,
+		logger:                    logger,
+		subBalancerBuilder:        initialSubBalancerBuilder,
+		loadReporter:              lr,
+		localityPickingWRR:        newRandomWRR,
+		localityWeightedLBEnabled: true,
+		clock:                     systemClock{},
 
 		enqueueChildBalancerStateUpdate: enqueueState,
 
-		priorityToLocalities:   make(map[priorityType]*balancerGroupWithConfig),
-		priorityToState:        make(map[priorityType]*balancer.State),
-		subConnToPriority:      make(map[balancer.SubConn]priorityType),
-		serviceRequestCountMax: defaultServiceRequestCountMax,
+		priorityToLocalities:      make(map[priorityType]*balancerGroupWithConfig),
+		priorityToState:           make(map[priorityType]*balancer.State),
+		subConnToPriority:         make(map[balancer.SubConn]priorityType),
+		subConnToAddrs:            make(map[balancer.SubConn][]resolver.Address),
+		serviceRequestCountMax:    defaultServiceRequestCountMax,
+		serviceConnectionCountMax: defaultServiceConnectionCountMax,
+		dropStats:                 newDropCategoryStats(),
+
+		affinitySeen:   make(map[balancer.SubConn]bool),
+		affinitySticky: make(map[string]balancer.SubConn),
+
+		localityBatchQueue: buffer.NewUnbounded(),
 	}
 	// Don't start balancer group here. Start it when handling the first EDS
 	// response. Otherwise the balancer group will be started with round-robin,
@@ -140,31 +418,82 @@ func (edsImpl *edsBalancerImpl) handleChildPolicy(name string, config json.RawMe
 	}
 	newSubBalancerBuilder := balancer.Get(name)
 	if newSubBalancerBuilder == nil {
-		edsImpl.logger.Infof("edsBalancerImpl: failed to find balancer with name %q, keep using %q", name, edsImpl.subBalancerBuilder.Name())
+		edsImpl.logger.Warningf("edsBalancerImpl: failed to find balancer with name %q, keep using %q", name, edsImpl.subBalancerBuilder.Name())
 		return
 	}
 	edsImpl.subBalancerBuilder = newSubBalancerBuilder
-	for _, bgwc := range edsImpl.priorityToLocalities {
+	for priority, bgwc := range edsImpl.priorityToLocalities {
 		if bgwc == nil {
 			continue
 		}
-		for lid, config := range bgwc.configs {
-			lidJSON, err := lid.ToString()
-			if err != nil {
-				edsImpl.logger.Errorf("failed to marshal LocalityID: %#v, skipping this locality", lid)
-				continue
-			}
-			// TODO: (eds) add support to balancer group to support smoothly
-			//  switching sub-balancers (keep old balancer around until new
-			//  balancer becomes ready).
-			bgwc.bg.Remove(lidJSON)
-			bgwc.bg.Add(lidJSON, edsImpl.subBalancerBuilder)
-			bgwc.bg.UpdateClientConnState(lidJSON, balancer.ClientConnState{
-				ResolverState: resolver.State{Addresses: config.addrs},
-			})
-			// This doesn't need to manually update picker, because the new
-			// sub-balancer will send it's picker later.
+		edsImpl.migratePriorityChildPolicy(bgwc, edsImpl.builderForPriority(priority))
+	}
+}
+
+// handleChildPolicyByPriority updates the per-priority child policy
+// overrides. A priority absent from configs reverts to subBalancerBuilder
+// (the policy set by handleChildPolicy).
+func (edsImpl *edsBalancerImpl) handleChildPolicyByPriority(configs map[uint32]*loadBalancingConfig) {
+	if cmp.Equal(configs, edsImpl.childPolicyByPriorityCfg, cmpopts.EquateEmpty()) {
+		return
+	}
+	edsImpl.childPolicyByPriorityCfg = configs
+
+	newOverrides := make(map[uint32]balancer.Builder, len(configs))
+	for priority, cfg := range configs {
+		b := balancer.Get(cfg.Name)
+		if b == nil {
+			edsImpl.logger.Warningf("edsBalancerImpl: failed to find balancer with name %q for priority %d, falling back to the default child policy", cfg.Name, priority)
+			continue
 		}
+		newOverrides[priority] = b
+	}
+	edsImpl.childPolicyByPriority = newOverrides
+
+	for priority, bgwc := range edsImpl.priorityToLocalities {
+		if bgwc == nil {
+			continue
+		}
+		edsImpl.migratePriorityChildPolicy(bgwc, edsImpl.builderForPriority(priority))
+	}
+}
+
+// builderForPriority returns the child policy builder to use for priority:
+// the childPolicyByPriority override if one's configured for it, otherwise
+// subBalancerBuilder.
+func (edsImpl *edsBalancerImpl) builderForPriority(priority priorityType) balancer.Builder {
+	if priority.isSet() {
+		if b, ok := edsImpl.childPolicyByPriority[priority.p]; ok {
+			return b
+		}
+	}
+	return edsImpl.subBalancerBuilder
+}
+
+// migratePriorityChildPolicy switches bgwc to newBuilder, recreating each of
+// its localities' sub-balancers in place. It's a no-op if bgwc is already
+// using newBuilder.
+func (edsImpl *edsBalancerImpl) migratePriorityChildPolicy(bgwc *balancerGroupWithConfig, newBuilder balancer.Builder) {
+	if bgwc.builder != nil && bgwc.builder.Name() == newBuilder.Name() {
+		return
+	}
+	bgwc.builder = newBuilder
+	for lid, config := range bgwc.configs {
+		lidJSON, err := lid.ToString()
+		if err != nil {
+			edsImpl.logger.Errorf("failed to marshal LocalityID: %#v, skipping this locality", lid)
+			continue
+		}
+		// TODO: (eds) add support to balancer group to support smoothly
+		//  switching sub-balancers (keep old balancer around until new
+		//  balancer becomes ready).
+		bgwc.bg.Remove(lidJSON)
+		bgwc.bg.Add(lidJSON, bgwc.builder)
+		bgwc.bg.UpdateClientConnState(lidJSON, balancer.ClientConnState{
+			ResolverState: resolver.State{Addresses: config.addrs},
+		})
+		// This doesn't need to manually update picker, because the new
+		// sub-balancer will send it's picker later.
 	}
 }
 
@@ -174,6 +503,7 @@ func (edsImpl *edsBalancerImpl) updateDrops(dropConfig []xdsclient.OverloadDropC
 	if cmp.Equal(dropConfig, edsImpl.dropConfig) {
 		return
 	}
+	edsImpl.validateDropConfig(dropConfig)
 	edsImpl.pickerMu.Lock()
 	edsImpl.dropConfig = dropConfig
 	var newDrops []*dropper
@@ -185,12 +515,57 @@ func (edsImpl *edsBalancerImpl) updateDrops(dropConfig []xdsclient.OverloadDropC
 		// Update picker with old inner picker, new drops.
 		edsImpl.cc.UpdateState(balancer.State{
 			ConnectivityState: edsImpl.innerState.ConnectivityState,
-			Picker:            newDropPicker(edsImpl.innerState.Picker, newDrops, edsImpl.loadReporter, edsImpl.serviceRequestsCounter, edsImpl.serviceRequestCountMax)},
+			Picker:            edsImpl.wrapPicker(edsImpl.innerState.Picker)},
 		)
 	}
 	edsImpl.pickerMu.Unlock()
 }
 
+// validateDropConfig logs a warning, and bumps dropConfigOverlapCount, if
+// dropConfig repeats a category or its categories' probabilities sum beyond
+// 100%. Both usually indicate a misconfiguration: because dropPicker.Pick
+// evaluates categories sequentially and stops at the first one that hits (see
+// EffectiveDropRate), a repeated or later category can end up firing far less
+// often than its configured probability suggests, or effectively never.
+func (edsImpl *edsBalancerImpl) validateDropConfig(dropConfig []xdsclient.OverloadDropConfig) {
+	seen := make(map[string]int)
+	var sum float64
+	for _, c := range dropConfig {
+		seen[c.Category]++
+		if c.Denominator == 0 {
+			continue
+		}
+		numerator := c.Numerator
+		if numerator > c.Denominator {
+			numerator = c.Denominator
+		}
+		sum += float64(numerator) / float64(c.Denominator)
+	}
+
+	var overlap bool
+	for category, count := range seen {
+		if count > 1 {
+			overlap = true
+			edsImpl.logger.Warningf("eds: drop category %q is configured %d times; dropPicker.Pick evaluates categories sequentially, so only the first instance can ever fire", category, count)
+		}
+	}
+	if sum > 1 {
+		overlap = true
+		edsImpl.logger.Warningf("eds: drop categories' probabilities sum to %.1f%%, exceeding 100%%; dropPicker.Pick's sequential evaluation caps the actual drop rate at 100%% (see EffectiveDropRate), but this usually means the later categories were meant to apply independently and rarely fire as configured", sum*100)
+	}
+	if overlap {
+		atomic.AddUint64(&edsImpl.dropConfigOverlapCount, 1)
+	}
+}
+
+// DropConfigOverlapCount returns the number of times updateDrops has seen a
+// new drop config with a repeated category or categories summing beyond
+// 100%, so far. A nonzero count is a sign of drop-config misconfiguration;
+// see validateDropConfig.
+func (edsImpl *edsBalancerImpl) DropConfigOverlapCount() uint64 {
+	return atomic.LoadUint64(&edsImpl.dropConfigOverlapCount)
+}
+
 // handleEDSResponse handles the EDS response and creates/deletes localities and
 // SubConns. It also handles drops.
 //
@@ -212,36 +587,76 @@ func (edsImpl *edsBalancerImpl) handleEDSResponse(edsResp xdsclient.EndpointsUpd
 	// TODO: define Equal() on type EndpointUpdate to avoid DeepEqual. And do
 	// the same for the other types.
 	if !edsImpl.respReceived && reflect.DeepEqual(edsResp, xdsclient.EndpointsUpdate{}) {
-		edsImpl.cc.UpdateState(balancer.State{ConnectivityState: connectivity.TransientFailure, Picker: base.NewErrPicker(errAllPrioritiesRemoved)})
+		edsImpl.cc.UpdateState(balancer.State{ConnectivityState: connectivity.TransientFailure, Picker: base.NewErrPicker(ErrAllPrioritiesRemoved)})
+		edsImpl.priorityMu.Lock()
+		edsImpl.notifyPriorityChange(newPriorityTypeUnset(), false, priorityChangeReasonAllRemoved)
+		edsImpl.priorityMu.Unlock()
+	}
+	var totalEndpoints int
+	for _, locality := range edsResp.Localities {
+		totalEndpoints += len(locality.Endpoints)
+	}
+	if totalEndpoints > defaultMaxTotalEndpoints {
+		edsImpl.logger.Warningf("eds: received EDS response with %d endpoints across %d localities, exceeding the max of %d; rejecting the update", totalEndpoints, len(edsResp.Localities), defaultMaxTotalEndpoints)
+		return
 	}
+
 	edsImpl.respReceived = true
 
 	edsImpl.updateDrops(edsResp.Drops)
 
-	// Filter out all localities with weight 0.
-	//
-	// Locality weighted load balancer can be enabled by setting an option in
-	// CDS, and the weight of each locality. Currently, without the guarantee
-	// that CDS is always sent, we assume locality weighted load balance is
-	// always enabled, and ignore all weight 0 localities.
-	//
-	// In the future, we should look at the config in CDS response and decide
-	// whether locality weight matters.
+	// Filter out all localities with weight 0, unless locality weighted load
+	// balancing has been explicitly disabled via CDS (see
+	// updateLocalityWeightedLBConfig), in which case a weight-0 locality is
+	// instead treated as equally weighted with defaultLocalityWeight.
 	newLocalitiesWithPriority := make(map[priorityType][]xdsclient.Locality)
+	// seenPriorities tracks every priority present in edsResp.Localities,
+	// regardless of weight, so a priority left with zero localities below
+	// (every one of them weight 0) still gets an entry in
+	// newLocalitiesWithPriority instead of silently disappearing: see below.
+	seenPriorities := make(map[priorityType]bool)
 	for _, locality := range edsResp.Localities {
+		priority := newPriorityType(locality.Priority)
+		seenPriorities[priority] = true
 		if locality.Weight == 0 {
-			continue
+			if !edsImpl.localityWeightedLBEnabled {
+				locality.Weight = defaultLocalityWeight
+			} else {
+				continue
+			}
 		}
-		priority := newPriorityType(locality.Priority)
 		newLocalitiesWithPriority[priority] = append(newLocalitiesWithPriority[priority], locality)
 	}
+	// A priority whose localities were all weight 0 would otherwise vanish
+	// here rather than being created: it'd be treated the same as a priority
+	// that was never in the response at all, and (if it already existed)
+	// torn down by the "deleted priorities" loop below with no failure
+	// signal. Give it an explicit (empty) entry instead, so it's created (or
+	// kept) with zero localities, which the state aggregator reports as
+	// TransientFailure rather than leaving the picker behavior undefined.
+	for priority := range seenPriorities {
+		if _, ok := newLocalitiesWithPriority[priority]; !ok {
+			edsImpl.logger.Warningf("eds: all localities in priority %v have weight 0; marking it failed", priority)
+			newLocalitiesWithPriority[priority] = nil
+		}
+	}
 
 	var (
 		priorityLowest  priorityType
 		priorityChanged bool
 	)
 
-	for priority, newLocalities := range newLocalitiesWithPriority {
+	// Processed in ascending priority order (rather than ranging over the map
+	// directly), so that balancer group creation and the "priority added" log
+	// line below have a deterministic order across EDS updates.
+	priorities := make([]priorityType, 0, len(newLocalitiesWithPriority))
+	for priority := range newLocalitiesWithPriority {
+		priorities = append(priorities, priority)
+	}
+	sort.Slice(priorities, func(i, j int) bool { return priorities[i].p < priorities[j].p })
+
+	for _, priority := range priorities {
+		newLocalities := newLocalitiesWithPriority[priority]
 		if !priorityLowest.isSet() || priorityLowest.higherThan(priority) {
 			priorityLowest = priority
 		}
@@ -253,31 +668,40 @@ func (edsImpl *edsBalancerImpl) handleEDSResponse(edsResp xdsclient.EndpointsUpd
 			// be started when necessary (e.g. when higher is down, or if it's a
 			// new lowest priority).
 			ccPriorityWrapper := edsImpl.ccWrapperWithPriority(priority)
-			stateAggregator := weightedaggregator.New(ccPriorityWrapper, edsImpl.logger, newRandomWRR)
+			stateAggregator := weightedaggregator.New(ccPriorityWrapper, edsImpl.logger, edsImpl.localityPickingWRR)
 			bgwc = &balancerGroupWithConfig{
 				bg:              balancergroup.New(ccPriorityWrapper, edsImpl.buildOpts, stateAggregator, edsImpl.loadReporter, edsImpl.logger),
 				stateAggregator: stateAggregator,
 				configs:         make(map[pkg.LocalityID]*localityConfig),
+				builder:         edsImpl.builderForPriority(priority),
 			}
 			edsImpl.priorityToLocalities[priority] = bgwc
 			priorityChanged = true
-			edsImpl.logger.Infof("New priority %v added", priority)
+			logKV(edsImpl.logger, "priority added", "priority", priority)
 		}
-		edsImpl.handleEDSResponsePerPriority(bgwc, newLocalities)
+		edsImpl.handleEDSResponsePerPriority(priority, bgwc, newLocalities)
 	}
 	edsImpl.priorityLowest = priorityLowest
 
 	// Delete priorities that are removed in the latest response, and also close
-	// the balancer group.
-	for p, bgwc := range edsImpl.priorityToLocalities {
+	// the balancer group. Processed in ascending priority order for the same
+	// determinism reason as the creation loop above.
+	deletedPriorities := make([]priorityType, 0, len(edsImpl.priorityToLocalities))
+	for p := range edsImpl.priorityToLocalities {
 		if _, ok := newLocalitiesWithPriority[p]; !ok {
-			delete(edsImpl.priorityToLocalities, p)
-			bgwc.bg.Close()
-			delete(edsImpl.priorityToState, p)
-			priorityChanged = true
-			edsImpl.logger.Infof("Priority %v deleted", p)
+			deletedPriorities = append(deletedPriorities, p)
 		}
 	}
+	sort.Slice(deletedPriorities, func(i, j int) bool { return deletedPriorities[i].p < deletedPriorities[j].p })
+
+	for _, p := range deletedPriorities {
+		bgwc := edsImpl.priorityToLocalities[p]
+		delete(edsImpl.priorityToLocalities, p)
+		bgwc.bg.Close()
+		delete(edsImpl.priorityToState, p)
+		priorityChanged = true
+		logKV(edsImpl.logger, "priority deleted", "priority", p)
+	}
 
 	// If priority was added/removed, it may affect the balancer group to use.
 	// E.g. priorityInUse was removed, or all priorities are down, and a new
@@ -287,12 +711,85 @@ func (edsImpl *edsBalancerImpl) handleEDSResponse(edsResp xdsclient.EndpointsUpd
 	}
 }
 
-func (edsImpl *edsBalancerImpl) handleEDSResponsePerPriority(bgwc *balancerGroupWithConfig, newLocalities []xdsclient.Locality) {
+// panicking reports whether the fraction of EDS-healthy endpoints (weight-0
+// endpoints aside, since those are explicitly excluded regardless of health;
+// see below) across newLocalities, which are all in the same priority, has
+// dropped below panicThreshold. panicThreshold of zero always returns false.
+func (edsImpl *edsBalancerImpl) panicking(newLocalities []xdsclient.Locality) bool {
+	if edsImpl.panicThreshold == 0 {
+		return false
+	}
+	var total, healthy int
+	for _, locality := range newLocalities {
+		for _, lbEndpoint := range locality.Endpoints {
+			if lbEndpoint.Weight == 0 {
+				continue
+			}
+			total++
+			if lbEndpoint.HealthStatus == xdsclient.EndpointHealthStatusHealthy ||
+				lbEndpoint.HealthStatus == xdsclient.EndpointHealthStatusUnknown {
+				healthy++
+			}
+		}
+	}
+	if total == 0 {
+		return false
+	}
+	return uint64(healthy)*100 < uint64(total)*uint64(edsImpl.panicThreshold)
+}
+
+// localityChangeType is a machine-readable description of how a locality's
+// membership in its priority's balancer group changed, reported alongside
+// the existing logKV calls via localityChangeCb.
+type localityChangeType string
+
+const (
+	// localityChangeTypeAdded is reported when a locality appears in an EDS
+	// response for a priority that didn't already have it.
+	localityChangeTypeAdded localityChangeType = "added"
+	// localityChangeTypeUpdated is reported when a known locality's weight
+	// or address set changes in a new EDS response.
+	localityChangeTypeUpdated localityChangeType = "updated"
+	// localityChangeTypeRemoved is reported when a locality present in the
+	// previous EDS response is absent from the latest one.
+	localityChangeTypeRemoved localityChangeType = "removed"
+)
+
+// localityChangeEvent is a structured, machine-readable record of a
+// locality's membership changing within its priority's balancer group. It's
+// emitted (via localityChangeCb) in addition to the existing logKV calls,
+// for operators (e.g. a custom metrics exporter) who want to track locality
+// membership programmatically.
+type localityChangeEvent struct {
+	// Priority is the EDS priority ID belongs to.
+	Priority priorityType
+	// ID is the locality whose membership changed.
+	ID pkg.LocalityID
+	// Type describes how ID's membership changed.
+	Type localityChangeType
+	// Weight is ID's current weight; 0 for localityChangeTypeRemoved.
+	Weight uint32
+	// AddrCount is the number of addresses currently in ID; 0 for
+	// localityChangeTypeRemoved.
+	AddrCount int
+}
+
+// notifyLocalityChange invokes localityChangeCb, if set, with a
+// localityChangeEvent describing typ happening to id within priority.
+func (edsImpl *edsBalancerImpl) notifyLocalityChange(priority priorityType, id pkg.LocalityID, typ localityChangeType, weight uint32, addrCount int) {
+	if edsImpl.localityChangeCb == nil {
+		return
+	}
+	edsImpl.localityChangeCb(localityChangeEvent{Priority: priority, ID: id, Type: typ, Weight: weight, AddrCount: addrCount})
+}
+
+func (edsImpl *edsBalancerImpl) handleEDSResponsePerPriority(priority priorityType, bgwc *balancerGroupWithConfig, newLocalities []xdsclient.Locality) {
 	// newLocalitiesSet contains all names of localities in the new EDS response
 	// for the same priority. It's used to delete localities that are removed in
 	// the new EDS response.
 	newLocalitiesSet := make(map[pkg.LocalityID]struct{})
 	var rebuildStateAndPicker bool
+	panicking := edsImpl.panicking(newLocalities)
 	for _, locality := range newLocalities {
 		// One balancer for each locality.
 
@@ -309,16 +806,29 @@ func (edsImpl *edsBalancerImpl) handleEDSResponsePerPriority(bgwc *balancerGroup
 		for _, lbEndpoint := range locality.Endpoints {
 			// Filter out all "unhealthy" endpoints (unknown and
 			// healthy are both considered to be healthy:
-			// https://www.envoyproxy.io/docs/envoy/latest/api-v2/api/v2/core/health_check.proto#envoy-api-enum-core-healthstatus).
-			if lbEndpoint.HealthStatus != xdsclient.EndpointHealthStatusHealthy &&
+			// https://www.envoyproxy.io/docs/envoy/latest/api-v2/api/v2/core/health_check.proto#envoy-api-enum-core-healthstatus),
+			// unless panicking, in which case every endpoint is kept: see
+			// EDSConfig.PanicThreshold.
+			if !panicking && lbEndpoint.HealthStatus != xdsclient.EndpointHealthStatusHealthy &&
 				lbEndpoint.HealthStatus != xdsclient.EndpointHealthStatusUnknown {
 				continue
 			}
+			// An endpoint with an unset load_balancing_weight is parsed with
+			// a weight of 1 (see parseEndpoints); a weight of 0 here is
+			// therefore always explicit, and per Envoy's semantics such an
+			// endpoint should receive no traffic at all.
+			if lbEndpoint.Weight == 0 {
+				continue
+			}
 
 			address := resolver.Address{
 				Addr: lbEndpoint.Address,
 			}
-			if edsImpl.subBalancerBuilder.Name() == weightedroundrobin.Name && lbEndpoint.Weight != 0 {
+			address = xdsclient.SetHealthStatus(address, lbEndpoint.HealthStatus)
+			if len(lbEndpoint.AdditionalAddresses) > 0 {
+				address = xdsclient.SetAdditionalAddresses(address, lbEndpoint.AdditionalAddresses)
+			}
+			if bgwc.builder.Name() == weightedroundrobin.Name {
 				ai := weightedroundrobin.AddrInfo{Weight: lbEndpoint.Weight}
 				address = weightedroundrobin.SetAddrInfo(address, ai)
 				// Metadata field in resolver.Address is deprecated. The
@@ -330,6 +840,9 @@ func (edsImpl *edsBalancerImpl) handleEDSResponsePerPriority(bgwc *balancerGroup
 				// See https://github.com/grpc/grpc-go/issues/3563.
 				address.Metadata = &ai
 			}
+			if edsImpl.addressTransformer != nil {
+				address = edsImpl.addressTransformer(address)
+			}
 			newAddrs = append(newAddrs, address)
 		}
 		var weightChanged, addrsChanged bool
@@ -337,7 +850,7 @@ func (edsImpl *edsBalancerImpl) handleEDSResponsePerPriority(bgwc *balancerGroup
 		if !ok {
 			// A new balancer, add it to balancer group and balancer map.
 			bgwc.stateAggregator.Add(lidJSON, newWeight)
-			bgwc.bg.Add(lidJSON, edsImpl.subBalancerBuilder)
+			bgwc.bg.Add(lidJSON, bgwc.builder)
 			config = &localityConfig{
 				weight: newWeight,
 			}
@@ -346,7 +859,8 @@ func (edsImpl *edsBalancerImpl) handleEDSResponsePerPriority(bgwc *balancerGroup
 			// weightChanged is false for new locality, because there's no need
 			// to update weight in bg.
 			addrsChanged = true
-			edsImpl.logger.Infof("New locality %v added", lid)
+			logKV(edsImpl.logger, "locality added", "locality", lid)
+			edsImpl.notifyLocalityChange(priority, lid, localityChangeTypeAdded, newWeight, len(newAddrs))
 		} else {
 			// Compare weight and addrs.
 			if config.weight != newWeight {
@@ -355,7 +869,10 @@ func (edsImpl *edsBalancerImpl) handleEDSResponsePerPriority(bgwc *balancerGroup
 			if !cmp.Equal(config.addrs, newAddrs) {
 				addrsChanged = true
 			}
-			edsImpl.logger.Infof("Locality %v updated, weightedChanged: %v, addrsChanged: %v", lid, weightChanged, addrsChanged)
+			logKV(edsImpl.logger, "locality updated", "locality", lid, "weight_changed", weightChanged, "addrs_changed", addrsChanged)
+			if weightChanged || addrsChanged {
+				edsImpl.notifyLocalityChange(priority, lid, localityChangeTypeUpdated, newWeight, len(newAddrs))
+			}
 		}
 
 		if weightChanged {
@@ -366,9 +883,7 @@ func (edsImpl *edsBalancerImpl) handleEDSResponsePerPriority(bgwc *balancerGroup
 
 		if addrsChanged {
 			config.addrs = newAddrs
-			bgwc.bg.UpdateClientConnState(lidJSON, balancer.ClientConnState{
-				ResolverState: resolver.State{Addresses: newAddrs},
-			})
+			edsImpl.updateLocalityAddrs(bgwc, lidJSON, newAddrs)
 		}
 	}
 
@@ -383,7 +898,8 @@ func (edsImpl *edsBalancerImpl) handleEDSResponsePerPriority(bgwc *balancerGroup
 			bgwc.stateAggregator.Remove(lidJSON)
 			bgwc.bg.Remove(lidJSON)
 			delete(bgwc.configs, lid)
-			edsImpl.logger.Infof("Locality %v deleted", lid)
+			logKV(edsImpl.logger, "locality deleted", "locality", lid)
+			edsImpl.notifyLocalityChange(priority, lid, localityChangeTypeRemoved, 0, 0)
 			rebuildStateAndPicker = true
 		}
 	}
@@ -393,6 +909,64 @@ func (edsImpl *edsBalancerImpl) handleEDSResponsePerPriority(bgwc *balancerGroup
 	}
 }
 
+// localityBatchUpdate is a deferred continuation of one locality's
+// UpdateClientConnState call, queued by updateLocalityAddrs when
+// subConnBatchSize splits newAddrs into batches. applied accumulates the
+// addresses already handed to the locality's child balancer; pending holds
+// the rest, still to be applied one batch at a time by processLocalityBatch.
+type localityBatchUpdate struct {
+	bgwc    *balancerGroupWithConfig
+	lidJSON string
+	applied []resolver.Address
+	pending []resolver.Address
+}
+
+// updateLocalityAddrs applies newAddrs to the child balancer for the
+// locality identified by lidJSON within bgwc, creating its SubConns. If
+// subConnBatchSize is zero, or newAddrs is no longer than it, this happens
+// synchronously in one call, as it always did before SubConnBatchSize was
+// added. Otherwise, newAddrs is queued as a localityBatchUpdate and applied
+// in batches by processLocalityBatch, one per pass through edsBalancer's
+// run loop (see pendingLocalityBatches), so that creating SubConns for a
+// locality with thousands of endpoints can't block the run loop from
+// handling any other priority's update, or any other balancer event, until
+// they've all been created.
+func (edsImpl *edsBalancerImpl) updateLocalityAddrs(bgwc *balancerGroupWithConfig, lidJSON string, newAddrs []resolver.Address) {
+	if bs := edsImpl.subConnBatchSize; bs > 0 && uint32(len(newAddrs)) > bs {
+		edsImpl.localityBatchQueue.Put(&localityBatchUpdate{bgwc: bgwc, lidJSON: lidJSON, pending: newAddrs})
+		return
+	}
+	bgwc.bg.UpdateClientConnState(lidJSON, balancer.ClientConnState{
+		ResolverState: resolver.State{Addresses: newAddrs},
+	})
+}
+
+// pendingLocalityBatches returns the queue of localityBatchUpdate
+// continuations created by updateLocalityAddrs, drained by edsBalancer.run().
+func (edsImpl *edsBalancerImpl) pendingLocalityBatches() *buffer.Unbounded {
+	return edsImpl.localityBatchQueue
+}
+
+// processLocalityBatch applies the next subConnBatchSize addresses of
+// item's pending list to its locality's child balancer, on top of the ones
+// already applied, and re-queues item if any remain. Called by
+// edsBalancer.run() for each value it reads off pendingLocalityBatches().
+func (edsImpl *edsBalancerImpl) processLocalityBatch(item interface{}) {
+	u := item.(*localityBatchUpdate)
+	bs := edsImpl.subConnBatchSize
+	if bs == 0 || bs > uint32(len(u.pending)) {
+		bs = uint32(len(u.pending))
+	}
+	u.applied = append(u.applied, u.pending[:bs]...)
+	u.pending = u.pending[bs:]
+	u.bgwc.bg.UpdateClientConnState(u.lidJSON, balancer.ClientConnState{
+		ResolverState: resolver.State{Addresses: u.applied},
+	})
+	if len(u.pending) > 0 {
+		edsImpl.localityBatchQueue.Put(u)
+	}
+}
+
 // handleSubConnStateChange handles the state change and update pickers accordingly.
 func (edsImpl *edsBalancerImpl) handleSubConnStateChange(sc balancer.SubConn, s connectivity.State) {
 	edsImpl.subConnMu.Lock()
@@ -401,6 +975,10 @@ func (edsImpl *edsBalancerImpl) handleSubConnStateChange(sc balancer.SubConn, s
 		if s == connectivity.Shutdown {
 			// Only delete sc from the map when state changed to Shutdown.
 			delete(edsImpl.subConnToPriority, sc)
+			delete(edsImpl.subConnToAddrs, sc)
+			if edsImpl.serviceConnectionsCounter != nil {
+				edsImpl.serviceConnectionsCounter.EndConnection()
+			}
 		}
 		bgwc = edsImpl.priorityToLocalities[p]
 	}
@@ -414,6 +992,198 @@ func (edsImpl *edsBalancerImpl) handleSubConnStateChange(sc balancer.SubConn, s
 	}
 }
 
+// subConnToPrioritySnapshot returns a point-in-time copy of which priority
+// each known SubConn belongs to, keyed by SubConn and valued by priority
+// (0 is highest). It's meant for diagnostics, e.g. when debugging the
+// "priority not found for sc state change" log line.
+func (edsImpl *edsBalancerImpl) subConnToPrioritySnapshot() map[balancer.SubConn]uint32 {
+	edsImpl.subConnMu.Lock()
+	defer edsImpl.subConnMu.Unlock()
+	ret := make(map[balancer.SubConn]uint32, len(edsImpl.subConnToPriority))
+	for sc, p := range edsImpl.subConnToPriority {
+		ret[sc] = p.p
+	}
+	return ret
+}
+
+// localityWeightStateSnapshot returns a point-in-time snapshot of the weight
+// and connectivity state of every locality (keyed by their LocalityID's
+// ToString() form) within the given priority, or nil if the priority is
+// unknown. It's meant for diagnostics, e.g. when trying to figure out why a
+// particular locality isn't receiving traffic.
+func (edsImpl *edsBalancerImpl) localityWeightStateSnapshot(priority priorityType) map[string]weightedaggregator.WeightedState {
+	edsImpl.priorityMu.Lock()
+	defer edsImpl.priorityMu.Unlock()
+	bgwc, ok := edsImpl.priorityToLocalities[priority]
+	if !ok {
+		return nil
+	}
+	return bgwc.stateAggregator.Snapshot()
+}
+
+// effectiveLocalityWeights returns the normalized (weight divided by the sum
+// of every locality's weight) effective pick probability of every locality
+// (keyed by their LocalityID's ToString() form) within the given priority,
+// or nil if the priority is unknown. It's meant for diagnostics, e.g.
+// confirming a configured locality weight translates into the traffic split
+// an operator expects.
+func (edsImpl *edsBalancerImpl) effectiveLocalityWeights(priority priorityType) map[string]float64 {
+	edsImpl.priorityMu.Lock()
+	defer edsImpl.priorityMu.Unlock()
+	bgwc, ok := edsImpl.priorityToLocalities[priority]
+	if !ok {
+		return nil
+	}
+	return bgwc.stateAggregator.EffectiveWeights()
+}
+
+// updateLocalityPickingPolicy sets the WRR algorithm used to pick across
+// localities within a priority. deterministic selects the EDF scheduler,
+// which gives a smoother (round-robin-like) interleaving over short windows;
+// otherwise the default weighted-random algorithm is used. It only takes
+// effect for priorities created after this call, since the WRR
+// implementation is baked into the weightedaggregator at creation time.
+func (edsImpl *edsBalancerImpl) updateLocalityPickingPolicy(deterministic bool) {
+	if deterministic {
+		edsImpl.localityPickingWRR = wrr.NewEDF
+	} else {
+		edsImpl.localityPickingWRR = newRandomWRR
+	}
+}
+
+// updateHealthCheckConfig updates whether newSubConn should turn on gRPC
+// client-side health checking for SubConns of this cluster. It only affects
+// SubConns created after this call.
+func (edsImpl *edsBalancerImpl) updateHealthCheckConfig(enable bool) {
+	edsImpl.healthCheckEnabled = enable
+}
+
+// updateLocalityWeightedLBConfig updates whether locality weighted load
+// balancing is enabled, as configured by the CDS cluster's
+// common_lb_config. It only affects EDS responses handled after this call.
+func (edsImpl *edsBalancerImpl) updateLocalityWeightedLBConfig(enable bool) {
+	edsImpl.localityWeightedLBEnabled = enable
+}
+
+// updateCircuitBreakingQueueing updates whether dropPicker should queue
+// (wait for a free circuit breaking slot) instead of immediately rejecting a
+// pick once the service's max concurrent requests is reached. It only
+// affects pickers created after this call.
+func (edsImpl *edsBalancerImpl) updateCircuitBreakingQueueing(enable bool) {
+	edsImpl.queueOnCircuitBreaking = enable
+}
+
+// updateAffinityHeader updates the metadata header used for session
+// affinity (see affinityPicker). An empty header disables affinity. It only
+// affects pickers created after this call.
+func (edsImpl *edsBalancerImpl) updateAffinityHeader(header string) {
+	edsImpl.affinityHeader = header
+}
+
+// updateFaultInjection updates the fault injection settings enforced by
+// faultInjectionPicker. A nil cfg disables fault injection. It only affects
+// pickers created after this call.
+func (edsImpl *edsBalancerImpl) updateFaultInjection(cfg *FaultInjectionConfig) {
+	edsImpl.faultInjection = cfg
+}
+
+// updateSubConnBatchSize updates the batch size used by updateLocalityAddrs:
+// a locality address update longer than it is deferred in full to
+// localityBatchQueue and applied one batch at a time. Zero disables
+// batching. It only affects address updates processed after this
+// call; a batch sequence already in progress keeps the batch size it
+// started with.
+func (edsImpl *edsBalancerImpl) updateSubConnBatchSize(size uint32) {
+	edsImpl.subConnBatchSize = size
+}
+
+// updateWarmUp updates whether updateState holds back forwarding picker
+// updates until the first priority reaches Ready or defaultWarmUpTimeout
+// elapses, queuing picks against the ClientConn's default picker in the
+// meantime instead of against a freshly-Connecting or flapping one. It
+// only affects a warm-up that hasn't started yet: startPriority checks it
+// every time it starts a priority, and warm-up runs at most once, so once
+// a warm-up has started, changing it has no effect.
+func (edsImpl *edsBalancerImpl) updateWarmUp(enabled bool) {
+	edsImpl.warmUp = enabled
+}
+
+// updateMinHealthyPercentage updates the panic threshold used by
+// handlePriorityWithNewState to fail a Ready priority over to the next lower
+// one once its weighted healthy fraction drops below pct. See
+// EDSConfig.MinHealthyPercentage.
+func (edsImpl *edsBalancerImpl) updateMinHealthyPercentage(pct uint32) {
+	edsImpl.minHealthyPercentage = pct
+}
+
+// updatePanicThreshold updates the threshold at which handleEDSResponsePerPriority
+// stops excluding a priority's unhealthy endpoints and falls back to routing
+// to all of them instead. See EDSConfig.PanicThreshold.
+func (edsImpl *edsBalancerImpl) updatePanicThreshold(pct uint32) {
+	edsImpl.panicThreshold = pct
+}
+
+// updatePriorityFailoverBackoff updates whether a flapping priority is given
+// a bounded, extended grace window before failing over to the next priority,
+// instead of failing over immediately on the first TransientFailure. It only
+// affects priority transitions handled after this call.
+func (edsImpl *edsBalancerImpl) updatePriorityFailoverBackoff(enable bool) {
+	edsImpl.priorityFailoverBackoffEnabled = enable
+}
+
+// updateReResolutionConfig updates how long the balancer waits, after the
+// lowest priority has failed with nowhere lower to fail over to, before
+// asking the parent resolver for fresh addresses via cc.ResolveNow. A nil or
+// zero intervalSeconds disables re-resolution on sustained failure.
+func (edsImpl *edsBalancerImpl) updateReResolutionConfig(intervalSeconds *uint32) {
+	var interval time.Duration
+	if intervalSeconds != nil {
+		interval = time.Duration(*intervalSeconds) * time.Second
+	}
+	edsImpl.priorityMu.Lock()
+	edsImpl.reResolveInterval = interval
+	edsImpl.priorityMu.Unlock()
+}
+
+// startDNSReResolution begins periodically re-resolving host on behalf of
+// lid, updating the locality's address set directly in its balancer group
+// child whenever the resolved addresses change, without a full EDS response
+// diff. This is the building block LOGICAL_DNS cluster support needs: such a
+// cluster's endpoints come from a hostname that must be periodically
+// re-resolved, rather than pushed by the control plane via EDS. If lid
+// already has a re-resolver running, it's replaced.
+func (edsImpl *edsBalancerImpl) startDNSReResolution(bgwc *balancerGroupWithConfig, lid pkg.LocalityID, resolve dnsResolveFunc, interval time.Duration) {
+	lidJSON, err := lid.ToString()
+	if err != nil {
+		edsImpl.logger.Errorf("failed to marshal LocalityID: %#v, not starting DNS re-resolution", lid)
+		return
+	}
+	edsImpl.dnsMu.Lock()
+	defer edsImpl.dnsMu.Unlock()
+	if r, ok := edsImpl.dnsReResolvers[lid]; ok {
+		r.stop()
+	}
+	if edsImpl.dnsReResolvers == nil {
+		edsImpl.dnsReResolvers = make(map[pkg.LocalityID]*dnsReResolver)
+	}
+	edsImpl.dnsReResolvers[lid] = newDNSReResolver(resolve, func(addrs []resolver.Address) {
+		bgwc.bg.UpdateClientConnState(lidJSON, balancer.ClientConnState{
+			ResolverState: resolver.State{Addresses: addrs},
+		})
+	}, interval, edsImpl.clock)
+}
+
+// stopDNSReResolution stops the periodic re-resolver started for lid by
+// startDNSReResolution, if any.
+func (edsImpl *edsBalancerImpl) stopDNSReResolution(lid pkg.LocalityID) {
+	edsImpl.dnsMu.Lock()
+	defer edsImpl.dnsMu.Unlock()
+	if r, ok := edsImpl.dnsReResolvers[lid]; ok {
+		r.stop()
+		delete(edsImpl.dnsReResolvers, lid)
+	}
+}
+
 // updateServiceRequestsConfig handles changes to the circuit breaking configuration.
 func (edsImpl *edsBalancerImpl) updateServiceRequestsConfig(serviceName string, max *uint32) {
 	if !env.CircuitBreakingSupport {
@@ -422,7 +1192,11 @@ func (edsImpl *edsBalancerImpl) updateServiceRequestsConfig(serviceName string,
 	edsImpl.pickerMu.Lock()
 	var updatePicker bool
 	if edsImpl.serviceRequestsCounter == nil || edsImpl.serviceRequestsCounter.ServiceName != serviceName {
+		oldCounter := edsImpl.serviceRequestsCounter
 		edsImpl.serviceRequestsCounter = client.GetServiceRequestsCounter(serviceName)
+		if oldCounter != nil {
+			client.ReleaseServiceRequestsCounter(oldCounter)
+		}
 		updatePicker = true
 	}
 
@@ -438,12 +1212,99 @@ func (edsImpl *edsBalancerImpl) updateServiceRequestsConfig(serviceName string,
 		// Update picker with old inner picker, new counter and counterMax.
 		edsImpl.cc.UpdateState(balancer.State{
 			ConnectivityState: edsImpl.innerState.ConnectivityState,
-			Picker:            newDropPicker(edsImpl.innerState.Picker, edsImpl.drops, edsImpl.loadReporter, edsImpl.serviceRequestsCounter, edsImpl.serviceRequestCountMax)},
+			Picker:            edsImpl.wrapPicker(edsImpl.innerState.Picker)},
 		)
 	}
 	edsImpl.pickerMu.Unlock()
 }
 
+// updateGlobalRequestsConfig handles changes to the global (process-wide)
+// circuit breaking configuration. A nil or zero max disables the global
+// limit, leaving only the per-service one (if any) in effect.
+func (edsImpl *edsBalancerImpl) updateGlobalRequestsConfig(max *uint32) {
+	if !env.CircuitBreakingSupport {
+		return
+	}
+	edsImpl.pickerMu.Lock()
+	var updatePicker bool
+	var newMax uint32
+	if max != nil {
+		newMax = *max
+	}
+	if (newMax != 0) != (edsImpl.globalRequestsCounter != nil) {
+		if newMax != 0 {
+			edsImpl.globalRequestsCounter = client.GetGlobalRequestsCounter()
+		} else {
+			edsImpl.globalRequestsCounter = nil
+		}
+		updatePicker = true
+	}
+	if edsImpl.globalRequestCountMax != newMax {
+		edsImpl.globalRequestCountMax = newMax
+		updatePicker = true
+	}
+	if updatePicker && edsImpl.innerState.Picker != nil {
+		// Update picker with old inner picker, new counter and counterMax.
+		edsImpl.cc.UpdateState(balancer.State{
+			ConnectivityState: edsImpl.innerState.ConnectivityState,
+			Picker:            edsImpl.wrapPicker(edsImpl.innerState.Picker)},
+		)
+	}
+	edsImpl.pickerMu.Unlock()
+}
+
+// updateServiceConnectionsConfig handles changes to the max_connections
+// circuit breaking configuration. Unlike updateServiceRequestsConfig, this
+// doesn't affect picking, only SubConn creation, so it locks subConnMu
+// instead of pickerMu and never needs to rewrap the picker.
+func (edsImpl *edsBalancerImpl) updateServiceConnectionsConfig(serviceName string, max *uint32) {
+	if !env.CircuitBreakingSupport {
+		return
+	}
+	edsImpl.subConnMu.Lock()
+	defer edsImpl.subConnMu.Unlock()
+	if edsImpl.serviceConnectionsCounter == nil || edsImpl.serviceConnectionsCounter.ServiceName != serviceName {
+		oldCounter := edsImpl.serviceConnectionsCounter
+		edsImpl.serviceConnectionsCounter = client.GetServiceConnectionsCounter(serviceName)
+		if oldCounter != nil {
+			client.ReleaseServiceConnectionsCounter(oldCounter)
+		}
+	}
+
+	newMax := uint32(defaultServiceConnectionCountMax)
+	if max != nil {
+		newMax = *max
+	}
+	edsImpl.serviceConnectionCountMax = newMax
+}
+
+// wrapPicker wraps p in an affinityPicker when session affinity is
+// configured, then in a faultInjectionPicker when fault injection is
+// configured, then in a dropPicker when drop configs, a load reporter, a
+// circuit breaking counter, or an in-progress drain are actually in play,
+// and returns p as-is otherwise. Skipping the dropPicker wrap avoids the
+// per-pick drop-category loop and Done-callback allocation in the common
+// case where none of that is configured.
+//
+// The atomic.LoadInt32 check on draining only catches a closeWithDrain that
+// raced ahead of this call; one that starts after p is handed to cc (and
+// before the next wrapPicker call) won't retroactively track or reject picks
+// made through the unwrapped p. That's an accepted gap: closeWithDrain is a
+// shutdown-time operation, not a steady-state one, and re-wrapping eagerly
+// for it would defeat the point of this optimization.
+func (edsImpl *edsBalancerImpl) wrapPicker(p balancer.Picker) balancer.Picker {
+	if edsImpl.affinityHeader != "" {
+		p = newAffinityPicker(p, edsImpl)
+	}
+	if edsImpl.faultInjection != nil {
+		p = newFaultInjectionPicker(p, edsImpl.faultInjection)
+	}
+	if len(edsImpl.drops) == 0 && edsImpl.loadReporter == nil && edsImpl.serviceRequestsCounter == nil && edsImpl.globalRequestsCounter == nil && atomic.LoadInt32(&edsImpl.draining) == 0 {
+		return p
+	}
+	return newDropPicker(p, edsImpl.drops, edsImpl.loadReporter, edsImpl.serviceRequestsCounter, edsImpl.serviceRequestCountMax, edsImpl.globalRequestsCounter, edsImpl.globalRequestCountMax, edsImpl.dropStats, edsImpl.queueOnCircuitBreaking, &edsImpl.inFlight, &edsImpl.draining)
+}
+
 // updateState first handles priority, and then wraps picker in a drop picker
 // before forwarding the update.
 func (edsImpl *edsBalancerImpl) updateState(priority priorityType, s balancer.State) {
@@ -453,13 +1314,39 @@ func (edsImpl *edsBalancerImpl) updateState(priority priorityType, s balancer.St
 		return
 	}
 
-	if edsImpl.handlePriorityWithNewState(priority, s) {
+	if !edsImpl.handlePriorityWithNewState(priority, s) {
+		return
+	}
+
+	if s.ConnectivityState == connectivity.Ready {
+		edsImpl.endWarmUp(false)
+	} else if edsImpl.isWarmingUp() {
+		// Record the state for endWarmUp to forward if warmUpTimer fires
+		// before any priority reaches Ready, but don't forward it now:
+		// the parent ClientConn's own pre-UpdateState picker already
+		// queues picks, which is the point of warm-up.
 		edsImpl.pickerMu.Lock()
-		defer edsImpl.pickerMu.Unlock()
 		edsImpl.innerState = s
-		// Don't reset drops when it's a state change.
-		edsImpl.cc.UpdateState(balancer.State{ConnectivityState: s.ConnectivityState, Picker: newDropPicker(s.Picker, edsImpl.drops, edsImpl.loadReporter, edsImpl.serviceRequestsCounter, edsImpl.serviceRequestCountMax)})
+		edsImpl.pickerMu.Unlock()
+		return
 	}
+
+	edsImpl.pushState(s)
+}
+
+// pushState wraps s.Picker and forwards it to cc, recording s in
+// innerState first so a later SubConn state change or warm-up timeout can
+// rewrap and resend the same underlying picker.
+func (edsImpl *edsBalancerImpl) pushState(s balancer.State) {
+	edsImpl.pickerMu.Lock()
+	defer edsImpl.pickerMu.Unlock()
+	edsImpl.innerState = s
+	p := s.Picker
+	if edsImpl.orcaListener != nil {
+		p = newORCAPicker(p, edsImpl)
+	}
+	// Don't reset drops when it's a state change.
+	edsImpl.cc.UpdateState(balancer.State{ConnectivityState: s.ConnectivityState, Picker: edsImpl.wrapPicker(p)})
 }
 
 func (edsImpl *edsBalancerImpl) ccWrapperWithPriority(priority priorityType) *edsBalancerWrapperCC {
@@ -485,13 +1372,47 @@ func (ebwcc *edsBalancerWrapperCC) UpdateState(state balancer.State) {
 	ebwcc.parent.enqueueChildBalancerStateUpdate(ebwcc.priority, state)
 }
 
+// subConnFailureEvent is a structured, machine-readable record of a failed
+// cc.NewSubConn call. It's emitted (via subConnFailureCb) in addition to the
+// existing logger.Warningf call, for operators who want to track SubConn
+// creation failures programmatically, e.g. to alert on repeated address
+// parse errors.
+type subConnFailureEvent struct {
+	// Priority is the priority the failed SubConn would have belonged to.
+	Priority priorityType
+	// Addrs is the address set that was passed to cc.NewSubConn.
+	Addrs []resolver.Address
+	// Err is the error returned by cc.NewSubConn.
+	Err error
+}
+
 func (edsImpl *edsBalancerImpl) newSubConn(priority priorityType, addrs []resolver.Address, opts balancer.NewSubConnOptions) (balancer.SubConn, error) {
+	if edsImpl.healthCheckEnabled {
+		opts.HealthCheckEnabled = true
+	}
+	edsImpl.subConnMu.Lock()
+	counter := edsImpl.serviceConnectionsCounter
+	max := edsImpl.serviceConnectionCountMax
+	edsImpl.subConnMu.Unlock()
+	if counter != nil {
+		if err := counter.StartConnection(max); err != nil {
+			return nil, err
+		}
+	}
 	sc, err := edsImpl.cc.NewSubConn(addrs, opts)
 	if err != nil {
+		if counter != nil {
+			counter.EndConnection()
+		}
+		edsImpl.logger.Warningf("eds: failed to create subconn for addresses %v in priority %v: %v", addrs, priority, err)
+		if edsImpl.subConnFailureCb != nil {
+			edsImpl.subConnFailureCb(subConnFailureEvent{Priority: priority, Addrs: addrs, Err: err})
+		}
 		return nil, err
 	}
 	edsImpl.subConnMu.Lock()
 	edsImpl.subConnToPriority[sc] = priority
+	edsImpl.subConnToAddrs[sc] = addrs
 	edsImpl.subConnMu.Unlock()
 	return sc, nil
 }
@@ -504,6 +1425,172 @@ func (edsImpl *edsBalancerImpl) close() {
 			bg.Close()
 		}
 	}
+	edsImpl.priorityMu.Lock()
+	if timer := edsImpl.reResolveTimer; timer != nil {
+		timer.Stop()
+		edsImpl.reResolveTimer = nil
+	}
+	if timer := edsImpl.warmUpTimer; timer != nil {
+		timer.Stop()
+		edsImpl.warmUpTimer = nil
+	}
+	edsImpl.priorityMu.Unlock()
+	edsImpl.dnsMu.Lock()
+	for lid, r := range edsImpl.dnsReResolvers {
+		r.stop()
+		delete(edsImpl.dnsReResolvers, lid)
+	}
+	edsImpl.dnsMu.Unlock()
+	if edsImpl.serviceRequestsCounter != nil {
+		client.ReleaseServiceRequestsCounter(edsImpl.serviceRequestsCounter)
+		edsImpl.serviceRequestsCounter = nil
+	}
+	if edsImpl.serviceConnectionsCounter != nil {
+		client.ReleaseServiceConnectionsCounter(edsImpl.serviceConnectionsCounter)
+		edsImpl.serviceConnectionsCounter = nil
+	}
+	if edsImpl.loadReporter != nil {
+		edsImpl.loadReporter.Flush()
+	}
+}
+
+// closeWithDrain behaves like close, but gives in-flight RPCs a chance to
+// complete first: it immediately makes dropPicker reject new picks with
+// ErrNoSubConnAvailable (so SubConns keep serving only RPCs already in
+// flight), then waits for those RPCs to finish, up to ctx, before closing
+// the balancer groups as close would.
+func (edsImpl *edsBalancerImpl) closeWithDrain(ctx context.Context) {
+	atomic.StoreInt32(&edsImpl.draining, 1)
+
+	drained := make(chan struct{})
+	go func() {
+		edsImpl.inFlight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+	}
+	edsImpl.close()
+}
+
+// RecomputePriorities forces the eds balancer to synchronously re-run
+// priority selection, as if an EDS response had just been processed. This is
+// useful for recovering from edge cases (e.g. a stuck init timer) that left
+// priorityInUse on a suboptimal priority, without waiting for the next EDS
+// update.
+func (edsImpl *edsBalancerImpl) RecomputePriorities() {
+	edsImpl.handlePriorityChange()
+}
+
+// dropCategoryStats tracks, per OverloadDropConfig category, how many RPCs
+// the eds balancer has dropped. It outlives any single dropPicker, since a
+// picker is recreated every time the drop config or the inner picker
+// changes, but operators need the cumulative counts to confirm a drop policy
+// is firing and at what rate.
+type dropCategoryStats struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+func newDropCategoryStats() *dropCategoryStats {
+	return &dropCategoryStats{counts: make(map[string]uint64)}
+}
+
+func (s *dropCategoryStats) inc(category string) {
+	s.mu.Lock()
+	s.counts[category]++
+	s.mu.Unlock()
+}
+
+// snapshot returns a copy of the current per-category drop counts.
+func (s *dropCategoryStats) snapshot() map[string]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]uint64, len(s.counts))
+	for k, v := range s.counts {
+		out[k] = v
+	}
+	return out
+}
+
+// DropStats returns a snapshot of the number of RPCs dropped by the eds
+// balancer so far, keyed by drop category.
+func (edsImpl *edsBalancerImpl) DropStats() map[string]uint64 {
+	return edsImpl.dropStats.snapshot()
+}
+
+// PriorityInitTimeoutCount returns the number of times priorityInitTimer has
+// fired and forced a failover to the next lower priority so far. A count
+// that keeps climbing relative to uptime is a sign defaultPriorityInitTimeout
+// is too short for how long priorities in this deployment actually take to
+// connect.
+func (edsImpl *edsBalancerImpl) PriorityInitTimeoutCount() uint64 {
+	return atomic.LoadUint64(&edsImpl.priorityInitTimeoutCount)
+}
+
+// EffectiveDropRate returns the aggregate probability, in [0, 1], that a
+// pick is dropped given the currently configured drop categories.
+//
+// Categories are evaluated sequentially by dropPicker.Pick: the first
+// category to "hit" wins and later categories are never consulted for that
+// pick. So a pick survives only if it survives every category in order,
+// giving an effective drop rate of 1 - Π(1 - p_i) rather than a simple sum
+// of the per-category rates.
+func (edsImpl *edsBalancerImpl) EffectiveDropRate() float64 {
+	edsImpl.pickerMu.Lock()
+	dropConfig := edsImpl.dropConfig
+	edsImpl.pickerMu.Unlock()
+
+	survive := 1.0
+	for _, c := range dropConfig {
+		if c.Denominator == 0 {
+			continue
+		}
+		numerator := c.Numerator
+		if numerator > c.Denominator {
+			numerator = c.Denominator
+		}
+		survive *= 1 - float64(numerator)/float64(c.Denominator)
+	}
+	return 1 - survive
+}
+
+// orcaPicker wraps a picker and, for every completed RPC, feeds the ORCA
+// load report (if any) carried in balancer.DoneInfo.ServerLoad to
+// edsImpl.orcaListener. It's a no-op wrapper when orcaListener is unset.
+type orcaPicker struct {
+	p       balancer.Picker
+	edsImpl *edsBalancerImpl
+}
+
+func newORCAPicker(p balancer.Picker, edsImpl *edsBalancerImpl) *orcaPicker {
+	return &orcaPicker{p: p, edsImpl: edsImpl}
+}
+
+func (op *orcaPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	pr, err := op.p.Pick(info)
+	if err != nil {
+		return pr, err
+	}
+	oldDone := pr.Done
+	pr.Done = func(doneInfo balancer.DoneInfo) {
+		if oldDone != nil {
+			oldDone(doneInfo)
+		}
+		report, ok := doneInfo.ServerLoad.(*orcapb.OrcaLoadReport)
+		if !ok {
+			return
+		}
+		op.edsImpl.subConnMu.Lock()
+		addrs := op.edsImpl.subConnToAddrs[pr.SubConn]
+		op.edsImpl.subConnMu.Unlock()
+		if len(addrs) == 0 {
+			return
+		}
+		op.edsImpl.orcaListener.OnLoadReport(addrs[0], report)
+	}
+	return pr, nil
 }
 
 type dropPicker struct {
@@ -512,19 +1599,113 @@ type dropPicker struct {
 	loadStore load.PerClusterReporter
 	counter   *client.ServiceRequestsCounter
 	countMax  uint32
+	// globalCounter and globalCountMax enforce an optional process-wide cap
+	// shared across every xDS-managed cluster, in addition to counter's
+	// per-service one. globalCounter is nil when no global limit is
+	// configured.
+	globalCounter  *client.GlobalRequestsCounter
+	globalCountMax uint32
+	dropStats      *dropCategoryStats
+	// queueOnCircuitBreaking, if set, makes Pick wait for a circuit breaking
+	// slot to free up (bounded by the RPC's context deadline) instead of
+	// immediately rejecting once countMax is reached.
+	queueOnCircuitBreaking bool
+	// inFlight and draining support closeWithDrain: every successful Pick
+	// adds to inFlight until its Done callback fires, and Pick rejects new
+	// RPCs with ErrNoSubConnAvailable once draining is set. Both are nil in
+	// tests that construct a dropPicker directly without them.
+	inFlight *sync.WaitGroup
+	draining *int32
 }
 
-func newDropPicker(p balancer.Picker, drops []*dropper, loadStore load.PerClusterReporter, counter *client.ServiceRequestsCounter, countMax uint32) *dropPicker {
+func newDropPicker(p balancer.Picker, drops []*dropper, loadStore load.PerClusterReporter, counter *client.ServiceRequestsCounter, countMax uint32, globalCounter *client.GlobalRequestsCounter, globalCountMax uint32, dropStats *dropCategoryStats, queueOnCircuitBreaking bool, inFlight *sync.WaitGroup, draining *int32) *dropPicker {
 	return &dropPicker{
-		drops:     drops,
-		p:         p,
-		loadStore: loadStore,
-		counter:   counter,
-		countMax:  countMax,
+		drops:                  drops,
+		p:                      p,
+		loadStore:              loadStore,
+		counter:                counter,
+		countMax:               countMax,
+		globalCounter:          globalCounter,
+		globalCountMax:         globalCountMax,
+		dropStats:              dropStats,
+		queueOnCircuitBreaking: queueOnCircuitBreaking,
+		inFlight:               inFlight,
+		draining:               draining,
+	}
+}
+
+// circuitBreakingQueuePollInterval is how often startRequestOrQueue retries
+// StartRequest while queueing for a circuit breaking slot.
+const circuitBreakingQueuePollInterval = 5 * time.Millisecond
+
+// startAllCounters starts a request against whichever of the per-service and
+// global counters are configured. If the global counter rejects after the
+// per-service one has already accepted, the per-service one is rolled back,
+// so a rejected pick never leaves one counter incremented without the other.
+func (d *dropPicker) startAllCounters() error {
+	if d.counter != nil {
+		if err := d.counter.StartRequest(d.countMax); err != nil {
+			return err
+		}
+	}
+	if d.globalCounter != nil {
+		if err := d.globalCounter.StartRequest(d.globalCountMax); err != nil {
+			if d.counter != nil {
+				d.counter.EndRequest()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// endAllCounters ends a request against whichever of the per-service and
+// global counters are configured. It undoes exactly what a successful
+// startAllCounters did.
+func (d *dropPicker) endAllCounters() {
+	if d.counter != nil {
+		d.counter.EndRequest()
+	}
+	if d.globalCounter != nil {
+		d.globalCounter.EndRequest()
+	}
+}
+
+// startRequestOrQueue calls startAllCounters, and if it fails and queueing is
+// enabled, retries until either a slot frees up or ctx's deadline elapses.
+// It returns the error from the last failed attempt if no slot freed up in
+// time, or if ctx has no deadline to bound the wait by.
+func (d *dropPicker) startRequestOrQueue(ctx context.Context) error {
+	err := d.startAllCounters()
+	if err == nil || !d.queueOnCircuitBreaking {
+		return err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return err
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	ticker := time.NewTicker(circuitBreakingQueuePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return err
+		case <-ctx.Done():
+			return err
+		case <-ticker.C:
+			if err = d.startAllCounters(); err == nil {
+				return nil
+			}
+		}
 	}
 }
 
 func (d *dropPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	if d.draining != nil && atomic.LoadInt32(d.draining) == 1 {
+		return balancer.PickResult{}, balancer.ErrNoSubConnAvailable
+	}
 	var (
 		drop     bool
 		category string
@@ -538,34 +1719,70 @@ func (d *dropPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
 	}
 	if drop {
 		if d.loadStore != nil {
-			d.loadStore.CallDropped(category)
+			d.loadStore.CallDropped(info.Ctx, info.FullMethodName, category)
+		}
+		if d.dropStats != nil {
+			d.dropStats.inc(category)
 		}
 		return balancer.PickResult{}, status.Errorf(codes.Unavailable, "RPC is dropped")
 	}
-	if d.counter != nil {
-		if err := d.counter.StartRequest(d.countMax); err != nil {
+	if d.counter != nil || d.globalCounter != nil {
+		if err := d.startRequestOrQueue(info.Ctx); err != nil {
 			// Drops by circuit breaking are reported with empty category. They
 			// will be reported only in total drops, but not in per category.
 			if d.loadStore != nil {
-				d.loadStore.CallDropped("")
+				d.loadStore.CallDropped(info.Ctx, info.FullMethodName, "")
 			}
 			return balancer.PickResult{}, status.Errorf(codes.Unavailable, err.Error())
 		}
+		// From here on, startAllCounters has succeeded exactly once, so
+		// endAllCounters must be called exactly once too. needEndRequest
+		// tracks whether that responsibility still lives here, or has been
+		// handed off to the Done callback below. The defer guarantees the
+		// counters are never leaked, even if d.p.Pick panics.
+		needEndRequest := true
+		defer func() {
+			if needEndRequest {
+				d.endAllCounters()
+			}
+		}()
 		pr, err := d.p.Pick(info)
 		if err != nil {
-			d.counter.EndRequest()
 			return pr, err
 		}
+		needEndRequest = false
 		oldDone := pr.Done
 		pr.Done = func(doneInfo balancer.DoneInfo) {
-			d.counter.EndRequest()
+			d.endAllCounters()
 			if oldDone != nil {
 				oldDone(doneInfo)
 			}
 		}
-		return pr, err
+		return d.trackInFlight(pr), nil
 	}
 	// TODO: (eds) don't drop unless the inner picker is READY. Similar to
 	// https://github.com/grpc/grpc-go/issues/2622.
-	return d.p.Pick(info)
+	pr, err := d.p.Pick(info)
+	if err != nil {
+		return pr, err
+	}
+	return d.trackInFlight(pr), nil
+}
+
+// trackInFlight, if d.inFlight is set, adds pr to it and wraps pr.Done to
+// remove it once the RPC completes, so closeWithDrain can wait for
+// outstanding RPCs before tearing down SubConns.
+func (d *dropPicker) trackInFlight(pr balancer.PickResult) balancer.PickResult {
+	if d.inFlight == nil {
+		return pr
+	}
+	d.inFlight.Add(1)
+	oldDone := pr.Done
+	pr.Done = func(doneInfo balancer.DoneInfo) {
+		d.inFlight.Done()
+		if oldDone != nil {
+			oldDone(doneInfo)
+		}
+	}
+	return pr
 }
@@ -0,0 +1,172 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package edsbalancer
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/xds/pkg/testutils"
+)
+
+// bigLocalityAddrs returns n distinct endpoint addresses, for tests that
+// need a locality too large to fit in one subConnBatchSize batch.
+func bigLocalityAddrs(n int) []string {
+	addrs := make([]string, n)
+	for i := range addrs {
+		addrs[i] = fmt.Sprintf("10.0.%d.%d:8080", i/256, i%256)
+	}
+	return addrs
+}
+
+// TestUpdateLocalityAddrsBatchingDefersSubConnCreation verifies that, once a
+// batch size is configured, a locality update larger than it doesn't create
+// any SubConns synchronously within handleEDSResponse: they're created only
+// as processLocalityBatch drains pendingLocalityBatches, in batch-sized
+// groups.
+func (s) TestUpdateLocalityAddrsBatchingDefersSubConnCreation(t *testing.T) {
+	const batchSize = 3
+	addrs := bigLocalityAddrs(7)
+
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.updateSubConnBatchSize(batchSize)
+
+	clab := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab.AddLocality(testSubZones[0], 1, 0, addrs, nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab.Build()))
+
+	select {
+	case sc := <-cc.NewSubConnCh:
+		t.Fatalf("NewSubConn called synchronously during handleEDSResponse, for %v, want none until processLocalityBatch drains the queue", sc)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// Drain the queue the way edsBalancer.run() would, and confirm SubConns
+	// show up in batchSize-sized groups (2 full batches, then 1 remainder).
+	wantBatches := []int{batchSize, batchSize, len(addrs) - 2*batchSize}
+	for i, want := range wantBatches {
+		select {
+		case item := <-edsb.pendingLocalityBatches().Get():
+			edsb.pendingLocalityBatches().Load()
+			edsb.processLocalityBatch(item)
+		case <-time.After(time.Second):
+			t.Fatalf("batch %d: timed out waiting for a pending locality batch", i)
+		}
+		for j := 0; j < want; j++ {
+			select {
+			case <-cc.NewSubConnCh:
+			case <-time.After(time.Second):
+				t.Fatalf("batch %d: timed out waiting for NewSubConn %d/%d", i, j, want)
+			}
+		}
+	}
+
+	select {
+	case sc := <-cc.NewSubConnCh:
+		t.Fatalf("got unexpected extra NewSubConn(%v) after all batches drained", sc)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+// TestUpdateLocalityAddrsBatchingOtherLocalitiesNotStarved verifies that a
+// huge locality, subject to batching, doesn't prevent a small locality
+// processed right after it within the same handleEDSResponse call (e.g. a
+// second locality in the same priority) from getting its SubConn created
+// right away, instead of waiting for the huge locality's batches to drain.
+func (s) TestUpdateLocalityAddrsBatchingOtherLocalitiesNotStarved(t *testing.T) {
+	const batchSize = 4
+	bigAddrs := bigLocalityAddrs(50)
+
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.updateSubConnBatchSize(batchSize)
+
+	clab := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab.AddLocality(testSubZones[0], 1, 0, bigAddrs, nil)              // huge, batched.
+	clab.AddLocality(testSubZones[1], 1, 0, testEndpointAddrs[:1], nil) // small, processed right after.
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab.Build()))
+
+	// The second locality's single SubConn is created synchronously within
+	// handleEDSResponse, without waiting for any of the first locality's
+	// pending batches to drain.
+	select {
+	case <-cc.NewSubConnCh:
+	case <-time.After(time.Second):
+		t.Fatalf("the small locality's SubConn was not created synchronously; it appears to have been starved by the huge locality's batching")
+	}
+
+	select {
+	case sc := <-cc.NewSubConnCh:
+		t.Fatalf("got an unexpected second NewSubConn(%v) before any batch was drained", sc)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+// countingClientConn is a minimal balancer.ClientConn that counts SubConns
+// created instead of funneling them through a bounded channel, so a
+// benchmark can push far more addresses through it than
+// testutils.TestClientConn's channels would buffer without a reader.
+type countingClientConn struct {
+	balancer.ClientConn
+	newSubConns int32
+}
+
+func (c *countingClientConn) NewSubConn([]resolver.Address, balancer.NewSubConnOptions) (balancer.SubConn, error) {
+	atomic.AddInt32(&c.newSubConns, 1)
+	return &testutils.TestSubConn{}, nil
+}
+
+func (c *countingClientConn) UpdateAddresses(balancer.SubConn, []resolver.Address) {}
+
+func (c *countingClientConn) RemoveSubConn(balancer.SubConn) {}
+
+func (c *countingClientConn) UpdateState(balancer.State) {}
+
+// BenchmarkHandleEDSResponsePerPriorityLargeLocality measures the cost of a
+// single handleEDSResponse call for one large locality, with batching
+// disabled (the whole address list applied, and every SubConn created,
+// synchronously) versus enabled (the address list, being longer than the
+// batch size, is only queued for the run loop, and no SubConn is created
+// before returning).
+func BenchmarkHandleEDSResponsePerPriorityLargeLocality(b *testing.B) {
+	addrs := bigLocalityAddrs(2000)
+	clab := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab.AddLocality(testSubZones[0], 1, 0, addrs, nil)
+	update := parseEDSRespProtoForTesting(clab.Build())
+
+	b.Run("Unbatched", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			edsb := newEDSBalancerImpl(&countingClientConn{}, balancer.BuildOptions{}, nil, nil, nil, nil)
+			edsb.handleEDSResponse(update)
+		}
+	})
+
+	b.Run("Batched", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			edsb := newEDSBalancerImpl(&countingClientConn{}, balancer.BuildOptions{}, nil, nil, nil, nil)
+			edsb.updateSubConnBatchSize(50)
+			edsb.handleEDSResponse(update)
+		}
+	})
+}
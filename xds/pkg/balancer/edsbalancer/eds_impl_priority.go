@@ -20,14 +20,134 @@ package edsbalancer
 import (
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/base"
 	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/resolver"
 )
 
-var errAllPrioritiesRemoved = errors.New("eds: no locality is provided, all priorities are removed")
+// ErrAllPrioritiesRemoved is the error returned by the picker installed on
+// cc when the latest EDS response (or, for the very first response, the lack
+// of any locality in it) leaves no priority at all. It's exported so RPC
+// callers can use errors.Is to distinguish this condition from other
+// Unavailable errors.
+var ErrAllPrioritiesRemoved = errors.New("eds: no locality is provided, all priorities are removed")
+
+// priorityChangeReason is a machine-readable description of why
+// priorityInUse was switched, reported alongside the existing
+// logger.Infof calls via priorityChangeCb.
+type priorityChangeReason string
+
+const (
+	// priorityChangeReasonInit is reported when priorityInUse is set for the
+	// first time, i.e. on the first EDS response with at least one locality.
+	priorityChangeReasonInit priorityChangeReason = "init"
+	// priorityChangeReasonDeleted is reported when priorityInUse was removed
+	// by the latest EDS response, and the new lowest priority takes over.
+	priorityChangeReasonDeleted priorityChangeReason = "deleted"
+	// priorityChangeReasonNewLowestAdded is reported when priorityInUse isn't
+	// Ready, and a newly added lower priority is started to take over.
+	priorityChangeReasonNewLowestAdded priorityChangeReason = "new-lowest-added"
+	// priorityChangeReasonInitTimeout is reported when a priority fails to
+	// reach Ready or TransientFailure before its init timer fires, causing
+	// the next lower priority to be started.
+	priorityChangeReasonInitTimeout priorityChangeReason = "init-timeout"
+	// priorityChangeReasonWentDown is reported when priorityInUse moves out
+	// of Ready (to TransientFailure, or Connecting from Ready), causing the
+	// next lower priority to be started.
+	priorityChangeReasonWentDown priorityChangeReason = "went-down"
+	// priorityChangeReasonWentReady is reported when a priority higher than
+	// priorityInUse becomes Ready and takes over.
+	priorityChangeReasonWentReady priorityChangeReason = "went-ready"
+	// priorityChangeReasonAllRemoved is reported when the latest EDS response
+	// (or, for the very first response, the lack of any locality in it)
+	// leaves no priority at all, and the eds impl installs the transient
+	// failure picker returning ErrAllPrioritiesRemoved.
+	priorityChangeReasonAllRemoved priorityChangeReason = "all-removed"
+	// priorityChangeReasonPinned is reported when PinPriority forces
+	// priorityInUse to the pinned priority, overriding normal selection.
+	priorityChangeReasonPinned priorityChangeReason = "pinned"
+)
+
+// PinPriority overrides the normal health-based priority selection, forcing
+// priorityInUse to p regardless of the connectivity state of p or any higher
+// priority, until UnpinPriority is called. It's meant for canarying a
+// specific (typically low) priority in a controlled rollout or test.
+//
+// If p doesn't currently exist (e.g. the next EDS response hasn't added it
+// yet), the pin takes effect the next time handlePriorityChange sees it.
+func (edsImpl *edsBalancerImpl) PinPriority(p uint32) {
+	edsImpl.priorityMu.Lock()
+	defer edsImpl.priorityMu.Unlock()
+	pinned := newPriorityType(p)
+	edsImpl.pinnedPriority = pinned
+	edsImpl.logger.Infof("eds: pinning priority to %v", pinned)
+	edsImpl.switchToPinnedPriorityLocked()
+}
+
+// UnpinPriority removes a pin installed by PinPriority, resuming normal
+// health-based priority selection. If no priority is pinned, this is a no-op.
+func (edsImpl *edsBalancerImpl) UnpinPriority() {
+	edsImpl.priorityMu.Lock()
+	if !edsImpl.pinnedPriority.isSet() {
+		edsImpl.priorityMu.Unlock()
+		return
+	}
+	edsImpl.pinnedPriority = newPriorityTypeUnset()
+	edsImpl.logger.Infof("eds: unpinning priority, resuming normal failover")
+	edsImpl.priorityMu.Unlock()
+	edsImpl.handlePriorityChange()
+}
+
+// switchToPinnedPriorityLocked starts pinnedPriority if it already exists and
+// isn't priorityInUse. If pinnedPriority doesn't exist yet, it's a no-op:
+// handlePriorityChange applies the pin once EDS adds it.
+//
+// Caller must hold priorityMu.
+func (edsImpl *edsBalancerImpl) switchToPinnedPriorityLocked() {
+	pinned := edsImpl.pinnedPriority
+	if _, ok := edsImpl.priorityToLocalities[pinned]; !ok {
+		return
+	}
+	if edsImpl.priorityInUse.equal(pinned) {
+		return
+	}
+	old := edsImpl.priorityInUse
+	edsImpl.logger.Infof("Switching priority from %v to %v, because it was pinned", old, pinned)
+	if old.isSet() {
+		edsImpl.notifyPriorityChange(old, false, priorityChangeReasonPinned)
+	}
+	edsImpl.notifyPriorityChange(pinned, true, priorityChangeReasonPinned)
+	edsImpl.startPriority(pinned)
+}
+
+// priorityChangeEvent is a structured, machine-readable record of a
+// priorityInUse transition. It's emitted (via priorityChangeCb) in addition
+// to the existing logger.Infof calls, for operators who want to track
+// failovers programmatically.
+type priorityChangeEvent struct {
+	// Priority is the priority entering or exiting use.
+	Priority priorityType
+	// Entered is true if Priority became priorityInUse, false if it stopped
+	// being priorityInUse.
+	Entered bool
+	// Reason describes why the transition happened.
+	Reason priorityChangeReason
+}
+
+// notifyPriorityChange invokes priorityChangeCb, if set, with a
+// priorityChangeEvent for Priority.
+//
+// Caller must hold priorityMu.
+func (edsImpl *edsBalancerImpl) notifyPriorityChange(priority priorityType, entered bool, reason priorityChangeReason) {
+	if edsImpl.priorityChangeCb == nil {
+		return
+	}
+	edsImpl.priorityChangeCb(priorityChangeEvent{Priority: priority, Entered: entered, Reason: reason})
+}
 
 // handlePriorityChange handles priority after EDS adds/removes a
 // priority.
@@ -45,8 +165,20 @@ func (edsImpl *edsBalancerImpl) handlePriorityChange() {
 	edsImpl.priorityMu.Lock()
 	defer edsImpl.priorityMu.Unlock()
 
+	if edsImpl.pinnedPriority.isSet() {
+		edsImpl.switchToPinnedPriorityLocked()
+		if _, ok := edsImpl.priorityToLocalities[edsImpl.pinnedPriority]; ok {
+			// The pin applies; don't let the normal selection below move
+			// priorityInUse away from it.
+			return
+		}
+		// The pinned priority doesn't exist yet: fall through to normal
+		// selection until EDS adds it.
+	}
+
 	// Everything was removed by EDS.
 	if !edsImpl.priorityLowest.isSet() {
+		oldPriorityInUse := edsImpl.priorityInUse
 		edsImpl.priorityInUse = newPriorityTypeUnset()
 		// Stop the init timer. This can happen if the only priority is removed
 		// shortly after it's added.
@@ -54,13 +186,17 @@ func (edsImpl *edsBalancerImpl) handlePriorityChange() {
 			timer.Stop()
 			edsImpl.priorityInitTimer = nil
 		}
-		edsImpl.cc.UpdateState(balancer.State{ConnectivityState: connectivity.TransientFailure, Picker: base.NewErrPicker(errAllPrioritiesRemoved)})
+		edsImpl.cc.UpdateState(balancer.State{ConnectivityState: connectivity.TransientFailure, Picker: base.NewErrPicker(ErrAllPrioritiesRemoved)})
+		if oldPriorityInUse.isSet() {
+			edsImpl.notifyPriorityChange(oldPriorityInUse, false, priorityChangeReasonAllRemoved)
+		}
 		return
 	}
 
 	// priorityInUse wasn't set, use 0.
 	if !edsImpl.priorityInUse.isSet() {
 		edsImpl.logger.Infof("Switching priority from unset to %v", 0)
+		edsImpl.notifyPriorityChange(newPriorityType(0), true, priorityChangeReasonInit)
 		edsImpl.startPriority(newPriorityType(0))
 		return
 	}
@@ -69,7 +205,10 @@ func (edsImpl *edsBalancerImpl) handlePriorityChange() {
 	if _, ok := edsImpl.priorityToLocalities[edsImpl.priorityInUse]; !ok {
 		oldP := edsImpl.priorityInUse
 		edsImpl.priorityInUse = edsImpl.priorityLowest
+		edsImpl.priorityInitBackoff = 0
 		edsImpl.logger.Infof("Switching priority from %v to %v, because former was deleted", oldP, edsImpl.priorityInUse)
+		edsImpl.notifyPriorityChange(oldP, false, priorityChangeReasonDeleted)
+		edsImpl.notifyPriorityChange(edsImpl.priorityLowest, true, priorityChangeReasonDeleted)
 		if s, ok := edsImpl.priorityToState[edsImpl.priorityLowest]; ok {
 			edsImpl.cc.UpdateState(*s)
 		} else {
@@ -91,6 +230,8 @@ func (edsImpl *edsBalancerImpl) handlePriorityChange() {
 		pNext := edsImpl.priorityInUse.nextLower()
 		if _, ok := edsImpl.priorityToLocalities[pNext]; ok {
 			edsImpl.logger.Infof("Switching priority from %v to %v, because latter was added, and former wasn't Ready")
+			edsImpl.notifyPriorityChange(edsImpl.priorityInUse, false, priorityChangeReasonNewLowestAdded)
+			edsImpl.notifyPriorityChange(pNext, true, priorityChangeReasonNewLowestAdded)
 			edsImpl.startPriority(pNext)
 		}
 	}
@@ -103,6 +244,11 @@ func (edsImpl *edsBalancerImpl) handlePriorityChange() {
 // must be non-nil.
 func (edsImpl *edsBalancerImpl) startPriority(priority priorityType) {
 	edsImpl.priorityInUse = priority
+	edsImpl.priorityInitBackoff = 0
+	if edsImpl.warmUp && !edsImpl.warmingUp && !edsImpl.warmUpDone {
+		edsImpl.warmingUp = true
+		edsImpl.warmUpTimer = edsImpl.clock.NewTimer(defaultWarmUpTimeout, func() { edsImpl.endWarmUp(true) })
+	}
 	p := edsImpl.priorityToLocalities[priority]
 	// NOTE: this will eventually send addresses to sub-balancers. If the
 	// sub-balancer tries to update picker, it will result in a deadlock on
@@ -112,6 +258,16 @@ func (edsImpl *edsBalancerImpl) startPriority(priority priorityType) {
 	// into its own, this asynchronous state handling needs to be copied.
 	p.stateAggregator.Start()
 	p.bg.Start()
+	if len(p.configs) == 0 {
+		// This priority has no localities at all (e.g. every one of them had
+		// weight 0 and was filtered out by handleEDSResponse). Nothing will
+		// ever call back through stateAggregator to report a state, so
+		// report the TransientFailure this priority actually represents
+		// directly on cc, mirroring how the ErrAllPrioritiesRemoved case
+		// above does it: calling back through the priority state machine
+		// here, while priorityMu is still held, would deadlock.
+		edsImpl.cc.UpdateState(balancer.State{ConnectivityState: connectivity.TransientFailure, Picker: base.NewErrPicker(balancer.ErrTransientFailure)})
+	}
 	// startPriority can be called when
 	// 1. first EDS resp, start p0
 	// 2. a high priority goes Failure, start next
@@ -119,15 +275,23 @@ func (edsImpl *edsBalancerImpl) startPriority(priority priorityType) {
 	//
 	// In all the cases, the existing init timer is either closed, also already
 	// expired. There's no need to close the old timer.
-	edsImpl.priorityInitTimer = time.AfterFunc(defaultPriorityInitTimeout, func() {
+	edsImpl.priorityInitTimer = edsImpl.clock.NewTimer(defaultPriorityInitTimeout, func() {
 		edsImpl.priorityMu.Lock()
 		defer edsImpl.priorityMu.Unlock()
 		if !edsImpl.priorityInUse.isSet() || !edsImpl.priorityInUse.equal(priority) {
 			return
 		}
 		edsImpl.priorityInitTimer = nil
+		if edsImpl.pinnedPriority.isSet() {
+			// Don't fail over away from a pinned priority just because it's
+			// slow to connect.
+			return
+		}
 		pNext := priority.nextLower()
 		if _, ok := edsImpl.priorityToLocalities[pNext]; ok {
+			atomic.AddUint64(&edsImpl.priorityInitTimeoutCount, 1)
+			edsImpl.notifyPriorityChange(priority, false, priorityChangeReasonInitTimeout)
+			edsImpl.notifyPriorityChange(pNext, true, priorityChangeReasonInitTimeout)
 			edsImpl.startPriority(pNext)
 		}
 	})
@@ -144,6 +308,13 @@ func (edsImpl *edsBalancerImpl) handlePriorityWithNewState(priority priorityType
 		return false
 	}
 
+	if edsImpl.pinnedPriority.isSet() && !priority.equal(edsImpl.pinnedPriority) {
+		// A priority is pinned: ignore updates from any other priority so
+		// they can't trigger failover away from the pin.
+		edsImpl.logger.Infof("eds: ignoring picker update from priority %v, priority %v is pinned", priority, edsImpl.pinnedPriority)
+		return false
+	}
+
 	if edsImpl.priorityInUse.higherThan(priority) {
 		// Lower priorities should all be closed, this is an unexpected update.
 		edsImpl.logger.Infof("eds: received picker update from priority lower then priorityInUse")
@@ -158,7 +329,16 @@ func (edsImpl *edsBalancerImpl) handlePriorityWithNewState(priority priorityType
 	oldState := bState.ConnectivityState
 	*bState = s
 
-	switch s.ConnectivityState {
+	effectiveState := s.ConnectivityState
+	if effectiveState == connectivity.Ready && edsImpl.belowMinHealthyPercentageLocked(priority) {
+		// priority is technically Ready, but Envoy's panic threshold applies:
+		// too few of its localities are healthy to trust it. Treat it like
+		// TransientFailure so the usual failover (and, if priority is
+		// priorityInUse, the usual backoff-vs-immediate choice) applies.
+		effectiveState = connectivity.TransientFailure
+	}
+
+	switch effectiveState {
 	case connectivity.Ready:
 		return edsImpl.handlePriorityWithNewStateReady(priority)
 	case connectivity.TransientFailure:
@@ -171,6 +351,35 @@ func (edsImpl *edsBalancerImpl) handlePriorityWithNewState(priority priorityType
 	}
 }
 
+// belowMinHealthyPercentageLocked reports whether priority's weighted
+// healthy (Ready) fraction, computed the same way as
+// localityWeightStateSnapshot, has fallen below minHealthyPercentage.
+// minHealthyPercentage of zero disables the check. If priority has no
+// weighted localities at all, there's nothing to compute, so it reports
+// false rather than spuriously panicking.
+//
+// Caller must hold priorityMu.
+func (edsImpl *edsBalancerImpl) belowMinHealthyPercentageLocked(priority priorityType) bool {
+	if edsImpl.minHealthyPercentage == 0 {
+		return false
+	}
+	bgwc, ok := edsImpl.priorityToLocalities[priority]
+	if !ok {
+		return false
+	}
+	var totalWeight, healthyWeight uint64
+	for _, ws := range bgwc.stateAggregator.Snapshot() {
+		totalWeight += uint64(ws.Weight)
+		if ws.State == connectivity.Ready {
+			healthyWeight += uint64(ws.Weight)
+		}
+	}
+	if totalWeight == 0 {
+		return false
+	}
+	return healthyWeight*100 < totalWeight*uint64(edsImpl.minHealthyPercentage)
+}
+
 // handlePriorityWithNewStateReady handles state Ready and decides whether to
 // forward update or not.
 //
@@ -179,6 +388,7 @@ func (edsImpl *edsBalancerImpl) handlePriorityWithNewState(priority priorityType
 //   - Forward the update
 //   - Set the priority as priorityInUse
 //   - Close all priorities lower than this one
+//
 // - If it's from priorityInUse:
 //   - Forward and do nothing else
 //
@@ -193,9 +403,18 @@ func (edsImpl *edsBalancerImpl) handlePriorityWithNewStateReady(priority priorit
 		timer.Stop()
 		edsImpl.priorityInitTimer = nil
 	}
+	edsImpl.priorityInitBackoff = 0
+	// A priority is healthy again: whatever prompted armReResolveTimerLocked
+	// no longer applies.
+	if timer := edsImpl.reResolveTimer; timer != nil {
+		timer.Stop()
+		edsImpl.reResolveTimer = nil
+	}
 
 	if edsImpl.priorityInUse.lowerThan(priority) {
 		edsImpl.logger.Infof("Switching priority from %v to %v, because latter became Ready", edsImpl.priorityInUse, priority)
+		edsImpl.notifyPriorityChange(edsImpl.priorityInUse, false, priorityChangeReasonWentReady)
+		edsImpl.notifyPriorityChange(priority, true, priorityChangeReasonWentReady)
 		edsImpl.priorityInUse = priority
 		for i := priority.nextLower(); !i.lowerThan(edsImpl.priorityLowest); i = i.nextLower() {
 			bgwc := edsImpl.priorityToLocalities[i]
@@ -213,13 +432,14 @@ func (edsImpl *edsBalancerImpl) handlePriorityWithNewStateReady(priority priorit
 // An update with state Failure:
 // - If it's from a higher priority:
 //   - Do not forward, and do nothing
+//
 // - If it's from priorityInUse:
 //   - If there's no lower:
-//     - Forward and do nothing else
+//   - Forward and do nothing else
 //   - If there's a lower priority:
-//     - Forward
-//     - Set lower as priorityInUse
-//     - Start lower
+//   - Forward
+//   - Set lower as priorityInUse
+//   - Start lower
 //
 // Caller must make sure priorityInUse is not higher than priority.
 //
@@ -228,26 +448,154 @@ func (edsImpl *edsBalancerImpl) handlePriorityWithNewStateTransientFailure(prior
 	if edsImpl.priorityInUse.lowerThan(priority) {
 		return false
 	}
-	// priorityInUse sends a failure. Stop its init timer.
-	if timer := edsImpl.priorityInitTimer; timer != nil {
-		timer.Stop()
-		edsImpl.priorityInitTimer = nil
+	if edsImpl.pinnedPriority.isSet() {
+		// Forward the failure picker, but don't fail over away from the pin.
+		if timer := edsImpl.priorityInitTimer; timer != nil {
+			timer.Stop()
+			edsImpl.priorityInitTimer = nil
+		}
+		return true
 	}
 	pNext := priority.nextLower()
 	if _, okNext := edsImpl.priorityToLocalities[pNext]; !okNext {
+		// priorityInUse sends a failure, and there's no lower priority to
+		// fail over to. Stop its init timer, if any, and ask the parent
+		// resolver for fresh addresses if the failure persists.
+		if timer := edsImpl.priorityInitTimer; timer != nil {
+			timer.Stop()
+			edsImpl.priorityInitTimer = nil
+		}
+		edsImpl.armReResolveTimerLocked()
+		return true
+	}
+	if edsImpl.priorityFailoverBackoffEnabled {
+		timeout := defaultPriorityInitTimeout
+		if edsImpl.priorityInitTimer == nil {
+			// Neither the init timer nor a grace window is running for this
+			// priority (e.g. it was Ready before this failure): instead of
+			// failing over immediately, give it a bounded grace window.
+			edsImpl.priorityInitBackoff = 0
+		} else {
+			// priority is reporting TransientFailure before its init timer
+			// or previous grace window elapsed, i.e. it's flapping
+			// rather than simply stuck. Reward that sign of progress with a
+			// longer (bounded) window instead of failing over right away.
+			edsImpl.priorityInitBackoff++
+			for i := 0; i < edsImpl.priorityInitBackoff && timeout < defaultPriorityInitMaxBackoff; i++ {
+				timeout *= time.Duration(defaultPriorityInitBackoffMultiplier)
+			}
+			if timeout > defaultPriorityInitMaxBackoff {
+				timeout = defaultPriorityInitMaxBackoff
+			}
+		}
+		edsImpl.armPriorityFailoverTimer(priority, pNext, timeout)
 		return true
 	}
+	// priorityInUse sends a failure. Stop its init timer.
+	if timer := edsImpl.priorityInitTimer; timer != nil {
+		timer.Stop()
+		edsImpl.priorityInitTimer = nil
+	}
 	edsImpl.logger.Infof("Switching priority from %v to %v, because former became TransientFailure", priority, pNext)
+	edsImpl.notifyPriorityChange(priority, false, priorityChangeReasonWentDown)
+	edsImpl.notifyPriorityChange(pNext, true, priorityChangeReasonWentDown)
 	edsImpl.startPriority(pNext)
 	return true
 }
 
+// armPriorityFailoverTimer (re)arms the timer that fails priority over to
+// pNext after timeout, unless priority reaches Ready, or is superseded,
+// before it fires. It reuses priorityInitTimer, so the existing handling
+// that stops that timer on Ready or on a priority change applies here
+// unchanged.
+//
+// Caller must hold priorityMu.
+func (edsImpl *edsBalancerImpl) armPriorityFailoverTimer(priority, pNext priorityType, timeout time.Duration) {
+	if timer := edsImpl.priorityInitTimer; timer != nil {
+		timer.Stop()
+	}
+	edsImpl.priorityInitTimer = edsImpl.clock.NewTimer(timeout, func() {
+		edsImpl.priorityMu.Lock()
+		defer edsImpl.priorityMu.Unlock()
+		if !edsImpl.priorityInUse.isSet() || !edsImpl.priorityInUse.equal(priority) {
+			return
+		}
+		edsImpl.priorityInitTimer = nil
+		atomic.AddUint64(&edsImpl.priorityInitTimeoutCount, 1)
+		edsImpl.logger.Infof("Switching priority from %v to %v, because former became TransientFailure", priority, pNext)
+		edsImpl.notifyPriorityChange(priority, false, priorityChangeReasonWentDown)
+		edsImpl.notifyPriorityChange(pNext, true, priorityChangeReasonWentDown)
+		edsImpl.startPriority(pNext)
+	})
+}
+
+// armReResolveTimerLocked starts reResolveTimer if re-resolution on
+// sustained failure is enabled (edsImpl.reResolveInterval > 0) and it isn't
+// running already. Once it fires, it asks the parent resolver for fresh
+// addresses via cc.ResolveNow; it's stopped early if any priority reaches
+// Ready first (handlePriorityWithNewStateReady).
+//
+// Caller must hold priorityMu.
+func (edsImpl *edsBalancerImpl) armReResolveTimerLocked() {
+	if edsImpl.reResolveInterval <= 0 || edsImpl.reResolveTimer != nil {
+		return
+	}
+	edsImpl.reResolveTimer = edsImpl.clock.NewTimer(edsImpl.reResolveInterval, func() {
+		edsImpl.priorityMu.Lock()
+		edsImpl.reResolveTimer = nil
+		edsImpl.priorityMu.Unlock()
+		edsImpl.cc.ResolveNow(resolver.ResolveNowOptions{})
+	})
+}
+
+// isWarmingUp reports whether updateState should currently hold back
+// forwarding a non-Ready state, per warmingUp.
+func (edsImpl *edsBalancerImpl) isWarmingUp() bool {
+	edsImpl.priorityMu.Lock()
+	defer edsImpl.priorityMu.Unlock()
+	return edsImpl.warmingUp
+}
+
+// endWarmUp stops holding back picker updates, started by startPriority
+// arming warmUpTimer. It's called either by updateState as soon as a
+// priority reaches Ready (forward is false: updateState forwards that
+// Ready state itself right after, same as if warm-up had never been
+// enabled), or by warmUpTimer firing (forward is true: nothing else will
+// forward the most recently computed state, so endWarmUp does).
+func (edsImpl *edsBalancerImpl) endWarmUp(forward bool) {
+	edsImpl.priorityMu.Lock()
+	if !edsImpl.warmingUp {
+		edsImpl.priorityMu.Unlock()
+		return
+	}
+	edsImpl.warmingUp = false
+	edsImpl.warmUpDone = true
+	if timer := edsImpl.warmUpTimer; timer != nil {
+		timer.Stop()
+		edsImpl.warmUpTimer = nil
+	}
+	edsImpl.priorityMu.Unlock()
+	if !forward {
+		return
+	}
+	edsImpl.pickerMu.Lock()
+	s := edsImpl.innerState
+	edsImpl.pickerMu.Unlock()
+	if s.Picker == nil {
+		// warmUpTimer fired before any priority reported a state at all;
+		// nothing to forward.
+		return
+	}
+	edsImpl.pushState(s)
+}
+
 // handlePriorityWithNewStateConnecting handles state Connecting and decides
 // whether to forward update or not.
 //
 // An update with state Connecting:
 // - If it's from a higher priority
 //   - Do nothing
+//
 // - If it's from priorityInUse, the behavior depends on previous state.
 //
 // When new state is Connecting, the behavior depends on previous state. If the
@@ -274,11 +622,17 @@ func (edsImpl *edsBalancerImpl) handlePriorityWithNewStateConnecting(priority pr
 
 	switch oldState {
 	case connectivity.Ready:
+		if edsImpl.pinnedPriority.isSet() {
+			// Forward, but don't fail over away from the pin.
+			return true
+		}
 		pNext := priority.nextLower()
 		if _, okNext := edsImpl.priorityToLocalities[pNext]; !okNext {
 			return true
 		}
 		edsImpl.logger.Infof("Switching priority from %v to %v, because former became Connecting from Ready", priority, pNext)
+		edsImpl.notifyPriorityChange(priority, false, priorityChangeReasonWentDown)
+		edsImpl.notifyPriorityChange(pNext, true, priorityChangeReasonWentDown)
 		edsImpl.startPriority(pNext)
 		return true
 	case connectivity.Idle:
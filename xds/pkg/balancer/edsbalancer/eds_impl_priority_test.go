@@ -19,6 +19,9 @@ package edsbalancer
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -26,6 +29,8 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/internal/grpclog"
+	xdsclient "google.golang.org/grpc/xds/pkg/client"
 	"google.golang.org/grpc/xds/pkg/testutils"
 )
 
@@ -35,7 +40,7 @@ import (
 // Init 0 and 1; 0 is up, use 0; add 2, use 0; remove 2, use 0.
 func (s) TestEDSPriority_HighPriorityReady(t *testing.T) {
 	cc := testutils.NewTestClientConn(t)
-	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
 	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
 
 	// Two localities, with priorities [0, 1], each with one backend.
@@ -101,7 +106,7 @@ func (s) TestEDSPriority_HighPriorityReady(t *testing.T) {
 // down, use 2; remove 2, use 1.
 func (s) TestEDSPriority_SwitchPriority(t *testing.T) {
 	cc := testutils.NewTestClientConn(t)
-	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
 	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
 
 	// Two localities, with priorities [0, 1], each with one backend.
@@ -203,12 +208,166 @@ func (s) TestEDSPriority_SwitchPriority(t *testing.T) {
 	}
 }
 
+// TestEDSPriority_Pin covers PinPriority/UnpinPriority: pinning priority 1
+// should force traffic there even though priority 0 is Ready, and a
+// TransientFailure from 0 while pinned should not trigger normal failover
+// bookkeeping; unpinning resumes normal selection, which keeps priority 1 in
+// use since it's Ready, without creating any new SubConn.
+func (s) TestEDSPriority_Pin(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	// Two localities, with priorities [0, 1], each with one backend.
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	clab1.AddLocality(testSubZones[1], 1, 1, testEndpointAddrs[1:2], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+
+	<-cc.NewSubConnAddrsCh
+	sc0 := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc0, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc0, connectivity.Ready)
+
+	// p0 is Ready and in use.
+	p0 := <-cc.NewPickerCh
+	if err := testutils.IsRoundRobin([]balancer.SubConn{sc0}, subConnFromPicker(p0)); err != nil {
+		t.Fatalf("want %v, got %v", []balancer.SubConn{sc0}, err)
+	}
+
+	// Pin priority 1: even though p0 is Ready, traffic should move to p1.
+	edsb.PinPriority(1)
+	addrs1 := <-cc.NewSubConnAddrsCh
+	if got, want := addrs1[0].Addr, testEndpointAddrs[1]; got != want {
+		t.Fatalf("sc is created with addr %v, want %v", got, want)
+	}
+	sc1 := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc1, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc1, connectivity.Ready)
+
+	p1 := <-cc.NewPickerCh
+	if err := testutils.IsRoundRobin([]balancer.SubConn{sc1}, subConnFromPicker(p1)); err != nil {
+		t.Fatalf("want %v, got %v", []balancer.SubConn{sc1}, err)
+	}
+
+	// p0 going TransientFailure while pinned to 1 shouldn't start any
+	// failover bookkeeping or new SubConns/pickers: it's not the pinned
+	// priority.
+	edsb.handleSubConnStateChange(sc0, connectivity.TransientFailure)
+	select {
+	case p := <-cc.NewPickerCh:
+		t.Fatalf("got unexpected new picker %v while pinned", p)
+	case <-time.After(defaultTestShortTimeout):
+	}
+
+	// Unpin: normal selection resumes, but p1 (priorityInUse) is still
+	// Ready, so there's nothing to fail over to and no churn is expected.
+	edsb.UnpinPriority()
+	select {
+	case sc := <-cc.NewSubConnCh:
+		t.Fatalf("got unexpected new SubConn %v after unpinning", sc)
+	case <-time.After(defaultTestShortTimeout):
+	}
+}
+
+// TestEDSPriority_ChangeEvents covers a failover sequence (0 down to 1, 1
+// down to 2, then 2 removed and 1 takes back over), and asserts that
+// priorityChangeCb receives the expected ordered events.
+//
+// Init 0 and 1; 0 down, use 1; 1 down, use 2; 2 removed, use 1.
+func (s) TestEDSPriority_ChangeEvents(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	var gotEvents []priorityChangeEvent
+	edsb.priorityChangeCb = func(e priorityChangeEvent) {
+		gotEvents = append(gotEvents, e)
+	}
+
+	// Two localities, with priorities [0, 1], each with one backend.
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	clab1.AddLocality(testSubZones[1], 1, 1, testEndpointAddrs[1:2], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+
+	sc0 := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc0, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc0, connectivity.Ready)
+	<-cc.NewPickerCh
+
+	// Turn down 0, 1 is used.
+	edsb.handleSubConnStateChange(sc0, connectivity.TransientFailure)
+	sc1 := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc1, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc1, connectivity.Ready)
+	<-cc.NewPickerCh
+
+	// Add p2.
+	clab2 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab2.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	clab2.AddLocality(testSubZones[1], 1, 1, testEndpointAddrs[1:2], nil)
+	clab2.AddLocality(testSubZones[2], 1, 2, testEndpointAddrs[2:3], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab2.Build()))
+
+	// Turn down 1, use 2.
+	edsb.handleSubConnStateChange(sc1, connectivity.TransientFailure)
+	sc2 := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc2, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc2, connectivity.Ready)
+	<-cc.NewPickerCh
+
+	// Remove 2, use 1.
+	clab3 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab3.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	clab3.AddLocality(testSubZones[1], 1, 1, testEndpointAddrs[1:2], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab3.Build()))
+	<-cc.RemoveSubConnCh
+	<-cc.NewPickerCh
+
+	wantEvents := []priorityChangeEvent{
+		{Priority: newPriorityType(0), Entered: true, Reason: priorityChangeReasonInit},
+		{Priority: newPriorityType(0), Entered: false, Reason: priorityChangeReasonWentDown},
+		{Priority: newPriorityType(1), Entered: true, Reason: priorityChangeReasonWentDown},
+		{Priority: newPriorityType(1), Entered: false, Reason: priorityChangeReasonWentDown},
+		{Priority: newPriorityType(2), Entered: true, Reason: priorityChangeReasonWentDown},
+		{Priority: newPriorityType(2), Entered: false, Reason: priorityChangeReasonDeleted},
+		{Priority: newPriorityType(1), Entered: true, Reason: priorityChangeReasonDeleted},
+	}
+	if diff := cmp.Diff(wantEvents, gotEvents, cmp.AllowUnexported(priorityType{})); diff != "" {
+		t.Fatalf("unexpected priority change events, diff (-want +got):\n%s", diff)
+	}
+}
+
+// The very first EDS response has no localities at all. The transient
+// failure picker is installed directly, without going through
+// handlePriorityChange, but the priority change hook should still fire.
+func (s) TestEDSPriority_ChangeEventsAllRemoved(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	var gotEvents []priorityChangeEvent
+	edsb.priorityChangeCb = func(e priorityChangeEvent) {
+		gotEvents = append(gotEvents, e)
+	}
+
+	edsb.handleEDSResponse(xdsclient.EndpointsUpdate{})
+
+	wantEvents := []priorityChangeEvent{
+		{Priority: newPriorityTypeUnset(), Entered: false, Reason: priorityChangeReasonAllRemoved},
+	}
+	if diff := cmp.Diff(wantEvents, gotEvents, cmp.AllowUnexported(priorityType{})); diff != "" {
+		t.Fatalf("unexpected priority change events, diff (-want +got):\n%s", diff)
+	}
+}
+
 // Add a lower priority while the higher priority is down.
 //
 // Init 0 and 1; 0 and 1 both down; add 2, use 2.
 func (s) TestEDSPriority_HigherDownWhileAddingLower(t *testing.T) {
 	cc := testutils.NewTestClientConn(t)
-	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
 	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
 
 	// Two localities, with different priorities, each with one backend.
@@ -271,7 +430,7 @@ func (s) TestEDSPriority_HigherDownWhileAddingLower(t *testing.T) {
 // Init 0,1,2; 0 and 1 down, use 2; 0 up, close 1 and 2.
 func (s) TestEDSPriority_HigherReadyCloseAllLower(t *testing.T) {
 	cc := testutils.NewTestClientConn(t)
-	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
 	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
 
 	// Two localities, with priorities [0,1,2], each with one backend.
@@ -338,6 +497,98 @@ func (s) TestEDSPriority_HigherReadyCloseAllLower(t *testing.T) {
 	}
 }
 
+// fakeClock is a clock that only fires timers when told to by a test,
+// letting priority failover timing be exercised deterministically instead
+// of via real sleeps.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	deadline time.Time
+	f        func()
+	stopped  bool
+}
+
+func (t *fakeTimer) Stop() bool {
+	stoppedBefore := t.stopped
+	t.stopped = true
+	return !stoppedBefore
+}
+
+func (c *fakeClock) NewTimer(d time.Duration, f func()) clockTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{deadline: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// advance moves the fake clock forward by d, synchronously calling the
+// callback of every timer (that hasn't already fired or been stopped) whose
+// deadline has now passed.
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var toFire []func()
+	for _, t := range c.timers {
+		if !t.stopped && !t.deadline.After(c.now) {
+			t.stopped = true
+			toFire = append(toFire, t.f)
+		}
+	}
+	c.mu.Unlock()
+	for _, f := range toFire {
+		f()
+	}
+}
+
+// TestEDSPriority_InitTimeoutFakeClock covers the same failover-on-timeout
+// behavior as TestEDSPriority_InitTimeout, but drives edsb's priority init
+// timer with a fakeClock advanced directly past the timeout, instead of
+// waiting on a real timer.
+func (s) TestEDSPriority_InitTimeoutFakeClock(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+	clock := &fakeClock{}
+	edsb.clock = clock
+
+	// Two localities, with different priorities, each with one backend.
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	clab1.AddLocality(testSubZones[1], 1, 1, testEndpointAddrs[1:2], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+
+	sc0 := <-cc.NewSubConnCh
+	// Keep 0 in connecting, 1 will be used once the init timer fires.
+	edsb.handleSubConnStateChange(sc0, connectivity.Connecting)
+
+	select {
+	case <-cc.NewSubConnCh:
+		t.Fatalf("Got a new SubConn before the init timer fired")
+	case <-time.After(defaultTestShortTimeout):
+	}
+
+	if got := edsb.PriorityInitTimeoutCount(); got != 0 {
+		t.Fatalf("PriorityInitTimeoutCount() = %v before the timer fired, want 0", got)
+	}
+
+	clock.advance(defaultPriorityInitTimeout)
+
+	select {
+	case <-cc.NewSubConnCh:
+	case <-time.After(defaultTestTimeout):
+		t.Fatalf("timed out waiting for SubConn for the next priority after the fake clock advanced past the init timeout")
+	}
+
+	if got := edsb.PriorityInitTimeoutCount(); got != 1 {
+		t.Errorf("PriorityInitTimeoutCount() = %v after the init timer forced failover, want 1", got)
+	}
+}
+
 // At init, start the next lower priority after timeout if the higher priority
 // doesn't get ready.
 //
@@ -353,7 +604,7 @@ func (s) TestEDSPriority_InitTimeout(t *testing.T) {
 	}()()
 
 	cc := testutils.NewTestClientConn(t)
-	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
 	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
 
 	// Two localities, with different priorities, each with one backend.
@@ -397,13 +648,199 @@ func (s) TestEDSPriority_InitTimeout(t *testing.T) {
 	}
 }
 
+// TestEDSPriority_FailoverBackoff verifies that, once backoff is enabled via
+// updatePriorityFailoverBackoff, a priority that keeps reporting
+// TransientFailure (i.e. is retrying/flapping, rather than simply stuck)
+// gets its grace window extended instead of being failed over as soon as
+// the first TransientFailure is seen.
+func (s) TestEDSPriority_FailoverBackoff(t *testing.T) {
+	const testPriorityInitTimeout = 100 * time.Millisecond
+
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+	defer edsb.close()
+
+	// defaultPriorityInitTimeout/defaultPriorityInitMaxBackoff are read by
+	// startPriority and handlePriorityWithNewStateTransientFailure while
+	// priorityMu is held, including from the background goroutine that
+	// services edsb's timers; take the same lock here so the swap below
+	// doesn't race with those reads.
+	edsb.priorityMu.Lock()
+	oldPriorityInitTimeout := defaultPriorityInitTimeout
+	oldPriorityInitMaxBackoff := defaultPriorityInitMaxBackoff
+	defaultPriorityInitTimeout = testPriorityInitTimeout
+	defaultPriorityInitMaxBackoff = 10 * testPriorityInitTimeout
+	edsb.priorityMu.Unlock()
+	defer func() {
+		edsb.priorityMu.Lock()
+		defaultPriorityInitTimeout = oldPriorityInitTimeout
+		defaultPriorityInitMaxBackoff = oldPriorityInitMaxBackoff
+		edsb.priorityMu.Unlock()
+	}()
+
+	edsb.updatePriorityFailoverBackoff(true)
+
+	// Two localities, with different priorities, each with one backend.
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	clab1.AddLocality(testSubZones[1], 1, 1, testEndpointAddrs[1:2], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+
+	addrs0 := <-cc.NewSubConnAddrsCh
+	if got, want := addrs0[0].Addr, testEndpointAddrs[0]; got != want {
+		t.Fatalf("sc is created with addr %v, want %v", got, want)
+	}
+	sc0 := <-cc.NewSubConnCh
+
+	// 0 fails, but should be given a grace window instead of an immediate
+	// failover.
+	edsb.handleSubConnStateChange(sc0, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc0, connectivity.TransientFailure)
+	select {
+	case <-time.After(testPriorityInitTimeout * 3 / 4):
+	case <-cc.NewSubConnAddrsCh:
+		t.Fatalf("Got a new SubConn too early; a flapping priority should get a grace window before failover")
+	}
+
+	// 0 reports TransientFailure again before its grace window elapsed,
+	// i.e. it's flapping rather than stuck; this should extend the window
+	// rather than letting the original window's failover fire.
+	edsb.handleSubConnStateChange(sc0, connectivity.TransientFailure)
+	select {
+	case <-time.After(testPriorityInitTimeout * 3 / 2):
+	case <-cc.NewSubConnAddrsCh:
+		t.Fatalf("Got a new SubConn too early; a repeated TransientFailure should have extended the grace window")
+	}
+
+	// The extended window eventually elapses without 0 reaching Ready, so 1
+	// is used.
+	addrs1 := <-cc.NewSubConnAddrsCh
+	if got, want := addrs1[0].Addr, testEndpointAddrs[1]; got != want {
+		t.Fatalf("sc is created with addr %v, want %v", got, want)
+	}
+}
+
+// TestEDSPriority_ReResolution covers the case where the lowest (only)
+// priority fails with nowhere lower to fail over to: once
+// ReResolutionInterval elapses with the failure still ongoing, the balancer
+// must ask the parent resolver for fresh addresses via cc.ResolveNow.
+func (s) TestEDSPriority_ReResolution(t *testing.T) {
+	const reResolutionInterval = 30 * time.Second
+
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+	clock := &fakeClock{}
+	edsb.clock = clock
+	interval := uint32(reResolutionInterval / time.Second)
+	edsb.updateReResolutionConfig(&interval)
+
+	// A single priority, with one backend.
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+
+	sc0 := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc0, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc0, connectivity.TransientFailure)
+
+	select {
+	case <-cc.ResolveNowCh:
+		t.Fatalf("Got a ResolveNow before the re-resolution interval elapsed")
+	case <-time.After(defaultTestShortTimeout):
+	}
+
+	clock.advance(reResolutionInterval)
+
+	select {
+	case <-cc.ResolveNowCh:
+	case <-time.After(defaultTestTimeout):
+		t.Fatalf("timed out waiting for ResolveNow after the fake clock advanced past the re-resolution interval")
+	}
+}
+
+// TestEDSPriority_RecomputePriorities verifies that, if priorityInUse is
+// somehow left unset (e.g. by a bug elsewhere leaving the balancer in an
+// inconsistent state), calling RecomputePriorities corrects it without
+// waiting for the next EDS response.
+func (s) TestEDSPriority_RecomputePriorities(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	// Two localities, with priorities [0, 1], each with one backend.
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	clab1.AddLocality(testSubZones[1], 1, 1, testEndpointAddrs[1:2], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+	<-cc.NewSubConnAddrsCh
+	<-cc.NewSubConnCh
+
+	// Simulate priorityInUse having been left unset by a bug elsewhere.
+	edsb.priorityMu.Lock()
+	edsb.priorityInUse = newPriorityTypeUnset()
+	edsb.priorityMu.Unlock()
+
+	edsb.RecomputePriorities()
+
+	edsb.priorityMu.Lock()
+	got := edsb.priorityInUse
+	edsb.priorityMu.Unlock()
+	if want := newPriorityType(0); !got.equal(want) {
+		t.Fatalf("priorityInUse = %v, want %v", got, want)
+	}
+}
+
+// TestEDSPriority_DeterministicOrder verifies that, for a multi-priority EDS
+// update, balancer groups are created (and logged as "priority added") in
+// ascending priority order, regardless of map iteration order.
+func (s) TestEDSPriority_DeterministicOrder(t *testing.T) {
+	cl := &capturingDepthLogger{}
+	logger := grpclog.NewPrefixLogger(cl, "")
+
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, logger, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	// Three priorities, added in an order that doesn't match ascending
+	// priority order, so a naive map iteration would likely (non-
+	// deterministically) create them out of order. Only the highest priority
+	// (0) is actually started, so only its SubConn is created here; the
+	// lower priorities' balancer groups are still created synchronously by
+	// handleEDSResponse, which is what this test cares about.
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 2, testEndpointAddrs[:1], nil)
+	clab1.AddLocality(testSubZones[1], 1, 0, testEndpointAddrs[1:2], nil)
+	clab1.AddLocality(testSubZones[2], 1, 1, testEndpointAddrs[2:3], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+	<-cc.NewSubConnAddrsCh
+	<-cc.NewSubConnCh
+
+	var added []string
+	for _, line := range cl.infos {
+		if strings.Contains(line, "priority added") {
+			added = append(added, line)
+		}
+	}
+	want := []string{"priority=0", "priority=1", "priority=2"}
+	if len(added) != len(want) {
+		t.Fatalf("got %d \"priority added\" log lines, want %d: %v", len(added), len(want), added)
+	}
+	for i, w := range want {
+		if !strings.Contains(added[i], w) {
+			t.Errorf("log line %d = %q, want it to contain %q", i, added[i], w)
+		}
+	}
+}
+
 // Add localities to existing priorities.
 //
-//  - start with 2 locality with p0 and p1
-//  - add localities to existing p0 and p1
+//   - start with 2 locality with p0 and p1
+//   - add localities to existing p0 and p1
 func (s) TestEDSPriority_MultipleLocalities(t *testing.T) {
 	cc := testutils.NewTestClientConn(t)
-	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
 	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
 
 	// Two localities, with different priorities, each with one backend.
@@ -514,7 +951,7 @@ func (s) TestEDSPriority_RemovesAllLocalities(t *testing.T) {
 	}()()
 
 	cc := testutils.NewTestClientConn(t)
-	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
 	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
 
 	// Two localities, with different priorities, each with one backend.
@@ -551,8 +988,15 @@ func (s) TestEDSPriority_RemovesAllLocalities(t *testing.T) {
 	// Test pick return TransientFailure.
 	pFail := <-cc.NewPickerCh
 	for i := 0; i < 5; i++ {
-		if _, err := pFail.Pick(balancer.PickInfo{}); err != errAllPrioritiesRemoved {
-			t.Fatalf("want pick error %v, got %v", errAllPrioritiesRemoved, err)
+		_, err := pFail.Pick(balancer.PickInfo{})
+		if err != ErrAllPrioritiesRemoved {
+			t.Fatalf("want pick error %v, got %v", ErrAllPrioritiesRemoved, err)
+		}
+		// ErrAllPrioritiesRemoved is exported so RPC callers can detect this
+		// specific condition with errors.Is instead of matching on the
+		// Unavailable status that wraps it at the RPC boundary.
+		if !errors.Is(err, ErrAllPrioritiesRemoved) {
+			t.Fatalf("errors.Is(err, ErrAllPrioritiesRemoved) = false, want true; err: %v", err)
 		}
 	}
 
@@ -698,7 +1142,7 @@ func (s) TestPriorityTypeEqual(t *testing.T) {
 // will be used.
 func (s) TestEDSPriority_HighPriorityNoEndpoints(t *testing.T) {
 	cc := testutils.NewTestClientConn(t)
-	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
 	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
 
 	// Two localities, with priorities [0, 1], each with one backend.
@@ -757,7 +1201,7 @@ func (s) TestEDSPriority_HighPriorityNoEndpoints(t *testing.T) {
 // priority will be used.
 func (s) TestEDSPriority_HighPriorityAllUnhealthy(t *testing.T) {
 	cc := testutils.NewTestClientConn(t)
-	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
 	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
 
 	// Two localities, with priorities [0, 1], each with one backend.
@@ -823,7 +1267,7 @@ func (s) TestEDSPriority_FirstPriorityUnavailable(t *testing.T) {
 	defaultPriorityInitTimeout = testPriorityInitTimeout
 
 	cc := testutils.NewTestClientConn(t)
-	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
 	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
 
 	// One localities, with priorities [0], each with one backend.
@@ -841,3 +1285,122 @@ func (s) TestEDSPriority_FirstPriorityUnavailable(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestEDSPriority_WarmUpQueuesUntilReady verifies that, with warm-up
+// enabled, neither the Connecting state reported when the only priority
+// starts, nor an intervening TransientFailure, is forwarded to cc: an RPC
+// made during that window would queue against the ClientConn's own
+// default pre-UpdateState picker (never replaced, since updateState holds
+// back both of these), rather than fail fast. Once the priority reaches
+// Ready, its picker is forwarded immediately, same as without warm-up.
+func (s) TestEDSPriority_WarmUpQueuesUntilReady(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+	edsb.updateWarmUp(true)
+
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+	sc := <-cc.NewSubConnCh
+
+	edsb.handleSubConnStateChange(sc, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc, connectivity.TransientFailure)
+
+	select {
+	case p := <-cc.NewPickerCh:
+		t.Fatalf("got unexpected picker %v while warming up; RPCs should be queuing instead of seeing a Connecting/TransientFailure picker", p)
+	case <-time.After(defaultTestShortTimeout):
+	}
+
+	edsb.handleSubConnStateChange(sc, connectivity.Ready)
+	p := <-cc.NewPickerCh
+	if err := testutils.IsRoundRobin([]balancer.SubConn{sc}, subConnFromPicker(p)); err != nil {
+		t.Fatalf("picker after warm-up ends: %v", err)
+	}
+}
+
+// TestEDSPriority_WarmUpEndsOnTimeout verifies that, with warm-up enabled,
+// a priority stuck below Ready past defaultWarmUpTimeout has its most
+// recently computed state forwarded once the timeout fires, instead of
+// queuing RPCs indefinitely.
+func (s) TestEDSPriority_WarmUpEndsOnTimeout(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+	edsb.updateWarmUp(true)
+	clock := &fakeClock{}
+	edsb.clock = clock
+
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+	sc := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc, connectivity.Connecting)
+
+	select {
+	case p := <-cc.NewPickerCh:
+		t.Fatalf("got unexpected picker %v while warming up", p)
+	case <-time.After(defaultTestShortTimeout):
+	}
+
+	clock.advance(defaultWarmUpTimeout)
+	if err := cc.WaitForErrPicker(context.Background()); err != nil {
+		t.Fatalf("didn't get the Connecting picker forwarded once warmUpTimer fired: %v", err)
+	}
+}
+
+// TestEDSPriority_MinHealthyPercentage verifies that, with a configured
+// minHealthyPercentage, a priority whose weighted healthy fraction drops
+// below the threshold fails over to the next lower priority even though its
+// aggregated state is still Ready (Envoy's panic threshold), and that it
+// reclaims priorityInUse once its healthy fraction recovers back above the
+// threshold.
+func (s) TestEDSPriority_MinHealthyPercentage(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+	edsb.updateMinHealthyPercentage(60)
+
+	// p0 starts with one locality.
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+	sc0a := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc0a, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc0a, connectivity.Ready)
+
+	p0 := <-cc.NewPickerCh
+	if err := testutils.IsRoundRobin([]balancer.SubConn{sc0a}, subConnFromPicker(p0)); err != nil {
+		t.Fatalf("initial p0 picker: %v", err)
+	}
+
+	// Add a second, equally weighted locality to p0 (not yet Ready), and a
+	// lower priority p1 to fail over to.
+	clab1.AddLocality(testSubZones[1], 1, 0, testEndpointAddrs[1:2], nil)
+	clab1.AddLocality(testSubZones[2], 1, 1, testEndpointAddrs[2:3], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+	sc0b := <-cc.NewSubConnCh
+
+	// sc0b staying Connecting drops p0's weighted healthy fraction to 1/2
+	// (50%), below the 60% minHealthyPercentage: even though p0's aggregate
+	// state is still Ready (sc0a is Ready), it should fail over to p1.
+	edsb.handleSubConnStateChange(sc0b, connectivity.Connecting)
+	sc1 := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc1, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc1, connectivity.Ready)
+
+	pFailover := <-cc.NewPickerCh
+	if err := testutils.IsRoundRobin([]balancer.SubConn{sc1}, subConnFromPicker(pFailover)); err != nil {
+		t.Fatalf("picker after dropping below minHealthyPercentage: %v", err)
+	}
+
+	// sc0b becoming Ready brings p0 back to 100% healthy, crossing back
+	// above the threshold: p0 should reclaim priorityInUse, since it's
+	// still the higher priority.
+	edsb.handleSubConnStateChange(sc0b, connectivity.Ready)
+	pRecovered := <-cc.NewPickerCh
+	if err := testutils.IsRoundRobin([]balancer.SubConn{sc0a, sc0b}, subConnFromPicker(pRecovered)); err != nil {
+		t.Fatalf("picker after recovering above minHealthyPercentage: %v", err)
+	}
+}
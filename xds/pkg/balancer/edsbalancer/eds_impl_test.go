@@ -17,12 +17,18 @@
 package edsbalancer
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"sort"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	orcapb "github.com/cncf/udpa/go/udpa/data/orca/v1"
 	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -32,8 +38,10 @@ import (
 	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/internal/balancer/stub"
 	"google.golang.org/grpc/internal/xds/env"
+	"google.golang.org/grpc/resolver"
 	"google.golang.org/grpc/xds/pkg"
 	"google.golang.org/grpc/xds/pkg/balancer/balancergroup"
+	"google.golang.org/grpc/xds/pkg/balancer/weightedtarget/weightedaggregator"
 	"google.golang.org/grpc/xds/pkg/client"
 	xdsclient "google.golang.org/grpc/xds/pkg/client"
 	"google.golang.org/grpc/xds/pkg/client/load"
@@ -62,7 +70,7 @@ func init() {
 //  - change drop rate
 func (s) TestEDS_OneLocality(t *testing.T) {
 	cc := testutils.NewTestClientConn(t)
-	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
 	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
 
 	// One locality with one backend.
@@ -175,6 +183,38 @@ func (s) TestEDS_OneLocality(t *testing.T) {
 	}
 }
 
+// TestEDS_AdditionalAddresses verifies that an Endpoint's AdditionalAddresses
+// (dual-stack) are attached to the resulting resolver.Address via
+// xdsclient.SetAdditionalAddresses, so a dual-stack-aware SubConn can reach
+// them.
+func (s) TestEDS_AdditionalAddresses(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	wantAdditional := []string{"[::ffff:" + testEndpointAddrs[0] + "]:0"}
+	edsb.handleEDSResponse(xdsclient.EndpointsUpdate{
+		Localities: []xdsclient.Locality{{
+			ID:     pkg.LocalityID{SubZone: testSubZones[0]},
+			Weight: 1,
+			Endpoints: []xdsclient.Endpoint{{
+				Address:             testEndpointAddrs[0],
+				HealthStatus:        xdsclient.EndpointHealthStatusHealthy,
+				Weight:              1,
+				AdditionalAddresses: wantAdditional,
+			}},
+		}},
+	})
+
+	addrs := <-cc.NewSubConnAddrsCh
+	if len(addrs) != 1 {
+		t.Fatalf("got %d addresses, want 1: %v", len(addrs), addrs)
+	}
+	if got := xdsclient.GetAdditionalAddresses(addrs[0]); !cmp.Equal(got, wantAdditional) {
+		t.Errorf("GetAdditionalAddresses() = %v, want %v", got, wantAdditional)
+	}
+}
+
 // 2 locality
 //  - start with 2 locality
 //  - add locality
@@ -183,7 +223,7 @@ func (s) TestEDS_OneLocality(t *testing.T) {
 //  - update locality weight
 func (s) TestEDS_TwoLocalities(t *testing.T) {
 	cc := testutils.NewTestClientConn(t)
-	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
 	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
 
 	// Two localities, each with one backend.
@@ -314,7 +354,7 @@ func (s) TestEDS_TwoLocalities(t *testing.T) {
 // healthy ones are used.
 func (s) TestEDS_EndpointsHealth(t *testing.T) {
 	cc := testutils.NewTestClientConn(t)
-	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
 	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
 
 	// Two localities, each 3 backend, one Healthy, one Unhealthy, one Unknown.
@@ -385,19 +425,110 @@ func (s) TestEDS_EndpointsHealth(t *testing.T) {
 	}
 }
 
+// TestEDS_PanicThreshold covers Envoy-style panic-mode routing: once a
+// priority's healthy endpoint fraction drops below the configured
+// PanicThreshold, every endpoint is kept, including the ones that would
+// otherwise be filtered out by TestEDS_EndpointsHealth's normal health
+// filtering.
+func (s) TestEDS_PanicThreshold(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+	edsb.updatePanicThreshold(50)
+
+	// One locality, 4 backends: 1 healthy, 3 unhealthy. The healthy
+	// fraction, 25%, is below the 50% panic threshold, so all 4 should get
+	// SubConns despite 3 of them being unhealthy.
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:4], &testutils.AddLocalityOptions{
+		Health: []corepb.HealthStatus{
+			corepb.HealthStatus_HEALTHY,
+			corepb.HealthStatus_UNHEALTHY,
+			corepb.HealthStatus_UNHEALTHY,
+			corepb.HealthStatus_UNHEALTHY,
+		},
+	})
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+
+	var newSubConnAddrStrs []string
+	for i := 0; i < 4; i++ {
+		addr := <-cc.NewSubConnAddrsCh
+		newSubConnAddrStrs = append(newSubConnAddrStrs, addr[0].Addr)
+		<-cc.NewSubConnCh
+	}
+	sortStrTrans := cmp.Transformer("Sort", func(in []string) []string {
+		out := append([]string(nil), in...) // Copy input to avoid mutating it.
+		sort.Strings(out)
+		return out
+	})
+	if !cmp.Equal(newSubConnAddrStrs, testEndpointAddrs[:4], sortStrTrans) {
+		t.Fatalf("panicking: want newSubConn for all addresses %v, got %v", testEndpointAddrs[:4], newSubConnAddrStrs)
+	}
+
+	select {
+	case sc := <-cc.NewSubConnCh:
+		t.Fatalf("unexpected extra NewSubConn while panicking: %v", sc)
+	case <-time.After(defaultTestShortTimeout):
+	}
+}
+
 func (s) TestClose(t *testing.T) {
-	edsb := newEDSBalancerImpl(nil, balancer.BuildOptions{}, nil, nil, nil)
+	edsb := newEDSBalancerImpl(nil, balancer.BuildOptions{}, nil, nil, nil, nil)
 	// This is what could happen when switching between fallback and eds. This
 	// make sure it doesn't panic.
 	edsb.close()
 }
 
+// TestEDSRejectsOversizedUpdate verifies that handleEDSResponse rejects an
+// EDS response whose total endpoint count (summed across all localities)
+// exceeds defaultMaxTotalEndpoints, leaving any previously applied state
+// untouched, instead of creating a SubConn per endpoint.
+func (s) TestEDSRejectsOversizedUpdate(t *testing.T) {
+	defer func(old int) { defaultMaxTotalEndpoints = old }(defaultMaxTotalEndpoints)
+	defaultMaxTotalEndpoints = 3
+
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	// One locality, within the cap: applied normally.
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:2], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+	sc1 := <-cc.NewSubConnCh
+	sc2 := <-cc.NewSubConnCh
+
+	// A second update with more endpoints than the cap allows: rejected
+	// wholesale, so no new SubConns should be created for it.
+	clab2 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab2.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:2], nil)
+	clab2.AddLocality(testSubZones[1], 1, 0, testEndpointAddrs[2:4], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab2.Build()))
+
+	sCtx, sCancel := context.WithTimeout(context.Background(), defaultTestShortTimeout)
+	defer sCancel()
+	select {
+	case sc := <-cc.NewSubConnCh:
+		t.Fatalf("unexpected NewSubConn(%v) call for a rejected (oversized) EDS update", sc)
+	case <-sCtx.Done():
+	}
+
+	// The SubConns from the earlier, accepted update are unaffected.
+	for _, sc := range []balancer.SubConn{sc1, sc2} {
+		edsb.handleSubConnStateChange(sc, connectivity.Connecting)
+		edsb.handleSubConnStateChange(sc, connectivity.Ready)
+	}
+	if _, err := (<-cc.NewPickerCh).Pick(balancer.PickInfo{}); err != nil {
+		t.Fatalf("Pick() after a rejected oversized update failed: %v", err)
+	}
+}
+
 // TestEDS_EmptyUpdate covers the cases when eds impl receives an empty update.
 //
 // It should send an error picker with transient failure to the parent.
 func (s) TestEDS_EmptyUpdate(t *testing.T) {
 	cc := testutils.NewTestClientConn(t)
-	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
 	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
 
 	// The first update is an empty update.
@@ -406,8 +537,8 @@ func (s) TestEDS_EmptyUpdate(t *testing.T) {
 	perr0 := <-cc.NewPickerCh
 	for i := 0; i < 5; i++ {
 		_, err := perr0.Pick(balancer.PickInfo{})
-		if !reflect.DeepEqual(err, errAllPrioritiesRemoved) {
-			t.Fatalf("picker.Pick, got error %v, want error %v", err, errAllPrioritiesRemoved)
+		if !reflect.DeepEqual(err, ErrAllPrioritiesRemoved) {
+			t.Fatalf("picker.Pick, got error %v, want error %v", err, ErrAllPrioritiesRemoved)
 		}
 	}
 
@@ -434,8 +565,8 @@ func (s) TestEDS_EmptyUpdate(t *testing.T) {
 	perr1 := <-cc.NewPickerCh
 	for i := 0; i < 5; i++ {
 		_, err := perr1.Pick(balancer.PickInfo{})
-		if !reflect.DeepEqual(err, errAllPrioritiesRemoved) {
-			t.Fatalf("picker.Pick, got error %v, want error %v", err, errAllPrioritiesRemoved)
+		if !reflect.DeepEqual(err, ErrAllPrioritiesRemoved) {
+			t.Fatalf("picker.Pick, got error %v, want error %v", err, ErrAllPrioritiesRemoved)
 		}
 	}
 
@@ -479,7 +610,7 @@ func (s) TestEDS_UpdateSubBalancerName(t *testing.T) {
 		},
 	})
 
-	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
 	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
 
 	t.Logf("update sub-balancer to stub-balancer")
@@ -571,13 +702,137 @@ func (s) TestEDS_UpdateSubBalancerName(t *testing.T) {
 	}
 }
 
+// TestEDS_ChildPolicyUnregisteredName verifies that handleChildPolicy leaves
+// the active child policy (and therefore its weight-attachment behavior)
+// untouched when asked to switch to a balancer name that isn't registered,
+// instead of silently flipping the weighted_round_robin detection in
+// handleEDSResponsePerPriority out from under the still-installed builder.
+func (s) TestEDS_ChildPolicyUnregisteredName(t *testing.T) {
+	const balancerName = "stubBalancer-TestEDS_ChildPolicyUnregisteredName"
+	stub.Register(balancerName, stub.BalancerFuncs{})
+
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, balancer.Get(balancerName))
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	if got := edsb.subBalancerBuilder.Name(); got != balancerName {
+		t.Fatalf("subBalancerBuilder.Name() = %q, want %q", got, balancerName)
+	}
+
+	edsb.handleChildPolicy("this-balancer-name-is-not-registered", nil)
+
+	if got := edsb.subBalancerBuilder.Name(); got != balancerName {
+		t.Fatalf("after handleChildPolicy with an unregistered name, subBalancerBuilder.Name() = %q, want unchanged %q", got, balancerName)
+	}
+}
+
+// TestEDS_ChildPolicyByPriority verifies that handleChildPolicyByPriority
+// lets a specific priority use a different child policy than the rest: only
+// the overridden priority's locality uses the stub balancer, while other
+// priorities keep using the default (round_robin).
+func (s) TestEDS_ChildPolicyByPriority(t *testing.T) {
+	const stubName = "stubBalancer-TestEDS_ChildPolicyByPriority"
+	stub.Register(stubName, stub.BalancerFuncs{
+		UpdateClientConnState: func(bd *stub.BalancerData, s balancer.ClientConnState) error {
+			if len(s.ResolverState.Addresses) == 0 {
+				return nil
+			}
+			bd.ClientConn.NewSubConn(s.ResolverState.Addresses, balancer.NewSubConnOptions{})
+			return nil
+		},
+		UpdateSubConnState: func(bd *stub.BalancerData, sc balancer.SubConn, state balancer.SubConnState) {
+			bd.ClientConn.UpdateState(balancer.State{
+				ConnectivityState: state.ConnectivityState,
+				Picker:            &testutils.TestConstPicker{Err: testutils.ErrTestConstPicker},
+			})
+		},
+	})
+
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	// Priority 0 uses the stub balancer; priority 1 keeps the default
+	// (round_robin), to verify the override doesn't leak to other priorities.
+	edsb.handleChildPolicyByPriority(map[uint32]*loadBalancingConfig{0: {Name: stubName}})
+
+	clab := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	clab.AddLocality(testSubZones[1], 1, 1, testEndpointAddrs[1:2], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab.Build()))
+
+	sc0 := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc0, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc0, connectivity.Ready)
+
+	p0 := <-cc.NewPickerCh
+	if _, err := p0.Pick(balancer.PickInfo{}); err != testutils.ErrTestConstPicker {
+		t.Fatalf("priority 0 picker.Pick, got err %v, want err %v (the stub balancer set via ChildPolicyByPriority)", err, testutils.ErrTestConstPicker)
+	}
+
+	// Fail priority 0 over to priority 1, which should use round_robin (the
+	// default), not the priority-0-only override.
+	edsb.handleSubConnStateChange(sc0, connectivity.TransientFailure)
+	sc1 := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc1, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc1, connectivity.Ready)
+
+	p1 := <-cc.NewPickerCh
+	want := []balancer.SubConn{sc1}
+	if err := testutils.IsRoundRobin(want, subConnFromPicker(p1)); err != nil {
+		t.Fatalf("priority 1 picker not round-robin (expected the default child policy, not the override): %v", err)
+	}
+}
+
+// Construct the EDS balancer with an initial sub-balancer builder other than
+// round_robin, and verify that round_robin is never installed: the very
+// first EDS response should go straight to the overridden sub-balancer.
+func (s) TestEDS_InitialSubBalancerBuilderOverride(t *testing.T) {
+	const balancerName = "stubBalancer-TestEDS_InitialSubBalancerBuilderOverride"
+	stub.Register(balancerName, stub.BalancerFuncs{
+		UpdateClientConnState: func(bd *stub.BalancerData, s balancer.ClientConnState) error {
+			if len(s.ResolverState.Addresses) == 0 {
+				return nil
+			}
+			bd.ClientConn.NewSubConn(s.ResolverState.Addresses, balancer.NewSubConnOptions{})
+			return nil
+		},
+		UpdateSubConnState: func(bd *stub.BalancerData, sc balancer.SubConn, state balancer.SubConnState) {
+			bd.ClientConn.UpdateState(balancer.State{
+				ConnectivityState: state.ConnectivityState,
+				Picker:            &testutils.TestConstPicker{Err: testutils.ErrTestConstPicker},
+			})
+		},
+	})
+
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, balancer.Get(balancerName))
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	if got := edsb.subBalancerBuilder.Name(); got != balancerName {
+		t.Fatalf("subBalancerBuilder.Name() = %q, want %q", got, balancerName)
+	}
+
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+
+	sc := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc, connectivity.Ready)
+
+	p := <-cc.NewPickerCh
+	if _, err := p.Pick(balancer.PickInfo{}); err != testutils.ErrTestConstPicker {
+		t.Fatalf("picker.Pick, got err %+v, want err %+v", err, testutils.ErrTestConstPicker)
+	}
+}
+
 func (s) TestEDS_CircuitBreaking(t *testing.T) {
 	origCircuitBreakingSupport := env.CircuitBreakingSupport
 	env.CircuitBreakingSupport = true
 	defer func() { env.CircuitBreakingSupport = origCircuitBreakingSupport }()
 
 	cc := testutils.NewTestClientConn(t)
-	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
 	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
 	var maxRequests uint32 = 50
 	edsb.updateServiceRequestsConfig("test", &maxRequests)
@@ -676,6 +931,42 @@ func (s) TestEDS_CircuitBreaking(t *testing.T) {
 	}
 }
 
+// TestEDS_CircuitBreaking_MaxConnections verifies that once max_connections
+// is reached, newSubConn refuses to create further SubConns for the
+// service, instead of only rejecting picks as max_concurrent_requests does.
+func (s) TestEDS_CircuitBreaking_MaxConnections(t *testing.T) {
+	origCircuitBreakingSupport := env.CircuitBreakingSupport
+	env.CircuitBreakingSupport = true
+	defer func() { env.CircuitBreakingSupport = origCircuitBreakingSupport }()
+
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+	var maxConnections uint32 = 3
+	edsb.updateServiceConnectionsConfig("test", &maxConnections)
+	// Without this, future tests with the same service name will fail.
+	defer client.ClearConnectionsCounterForTesting("test")
+
+	// One locality with more backends than the connection cap.
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:5], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+
+	for i := 0; i < int(maxConnections); i++ {
+		select {
+		case <-cc.NewSubConnCh:
+		case <-time.After(defaultTestTimeout):
+			t.Fatalf("timed out waiting for NewSubConn #%d", i)
+		}
+	}
+
+	select {
+	case sc := <-cc.NewSubConnCh:
+		t.Fatalf("unexpected NewSubConn call beyond max_connections: %v", sc)
+	case <-time.After(defaultTestShortTimeout):
+	}
+}
+
 func init() {
 	balancer.Register(&testInlineUpdateBalancerBuilder{})
 }
@@ -721,7 +1012,7 @@ func (*testInlineUpdateBalancer) Close() {
 // by acquiring a locked mutex.
 func (s) TestEDS_ChildPolicyUpdatePickerInline(t *testing.T) {
 	cc := testutils.NewTestClientConn(t)
-	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
 	edsb.enqueueChildBalancerStateUpdate = func(p priorityType, state balancer.State) {
 		// For this test, euqueue needs to happen asynchronously (like in the
 		// real implementation).
@@ -782,7 +1073,7 @@ func (s) TestDropPicker(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
-			p := newDropPicker(constPicker, tt.drops, nil, nil, defaultServiceRequestCountMax)
+			p := newDropPicker(constPicker, tt.drops, nil, nil, defaultServiceRequestCountMax, nil, 0, nil, false, nil, nil)
 
 			// scCount is the number of sc's returned by pick. The opposite of
 			// drop-count.
@@ -808,89 +1099,570 @@ func (s) TestDropPicker(t *testing.T) {
 	}
 }
 
-func (s) TestEDS_LoadReport(t *testing.T) {
-	origCircuitBreakingSupport := env.CircuitBreakingSupport
-	env.CircuitBreakingSupport = true
-	defer func() { env.CircuitBreakingSupport = origCircuitBreakingSupport }()
+// TestEDSEffectiveDropRate verifies that EffectiveDropRate computes the
+// aggregate probability 1 - Π(1 - p_i) across the configured drop
+// categories, matching the sequential first-match-wins semantics of
+// dropPicker.Pick, rather than a simple sum of the per-category rates.
+func (s) TestEDSEffectiveDropRate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config []xdsclient.OverloadDropConfig
+		want   float64
+	}{
+		{
+			name: "no drop",
+			want: 0,
+		},
+		{
+			name:   "one category",
+			config: []xdsclient.OverloadDropConfig{{Numerator: 1, Denominator: 2}},
+			want:   0.5,
+		},
+		{
+			name: "two categories",
+			// A pick survives only if it survives both: 2/3 * 1/2 = 1/3.
+			// Effective drop rate is 1 - 1/3 = 2/3, not 1/3 + 1/2.
+			config: []xdsclient.OverloadDropConfig{
+				{Category: "cat-1", Numerator: 1, Denominator: 3},
+				{Category: "cat-2", Numerator: 1, Denominator: 2},
+			},
+			want: 1 - float64(2)/3*float64(1)/2,
+		},
+		{
+			name: "numerator greater than denominator clamps to 100%",
+			config: []xdsclient.OverloadDropConfig{
+				{Numerator: 5, Denominator: 2},
+			},
+			want: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edsb := newEDSBalancerImpl(nil, balancer.BuildOptions{}, nil, nil, nil, nil)
+			edsb.updateDrops(tt.config)
+			if got := edsb.EffectiveDropRate(); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("EffectiveDropRate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
 
-	// We create an xdsClientWrapper with a dummy xdsClientInterface which only
-	// implements the LoadStore() method to return the underlying load.Store to
-	// be used.
-	loadStore := load.NewStore()
-	lsWrapper := &loadStoreWrapper{}
-	lsWrapper.updateServiceName(testClusterNames[0])
-	lsWrapper.updateLoadStore(loadStore)
+// TestEDSDropConfigOverlap verifies that updateDrops warns (via
+// DropConfigOverlapCount) when two drop categories' probabilities sum beyond
+// 100%, and that EffectiveDropRate's sequential evaluation still caps the
+// actual drop rate at 100% despite the configured sum exceeding it.
+func (s) TestEDSDropConfigOverlap(t *testing.T) {
+	edsb := newEDSBalancerImpl(nil, balancer.BuildOptions{}, nil, nil, nil, nil)
+	if got := edsb.DropConfigOverlapCount(); got != 0 {
+		t.Fatalf("DropConfigOverlapCount() before any drop config = %v, want 0", got)
+	}
 
-	cc := testutils.NewTestClientConn(t)
-	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, lsWrapper, nil)
-	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+	// Two independent 60% categories: 60% + 60% = 120%, over the 100% that
+	// dropPicker.Pick's sequential evaluation can actually deliver.
+	edsb.updateDrops([]xdsclient.OverloadDropConfig{
+		{Category: "cat-1", Numerator: 60, Denominator: 100},
+		{Category: "cat-2", Numerator: 60, Denominator: 100},
+	})
+	if got := edsb.DropConfigOverlapCount(); got != 1 {
+		t.Fatalf("DropConfigOverlapCount() after overlapping drop config = %v, want 1", got)
+	}
+	if got := edsb.EffectiveDropRate(); got > 1 {
+		t.Fatalf("EffectiveDropRate() = %v, want capped at 1 (100%%)", got)
+	}
 
-	const (
-		testServiceName = "test-service"
-		cbMaxRequests   = 20
-	)
-	var maxRequestsTemp uint32 = cbMaxRequests
-	edsb.updateServiceRequestsConfig(testServiceName, &maxRequestsTemp)
-	defer client.ClearCounterForTesting(testServiceName)
+	// A non-overlapping config shouldn't bump the count further.
+	edsb.updateDrops([]xdsclient.OverloadDropConfig{
+		{Category: "cat-1", Numerator: 1, Denominator: 10},
+	})
+	if got := edsb.DropConfigOverlapCount(); got != 1 {
+		t.Fatalf("DropConfigOverlapCount() after non-overlapping drop config = %v, want 1", got)
+	}
 
-	backendToBalancerID := make(map[balancer.SubConn]pkg.LocalityID)
+	// The same category configured twice is also an overlap, even if the
+	// combined probability doesn't exceed 100%.
+	edsb.updateDrops([]xdsclient.OverloadDropConfig{
+		{Category: "cat-1", Numerator: 1, Denominator: 10},
+		{Category: "cat-1", Numerator: 1, Denominator: 10},
+	})
+	if got := edsb.DropConfigOverlapCount(); got != 2 {
+		t.Fatalf("DropConfigOverlapCount() after repeated-category drop config = %v, want 2", got)
+	}
+}
 
-	const testDropCategory = "test-drop"
-	// Two localities, each with one backend.
-	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], map[string]uint32{testDropCategory: 50})
-	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
-	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
-	sc1 := <-cc.NewSubConnCh
-	edsb.handleSubConnStateChange(sc1, connectivity.Connecting)
-	edsb.handleSubConnStateChange(sc1, connectivity.Ready)
-	locality1 := pkg.LocalityID{SubZone: testSubZones[0]}
-	backendToBalancerID[sc1] = locality1
+// TestDropPickerCounterPairedOnError covers the case that, when the inner
+// picker's Pick fails, the request counter incremented by StartRequest is
+// always paired with an EndRequest, instead of leaking. This is verified by
+// firing many failing picks and asserting the counter returns to zero.
+func (s) TestDropPickerCounterPairedOnError(t *testing.T) {
+	const serviceName = "test-drop-picker-counter-paired"
+	counter := client.GetServiceRequestsCounter(serviceName)
+	defer client.ClearCounterForTesting(serviceName)
+
+	errPicker := &testutils.TestConstPicker{Err: testutils.ErrTestConstPicker}
+	p := newDropPicker(errPicker, nil, nil, counter, defaultServiceRequestCountMax, nil, 0, nil, false, nil, nil)
+
+	const pickCount = 50
+	for i := 0; i < pickCount; i++ {
+		if _, err := p.Pick(balancer.PickInfo{}); err != testutils.ErrTestConstPicker {
+			t.Fatalf("p.Pick() returned err %v, want %v", err, testutils.ErrTestConstPicker)
+		}
+	}
 
-	// Add the second locality later to make sure sc2 belongs to the second
-	// locality. Otherwise the test is flaky because of a map is used in EDS to
-	// keep localities.
-	clab1.AddLocality(testSubZones[1], 1, 0, testEndpointAddrs[1:2], nil)
-	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
-	sc2 := <-cc.NewSubConnCh
-	edsb.handleSubConnStateChange(sc2, connectivity.Connecting)
-	edsb.handleSubConnStateChange(sc2, connectivity.Ready)
-	locality2 := pkg.LocalityID{SubZone: testSubZones[1]}
-	backendToBalancerID[sc2] = locality2
+	if err := counter.StartRequest(1); err != nil {
+		t.Fatalf("counter not back to zero after %d failing picks: StartRequest(1) failed with %v", pickCount, err)
+	}
+	counter.EndRequest()
+}
 
-	// Test roundrobin with two subconns.
-	p1 := <-cc.NewPickerCh
-	// We expect the 10 picks to be split between the localities since they are
-	// of equal weight. And since we only mark the picks routed to sc2 as done,
-	// the picks on sc1 should show up as inProgress.
-	locality1JSON, _ := locality1.ToString()
-	locality2JSON, _ := locality2.ToString()
-	const (
-		rpcCount = 100
-		// 50% will be dropped with category testDropCategory.
-		dropWithCategory = rpcCount / 2
-		// In the remaining RPCs, only cbMaxRequests are allowed by circuit
-		// breaking. Others will be dropped by CB.
-		dropWithCB = rpcCount - dropWithCategory - cbMaxRequests
+// TestDropPickerCircuitBreakingImmediateReject covers the default (non-queued)
+// circuit breaking behavior: once countMax is reached, Pick fails
+// immediately, without waiting for the RPC's context deadline.
+func (s) TestDropPickerCircuitBreakingImmediateReject(t *testing.T) {
+	const serviceName = "test-drop-picker-circuit-breaking-immediate-reject"
+	counter := client.GetServiceRequestsCounter(serviceName)
+	defer client.ClearCounterForTesting(serviceName)
+	if err := counter.StartRequest(1); err != nil {
+		t.Fatalf("counter.StartRequest(1) failed: %v", err)
+	}
+	defer counter.EndRequest()
 
-		rpcInProgress = cbMaxRequests / 2 // 50% of RPCs will be never done.
-		rpcSucceeded  = cbMaxRequests / 2 // 50% of RPCs will succeed.
-	)
-	wantStoreData := []*load.Data{{
-		Cluster: testClusterNames[0],
-		Service: "",
-		LocalityStats: map[string]load.LocalityData{
-			locality1JSON: {RequestStats: load.RequestData{InProgress: rpcInProgress}},
-			locality2JSON: {RequestStats: load.RequestData{Succeeded: rpcSucceeded}},
-		},
-		TotalDrops: dropWithCategory + dropWithCB,
-		Drops: map[string]uint64{
-			testDropCategory: dropWithCategory,
-		},
-	}}
+	constPicker := &testutils.TestConstPicker{SC: testutils.TestSubConns[0]}
+	p := newDropPicker(constPicker, nil, nil, counter, 1, nil, 0, nil, false, nil, nil)
 
-	var rpcsToBeDone []balancer.PickResult
-	// Run the picks, but only pick with sc1 will be done later.
-	for i := 0; i < rpcCount; i++ {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	start := time.Now()
+	if _, err := p.Pick(balancer.PickInfo{Ctx: ctx}); err == nil {
+		t.Fatalf("p.Pick() succeeded, want circuit breaking error")
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("p.Pick() took %v to reject, want an immediate rejection", elapsed)
+	}
+}
+
+// TestDropPickerCircuitBreakingQueue covers the queueing mode: a pick that
+// would otherwise be rejected by circuit breaking instead waits for a slot
+// to free up, bounded by the RPC's context deadline.
+func (s) TestDropPickerCircuitBreakingQueue(t *testing.T) {
+	const serviceName = "test-drop-picker-circuit-breaking-queue"
+	counter := client.GetServiceRequestsCounter(serviceName)
+	defer client.ClearCounterForTesting(serviceName)
+	if err := counter.StartRequest(1); err != nil {
+		t.Fatalf("counter.StartRequest(1) failed: %v", err)
+	}
+
+	constPicker := &testutils.TestConstPicker{SC: testutils.TestSubConns[0]}
+	p := newDropPicker(constPicker, nil, nil, counter, 1, nil, 0, nil, true, nil, nil)
+
+	// Free up the slot shortly after the pick starts queueing.
+	time.AfterFunc(50*time.Millisecond, counter.EndRequest)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	pr, err := p.Pick(balancer.PickInfo{Ctx: ctx})
+	if err != nil {
+		t.Fatalf("p.Pick() failed: %v, want it to succeed once the slot freed up", err)
+	}
+	if pr.Done != nil {
+		pr.Done(balancer.DoneInfo{})
+	}
+
+	// A context that's already passed its deadline should still result in
+	// an immediate rejection, not an indefinite wait.
+	if err := counter.StartRequest(1); err != nil {
+		t.Fatalf("counter.StartRequest(1) failed: %v", err)
+	}
+	expiredCtx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	if _, err := p.Pick(balancer.PickInfo{Ctx: expiredCtx}); err == nil {
+		t.Fatalf("p.Pick() with an expired context succeeded, want circuit breaking error")
+	}
+	counter.EndRequest()
+}
+
+// TestDropPickerGlobalCircuitBreaking covers the optional global (process-wide)
+// request limit: two dropPickers for distinct services, each with its own
+// per-service counter well under its own limit, must still be rejected once
+// their combined in-flight count trips the shared global counter.
+func (s) TestDropPickerGlobalCircuitBreaking(t *testing.T) {
+	const service1, service2 = "test-global-cb-service-1", "test-global-cb-service-2"
+	counter1 := client.GetServiceRequestsCounter(service1)
+	counter2 := client.GetServiceRequestsCounter(service2)
+	defer client.ClearCounterForTesting(service1)
+	defer client.ClearCounterForTesting(service2)
+	globalCounter := client.GetGlobalRequestsCounter()
+	defer client.ClearGlobalCounterForTesting()
+
+	const globalMax = 2
+	constPicker := &testutils.TestConstPicker{SC: testutils.TestSubConns[0]}
+	p1 := newDropPicker(constPicker, nil, nil, counter1, 100, globalCounter, globalMax, nil, false, nil, nil)
+	p2 := newDropPicker(constPicker, nil, nil, counter2, 100, globalCounter, globalMax, nil, false, nil, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// The first globalMax picks, split across both services, succeed: the
+	// per-service counters are nowhere near their own (much higher) limit.
+	pr1, err := p1.Pick(balancer.PickInfo{Ctx: ctx})
+	if err != nil {
+		t.Fatalf("p1.Pick() failed: %v", err)
+	}
+	pr2, err := p2.Pick(balancer.PickInfo{Ctx: ctx})
+	if err != nil {
+		t.Fatalf("p2.Pick() failed: %v", err)
+	}
+
+	// A third pick, against either service, must be rejected: the combined
+	// in-flight count across both services has reached the global cap.
+	if _, err := p1.Pick(balancer.PickInfo{Ctx: ctx}); err == nil {
+		t.Fatalf("p1.Pick() succeeded, want rejection by the global circuit breaker")
+	}
+	if _, err := p2.Pick(balancer.PickInfo{Ctx: ctx}); err == nil {
+		t.Fatalf("p2.Pick() succeeded, want rejection by the global circuit breaker")
+	}
+
+	// Completing one request frees a global slot for either service.
+	if pr1.Done != nil {
+		pr1.Done(balancer.DoneInfo{})
+	}
+	pr3, err := p2.Pick(balancer.PickInfo{Ctx: ctx})
+	if err != nil {
+		t.Fatalf("p2.Pick() failed after freeing a global slot: %v", err)
+	}
+	if _, err := p1.Pick(balancer.PickInfo{Ctx: ctx}); err == nil {
+		t.Fatalf("p1.Pick() succeeded, want rejection: global slot should be exhausted again")
+	}
+
+	if pr2.Done != nil {
+		pr2.Done(balancer.DoneInfo{})
+	}
+	if pr3.Done != nil {
+		pr3.Done(balancer.DoneInfo{})
+	}
+}
+
+// TestDropPickerCategoryStats covers the case that dropPicker increments the
+// dropCategoryStats snapshot by category for every dropped pick, driving
+// picks through a deterministic dropper and asserting per-category counts.
+func (s) TestDropPickerCategoryStats(t *testing.T) {
+	const pickCount = 100
+	constPicker := &testutils.TestConstPicker{SC: testutils.TestSubConns[0]}
+	// The deterministic test WRR (installed in util_test.go) alternates
+	// true/false evenly for a 1/2 ratio, making the expected count exact.
+	drops := []*dropper{
+		newDropper(xdsclient.OverloadDropConfig{Category: "cat-1", Numerator: 1, Denominator: 2}),
+	}
+
+	stats := newDropCategoryStats()
+	p := newDropPicker(constPicker, drops, nil, nil, defaultServiceRequestCountMax, nil, 0, stats, false, nil, nil)
+	for i := 0; i < pickCount; i++ {
+		p.Pick(balancer.PickInfo{})
+	}
+
+	got := stats.snapshot()
+	want := map[string]uint64{"cat-1": pickCount / 2}
+	if !cmp.Equal(got, want) {
+		t.Errorf("dropCategoryStats.snapshot() = %v, want %v", got, want)
+	}
+}
+
+// TestEDSWrapPicker verifies that wrapPicker returns the raw inner picker
+// unmodified when no drop config, load reporter, circuit breaking counter,
+// or in-progress drain is active, and falls back to wrapping in a dropPicker
+// as soon as any of those is present.
+func (s) TestEDSWrapPicker(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	inner := &testutils.TestConstPicker{SC: testutils.TestSubConns[0]}
+
+	if got := edsb.wrapPicker(inner); got != balancer.Picker(inner) {
+		t.Errorf("wrapPicker() with no drop/CB/load config = %v, want the raw inner picker %v", got, inner)
+	}
+
+	edsb.drops = []*dropper{newDropper(xdsclient.OverloadDropConfig{Numerator: 1, Denominator: 2})}
+	if _, ok := edsb.wrapPicker(inner).(*dropPicker); !ok {
+		t.Errorf("wrapPicker() with drops set did not return a *dropPicker")
+	}
+	edsb.drops = nil
+
+	edsb.loadReporter = load.NewStore().PerCluster(testClusterNames[0], "")
+	if _, ok := edsb.wrapPicker(inner).(*dropPicker); !ok {
+		t.Errorf("wrapPicker() with a load reporter set did not return a *dropPicker")
+	}
+	edsb.loadReporter = nil
+
+	atomic.StoreInt32(&edsb.draining, 1)
+	if _, ok := edsb.wrapPicker(inner).(*dropPicker); !ok {
+		t.Errorf("wrapPicker() while draining did not return a *dropPicker")
+	}
+}
+
+// BenchmarkDropPickerBypassed and BenchmarkDropPickerWrapped compare the
+// per-pick overhead wrapPicker avoids (see TestEDSWrapPicker) when no
+// drop/CB/load config is active.
+func BenchmarkDropPickerBypassed(b *testing.B) {
+	edsb := newEDSBalancerImpl(nil, balancer.BuildOptions{}, nil, nil, nil, nil)
+	p := edsb.wrapPicker(&testutils.TestConstPicker{SC: testutils.TestSubConns[0]})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Pick(balancer.PickInfo{})
+	}
+}
+
+func BenchmarkDropPickerWrapped(b *testing.B) {
+	p := newDropPicker(&testutils.TestConstPicker{SC: testutils.TestSubConns[0]}, nil, nil, nil, defaultServiceRequestCountMax, nil, 0, nil, false, nil, nil)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Pick(balancer.PickInfo{})
+	}
+}
+
+// TestDropPickerDraining covers dropPicker's half of closeWithDrain: once
+// draining is set, Pick rejects new picks with ErrNoSubConnAvailable, but
+// picks already in flight are tracked until their Done callback fires.
+func (s) TestDropPickerDraining(t *testing.T) {
+	var (
+		inFlight sync.WaitGroup
+		draining int32
+	)
+	constPicker := &testutils.TestConstPicker{SC: testutils.TestSubConns[0]}
+	p := newDropPicker(constPicker, nil, nil, nil, defaultServiceRequestCountMax, nil, 0, nil, false, &inFlight, &draining)
+
+	pr, err := p.Pick(balancer.PickInfo{})
+	if err != nil {
+		t.Fatalf("p.Pick() failed: %v", err)
+	}
+
+	atomic.StoreInt32(&draining, 1)
+	if _, err := p.Pick(balancer.PickInfo{}); err != balancer.ErrNoSubConnAvailable {
+		t.Fatalf("p.Pick() while draining returned err %v, want %v", err, balancer.ErrNoSubConnAvailable)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		inFlight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		t.Fatalf("inFlight drained before the in-flight RPC completed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	pr.Done(balancer.DoneInfo{})
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatalf("inFlight did not drain after the in-flight RPC completed")
+	}
+}
+
+// TestEDSCloseWithDrain verifies that closeWithDrain rejects new picks
+// immediately, but doesn't return until in-flight RPCs (tracked via
+// dropPicker) complete, bounded by the passed-in context.
+func (s) TestEDSCloseWithDrain(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+
+	// Simulate one RPC still in flight.
+	edsb.inFlight.Add(1)
+
+	done := make(chan struct{})
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		edsb.closeWithDrain(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatalf("closeWithDrain() returned before the in-flight RPC completed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if got := atomic.LoadInt32(&edsb.draining); got != 1 {
+		t.Fatalf("draining = %v, want 1 once closeWithDrain has started", got)
+	}
+
+	edsb.inFlight.Done()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("closeWithDrain() did not return after the in-flight RPC completed")
+	}
+}
+
+// TestEDSCloseWithDrainTimesOut verifies that closeWithDrain gives up
+// waiting for in-flight RPCs once ctx expires, instead of blocking forever.
+func (s) TestEDSCloseWithDrainTimesOut(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+
+	edsb.inFlight.Add(1) // Not completed until after closeWithDrain returns.
+	defer edsb.inFlight.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		edsb.closeWithDrain(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("closeWithDrain() did not return after ctx expired")
+	}
+}
+
+// fakeLoadReporter is a load.PerClusterReporter that only tracks drops and
+// how many times Flush is called, for TestEDSCloseFlushesLoadReporter.
+type fakeLoadReporter struct {
+	mu      sync.Mutex
+	dropped map[string]int
+	flushed int
+}
+
+func (r *fakeLoadReporter) CallStarted(locality string)                       {}
+func (r *fakeLoadReporter) CallFinished(locality string, err error)           {}
+func (r *fakeLoadReporter) CallServerLoad(locality, name string, val float64) {}
+
+func (r *fakeLoadReporter) CallDropped(ctx context.Context, method, category string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.dropped == nil {
+		r.dropped = make(map[string]int)
+	}
+	r.dropped[category]++
+}
+
+func (r *fakeLoadReporter) Flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.flushed++
+}
+
+// TestEDSCloseFlushesLoadReporter verifies that edsBalancerImpl.close calls
+// Flush on its loadReporter exactly once, after all pending drops have been
+// recorded.
+func (s) TestEDSCloseFlushesLoadReporter(t *testing.T) {
+	const testDropCategory = "test-drop"
+
+	lr := &fakeLoadReporter{}
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, lr, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], map[string]uint32{testDropCategory: 100})
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+	sc := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc, connectivity.Ready)
+
+	p := <-cc.NewPickerCh
+	const rpcCount = 5
+	for i := 0; i < rpcCount; i++ {
+		if _, err := p.Pick(balancer.PickInfo{}); err == nil {
+			t.Fatalf("Pick() succeeded, want it dropped (100%% drop rate)")
+		}
+	}
+
+	edsb.close()
+
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	if lr.flushed != 1 {
+		t.Errorf("close() called Flush() %d times, want 1", lr.flushed)
+	}
+	if got := lr.dropped[testDropCategory]; got != rpcCount {
+		t.Errorf("Flush() observed %d drops for category %q, want %d", got, testDropCategory, rpcCount)
+	}
+}
+
+func (s) TestEDS_LoadReport(t *testing.T) {
+	origCircuitBreakingSupport := env.CircuitBreakingSupport
+	env.CircuitBreakingSupport = true
+	defer func() { env.CircuitBreakingSupport = origCircuitBreakingSupport }()
+
+	// We create an xdsClientWrapper with a dummy xdsClientInterface which only
+	// implements the LoadStore() method to return the underlying load.Store to
+	// be used.
+	loadStore := load.NewStore()
+	lsWrapper := &loadStoreWrapper{}
+	lsWrapper.updateServiceName(testClusterNames[0])
+	lsWrapper.updateLoadStore(loadStore)
+
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, lsWrapper, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	const (
+		testServiceName = "test-service"
+		cbMaxRequests   = 20
+	)
+	var maxRequestsTemp uint32 = cbMaxRequests
+	edsb.updateServiceRequestsConfig(testServiceName, &maxRequestsTemp)
+	defer client.ClearCounterForTesting(testServiceName)
+
+	backendToBalancerID := make(map[balancer.SubConn]pkg.LocalityID)
+
+	const testDropCategory = "test-drop"
+	// Two localities, each with one backend.
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], map[string]uint32{testDropCategory: 50})
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+	sc1 := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc1, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc1, connectivity.Ready)
+	locality1 := pkg.LocalityID{SubZone: testSubZones[0]}
+	backendToBalancerID[sc1] = locality1
+
+	// Add the second locality later to make sure sc2 belongs to the second
+	// locality. Otherwise the test is flaky because of a map is used in EDS to
+	// keep localities.
+	clab1.AddLocality(testSubZones[1], 1, 0, testEndpointAddrs[1:2], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+	sc2 := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc2, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc2, connectivity.Ready)
+	locality2 := pkg.LocalityID{SubZone: testSubZones[1]}
+	backendToBalancerID[sc2] = locality2
+
+	// Test roundrobin with two subconns.
+	p1 := <-cc.NewPickerCh
+	// We expect the 10 picks to be split between the localities since they are
+	// of equal weight. And since we only mark the picks routed to sc2 as done,
+	// the picks on sc1 should show up as inProgress.
+	locality1JSON, _ := locality1.ToString()
+	locality2JSON, _ := locality2.ToString()
+	const (
+		rpcCount = 100
+		// 50% will be dropped with category testDropCategory.
+		dropWithCategory = rpcCount / 2
+		// In the remaining RPCs, only cbMaxRequests are allowed by circuit
+		// breaking. Others will be dropped by CB.
+		dropWithCB = rpcCount - dropWithCategory - cbMaxRequests
+
+		rpcInProgress = cbMaxRequests / 2 // 50% of RPCs will be never done.
+		rpcSucceeded  = cbMaxRequests / 2 // 50% of RPCs will succeed.
+	)
+	wantStoreData := []*load.Data{{
+		Cluster: testClusterNames[0],
+		Service: "",
+		LocalityStats: map[string]load.LocalityData{
+			locality1JSON: {RequestStats: load.RequestData{InProgress: rpcInProgress}},
+			locality2JSON: {RequestStats: load.RequestData{Succeeded: rpcSucceeded}},
+		},
+		TotalDrops: dropWithCategory + dropWithCB,
+		Drops: map[string]uint64{
+			testDropCategory: dropWithCategory,
+		},
+	}}
+
+	var rpcsToBeDone []balancer.PickResult
+	// Run the picks, but only pick with sc1 will be done later.
+	for i := 0; i < rpcCount; i++ {
 		scst, _ := p1.Pick(balancer.PickInfo{})
 		if scst.Done != nil && scst.SubConn != sc1 {
 			rpcsToBeDone = append(rpcsToBeDone, scst)
@@ -915,7 +1687,7 @@ func (s) TestEDS_LoadReportDisabled(t *testing.T) {
 	// Not calling lsWrapper.updateLoadStore(loadStore) because LRS is disabled.
 
 	cc := testutils.NewTestClientConn(t)
-	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, lsWrapper, nil)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, lsWrapper, nil, nil)
 	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
 
 	// One localities, with one backend.
@@ -933,3 +1705,537 @@ func (s) TestEDS_LoadReportDisabled(t *testing.T) {
 		p1.Pick(balancer.PickInfo{})
 	}
 }
+
+// fakeORCAReportListener records every OnLoadReport call it receives, keyed
+// by the address of the backend the report came from.
+type fakeORCAReportListener struct {
+	mu      sync.Mutex
+	reports map[string][]*orcapb.OrcaLoadReport
+}
+
+func newFakeORCAReportListener() *fakeORCAReportListener {
+	return &fakeORCAReportListener{reports: make(map[string][]*orcapb.OrcaLoadReport)}
+}
+
+func (f *fakeORCAReportListener) OnLoadReport(addr resolver.Address, report *orcapb.OrcaLoadReport) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reports[addr.Addr] = append(f.reports[addr.Addr], report)
+}
+
+func (f *fakeORCAReportListener) reportsFor(addr string) []*orcapb.OrcaLoadReport {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reports[addr]
+}
+
+// TestEDS_ORCALoadReport covers the case where an orcaListener is set on the
+// eds balancer: for every completed RPC whose balancer.DoneInfo carries an
+// ORCA load report, the report must be forwarded to the listener along with
+// the address of the backend that served the RPC.
+func (s) TestEDS_ORCALoadReport(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+	listener := newFakeORCAReportListener()
+	edsb.orcaListener = listener
+
+	// Two localities, each with one backend.
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	clab1.AddLocality(testSubZones[1], 1, 0, testEndpointAddrs[1:2], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+
+	sc1 := <-cc.NewSubConnCh
+	addrs1 := <-cc.NewSubConnAddrsCh
+	edsb.handleSubConnStateChange(sc1, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc1, connectivity.Ready)
+	sc2 := <-cc.NewSubConnCh
+	addrs2 := <-cc.NewSubConnAddrsCh
+	edsb.handleSubConnStateChange(sc2, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc2, connectivity.Ready)
+
+	p := <-cc.NewPickerCh
+	scToReport := map[balancer.SubConn]*orcapb.OrcaLoadReport{
+		sc1: {CpuUtilization: 0.5},
+		sc2: {CpuUtilization: 0.8},
+	}
+	// Pick until each SubConn has been exercised at least once, and invoke
+	// Done with a distinct ORCA report for each.
+	seen := make(map[balancer.SubConn]bool)
+	for i := 0; i < 100 && len(seen) < len(scToReport); i++ {
+		pr, err := p.Pick(balancer.PickInfo{})
+		if err != nil {
+			continue
+		}
+		seen[pr.SubConn] = true
+		if pr.Done != nil {
+			pr.Done(balancer.DoneInfo{ServerLoad: scToReport[pr.SubConn]})
+		}
+	}
+
+	if got := listener.reportsFor(addrs1[0].Addr); len(got) == 0 || got[0] != scToReport[sc1] {
+		t.Errorf("listener got reports %v for sc1's address, want a report matching %v", got, scToReport[sc1])
+	}
+	if got := listener.reportsFor(addrs2[0].Addr); len(got) == 0 || got[0] != scToReport[sc2] {
+		t.Errorf("listener got reports %v for sc2's address, want a report matching %v", got, scToReport[sc2])
+	}
+}
+
+// TestEDS_AddressTransformer covers the case where an addressTransformer is
+// set on the eds balancer: every resolver.Address built from an EDS endpoint
+// must be rewritten by it before being used to create a SubConn.
+func (s) TestEDS_AddressTransformer(t *testing.T) {
+	const proxyAddr = "proxy.example.com:443"
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+	edsb.addressTransformer = func(addr resolver.Address) resolver.Address {
+		addr.Addr = proxyAddr
+		return addr
+	}
+
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+
+	addrs := <-cc.NewSubConnAddrsCh
+	if len(addrs) != 1 || addrs[0].Addr != proxyAddr {
+		t.Fatalf("got SubConn addresses %v, want a single address %q", addrs, proxyAddr)
+	}
+}
+
+// TestEDS_LocalityPickingPolicyDeterministic covers updateLocalityPickingPolicy(true):
+// it switches the weightedaggregator from the default weighted-random WRR to
+// the deterministic EDF scheduler, which must produce the exact same
+// interleaving of localities every period (period == sum of the locality
+// weights), instead of a fresh random draw each time.
+func (s) TestEDS_LocalityPickingPolicyDeterministic(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+	edsb.updateLocalityPickingPolicy(true)
+
+	// Two localities in the same priority, with weights 2 and 1.
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 2, 0, testEndpointAddrs[:1], nil)
+	clab1.AddLocality(testSubZones[1], 1, 0, testEndpointAddrs[1:2], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+
+	sc1 := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc1, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc1, connectivity.Ready)
+	sc2 := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc2, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc2, connectivity.Ready)
+
+	p := <-cc.NewPickerCh
+	const period = 3 // sum of the locality weights
+	pick := func() balancer.SubConn {
+		pr, err := p.Pick(balancer.PickInfo{})
+		if err != nil {
+			t.Fatalf("unexpected error from Pick(): %v", err)
+		}
+		return pr.SubConn
+	}
+
+	firstPeriod := []balancer.SubConn{pick(), pick(), pick()}
+	gotWeight := map[balancer.SubConn]int{}
+	for _, sc := range firstPeriod {
+		gotWeight[sc]++
+	}
+	if gotWeight[sc1] != 2 || gotWeight[sc2] != 1 {
+		t.Fatalf("pick distribution over one period = {sc1: %v, sc2: %v}, want {sc1: 2, sc2: 1}", gotWeight[sc1], gotWeight[sc2])
+	}
+
+	// A deterministic scheduler repeats the exact same sequence every
+	// period; a random one would not.
+	for i := 0; i < 3; i++ {
+		for j, want := range firstPeriod {
+			if got := pick(); got != want {
+				t.Fatalf("pick sequence changed between periods at index %v: got %v, want %v (same as the first period), want the same sequence every period with the deterministic policy", j, got, want)
+			}
+		}
+	}
+}
+
+// TestEDS_SubConnToPrioritySnapshot covers subConnToPrioritySnapshot: it
+// should report the priority of every SubConn created so far, across
+// priorities, and stop reporting a SubConn once it's shut down.
+func (s) TestEDS_SubConnToPrioritySnapshot(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	// Two localities, with priorities [0, 1], each with one backend.
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	clab1.AddLocality(testSubZones[1], 1, 1, testEndpointAddrs[1:2], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+	sc0 := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc0, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc0, connectivity.Ready)
+
+	if got := edsb.subConnToPrioritySnapshot(); !cmp.Equal(got, map[balancer.SubConn]uint32{sc0: 0}, cmp.AllowUnexported(testutils.TestSubConn{})) {
+		t.Fatalf("subConnToPrioritySnapshot() = %v, want {sc0: 0}", got)
+	}
+
+	// Turn priority 0 down, so priority 1's SubConn gets created too.
+	edsb.handleSubConnStateChange(sc0, connectivity.TransientFailure)
+	sc1 := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc1, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc1, connectivity.Ready)
+
+	want := map[balancer.SubConn]uint32{sc0: 0, sc1: 1}
+	if got := edsb.subConnToPrioritySnapshot(); !cmp.Equal(got, want, cmp.AllowUnexported(testutils.TestSubConn{})) {
+		t.Fatalf("subConnToPrioritySnapshot() = %v, want %v", got, want)
+	}
+
+	// Shutting down sc0 should remove it from the snapshot.
+	edsb.handleSubConnStateChange(sc0, connectivity.Shutdown)
+	want = map[balancer.SubConn]uint32{sc1: 1}
+	if got := edsb.subConnToPrioritySnapshot(); !cmp.Equal(got, want, cmp.AllowUnexported(testutils.TestSubConn{})) {
+		t.Fatalf("subConnToPrioritySnapshot() = %v, want %v", got, want)
+	}
+}
+
+// TestEDS_LocalityWeightStateSnapshot covers localityWeightStateSnapshot: it
+// should report each locality's weight and connectivity state, so a locality
+// that's up but getting no traffic because of its weight ("up" entry) is
+// distinguishable from one that's actually down ("down" entry).
+func (s) TestEDS_LocalityWeightStateSnapshot(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	// Two localities at the same priority, with different weights.
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality("up", 99, 0, testEndpointAddrs[:1], nil)
+	clab1.AddLocality("down", 1, 0, testEndpointAddrs[1:2], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+
+	// SubConns aren't necessarily created in locality order, so match each
+	// one to its locality by address instead of assuming an order.
+	scForAddr := make(map[string]balancer.SubConn)
+	for i := 0; i < 2; i++ {
+		addrs := <-cc.NewSubConnAddrsCh
+		scForAddr[addrs[0].Addr] = <-cc.NewSubConnCh
+	}
+	scUp, scDown := scForAddr[testEndpointAddrs[0]], scForAddr[testEndpointAddrs[1]]
+	edsb.handleSubConnStateChange(scUp, connectivity.Connecting)
+	edsb.handleSubConnStateChange(scUp, connectivity.Ready)
+	edsb.handleSubConnStateChange(scDown, connectivity.Connecting)
+	edsb.handleSubConnStateChange(scDown, connectivity.TransientFailure)
+
+	want := map[string]weightedaggregator.WeightedState{
+		`{"subZone":"up"}`:   {Weight: 99, State: connectivity.Ready},
+		`{"subZone":"down"}`: {Weight: 1, State: connectivity.TransientFailure},
+	}
+	if got := edsb.localityWeightStateSnapshot(newPriorityType(0)); !cmp.Equal(got, want) {
+		t.Fatalf("localityWeightStateSnapshot() = %v, want %v", got, want)
+	}
+}
+
+// TestEDS_EffectiveLocalityWeights covers effectiveLocalityWeights: raw EDS
+// weights {1, 3} should normalize to effective pick probabilities
+// {0.25, 0.75}.
+func (s) TestEDS_EffectiveLocalityWeights(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality("minority", 1, 0, testEndpointAddrs[:1], nil)
+	clab1.AddLocality("majority", 3, 0, testEndpointAddrs[1:2], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+
+	want := map[string]float64{
+		`{"subZone":"minority"}`: 0.25,
+		`{"subZone":"majority"}`: 0.75,
+	}
+	if got := edsb.effectiveLocalityWeights(newPriorityType(0)); !cmp.Equal(got, want) {
+		t.Fatalf("effectiveLocalityWeights() = %v, want %v", got, want)
+	}
+}
+
+// healthCheckOptsCapturingCC wraps a TestClientConn and records the
+// NewSubConnOptions passed to the most recent NewSubConn call, so that tests
+// can assert on options (like HealthCheckEnabled) that TestClientConn itself
+// doesn't expose.
+type healthCheckOptsCapturingCC struct {
+	*testutils.TestClientConn
+	lastOpts balancer.NewSubConnOptions
+}
+
+func (cc *healthCheckOptsCapturingCC) NewSubConn(a []resolver.Address, o balancer.NewSubConnOptions) (balancer.SubConn, error) {
+	cc.lastOpts = o
+	return cc.TestClientConn.NewSubConn(a, o)
+}
+
+// TestEDS_HealthCheckConfig covers updateHealthCheckConfig: once enabled, it
+// must make newSubConn force HealthCheckEnabled on, even if the caller (the
+// child policy) didn't ask for it; once disabled again, newSubConn must go
+// back to passing the caller's options through unchanged.
+func (s) TestEDS_HealthCheckConfig(t *testing.T) {
+	cc := &healthCheckOptsCapturingCC{TestClientConn: testutils.NewTestClientConn(t)}
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	addrs := []resolver.Address{{Addr: testEndpointAddrs[0]}}
+
+	if _, err := edsb.newSubConn(priorityType{}, addrs, balancer.NewSubConnOptions{}); err != nil {
+		t.Fatalf("newSubConn() failed: %v", err)
+	}
+	if cc.lastOpts.HealthCheckEnabled {
+		t.Fatalf("HealthCheckEnabled = true before updateHealthCheckConfig(true), want false")
+	}
+
+	edsb.updateHealthCheckConfig(true)
+	if _, err := edsb.newSubConn(priorityType{}, addrs, balancer.NewSubConnOptions{}); err != nil {
+		t.Fatalf("newSubConn() failed: %v", err)
+	}
+	if !cc.lastOpts.HealthCheckEnabled {
+		t.Fatalf("HealthCheckEnabled = false after updateHealthCheckConfig(true), want true")
+	}
+
+	edsb.updateHealthCheckConfig(false)
+	if _, err := edsb.newSubConn(priorityType{}, addrs, balancer.NewSubConnOptions{}); err != nil {
+		t.Fatalf("newSubConn() failed: %v", err)
+	}
+	if cc.lastOpts.HealthCheckEnabled {
+		t.Fatalf("HealthCheckEnabled = true after updateHealthCheckConfig(false), want false")
+	}
+}
+
+// TestEDS_LocalityWeightedLBConfig verifies that a weight-0 locality is
+// excluded by default (locality weighted LB assumed enabled), but is instead
+// included at defaultLocalityWeight once updateLocalityWeightedLBConfig(false)
+// has been called.
+func (s) TestEDS_LocalityWeightedLBConfig(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	clab1.AddLocality(testSubZones[1], 0, 0, testEndpointAddrs[1:2], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+
+	sc1 := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc1, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc1, connectivity.Ready)
+
+	select {
+	case sc := <-cc.NewSubConnCh:
+		t.Fatalf("unexpected NewSubConn for the weight-0 locality's endpoint: %v", sc)
+	case <-time.After(defaultTestShortTimeout):
+	}
+
+	edsb.updateLocalityWeightedLBConfig(false)
+	clab2 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab2.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	clab2.AddLocality(testSubZones[1], 0, 0, testEndpointAddrs[1:2], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab2.Build()))
+
+	sc2 := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc2, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc2, connectivity.Ready)
+
+	p := <-cc.NewPickerCh
+	want := []balancer.SubConn{sc1, sc2}
+	if err := testutils.IsRoundRobin(want, subConnFromPicker(p)); err != nil {
+		t.Fatalf("want %v, got %v", want, err)
+	}
+}
+
+// TestEDS_EndpointWeight verifies that, within a locality, an endpoint whose
+// load_balancing_weight is unset gets a SubConn like any other endpoint,
+// while an endpoint with an explicit weight of 0 is excluded entirely.
+func (s) TestEDS_EndpointWeight(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	// endpoint 0 has an explicit weight of 0 and should be excluded;
+	// endpoints 1 and 2 have their weight left unset and should both
+	// still get a SubConn.
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:3], &testutils.AddLocalityOptions{
+		Weight: []uint32{0},
+	})
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+
+	sc1 := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc1, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc1, connectivity.Ready)
+	sc2 := <-cc.NewSubConnCh
+	edsb.handleSubConnStateChange(sc2, connectivity.Connecting)
+	edsb.handleSubConnStateChange(sc2, connectivity.Ready)
+
+	select {
+	case sc := <-cc.NewSubConnCh:
+		t.Fatalf("unexpected NewSubConn for the weight-0 endpoint: %v", sc)
+	case <-time.After(defaultTestShortTimeout):
+	}
+
+	p := <-cc.NewPickerCh
+	want := []balancer.SubConn{sc1, sc2}
+	if err := testutils.IsRoundRobin(want, subConnFromPicker(p)); err != nil {
+		t.Fatalf("want %v, got %v", want, err)
+	}
+}
+
+// TestEDS_EndpointHealthStatusAttribute covers the health status that
+// parseEDSRespProto attaches to each xdsclient.Endpoint (client.go):
+// it should come through unchanged as a resolver.Address attribute,
+// readable via xdsclient.GetHealthStatus, on every address handed to the
+// child balancer's SubConn.
+func (s) TestEDS_EndpointHealthStatusAttribute(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:2], &testutils.AddLocalityOptions{
+		Health: []corepb.HealthStatus{
+			corepb.HealthStatus_HEALTHY,
+			corepb.HealthStatus_UNKNOWN,
+		},
+	})
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+
+	want := map[string]xdsclient.EndpointHealthStatus{
+		testEndpointAddrs[0]: xdsclient.EndpointHealthStatusHealthy,
+		testEndpointAddrs[1]: xdsclient.EndpointHealthStatusUnknown,
+	}
+	for i := 0; i < 2; i++ {
+		addrs := <-cc.NewSubConnAddrsCh
+		if len(addrs) != 1 {
+			t.Fatalf("got %d addresses in NewSubConn, want 1", len(addrs))
+		}
+		addr := addrs[0]
+		if got, want := xdsclient.GetHealthStatus(addr), want[addr.Addr]; got != want {
+			t.Errorf("GetHealthStatus(%v) = %v, want %v", addr.Addr, got, want)
+		}
+	}
+}
+
+// TestEDS_AllZeroWeightLocalitiesInPriority covers a priority whose
+// localities all have weight 0: with locality weighted load balancing
+// enabled (the default), every one of them is filtered out by
+// handleEDSResponse. Rather than the priority silently disappearing (no
+// failure signal, and an empty-but-existing balancer group if something
+// later references it), it should be explicitly marked failed, so the
+// picker it contributes reports TransientFailure.
+func (s) TestEDS_AllZeroWeightLocalitiesInPriority(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 0, 0, testEndpointAddrs[:1], nil)
+	clab1.AddLocality(testSubZones[1], 0, 0, testEndpointAddrs[1:2], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+
+	select {
+	case sc := <-cc.NewSubConnCh:
+		t.Fatalf("unexpected NewSubConn for an all-zero-weight priority: %v", sc)
+	case <-time.After(defaultTestShortTimeout):
+	}
+
+	p := <-cc.NewPickerCh
+	if _, err := p.Pick(balancer.PickInfo{}); err != balancer.ErrTransientFailure {
+		t.Fatalf("picker.Pick, got error %v, want %v", err, balancer.ErrTransientFailure)
+	}
+}
+
+// TestEDS_SubConnCreationFailure covers the case where cc.NewSubConn fails
+// (e.g. because it was passed an address it can't parse): the failure should
+// be recorded via subConnFailureCb rather than silently disappearing into the
+// returned, unused error.
+func (s) TestEDS_SubConnCreationFailure(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	cc.NewSubConnError = errors.New("no addresses available")
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	var gotEvents []subConnFailureEvent
+	edsb.subConnFailureCb = func(e subConnFailureEvent) {
+		gotEvents = append(gotEvents, e)
+	}
+
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+
+	select {
+	case sc := <-cc.NewSubConnCh:
+		t.Fatalf("unexpected NewSubConn success: %v", sc)
+	case <-time.After(defaultTestShortTimeout):
+	}
+
+	if len(gotEvents) != 1 {
+		t.Fatalf("got %d subConnFailureEvents, want 1: %+v", len(gotEvents), gotEvents)
+	}
+	if got := gotEvents[0]; got.Priority != newPriorityType(0) || got.Err != cc.NewSubConnError {
+		t.Errorf("subConnFailureEvent = %+v, want Priority %v and Err %v", got, newPriorityType(0), cc.NewSubConnError)
+	}
+}
+
+// TestEDS_LocalityChangeCallback covers the case where localityChangeCb is
+// set: it should observe, in order, a locality being added, a second
+// locality being added, the first locality's weight changing, and finally
+// the first locality being removed, each with the locality's current weight
+// and address count (zero for a removal).
+func (s) TestEDS_LocalityChangeCallback(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := newEDSBalancerImpl(cc, balancer.BuildOptions{}, nil, nil, nil, nil)
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+
+	var gotEvents []localityChangeEvent
+	edsb.localityChangeCb = func(e localityChangeEvent) {
+		gotEvents = append(gotEvents, e)
+	}
+
+	// Add locality 0.
+	clab1 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab1.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab1.Build()))
+	<-cc.NewSubConnCh
+
+	// Add locality 1.
+	clab2 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab2.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	clab2.AddLocality(testSubZones[1], 1, 0, testEndpointAddrs[1:2], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab2.Build()))
+	<-cc.NewSubConnCh
+
+	// Change locality 0's weight.
+	clab3 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab3.AddLocality(testSubZones[0], 2, 0, testEndpointAddrs[:1], nil)
+	clab3.AddLocality(testSubZones[1], 1, 0, testEndpointAddrs[1:2], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab3.Build()))
+
+	// Remove locality 0.
+	clab4 := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab4.AddLocality(testSubZones[1], 1, 0, testEndpointAddrs[1:2], nil)
+	edsb.handleEDSResponse(parseEDSRespProtoForTesting(clab4.Build()))
+	<-cc.RemoveSubConnCh
+
+	wantTypes := []localityChangeType{localityChangeTypeAdded, localityChangeTypeAdded, localityChangeTypeUpdated, localityChangeTypeRemoved}
+	if len(gotEvents) != len(wantTypes) {
+		t.Fatalf("got %d localityChangeEvents, want %d: %+v", len(gotEvents), len(wantTypes), gotEvents)
+	}
+	for i, want := range wantTypes {
+		if got := gotEvents[i].Type; got != want {
+			t.Errorf("localityChangeEvents[%d].Type = %v, want %v", i, got, want)
+		}
+	}
+	if got := gotEvents[0]; got.Weight != 1 || got.AddrCount != 1 {
+		t.Errorf("first added event = %+v, want Weight 1 and AddrCount 1", got)
+	}
+	if got := gotEvents[2]; got.Weight != 2 || got.AddrCount != 1 {
+		t.Errorf("updated event = %+v, want Weight 2 and AddrCount 1", got)
+	}
+	if got := gotEvents[3]; got.Weight != 0 || got.AddrCount != 0 {
+		t.Errorf("removed event = %+v, want Weight 0 and AddrCount 0", got)
+	}
+}
@@ -32,7 +32,9 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/internal/buffer"
 	"google.golang.org/grpc/internal/grpclog"
+	"google.golang.org/grpc/internal/grpcsync"
 	"google.golang.org/grpc/internal/grpctest"
 	scpb "google.golang.org/grpc/internal/proto/grpc_service_config"
 	"google.golang.org/grpc/internal/testutils"
@@ -117,6 +119,7 @@ type fakeEDSBalancer struct {
 	edsUpdate          *testutils.Channel
 	serviceName        *testutils.Channel
 	serviceRequestMax  *testutils.Channel
+	localityBatchQueue *buffer.Unbounded
 }
 
 func (f *fakeEDSBalancer) handleSubConnStateChange(sc balancer.SubConn, state connectivity.State) {
@@ -127,6 +130,9 @@ func (f *fakeEDSBalancer) handleChildPolicy(name string, config json.RawMessage)
 	f.childPolicy.Send(&loadBalancingConfig{Name: name, Config: config})
 }
 
+func (f *fakeEDSBalancer) handleChildPolicyByPriority(configs map[uint32]*loadBalancingConfig) {
+}
+
 func (f *fakeEDSBalancer) handleEDSResponse(edsResp xdsclient.EndpointsUpdate) {
 	f.edsUpdate.Send(edsResp)
 }
@@ -138,6 +144,37 @@ func (f *fakeEDSBalancer) updateServiceRequestsConfig(serviceName string, max *u
 	f.serviceRequestMax.Send(max)
 }
 
+func (f *fakeEDSBalancer) updateGlobalRequestsConfig(max *uint32) {}
+
+func (f *fakeEDSBalancer) updateServiceConnectionsConfig(serviceName string, max *uint32) {}
+
+func (f *fakeEDSBalancer) updateLocalityPickingPolicy(deterministic bool) {}
+
+func (f *fakeEDSBalancer) updateHealthCheckConfig(enable bool) {}
+
+func (f *fakeEDSBalancer) updateCircuitBreakingQueueing(enable bool) {}
+
+func (f *fakeEDSBalancer) updateLocalityWeightedLBConfig(enable bool) {}
+
+func (f *fakeEDSBalancer) updatePriorityFailoverBackoff(enable bool) {}
+
+func (f *fakeEDSBalancer) updateReResolutionConfig(intervalSeconds *uint32) {}
+
+func (f *fakeEDSBalancer) updateAffinityHeader(header string) {}
+
+func (f *fakeEDSBalancer) updateFaultInjection(cfg *FaultInjectionConfig) {}
+
+func (f *fakeEDSBalancer) updateSubConnBatchSize(size uint32) {}
+
+func (f *fakeEDSBalancer) pendingLocalityBatches() *buffer.Unbounded { return f.localityBatchQueue }
+
+func (f *fakeEDSBalancer) processLocalityBatch(item interface{}) {}
+
+func (f *fakeEDSBalancer) updateWarmUp(enabled bool) {}
+
+func (f *fakeEDSBalancer) updateMinHealthyPercentage(pct uint32) {}
+func (f *fakeEDSBalancer) updatePanicThreshold(pct uint32)       {}
+
 func (f *fakeEDSBalancer) close() {}
 
 func (f *fakeEDSBalancer) waitForChildPolicy(ctx context.Context, wantPolicy *loadBalancingConfig) error {
@@ -215,6 +252,7 @@ func newFakeEDSBalancer(cc balancer.ClientConn) edsBalancerImplInterface {
 		edsUpdate:          testutils.NewChannelWithSize(10),
 		serviceName:        testutils.NewChannelWithSize(10),
 		serviceRequestMax:  testutils.NewChannelWithSize(10),
+		localityBatchQueue: buffer.NewUnbounded(),
 	}
 }
 
@@ -301,13 +339,13 @@ func (b *fakeBalancer) Close() {}
 // section of the lbConfig is updated.
 //
 // The test does the following:
-// * Builds a new EDS balancer.
-// * Pushes a new ClientConnState with a childPolicy set to fakeBalancerA.
-//   Verifies that an EDS watch is registered. It then pushes a new edsUpdate
-//   through the fakexds client. Verifies that a new edsLB is created and it
-//   receives the expected childPolicy.
-// * Pushes a new ClientConnState with a childPolicy set to fakeBalancerB.
-//   Verifies that the existing edsLB receives the new child policy.
+//   - Builds a new EDS balancer.
+//   - Pushes a new ClientConnState with a childPolicy set to fakeBalancerA.
+//     Verifies that an EDS watch is registered. It then pushes a new edsUpdate
+//     through the fakexds client. Verifies that a new edsLB is created and it
+//     receives the expected childPolicy.
+//   - Pushes a new ClientConnState with a childPolicy set to fakeBalancerB.
+//     Verifies that the existing edsLB receives the new child policy.
 func (s) TestConfigChildPolicyUpdate(t *testing.T) {
 	edsLBCh := testutils.NewChannel()
 	xdsC, cleanup := setup(edsLBCh)
@@ -557,6 +595,29 @@ func (s) TestErrorFromResolver(t *testing.T) {
 	}
 }
 
+// TestEnqueueChildBalancerStateAfterClose verifies that a child balancer
+// state update delivered via enqueueChildBalancerState (what
+// edsBalancerWrapperCC.UpdateState calls into) after the EDS balancer has
+// been closed is dropped instead of being queued forever.
+func (s) TestEnqueueChildBalancerStateAfterClose(t *testing.T) {
+	x := &edsBalancer{
+		closed:            grpcsync.NewEvent(),
+		childPolicyUpdate: buffer.NewUnbounded(),
+	}
+	x.logger = prefixLogger(x)
+
+	x.closed.Fire()
+	x.enqueueChildBalancerState(priorityType{}, balancer.State{})
+
+	sCtx, sCancel := context.WithTimeout(context.Background(), defaultTestShortTimeout)
+	defer sCancel()
+	select {
+	case <-x.childPolicyUpdate.Get():
+		t.Fatal("enqueueChildBalancerState() queued an update after Close(), want it dropped")
+	case <-sCtx.Done():
+	}
+}
+
 // Given a list of resource names, verifies that EDS requests for the same are
 // sent by the EDS balancer, through the fake xDS client.
 func verifyExpectedRequests(ctx context.Context, fc *fakeclient.Client, resourceNames ...string) error {
@@ -730,7 +791,10 @@ func (s) TestBalancerConfigParsing(t *testing.T) {
   ],
   "edsServiceName": "eds.service",
   "maxConcurrentRequests": 123,
-  "lrsLoadReportingServerName": "lrs.server"
+  "lrsLoadReportingServerName": "lrs.server",
+  "localityPickingPolicy": "deterministic",
+  "enableHealthCheck": true,
+  "queueOnCircuitBreaking": true
 }`),
 			want: &EDSConfig{
 				ChildPolicy: &loadBalancingConfig{
@@ -744,6 +808,9 @@ func (s) TestBalancerConfigParsing(t *testing.T) {
 				EDSServiceName:             testEDSName,
 				MaxConcurrentRequests:      &testMaxConcurrentRequests,
 				LrsLoadReportingServerName: &testLRSName,
+				LocalityPickingPolicy:      "deterministic",
+				EnableHealthCheck:          true,
+				QueueOnCircuitBreaking:     true,
 			},
 		},
 		{
@@ -19,6 +19,7 @@ package edsbalancer
 import (
 	"fmt"
 	"net"
+	"sort"
 	"strconv"
 
 	xdspb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
@@ -31,8 +32,8 @@ import (
 
 // parseEDSRespProtoForTesting parses EDS response, and panic if parsing fails.
 //
-// TODO: delete this. The EDS balancer tests should build an EndpointsUpdate
-// directly, instead of building and parsing a proto message.
+// Prefer xdsclient.NewEndpointsUpdateBuilder for new tests: it builds an
+// EndpointsUpdate directly, without the proto boilerplate.
 func parseEDSRespProtoForTesting(m *xdspb.ClusterLoadAssignment) xdsclient.EndpointsUpdate {
 	u, err := parseEDSRespProto(m)
 	if err != nil {
@@ -67,10 +68,20 @@ func parseEDSRespProto(m *xdspb.ClusterLoadAssignment) (xdsclient.EndpointsUpdat
 			Priority:  priority,
 		})
 	}
-	for i := 0; i < len(priorities); i++ {
-		if _, ok := priorities[uint32(i)]; !ok {
-			return xdsclient.EndpointsUpdate{}, fmt.Errorf("priority %v missing (with different priorities %v received)", i, priorities)
-		}
+	// Compact sparse priorities (e.g. {0, 2, 5}) into a contiguous range
+	// starting at 0 (e.g. {0, 1, 2}), preserving their relative order, to
+	// mirror the behavior of the production parseEDSRespProto.
+	sortedPriorities := make([]uint32, 0, len(priorities))
+	for p := range priorities {
+		sortedPriorities = append(sortedPriorities, p)
+	}
+	sort.Slice(sortedPriorities, func(i, j int) bool { return sortedPriorities[i] < sortedPriorities[j] })
+	priorityCompact := make(map[uint32]uint32, len(sortedPriorities))
+	for i, p := range sortedPriorities {
+		priorityCompact[p] = uint32(i)
+	}
+	for i := range ret.Localities {
+		ret.Localities[i].Priority = priorityCompact[ret.Localities[i].Priority]
 	}
 	return ret, nil
 }
@@ -100,13 +111,22 @@ func parseDropPolicy(dropPolicy *xdspb.ClusterLoadAssignment_Policy_DropOverload
 	}
 }
 
+// defaultEndpointWeight mirrors the production defaultEndpointWeight in
+// xds/pkg/client/xds.go: an endpoint with an unset load_balancing_weight is
+// given this weight, distinct from an explicit weight of 0.
+const defaultEndpointWeight = 1
+
 func parseEndpoints(lbEndpoints []*endpointpb.LbEndpoint) []xdsclient.Endpoint {
 	endpoints := make([]xdsclient.Endpoint, 0, len(lbEndpoints))
 	for _, lbEndpoint := range lbEndpoints {
+		weight := uint32(defaultEndpointWeight)
+		if w := lbEndpoint.GetLoadBalancingWeight(); w != nil {
+			weight = w.GetValue()
+		}
 		endpoints = append(endpoints, xdsclient.Endpoint{
 			HealthStatus: xdsclient.EndpointHealthStatus(lbEndpoint.GetHealthStatus()),
 			Address:      parseAddress(lbEndpoint.GetEndpoint().GetAddress().GetSocketAddress()),
-			Weight:       lbEndpoint.GetLoadBalancingWeight().GetValue(),
+			Weight:       weight,
 		})
 	}
 	return endpoints
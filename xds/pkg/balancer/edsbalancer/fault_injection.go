@@ -0,0 +1,116 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package edsbalancer
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/internal/grpcrand"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Envoy's well-known fault injection override headers; see
+// https://www.envoyproxy.io/docs/envoy/latest/configuration/http/http_filters/fault_filter.
+// A pick's own headers can only ever lower the configured percentage, never
+// raise it, matching httpfilter/fault's resolver-layer enforcement of the
+// same headers.
+const (
+	headerDelayPercentage = "x-envoy-fault-delay-request-percentage"
+	headerAbortPercentage = "x-envoy-fault-abort-request-percentage"
+)
+
+// activeFaultInjections is the process-wide count of in-flight picks
+// currently subject to a fault injection decision, accessed atomically. It
+// backs FaultInjectionConfig.MaxActiveFaults, mirroring
+// httpfilter/fault's own activeFaults counter for the resolver-layer
+// enforcement point.
+var activeFaultInjections uint32
+
+// faultInjectionPicker wraps a picker and applies Envoy-style client-side
+// fault injection (delay and/or abort) to picks, as configured by cfg. It's
+// the eds balancer's own enforcement point for fault injection, alongside
+// (and independent of) the resolver-layer enforcement in httpfilter/fault;
+// see serviceUpdate.FaultInjectionPercentages for how that path derives its
+// percentages from the same LDS HTTP filter config this package doesn't
+// have direct access to.
+type faultInjectionPicker struct {
+	p   balancer.Picker
+	cfg *FaultInjectionConfig
+}
+
+// newFaultInjectionPicker returns a picker that applies the fault injection
+// settings in cfg on top of p. cfg must be non-nil.
+func newFaultInjectionPicker(p balancer.Picker, cfg *FaultInjectionConfig) *faultInjectionPicker {
+	return &faultInjectionPicker{p: p, cfg: cfg}
+}
+
+// For overriding in tests.
+var (
+	faultRandIntn = grpcrand.Intn
+	faultNewTimer = time.NewTimer
+)
+
+func (f *faultInjectionPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	cfg := f.cfg
+	if cfg.MaxActiveFaults > 0 {
+		defer atomic.AddUint32(&activeFaultInjections, ^uint32(0)) // decrement counter
+		if af := atomic.AddUint32(&activeFaultInjections, 1); af > cfg.MaxActiveFaults {
+			// Would exceed maximum active fault limit.
+			return f.p.Pick(info)
+		}
+	}
+
+	if cfg.Delay > 0 && faultRandIntn(100) < int(percentageWithHeaderOverride(info, headerDelayPercentage, cfg.DelayPercentage)) {
+		t := faultNewTimer(cfg.Delay)
+		select {
+		case <-t.C:
+		case <-info.Ctx.Done():
+			t.Stop()
+			return balancer.PickResult{}, info.Ctx.Err()
+		}
+	}
+
+	if cfg.AbortPercentage > 0 && faultRandIntn(100) < int(percentageWithHeaderOverride(info, headerAbortPercentage, cfg.AbortPercentage)) {
+		return balancer.PickResult{}, status.Errorf(cfg.AbortCode, "RPC terminated due to fault injection")
+	}
+
+	return f.p.Pick(info)
+}
+
+// percentageWithHeaderOverride returns configured, or the value of header in
+// info's outgoing metadata if present, parseable, and lower than configured.
+func percentageWithHeaderOverride(info balancer.PickInfo, header string, configured float64) float64 {
+	md, ok := metadata.FromOutgoingContext(info.Ctx)
+	if !ok {
+		return configured
+	}
+	vs := md.Get(header)
+	if len(vs) == 0 {
+		return configured
+	}
+	v, err := strconv.ParseFloat(vs[len(vs)-1], 64)
+	if err != nil || v >= configured {
+		return configured
+	}
+	return v
+}
@@ -0,0 +1,146 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package edsbalancer
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/xds/pkg/testutils"
+)
+
+// TestFaultInjectionPickerAbortRate verifies that an abort fault configured
+// at a given percentage fires at approximately that rate, and returns the
+// configured status code when it does.
+func (s) TestFaultInjectionPickerAbortRate(t *testing.T) {
+	inner := &testutils.TestConstPicker{SC: testutils.TestSubConns[0]}
+	cfg := &FaultInjectionConfig{AbortPercentage: 50, AbortCode: codes.ResourceExhausted}
+	p := newFaultInjectionPicker(inner, cfg)
+
+	const n = 10000
+	var aborted int
+	for i := 0; i < n; i++ {
+		res, err := p.Pick(balancer.PickInfo{Ctx: pickInfoWithHeader("", "").Ctx})
+		if err != nil {
+			aborted++
+			if status.Code(err) != codes.ResourceExhausted {
+				t.Fatalf("Pick() returned code %v, want %v", status.Code(err), codes.ResourceExhausted)
+			}
+			continue
+		}
+		if res.SubConn != testutils.TestSubConns[0] {
+			t.Fatalf("Pick() = %v, want %v", res.SubConn, testutils.TestSubConns[0])
+		}
+	}
+	if rate := float64(aborted) / n; rate < 0.45 || rate > 0.55 {
+		t.Errorf("observed abort rate %.2f, want ~0.50", rate)
+	}
+}
+
+// TestFaultInjectionPickerDelay verifies that a configured delay fault adds
+// at least the configured latency to a pick that it fires for.
+func (s) TestFaultInjectionPickerDelay(t *testing.T) {
+	inner := &testutils.TestConstPicker{SC: testutils.TestSubConns[0]}
+	cfg := &FaultInjectionConfig{DelayPercentage: 100, Delay: 20 * time.Millisecond}
+	p := newFaultInjectionPicker(inner, cfg)
+
+	start := time.Now()
+	if _, err := p.Pick(balancer.PickInfo{Ctx: pickInfoWithHeader("", "").Ctx}); err != nil {
+		t.Fatalf("Pick() failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < cfg.Delay {
+		t.Errorf("Pick() returned after %v, want at least the configured delay %v", elapsed, cfg.Delay)
+	}
+}
+
+// TestFaultInjectionPickerHeaderOverrideLowersPercentage verifies that a
+// per-pick header can only lower the configured abort percentage, never
+// raise it: a header requesting a lower percentage than configured disables
+// the abort fault entirely once luck (here, a stubbed randIntn) would have
+// otherwise permitted it, while a header requesting a higher percentage than
+// configured is ignored.
+func (s) TestFaultInjectionPickerHeaderOverrideLowersPercentage(t *testing.T) {
+	oldRandIntn := faultRandIntn
+	defer func() { faultRandIntn = oldRandIntn }()
+	faultRandIntn = func(n int) int { return 40 } // "hits" any percentage > 40
+
+	inner := &testutils.TestConstPicker{SC: testutils.TestSubConns[0]}
+	cfg := &FaultInjectionConfig{AbortPercentage: 50, AbortCode: codes.Unavailable}
+	p := newFaultInjectionPicker(inner, cfg)
+
+	// A header asking for a lower percentage than configured (10 < 50) wins,
+	// and 40 no longer "hits" a 10% chance, so the pick proceeds normally.
+	if _, err := p.Pick(balancer.PickInfo{Ctx: pickInfoWithHeader(headerAbortPercentage, "10").Ctx}); err != nil {
+		t.Errorf("Pick() with a lower header percentage = %v, want nil error", err)
+	}
+
+	// A header asking for a higher percentage than configured (90 > 50) is
+	// ignored in favor of the configured 50%, which 40 still "hits".
+	if _, err := p.Pick(balancer.PickInfo{Ctx: pickInfoWithHeader(headerAbortPercentage, "90").Ctx}); status.Code(err) != codes.Unavailable {
+		t.Errorf("Pick() with a higher header percentage = %v, want code %v", err, codes.Unavailable)
+	}
+}
+
+// TestFaultInjectionPickerMaxActiveFaults verifies that once MaxActiveFaults
+// concurrent faulted picks are outstanding, further picks pass through
+// unfaulted instead of queueing or being rejected.
+func (s) TestFaultInjectionPickerMaxActiveFaults(t *testing.T) {
+	inner := &testutils.TestConstPicker{SC: testutils.TestSubConns[0]}
+	cfg := &FaultInjectionConfig{AbortPercentage: 100, AbortCode: codes.Unavailable, MaxActiveFaults: 1}
+	p := newFaultInjectionPicker(inner, cfg)
+
+	// Hold the single active-fault slot open across a concurrent Pick by
+	// blocking inside it with a delay, then confirm a pick that arrives
+	// while that's in flight is passed through instead of being faulted.
+	cfg.Delay = 50 * time.Millisecond
+	cfg.DelayPercentage = 100
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Pick(balancer.PickInfo{Ctx: pickInfoWithHeader("", "").Ctx})
+	}()
+	time.Sleep(10 * time.Millisecond) // let the goroutine above claim the slot
+
+	res, err := p.Pick(balancer.PickInfo{Ctx: pickInfoWithHeader("", "").Ctx})
+	if err != nil {
+		t.Errorf("Pick() beyond MaxActiveFaults = %v, want nil error (pass-through)", err)
+	}
+	if res.SubConn != testutils.TestSubConns[0] {
+		t.Errorf("Pick() beyond MaxActiveFaults = %v, want pass-through to %v", res.SubConn, testutils.TestSubConns[0])
+	}
+	<-done
+}
+
+// TestFaultInjectionPickerDisabled verifies that wrapPicker doesn't wrap in a
+// faultInjectionPicker at all when no fault injection config is set.
+func (s) TestFaultInjectionPickerDisabled(t *testing.T) {
+	edsb := newEDSBalancerImpl(nil, balancer.BuildOptions{}, nil, nil, nil, nil)
+	inner := &testutils.TestConstPicker{SC: testutils.TestSubConns[0]}
+	if got := edsb.wrapPicker(inner); got != balancer.Picker(inner) {
+		t.Errorf("wrapPicker() with no fault injection configured = %v, want the raw inner picker %v", got, inner)
+	}
+
+	edsb.updateFaultInjection(&FaultInjectionConfig{AbortPercentage: 100, AbortCode: codes.Unavailable})
+	if _, ok := edsb.wrapPicker(inner).(*faultInjectionPicker); !ok {
+		t.Errorf("wrapPicker() with fault injection configured did not return a *faultInjectionPicker")
+	}
+}
@@ -19,6 +19,7 @@
 package edsbalancer
 
 import (
+	"context"
 	"sync"
 
 	"google.golang.org/grpc/xds/pkg/client/load"
@@ -79,10 +80,18 @@ func (lsw *loadStoreWrapper) CallServerLoad(locality, name string, val float64)
 	}
 }
 
-func (lsw *loadStoreWrapper) CallDropped(category string) {
+func (lsw *loadStoreWrapper) CallDropped(ctx context.Context, method, category string) {
 	lsw.mu.RLock()
 	defer lsw.mu.RUnlock()
 	if lsw.perCluster != nil {
-		lsw.perCluster.CallDropped(category)
+		lsw.perCluster.CallDropped(ctx, method, category)
+	}
+}
+
+func (lsw *loadStoreWrapper) Flush() {
+	lsw.mu.RLock()
+	defer lsw.mu.RUnlock()
+	if lsw.perCluster != nil {
+		lsw.perCluster.Flush()
 	}
 }
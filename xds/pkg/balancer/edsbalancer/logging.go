@@ -20,6 +20,7 @@ package edsbalancer
 
 import (
 	"fmt"
+	"strings"
 
 	"google.golang.org/grpc/grpclog"
 	internalgrpclog "google.golang.org/grpc/internal/grpclog"
@@ -32,3 +33,17 @@ var logger = grpclog.Component("xds")
 func prefixLogger(p *edsBalancer) *internalgrpclog.PrefixLogger {
 	return internalgrpclog.NewPrefixLogger(logger, fmt.Sprintf(prefix, p))
 }
+
+// logKV logs msg at Info level, followed by kv formatted as space-separated
+// key=value pairs (kv must have an even number of elements). It's used for
+// the high-frequency locality/priority lifecycle events, whose Infof
+// predecessors (e.g. "Locality %v updated, weightedChanged: %v,
+// addrsChanged: %v") are hard to parse in log aggregation systems.
+func logKV(l *internalgrpclog.PrefixLogger, msg string, kv ...interface{}) {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i+1 < len(kv); i += 2 {
+		fmt.Fprintf(&b, " %v=%v", kv[i], kv[i+1])
+	}
+	l.Infof("%s", b.String())
+}
@@ -0,0 +1,60 @@
+/*
+ *
+ * Copyright 2020 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package edsbalancer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	internalgrpclog "google.golang.org/grpc/internal/grpclog"
+)
+
+// capturingDepthLogger implements internalgrpclog.DepthLoggerV2, recording
+// every Info-level message passed to it.
+type capturingDepthLogger struct {
+	infos []string
+}
+
+func (l *capturingDepthLogger) InfoDepth(_ int, args ...interface{}) {
+	l.infos = append(l.infos, fmt.Sprint(args...))
+}
+func (l *capturingDepthLogger) WarningDepth(int, ...interface{}) {}
+func (l *capturingDepthLogger) ErrorDepth(int, ...interface{})   {}
+func (l *capturingDepthLogger) FatalDepth(int, ...interface{})   {}
+
+// TestLogKV verifies that logKV logs the message followed by its key/value
+// pairs formatted as "key=value", as used for locality/priority lifecycle
+// events.
+func (s) TestLogKV(t *testing.T) {
+	cl := &capturingDepthLogger{}
+	l := internalgrpclog.NewPrefixLogger(cl, "")
+
+	logKV(l, "locality updated", "locality", "{\"region\":\"r\"}", "weight_changed", true, "addrs_changed", false)
+
+	if len(cl.infos) != 1 {
+		t.Fatalf("got %d log lines, want 1: %v", len(cl.infos), cl.infos)
+	}
+	got := cl.infos[0]
+	for _, want := range []string{"locality updated", "locality={\"region\":\"r\"}", "weight_changed=true", "addrs_changed=false"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log line %q missing expected field %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package edsbalancer
+
+import (
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/internal/grpclog"
+	xdsclient "google.golang.org/grpc/xds/pkg/client"
+	"google.golang.org/grpc/xds/pkg/client/load"
+)
+
+// EDSBalancerImpl is the exported name of the internal locality/priority
+// handling implementation, so that other xDS-style balancers (e.g. a
+// balancer for a protocol that reuses EDS semantics but isn't driven by the
+// eds_experimental policy) can embed it instead of reimplementing locality
+// and priority handling from scratch.
+type EDSBalancerImpl = edsBalancerImpl
+
+// PriorityType opaquely identifies a priority as reported by EDS. Values of
+// this type are only ever produced by EDSBalancerImpl; callers supplying an
+// EnqueueChildBalancerStateUpdate callback should treat it as an opaque
+// token to be passed back unmodified (e.g. into RecomputePriorities-style
+// bookkeeping), not something to construct or compare by value.
+type PriorityType = priorityType
+
+// EDSBalancerImplOptions groups the parameters needed to construct an
+// EDSBalancerImpl via NewEDSBalancerImpl.
+type EDSBalancerImplOptions struct {
+	// ClientConn is the balancer.ClientConn passed to the wrapping
+	// balancer.Balancer's Build; EDSBalancerImpl uses it to create and
+	// update SubConns and to push picker updates.
+	ClientConn balancer.ClientConn
+	// BuildOptions is the balancer.BuildOptions passed to the wrapping
+	// balancer.Balancer's Build; it's forwarded unchanged to child policies.
+	BuildOptions balancer.BuildOptions
+	// EnqueueChildBalancerStateUpdate is invoked every time a priority's
+	// aggregated child balancer.State changes. The caller is expected to
+	// route it back into the EDSBalancerImpl's own UpdateState handling
+	// (see the eds_experimental policy's enqueueChildBalancerState for the
+	// reference implementation), since EDSBalancerImpl itself doesn't run
+	// a goroutine to serialize callbacks.
+	EnqueueChildBalancerStateUpdate func(PriorityType, balancer.State)
+	// LoadReporter, if non-nil, is notified of per-locality drop and load
+	// data as EDS responses are processed. May be nil if load reporting
+	// isn't in use.
+	LoadReporter load.PerClusterReporter
+	// Logger is used for all logging done by the returned EDSBalancerImpl.
+	// May be nil, in which case logging falls back to the grpclog package
+	// defaults.
+	Logger *grpclog.PrefixLogger
+	// InitialSubBalancerBuilder is the child policy used to manage
+	// endpoints within a locality until an EDS response (or the wrapping
+	// policy's config) overrides it via HandleChildPolicy. Defaults to
+	// round_robin if nil.
+	InitialSubBalancerBuilder balancer.Builder
+	// PriorityInitTimeout bounds how long a newly started priority is
+	// given to reach Ready or TransientFailure before the next lower
+	// priority is started. Defaults to defaultPriorityInitTimeout (10s) if
+	// zero.
+	//
+	// This is currently a process-wide setting shared by every
+	// EDSBalancerImpl in the binary (it overrides the same package-level
+	// default used by the eds_experimental policy), so mixing multiple
+	// non-zero values across concurrently-running instances isn't
+	// supported.
+	PriorityInitTimeout time.Duration
+}
+
+// NewEDSBalancerImpl creates an EDSBalancerImpl from the given options, for
+// embedding by a balancer implementation other than the eds_experimental
+// policy built into this package.
+func NewEDSBalancerImpl(opts EDSBalancerImplOptions) *EDSBalancerImpl {
+	if opts.PriorityInitTimeout > 0 {
+		defaultPriorityInitTimeout = opts.PriorityInitTimeout
+	}
+	return newEDSBalancerImpl(opts.ClientConn, opts.BuildOptions, opts.EnqueueChildBalancerStateUpdate, opts.LoadReporter, opts.Logger, opts.InitialSubBalancerBuilder)
+}
+
+// HandleEDSResponse processes a parsed EDS response, updating localities,
+// priorities and SubConns as needed.
+func (edsImpl *EDSBalancerImpl) HandleEDSResponse(edsResp xdsclient.EndpointsUpdate) {
+	edsImpl.handleEDSResponse(edsResp)
+}
+
+// HandleSubConnStateChange forwards a SubConn's connectivity state change,
+// as reported by UpdateSubConnState, to the priority/locality currently
+// owning it.
+func (edsImpl *EDSBalancerImpl) HandleSubConnStateChange(sc balancer.SubConn, s connectivity.State) {
+	edsImpl.handleSubConnStateChange(sc, s)
+}
+
+// Close releases resources held by the EDSBalancerImpl, including all child
+// policies and their SubConns.
+func (edsImpl *EDSBalancerImpl) Close() {
+	edsImpl.close()
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package edsbalancer
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/xds/pkg/testutils"
+)
+
+// TestPublicNewEDSBalancerImpl verifies that an EDSBalancerImpl constructed
+// through the exported NewEDSBalancerImpl, as a third-party balancer
+// embedding it would, can process a basic EDS response end to end: a SubConn
+// is created for the one endpoint, and once it's Ready the resulting picker
+// routes to it.
+func (s) TestPublicNewEDSBalancerImpl(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	edsb := NewEDSBalancerImpl(EDSBalancerImplOptions{
+		ClientConn: cc,
+	})
+	edsb.enqueueChildBalancerStateUpdate = edsb.updateState
+	defer edsb.Close()
+
+	clab := testutils.NewClusterLoadAssignmentBuilder(testClusterNames[0], nil)
+	clab.AddLocality(testSubZones[0], 1, 0, testEndpointAddrs[:1], nil)
+	edsb.HandleEDSResponse(parseEDSRespProtoForTesting(clab.Build()))
+
+	sc := <-cc.NewSubConnCh
+	edsb.HandleSubConnStateChange(sc, connectivity.Connecting)
+	edsb.HandleSubConnStateChange(sc, connectivity.Ready)
+
+	p := <-cc.NewPickerCh
+	gotSC, err := p.Pick(balancer.PickInfo{})
+	if err != nil {
+		t.Fatalf("Pick() failed: %v", err)
+	}
+	if gotSC.SubConn != sc {
+		t.Fatalf("Pick() = %v, want %v", gotSC.SubConn, sc)
+	}
+}
+
+// TestPublicNewEDSBalancerImplDefaultChildPolicy verifies that
+// NewEDSBalancerImpl defaults InitialSubBalancerBuilder to round_robin, same
+// as the unexported constructor it wraps.
+func (s) TestPublicNewEDSBalancerImplDefaultChildPolicy(t *testing.T) {
+	edsb := NewEDSBalancerImpl(EDSBalancerImplOptions{})
+	if got, want := edsb.subBalancerBuilder.Name(), "round_robin"; got != want {
+		t.Errorf("subBalancerBuilder.Name() = %v, want %v", got, want)
+	}
+}
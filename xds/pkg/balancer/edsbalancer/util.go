@@ -17,11 +17,21 @@
 package edsbalancer
 
 import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
 	"google.golang.org/grpc/internal/wrr"
 	xdsclient "google.golang.org/grpc/xds/pkg/client"
 )
 
-var newRandomWRR = wrr.NewRandom
+// newRandomWRR defaults to newPooledRandomWRR, rather than wrr.NewRandom,
+// because dropper.drop() is called once per RPC and wrr.NewRandom's draws
+// all come from the single mutex-protected source in internal/grpcrand,
+// which dropper would otherwise contend on with every other WRR in the
+// process under load. Tests override this to a deterministic WRR.
+var newRandomWRR = newPooledRandomWRR
 
 type dropper struct {
 	c xdsclient.OverloadDropConfig
@@ -29,9 +39,17 @@ type dropper struct {
 }
 
 func newDropper(c xdsclient.OverloadDropConfig) *dropper {
+	numerator := c.Numerator
+	if numerator > c.Denominator {
+		// A numerator greater than the denominator would make
+		// Denominator-Numerator underflow into a huge int64, effectively
+		// never dropping. Clamp to a 100% drop rate instead.
+		numerator = c.Denominator
+	}
+
 	w := newRandomWRR()
-	w.Add(true, int64(c.Numerator))
-	w.Add(false, int64(c.Denominator-c.Numerator))
+	w.Add(true, int64(numerator))
+	w.Add(false, int64(c.Denominator-numerator))
 
 	return &dropper{
 		c: c,
@@ -42,3 +60,68 @@ func newDropper(c xdsclient.OverloadDropConfig) *dropper {
 func (d *dropper) drop() (ret bool) {
 	return d.w.Next().(bool)
 }
+
+// pooledWeightedItem is pooledRandomWRR's analog of the weightedItem type
+// internal/wrr's randomWRR uses internally.
+type pooledWeightedItem struct {
+	item   interface{}
+	weight int64
+}
+
+// rngPool hands out independent *rand.Rand instances for pooledRandomWRR's
+// draws, so that concurrent Next() calls scale with the number of
+// goroutines actually calling it concurrently instead of all serializing on
+// one shared source.
+var rngPool = sync.Pool{
+	New: func() interface{} {
+		return rand.New(rand.NewSource(time.Now().UnixNano()))
+	},
+}
+
+// pooledRandomWRR is a WRR with the exact same selection algorithm as
+// internal/wrr's default random implementation, but drawing from rngPool
+// instead of internal/grpcrand's single mutex-protected global source. It's
+// used instead of wrr.NewRandom as eds's default WRR because dropper.drop()
+// is the hottest caller of WRR.Next() in this balancer, invoked once per
+// dropped-cluster-eligible RPC.
+type pooledRandomWRR struct {
+	mu           sync.RWMutex
+	items        []pooledWeightedItem
+	sumOfWeights int64
+}
+
+// newPooledRandomWRR creates a new WRR backed by rngPool.
+func newPooledRandomWRR() wrr.WRR {
+	return &pooledRandomWRR{}
+}
+
+func (p *pooledRandomWRR) Add(item interface{}, weight int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.items = append(p.items, pooledWeightedItem{item: item, weight: weight})
+	p.sumOfWeights += weight
+}
+
+func (p *pooledRandomWRR) Next() interface{} {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.sumOfWeights == 0 {
+		return nil
+	}
+
+	r := rngPool.Get().(*rand.Rand)
+	randomWeight := r.Int63n(p.sumOfWeights)
+	rngPool.Put(r)
+
+	for _, it := range p.items {
+		randomWeight -= it.weight
+		if randomWeight < 0 {
+			return it.item
+		}
+	}
+	return p.items[len(p.items)-1].item
+}
+
+func (p *pooledRandomWRR) String() string {
+	return fmt.Sprint(p.items)
+}
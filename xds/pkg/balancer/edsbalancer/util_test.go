@@ -17,8 +17,12 @@
 package edsbalancer
 
 import (
+	"math"
+	"sync"
+	"sync/atomic"
 	"testing"
 
+	"google.golang.org/grpc/internal/wrr"
 	xdsclient "google.golang.org/grpc/xds/pkg/client"
 	"google.golang.org/grpc/xds/pkg/testutils"
 )
@@ -86,3 +90,89 @@ func (s) TestDropper(t *testing.T) {
 		})
 	}
 }
+
+// TestDropperNumeratorGreaterThanDenominator covers the case that a
+// numerator greater than the denominator results in a 100% drop rate,
+// instead of underflowing into never dropping.
+func (s) TestDropperNumeratorGreaterThanDenominator(t *testing.T) {
+	d := newDropper(xdsclient.OverloadDropConfig{Numerator: 150, Denominator: 100})
+	const loopCount = 20
+	for i := 0; i < loopCount; i++ {
+		if !d.drop() {
+			t.Errorf("d.drop() = false, want true (100%% drop rate) on iteration %d", i)
+		}
+	}
+}
+
+// TestDropperAggregateDropRate covers that switching dropper's default WRR
+// from wrr.NewRandom to pooledRandomWRR (see newRandomWRR) didn't change the
+// overall drop rate: many goroutines hammer a single dropper concurrently,
+// each pulling its random draws from a different pooled *rand.Rand, and the
+// aggregate fraction dropped should still track numerator/denominator.
+func (s) TestDropperAggregateDropRate(t *testing.T) {
+	old := newRandomWRR
+	newRandomWRR = newPooledRandomWRR
+	defer func() { newRandomWRR = old }()
+
+	const (
+		numerator       = 37
+		denominator     = 100
+		goroutines      = 50
+		dropsPerRoutine = 4000
+		tolerance       = 0.02 // 2 percentage points
+	)
+	d := newDropper(xdsclient.OverloadDropConfig{Numerator: numerator, Denominator: denominator})
+
+	var dropped int64
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var local int64
+			for j := 0; j < dropsPerRoutine; j++ {
+				if d.drop() {
+					local++
+				}
+			}
+			atomic.AddInt64(&dropped, local)
+		}()
+	}
+	wg.Wait()
+
+	got := float64(dropped) / float64(goroutines*dropsPerRoutine)
+	want := float64(numerator) / float64(denominator)
+	if math.Abs(got-want) > tolerance {
+		t.Errorf("aggregate drop rate = %.4f, want %.4f ± %.4f", got, want, tolerance)
+	}
+}
+
+// BenchmarkDropperDrop compares dropper.drop() using eds's default pooled
+// WRR against the same dropper using wrr.NewRandom (the WRR every other
+// balancer in this package tree still uses), under concurrency, to show the
+// pooled RNG scales instead of serializing on internal/grpcrand's single
+// mutex-protected source. Run with -cpu=1,4,8 to see the gap widen with
+// parallelism.
+func BenchmarkDropperDrop(b *testing.B) {
+	for _, bm := range []struct {
+		name      string
+		newRandom func() wrr.WRR
+	}{
+		{name: "Pooled", newRandom: newPooledRandomWRR},
+		{name: "Shared", newRandom: wrr.NewRandom},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			old := newRandomWRR
+			newRandomWRR = bm.newRandom
+			defer func() { newRandomWRR = old }()
+
+			d := newDropper(xdsclient.OverloadDropConfig{Numerator: 1, Denominator: 2})
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					d.drop()
+				}
+			})
+		})
+	}
+}
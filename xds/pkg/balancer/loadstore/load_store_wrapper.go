@@ -20,6 +20,7 @@
 package loadstore
 
 import (
+	"context"
 	"sync"
 
 	"google.golang.org/grpc/xds/pkg/client/load"
@@ -111,10 +112,19 @@ func (lsw *Wrapper) CallServerLoad(locality, name string, val float64) {
 }
 
 // CallDropped records a call dropped in the store.
-func (lsw *Wrapper) CallDropped(category string) {
+func (lsw *Wrapper) CallDropped(ctx context.Context, method, category string) {
 	lsw.mu.RLock()
 	defer lsw.mu.RUnlock()
 	if lsw.perCluster != nil {
-		lsw.perCluster.CallDropped(category)
+		lsw.perCluster.CallDropped(ctx, method, category)
+	}
+}
+
+// Flush forces the wrapped reporter to report any pending load data now.
+func (lsw *Wrapper) Flush() {
+	lsw.mu.RLock()
+	defer lsw.mu.RUnlock()
+	if lsw.perCluster != nil {
+		lsw.perCluster.Flush()
 	}
 }
@@ -141,17 +141,63 @@ func (wbsa *Aggregator) UpdateWeight(id string, newWeight uint32) {
 	pState.weight = newWeight
 }
 
+// WeightedState describes a sub-balancer's weight and connectivity state, as
+// last reported to UpdateState (or Connecting, if no state has been reported
+// yet).
+type WeightedState struct {
+	Weight uint32
+	State  connectivity.State
+}
+
+// Snapshot returns a point-in-time copy of the weight and connectivity state
+// of every sub-balancer currently tracked by this aggregator, keyed by ID.
+// It's meant for diagnostics, e.g. when trying to figure out why a
+// particular locality isn't receiving traffic.
+func (wbsa *Aggregator) Snapshot() map[string]WeightedState {
+	wbsa.mu.Lock()
+	defer wbsa.mu.Unlock()
+	ret := make(map[string]WeightedState, len(wbsa.idToPickerState))
+	for id, ps := range wbsa.idToPickerState {
+		ret[id] = WeightedState{Weight: ps.weight, State: ps.state.ConnectivityState}
+	}
+	return ret
+}
+
+// EffectiveWeights returns each tracked sub-balancer's weight divided by the
+// sum of every tracked sub-balancer's weight: the fraction of picks it's
+// expected to receive once they're all Ready, keyed the same way as
+// Snapshot. It's meant for diagnostics, e.g. confirming a locality's
+// configured weight translates into the traffic split an operator expects.
+// Returns an empty map if no sub-balancer is tracked, or if every tracked
+// weight is 0 (the split would otherwise be undefined).
+func (wbsa *Aggregator) EffectiveWeights() map[string]float64 {
+	wbsa.mu.Lock()
+	defer wbsa.mu.Unlock()
+	var sum uint64
+	for _, ps := range wbsa.idToPickerState {
+		sum += uint64(ps.weight)
+	}
+	ret := make(map[string]float64, len(wbsa.idToPickerState))
+	if sum == 0 {
+		return ret
+	}
+	for id, ps := range wbsa.idToPickerState {
+		ret[id] = float64(ps.weight) / float64(sum)
+	}
+	return ret
+}
+
 // UpdateState is called to report a balancer state change from sub-balancer.
 // It's usually called by the balancer group.
 //
 // It calls parent ClientConn's UpdateState with the new aggregated state.
 func (wbsa *Aggregator) UpdateState(id string, newState balancer.State) {
 	wbsa.mu.Lock()
-	defer wbsa.mu.Unlock()
 	oldState, ok := wbsa.idToPickerState[id]
 	if !ok {
 		// All state starts with an entry in pickStateMap. If ID is not in map,
 		// it's either removed, or never existed.
+		wbsa.mu.Unlock()
 		return
 	}
 	if !(oldState.state.ConnectivityState == connectivity.TransientFailure && newState.ConnectivityState == connectivity.Connecting) {
@@ -164,9 +210,17 @@ func (wbsa *Aggregator) UpdateState(id string, newState balancer.State) {
 	oldState.state = newState
 
 	if !wbsa.started {
+		wbsa.mu.Unlock()
 		return
 	}
-	wbsa.cc.UpdateState(wbsa.build())
+	// build() fully snapshots the aggregated state before cc.UpdateState is
+	// called, so it's safe to release wbsa.mu first: this keeps it from
+	// being held across a call into cc, which could otherwise deadlock if cc
+	// calls back into e.g. Snapshot synchronously (as edsBalancerImpl's
+	// minHealthyPercentage check does).
+	s := wbsa.build()
+	wbsa.mu.Unlock()
+	wbsa.cc.UpdateState(s)
 }
 
 // clearState Reset everything to init state (Connecting) but keep the entry in
@@ -187,11 +241,13 @@ func (wbsa *Aggregator) clearStates() {
 // and update it to parent ClientConn.
 func (wbsa *Aggregator) BuildAndUpdate() {
 	wbsa.mu.Lock()
-	defer wbsa.mu.Unlock()
 	if !wbsa.started {
+		wbsa.mu.Unlock()
 		return
 	}
-	wbsa.cc.UpdateState(wbsa.build())
+	s := wbsa.build()
+	wbsa.mu.Unlock()
+	wbsa.cc.UpdateState(s)
 }
 
 // build combines sub-states into one.
@@ -0,0 +1,111 @@
+/*
+ *
+ * Copyright 2020 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package weightedaggregator
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/internal/wrr"
+	"google.golang.org/grpc/xds/pkg/testutils"
+)
+
+func TestSnapshot(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	wbsa := New(cc, nil, wrr.NewRandom)
+	wbsa.Start()
+
+	wbsa.Add("locality-1", 1)
+	wbsa.Add("locality-2", 2)
+	wbsa.UpdateState("locality-1", balancer.State{ConnectivityState: connectivity.Ready, Picker: base.NewErrPicker(nil)})
+
+	got := wbsa.Snapshot()
+	want := map[string]WeightedState{
+		"locality-1": {Weight: 1, State: connectivity.Ready},
+		"locality-2": {Weight: 2, State: connectivity.Connecting},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Snapshot() returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+// TestSnapshotReadyAndTransientFailure covers distinguishing, via Snapshot,
+// between a locality that's up but receiving no traffic because of its
+// weight, and one that's actually down: the two must report their real
+// connectivity states, not be conflated into the aggregated state of the
+// group as a whole.
+func TestSnapshotReadyAndTransientFailure(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	wbsa := New(cc, nil, wrr.NewRandom)
+	wbsa.Start()
+
+	wbsa.Add("locality-1", 1)
+	wbsa.Add("locality-2", 1)
+	wbsa.UpdateState("locality-1", balancer.State{ConnectivityState: connectivity.Ready, Picker: base.NewErrPicker(nil)})
+	wbsa.UpdateState("locality-2", balancer.State{ConnectivityState: connectivity.TransientFailure, Picker: base.NewErrPicker(balancer.ErrTransientFailure)})
+
+	got := wbsa.Snapshot()
+	want := map[string]WeightedState{
+		"locality-1": {Weight: 1, State: connectivity.Ready},
+		"locality-2": {Weight: 1, State: connectivity.TransientFailure},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Snapshot() returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+// TestEffectiveWeights covers computing each sub-balancer's normalized
+// (weight/sum) effective pick probability: weights {1, 3} should normalize
+// to {0.25, 0.75}.
+func TestEffectiveWeights(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	wbsa := New(cc, nil, wrr.NewRandom)
+	wbsa.Start()
+
+	wbsa.Add("locality-1", 1)
+	wbsa.Add("locality-2", 3)
+
+	got := wbsa.EffectiveWeights()
+	want := map[string]float64{
+		"locality-1": 0.25,
+		"locality-2": 0.75,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("EffectiveWeights() returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+// TestEffectiveWeightsAllZero covers the degenerate case where every tracked
+// sub-balancer has weight 0: the split would be undefined, so
+// EffectiveWeights reports none rather than dividing by zero.
+func TestEffectiveWeightsAllZero(t *testing.T) {
+	cc := testutils.NewTestClientConn(t)
+	wbsa := New(cc, nil, wrr.NewRandom)
+	wbsa.Start()
+
+	wbsa.Add("locality-1", 0)
+	wbsa.Add("locality-2", 0)
+
+	if got := wbsa.EffectiveWeights(); len(got) != 0 {
+		t.Errorf("EffectiveWeights() = %v, want empty", got)
+	}
+}
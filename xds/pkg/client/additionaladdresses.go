@@ -0,0 +1,51 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import "google.golang.org/grpc/resolver"
+
+// additionalAddressesKey is the type used as the key to store an Endpoint's
+// AdditionalAddresses in the Attributes field of resolver.Address.
+type additionalAddressesKey struct{}
+
+// SetAdditionalAddresses returns a copy of addr in which the Attributes
+// field carries addrs, so that a dual-stack-aware SubConn constructed from
+// addr can reach them (e.g. for happy-eyeballs) alongside addr.Addr.
+//
+// Experimental
+//
+// Notice: This API is EXPERIMENTAL and may be changed or removed in a
+// later release.
+func SetAdditionalAddresses(addr resolver.Address, addrs []string) resolver.Address {
+	addr.Attributes = addr.Attributes.WithValues(additionalAddressesKey{}, addrs)
+	return addr
+}
+
+// GetAdditionalAddresses returns the additional addresses stored in the
+// Attributes field of addr, or nil if none were set.
+//
+// Experimental
+//
+// Notice: This API is EXPERIMENTAL and may be changed or removed in a
+// later release.
+func GetAdditionalAddresses(addr resolver.Address) []string {
+	v := addr.Attributes.Value(additionalAddressesKey{})
+	addrs, _ := v.([]string)
+	return addrs
+}
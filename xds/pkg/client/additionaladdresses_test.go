@@ -0,0 +1,42 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/resolver"
+)
+
+func (s) TestSetGetAdditionalAddresses(t *testing.T) {
+	addr := resolver.Address{Addr: "192.0.2.1:443"}
+	if got := GetAdditionalAddresses(addr); got != nil {
+		t.Fatalf("GetAdditionalAddresses() on unset addr = %v, want nil", got)
+	}
+
+	want := []string{"[2001:db8::1]:443"}
+	addr = SetAdditionalAddresses(addr, want)
+	if got := GetAdditionalAddresses(addr); !cmp.Equal(got, want) {
+		t.Errorf("GetAdditionalAddresses() = %v, want %v", got, want)
+	}
+	if addr.Addr != "192.0.2.1:443" {
+		t.Errorf("SetAdditionalAddresses() changed Addr to %q", addr.Addr)
+	}
+}
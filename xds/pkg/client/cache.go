@@ -18,6 +18,13 @@
 
 package client
 
+// cache returns the version, metadata and resource cache for t. The returned
+// cache is a fresh, deep copy made while c.mu is held, not c's own live map:
+// c goes on mutating its internal maps in place as updates arrive, so
+// handing those out directly (or copying only the top-level map, leaving
+// its values' own slices aliased) would let a caller race with c's own
+// callbacks, or corrupt c's cache by mutating a slice it still owns, the
+// moment it dropped c.mu.
 func (c *clientImpl) cache(t ResourceType) (string, map[string]UpdateMetadata, interface{}) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -31,19 +38,35 @@ func (c *clientImpl) cache(t ResourceType) (string, map[string]UpdateMetadata, i
 	case ListenerResource:
 		version = c.ldsVersion
 		md = c.ldsMD
-		cache = c.ldsCache
+		cp := make(map[string]ListenerUpdate, len(c.ldsCache))
+		for name, u := range c.ldsCache {
+			cp[name] = u.Clone()
+		}
+		cache = cp
 	case RouteConfigResource:
 		version = c.rdsVersion
 		md = c.rdsMD
-		cache = c.rdsCache
+		cp := make(map[string]RouteConfigUpdate, len(c.rdsCache))
+		for name, u := range c.rdsCache {
+			cp[name] = u.Clone()
+		}
+		cache = cp
 	case ClusterResource:
 		version = c.cdsVersion
 		md = c.cdsMD
-		cache = c.cdsCache
+		cp := make(map[string]ClusterUpdate, len(c.cdsCache))
+		for name, u := range c.cdsCache {
+			cp[name] = u.Clone()
+		}
+		cache = cp
 	case EndpointsResource:
 		version = c.edsVersion
 		md = c.edsMD
-		cache = c.edsCache
+		cp := make(map[string]EndpointsUpdate, len(c.edsCache))
+		for name, u := range c.edsCache {
+			cp[name] = u.Clone()
+		}
+		cache = cp
 	default:
 		c.logger.Errorf("dumping resource of unknown type: %v", t)
 		return "", nil, nil
@@ -75,3 +98,68 @@ func (c *clientImpl) EDSCache() (string, map[string]EndpointsUpdate) {
 	ver, _, inter := c.cache(EndpointsResource)
 	return ver, inter.(map[string]EndpointsUpdate)
 }
+
+// EDSCacheDelta returns the status and contents of EDS, the same as
+// EDSCache, plus the names of resources that were present in the previous
+// call to EDSCacheDelta but are no longer in the cache.
+//
+// This exists for consumers built around delta (incremental) xDS semantics,
+// where resources are added and removed individually and a consumer needs
+// to know about a removal even though EDSCache itself only ever reports the
+// current snapshot. Each call updates the set of names used to compute the
+// removals for the next call, so it is meant to be polled by a single
+// logical consumer; mixing calls from independent consumers will make each
+// of them see removals caused by the other's reads.
+func (c *clientImpl) EDSCacheDelta() (string, map[string]EndpointsUpdate, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var removed []string
+	for name := range c.edsCacheDeltaSeen {
+		if _, ok := c.edsCache[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+
+	seen := make(map[string]bool, len(c.edsCache))
+	cp := make(map[string]EndpointsUpdate, len(c.edsCache))
+	for name, u := range c.edsCache {
+		seen[name] = true
+		cp[name] = u.Clone()
+	}
+	c.edsCacheDeltaSeen = seen
+
+	return c.edsVersion, cp, removed
+}
+
+// NACKedResources returns, for every resource type, the name and NACK reason
+// of every resource currently in ServiceStatusNACKed state. It's meant to
+// help operators find out why a resource update was rejected without having
+// to dig through logs.
+func (c *clientImpl) NACKedResources() map[ResourceType]map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ret := make(map[ResourceType]map[string]string)
+	for t, md := range map[ResourceType]map[string]UpdateMetadata{
+		ListenerResource:    c.ldsMD,
+		RouteConfigResource: c.rdsMD,
+		ClusterResource:     c.cdsMD,
+		EndpointsResource:   c.edsMD,
+	} {
+		for name, m := range md {
+			if m.Status != ServiceStatusNACKed {
+				continue
+			}
+			if ret[t] == nil {
+				ret[t] = make(map[string]string)
+			}
+			if m.ErrState != nil {
+				ret[t][name] = m.ErrState.Err.Error()
+			} else {
+				ret[t][name] = ""
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,93 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func (s) TestNACKedResources(t *testing.T) {
+	c := &clientImpl{
+		ldsCache: make(map[string]ListenerUpdate),
+		ldsMD: map[string]UpdateMetadata{
+			"good-listener": {Status: ServiceStatusACKed},
+			"bad-listener":  {Status: ServiceStatusNACKed, ErrState: &UpdateErrorMetadata{Err: errors.New("bad listener resource")}},
+		},
+		rdsCache: make(map[string]RouteConfigUpdate),
+		rdsMD: map[string]UpdateMetadata{
+			"good-route": {Status: ServiceStatusACKed},
+		},
+		cdsCache: make(map[string]ClusterUpdate),
+		cdsMD: map[string]UpdateMetadata{
+			"bad-cluster": {Status: ServiceStatusNACKed, ErrState: &UpdateErrorMetadata{Err: errors.New("bad cluster resource")}},
+		},
+		edsCache: make(map[string]EndpointsUpdate),
+		edsMD:    map[string]UpdateMetadata{},
+	}
+
+	got := c.NACKedResources()
+	want := map[ResourceType]map[string]string{
+		ListenerResource: {"bad-listener": "bad listener resource"},
+		ClusterResource:  {"bad-cluster": "bad cluster resource"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("NACKedResources() returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func (s) TestEDSCacheDelta(t *testing.T) {
+	c := &clientImpl{
+		edsCache:          make(map[string]EndpointsUpdate),
+		edsCacheDeltaSeen: make(map[string]bool),
+		edsVersion:        "0",
+	}
+
+	// First call with an empty cache: nothing added yet, nothing removed.
+	if _, got, removed := c.EDSCacheDelta(); len(got) != 0 || len(removed) != 0 {
+		t.Fatalf("EDSCacheDelta() = (_, %v, %v), want (_, empty, empty)", got, removed)
+	}
+
+	// Simulate a delta add of "cluster-1" and "cluster-2".
+	c.edsCache["cluster-1"] = EndpointsUpdate{}
+	c.edsCache["cluster-2"] = EndpointsUpdate{}
+	c.edsVersion = "1"
+	if _, got, removed := c.EDSCacheDelta(); len(got) != 2 || len(removed) != 0 {
+		t.Fatalf("EDSCacheDelta() = (_, %v, %v), want (2 entries, empty removed)", got, removed)
+	}
+
+	// Simulate a delta remove of "cluster-1" and an add of "cluster-3".
+	delete(c.edsCache, "cluster-1")
+	c.edsCache["cluster-3"] = EndpointsUpdate{}
+	c.edsVersion = "2"
+	_, got, removed := c.EDSCacheDelta()
+	if diff := cmp.Diff(map[string]EndpointsUpdate{"cluster-2": {}, "cluster-3": {}}, got); diff != "" {
+		t.Errorf("EDSCacheDelta() snapshot returned unexpected diff (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"cluster-1"}, removed); diff != "" {
+		t.Errorf("EDSCacheDelta() removed returned unexpected diff (-want +got):\n%s", diff)
+	}
+
+	// A call with no further changes should report no new removals.
+	if _, _, removed := c.EDSCacheDelta(); len(removed) != 0 {
+		t.Errorf("EDSCacheDelta() removed = %v, want empty after a no-op update", removed)
+	}
+}
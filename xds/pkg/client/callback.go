@@ -218,7 +218,7 @@ func (c *clientImpl) NewClusters(updates map[string]ClusterUpdate, metadata Upda
 			// from cache, and also send an resource not found error to indicate
 			// resource removed.
 			delete(c.cdsCache, name)
-			c.ldsMD[name] = UpdateMetadata{Status: ServiceStatusNotExist}
+			c.cdsMD[name] = UpdateMetadata{Status: ServiceStatusNotExist}
 			for wi := range c.cdsWatchers[name] {
 				wi.resourceNotFound()
 			}
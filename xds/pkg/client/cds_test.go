@@ -26,9 +26,12 @@ import (
 	v2corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	v3clusterpb "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	v3corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3endpointpb "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	v3aggregateclusterpb "github.com/envoyproxy/go-control-plane/envoy/extensions/clusters/aggregate/v3"
 	v3tlspb "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	v3matcherpb "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
 	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
 	anypb "github.com/golang/protobuf/ptypes/any"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -45,6 +48,16 @@ const (
 
 var emptyUpdate = ClusterUpdate{ServiceName: "", EnableLRS: false}
 
+// marshalAnyOrDie marshals m into an Any proto, for use in table-driven test
+// cases where error-checking a marshal failure would only add noise.
+func marshalAnyOrDie(m proto.Message) *anypb.Any {
+	a, err := ptypes.MarshalAny(m)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
 func (s) TestValidateCluster_Failure(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -68,6 +81,23 @@ func (s) TestValidateCluster_Failure(t *testing.T) {
 			wantUpdate: emptyUpdate,
 			wantErr:    true,
 		},
+		{
+			name: "static-cluster-no-load-assignment",
+			cluster: &v3clusterpb.Cluster{
+				ClusterDiscoveryType: &v3clusterpb.Cluster_Type{Type: v3clusterpb.Cluster_STATIC},
+			},
+			wantUpdate: emptyUpdate,
+			wantErr:    true,
+		},
+		{
+			name: "logical-dns-cluster-empty-load-assignment",
+			cluster: &v3clusterpb.Cluster{
+				ClusterDiscoveryType: &v3clusterpb.Cluster_Type{Type: v3clusterpb.Cluster_LOGICAL_DNS},
+				LoadAssignment:       &v3endpointpb.ClusterLoadAssignment{},
+			},
+			wantUpdate: emptyUpdate,
+			wantErr:    true,
+		},
 		{
 			name: "no-eds-config",
 			cluster: &v3clusterpb.Cluster{
@@ -207,6 +237,135 @@ func (s) TestValidateCluster_Success(t *testing.T) {
 			},
 			wantUpdate: ClusterUpdate{ServiceName: serviceName, EnableLRS: true, MaxRequests: func() *uint32 { i := uint32(512); return &i }()},
 		},
+		{
+			name: "happiest-case-with-grpc-health-check",
+			cluster: &v3clusterpb.Cluster{
+				Name:                 clusterName,
+				ClusterDiscoveryType: &v3clusterpb.Cluster_Type{Type: v3clusterpb.Cluster_EDS},
+				EdsClusterConfig: &v3clusterpb.Cluster_EdsClusterConfig{
+					EdsConfig: &v3corepb.ConfigSource{
+						ConfigSourceSpecifier: &v3corepb.ConfigSource_Ads{
+							Ads: &v3corepb.AggregatedConfigSource{},
+						},
+					},
+					ServiceName: serviceName,
+				},
+				LbPolicy: v3clusterpb.Cluster_ROUND_ROBIN,
+				HealthChecks: []*v3corepb.HealthCheck{
+					{
+						HealthChecker: &v3corepb.HealthCheck_GrpcHealthCheck_{
+							GrpcHealthCheck: &v3corepb.HealthCheck_GrpcHealthCheck{},
+						},
+					},
+				},
+			},
+			wantUpdate: ClusterUpdate{ServiceName: serviceName, EnableLRS: false, EnableHealthCheck: true},
+		},
+		{
+			name: "ring-hash-cluster-with-explicit-ring-size",
+			cluster: &v3clusterpb.Cluster{
+				ClusterDiscoveryType: &v3clusterpb.Cluster_Type{Type: v3clusterpb.Cluster_EDS},
+				EdsClusterConfig: &v3clusterpb.Cluster_EdsClusterConfig{
+					EdsConfig: &v3corepb.ConfigSource{
+						ConfigSourceSpecifier: &v3corepb.ConfigSource_Ads{
+							Ads: &v3corepb.AggregatedConfigSource{},
+						},
+					},
+					ServiceName: serviceName,
+				},
+				LbPolicy: v3clusterpb.Cluster_RING_HASH,
+				LbConfig: &v3clusterpb.Cluster_RingHashLbConfig_{
+					RingHashLbConfig: &v3clusterpb.Cluster_RingHashLbConfig{
+						MinimumRingSize: wrapperspb.UInt64(2048),
+						MaximumRingSize: wrapperspb.UInt64(4096),
+					},
+				},
+			},
+			wantUpdate: ClusterUpdate{
+				ServiceName: serviceName,
+				LBPolicy:    ClusterLBPolicyRingHash,
+				RingHashConfig: &ClusterLBPolicyRingHashConfig{
+					MinimumRingSize: 2048,
+					MaximumRingSize: 4096,
+				},
+			},
+		},
+		{
+			name: "ring-hash-cluster-with-default-ring-size",
+			cluster: &v3clusterpb.Cluster{
+				ClusterDiscoveryType: &v3clusterpb.Cluster_Type{Type: v3clusterpb.Cluster_EDS},
+				EdsClusterConfig: &v3clusterpb.Cluster_EdsClusterConfig{
+					EdsConfig: &v3corepb.ConfigSource{
+						ConfigSourceSpecifier: &v3corepb.ConfigSource_Ads{
+							Ads: &v3corepb.AggregatedConfigSource{},
+						},
+					},
+					ServiceName: serviceName,
+				},
+				LbPolicy: v3clusterpb.Cluster_RING_HASH,
+			},
+			wantUpdate: ClusterUpdate{
+				ServiceName: serviceName,
+				LBPolicy:    ClusterLBPolicyRingHash,
+				RingHashConfig: &ClusterLBPolicyRingHashConfig{
+					MinimumRingSize: defaultRingHashMinimumRingSize,
+					MaximumRingSize: defaultRingHashMaximumRingSize,
+				},
+			},
+		},
+		{
+			name: "aggregate-cluster",
+			cluster: &v3clusterpb.Cluster{
+				Name: clusterName,
+				ClusterDiscoveryType: &v3clusterpb.Cluster_ClusterType{
+					ClusterType: &v3clusterpb.Cluster_CustomClusterType{
+						Name:        aggregateClusterTypeName,
+						TypedConfig: marshalAnyOrDie(&v3aggregateclusterpb.ClusterConfig{Clusters: []string{"a", "b", "c"}}),
+					},
+				},
+			},
+			wantUpdate: ClusterUpdate{ClusterType: ClusterTypeAggregate, PrioritizedClusterNames: []string{"a", "b", "c"}},
+		},
+		{
+			name: "logical-dns-cluster",
+			cluster: &v3clusterpb.Cluster{
+				Name:                 clusterName,
+				ClusterDiscoveryType: &v3clusterpb.Cluster_Type{Type: v3clusterpb.Cluster_LOGICAL_DNS},
+				LoadAssignment:       func() *v3endpointpb.ClusterLoadAssignment { b := newClaBuilder(clusterName, nil); b.addLocality("subzone", 1, 0, []string{"dns.example.com:80"}, nil); return b.v }(),
+			},
+			wantUpdate: ClusterUpdate{
+				ClusterType: ClusterTypeLogicalDNS,
+				InlineEndpointsUpdate: func() *EndpointsUpdate {
+					b := newClaBuilder(clusterName, nil)
+					b.addLocality("subzone", 1, 0, []string{"dns.example.com:80"}, nil)
+					eu, err := parseEDSRespProto(b.v)
+					if err != nil {
+						panic(err)
+					}
+					return &eu
+				}(),
+			},
+		},
+		{
+			name: "static-cluster",
+			cluster: &v3clusterpb.Cluster{
+				Name:                 clusterName,
+				ClusterDiscoveryType: &v3clusterpb.Cluster_Type{Type: v3clusterpb.Cluster_STATIC},
+				LoadAssignment:       func() *v3endpointpb.ClusterLoadAssignment { b := newClaBuilder(clusterName, nil); b.addLocality("subzone", 1, 0, []string{"192.168.0.1:80"}, nil); return b.v }(),
+			},
+			wantUpdate: ClusterUpdate{
+				ClusterType: ClusterTypeStatic,
+				InlineEndpointsUpdate: func() *EndpointsUpdate {
+					b := newClaBuilder(clusterName, nil)
+					b.addLocality("subzone", 1, 0, []string{"192.168.0.1:80"}, nil)
+					eu, err := parseEDSRespProto(b.v)
+					if err != nil {
+						panic(err)
+					}
+					return &eu
+				}(),
+			},
+		},
 	}
 
 	origCircuitBreakingSupport := env.CircuitBreakingSupport
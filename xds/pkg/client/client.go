@@ -31,6 +31,8 @@ import (
 	v2corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	v3corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"google.golang.org/protobuf/types/known/anypb"
 
 	"google.golang.org/grpc/internal/xds"
@@ -210,6 +212,18 @@ type ListenerUpdate struct {
 	Raw *anypb.Any
 }
 
+// Clone returns a deep copy of u, safe for a caller to mutate without
+// affecting u. HTTPFilters elements and Raw are not deep-copied, since both
+// are treated as immutable once constructed.
+func (u ListenerUpdate) Clone() ListenerUpdate {
+	c := u
+	if u.HTTPFilters != nil {
+		c.HTTPFilters = append([]HTTPFilter(nil), u.HTTPFilters...)
+	}
+	c.InboundListenerCfg = u.InboundListenerCfg.clone()
+	return c
+}
+
 // HTTPFilter represents one HTTP filter from an LDS response's HTTP connection
 // manager field.
 type HTTPFilter struct {
@@ -239,6 +253,22 @@ type InboundListenerConfig struct {
 	DefaultFilterChain *FilterChain
 }
 
+// clone returns a deep copy of c, or nil if c is nil.
+func (c *InboundListenerConfig) clone() *InboundListenerConfig {
+	if c == nil {
+		return nil
+	}
+	cp := *c
+	if c.FilterChains != nil {
+		cp.FilterChains = make([]*FilterChain, len(c.FilterChains))
+		for i, fc := range c.FilterChains {
+			cp.FilterChains[i] = fc.clone()
+		}
+	}
+	cp.DefaultFilterChain = c.DefaultFilterChain.clone()
+	return &cp
+}
+
 // FilterChain wraps a set of match criteria and associated security
 // configuration.
 //
@@ -252,6 +282,17 @@ type FilterChain struct {
 	SecurityCfg *SecurityConfig
 }
 
+// clone returns a deep copy of fc, or nil if fc is nil.
+func (fc *FilterChain) clone() *FilterChain {
+	if fc == nil {
+		return nil
+	}
+	cp := *fc
+	cp.Match = fc.Match.clone()
+	cp.SecurityCfg = fc.SecurityCfg.clone()
+	return &cp
+}
+
 // SourceType specifies the connection source IP match type.
 type SourceType int
 
@@ -270,7 +311,7 @@ const (
 // The xDS FilterChainMatch proto specifies 8 match criteria. But we only have a
 // subset of those fields here because we explicitly ignore filter chains whose
 // match criteria specifies values for fields like destination_port,
-// server_names, application_protocols, transport_protocol.
+// application_protocols, transport_protocol.
 type FilterChainMatch struct {
 	// DestPrefixRanges specifies a set of IP addresses and prefix lengths to
 	// match the destination address of the incoming connection when the
@@ -287,6 +328,39 @@ type FilterChainMatch struct {
 	// SourcePorts specifies a set of ports to match the source port of the
 	// incoming connection. If this field is empty, the source port is ignored.
 	SourcePorts []uint32
+	// ServerNames specifies a set of server names (SNI) to match the
+	// incoming connection's TLS ClientHello server_name extension against.
+	// If this field is empty, the server name is ignored, and the filter
+	// chain matches connections with any (or no) SNI.
+	ServerNames []string
+}
+
+// clone returns a deep copy of m, or nil if m is nil. net.IP values are
+// copied rather than shared, since they're backed by mutable byte slices.
+func (m *FilterChainMatch) clone() *FilterChainMatch {
+	if m == nil {
+		return nil
+	}
+	cp := *m
+	if m.DestPrefixRanges != nil {
+		cp.DestPrefixRanges = make([]net.IP, len(m.DestPrefixRanges))
+		for i, ip := range m.DestPrefixRanges {
+			cp.DestPrefixRanges[i] = append(net.IP(nil), ip...)
+		}
+	}
+	if m.SourcePrefixRanges != nil {
+		cp.SourcePrefixRanges = make([]net.IP, len(m.SourcePrefixRanges))
+		for i, ip := range m.SourcePrefixRanges {
+			cp.SourcePrefixRanges[i] = append(net.IP(nil), ip...)
+		}
+	}
+	if m.SourcePorts != nil {
+		cp.SourcePorts = append([]uint32(nil), m.SourcePorts...)
+	}
+	if m.ServerNames != nil {
+		cp.ServerNames = append([]string(nil), m.ServerNames...)
+	}
+	return &cp
 }
 
 // RouteConfigUpdate contains information received in an RDS response, which is
@@ -298,6 +372,23 @@ type RouteConfigUpdate struct {
 	Raw *anypb.Any
 }
 
+// Clone returns a copy of u whose slices and maps are newly allocated at
+// every level, so a caller can add, remove or replace their elements without
+// affecting u. The pointer fields of each Route (Path, Prefix, Regex,
+// Fraction, MaxStreamDuration) and of each HeaderMatcher still point at the
+// same values as u's. HTTPFilterConfigOverride values and Raw are not
+// deep-copied, since both are treated as immutable once constructed.
+func (u RouteConfigUpdate) Clone() RouteConfigUpdate {
+	c := u
+	if u.VirtualHosts != nil {
+		c.VirtualHosts = make([]*VirtualHost, len(u.VirtualHosts))
+		for i, vh := range u.VirtualHosts {
+			c.VirtualHosts[i] = vh.clone()
+		}
+	}
+	return c
+}
+
 // VirtualHost contains the routes for a list of Domains.
 //
 // Note that the domains in this slice can be a wildcard, not an exact string.
@@ -314,6 +405,32 @@ type VirtualHost struct {
 	HTTPFilterConfigOverride map[string]httpfilter.FilterConfig
 }
 
+// clone returns a copy of vh, or nil if vh is nil, with its Domains, Routes
+// and HTTPFilterConfigOverride newly allocated and each Route copied by
+// Route.clone.
+func (vh *VirtualHost) clone() *VirtualHost {
+	if vh == nil {
+		return nil
+	}
+	cp := *vh
+	if vh.Domains != nil {
+		cp.Domains = append([]string(nil), vh.Domains...)
+	}
+	if vh.Routes != nil {
+		cp.Routes = make([]*Route, len(vh.Routes))
+		for i, r := range vh.Routes {
+			cp.Routes[i] = r.clone()
+		}
+	}
+	if vh.HTTPFilterConfigOverride != nil {
+		cp.HTTPFilterConfigOverride = make(map[string]httpfilter.FilterConfig, len(vh.HTTPFilterConfigOverride))
+		for name, fc := range vh.HTTPFilterConfigOverride {
+			cp.HTTPFilterConfigOverride[name] = fc
+		}
+	}
+	return &cp
+}
+
 // Route is both a specification of how to match a request as well as an
 // indication of the action to take upon match.
 type Route struct {
@@ -339,6 +456,46 @@ type Route struct {
 	HTTPFilterConfigOverride map[string]httpfilter.FilterConfig
 }
 
+// clone returns a copy of r, or nil if r is nil, with its Headers (and each
+// HeaderMatcher in it), WeightedClusters and HTTPFilterConfigOverride newly
+// allocated. The pointer fields (Path, Prefix, Regex, Fraction,
+// MaxStreamDuration, and those inside each HeaderMatcher) point at the same
+// values as r's. HTTPFilterConfigOverride values are not deep-copied, since
+// they're treated as immutable once constructed.
+func (r *Route) clone() *Route {
+	if r == nil {
+		return nil
+	}
+	cp := *r
+	if r.Headers != nil {
+		cp.Headers = make([]*HeaderMatcher, len(r.Headers))
+		for i, hm := range r.Headers {
+			hmCopy := *hm
+			cp.Headers[i] = &hmCopy
+		}
+	}
+	if r.WeightedClusters != nil {
+		cp.WeightedClusters = make(map[string]WeightedCluster, len(r.WeightedClusters))
+		for name, wc := range r.WeightedClusters {
+			if wc.HTTPFilterConfigOverride != nil {
+				wcCopy := make(map[string]httpfilter.FilterConfig, len(wc.HTTPFilterConfigOverride))
+				for fname, fc := range wc.HTTPFilterConfigOverride {
+					wcCopy[fname] = fc
+				}
+				wc.HTTPFilterConfigOverride = wcCopy
+			}
+			cp.WeightedClusters[name] = wc
+		}
+	}
+	if r.HTTPFilterConfigOverride != nil {
+		cp.HTTPFilterConfigOverride = make(map[string]httpfilter.FilterConfig, len(r.HTTPFilterConfigOverride))
+		for name, fc := range r.HTTPFilterConfigOverride {
+			cp.HTTPFilterConfigOverride[name] = fc
+		}
+	}
+	return &cp
+}
+
 // WeightedCluster contains settings for an xds RouteAction.WeightedCluster.
 type WeightedCluster struct {
 	// Weight is the relative weight of the cluster.  It will never be zero.
@@ -401,9 +558,48 @@ type SecurityConfig struct {
 	RequireClientCert bool
 }
 
+// clone returns a deep copy of c, or nil if c is nil. SubjectAltNameMatchers
+// elements are xds.StringMatcher values, which are immutable once
+// constructed, so the slice is copied but its elements are not.
+func (c *SecurityConfig) clone() *SecurityConfig {
+	if c == nil {
+		return nil
+	}
+	cp := *c
+	if c.SubjectAltNameMatchers != nil {
+		cp.SubjectAltNameMatchers = append([]xds.StringMatcher(nil), c.SubjectAltNameMatchers...)
+	}
+	return &cp
+}
+
+// ClusterType is the type of cluster that a ClusterUpdate describes, as
+// determined by the Cluster proto's discovery type.
+type ClusterType int
+
+const (
+	// ClusterTypeEDS represents a cluster that resolves endpoints via EDS.
+	// This is the default, and the only type supported prior to the
+	// introduction of aggregate clusters.
+	ClusterTypeEDS ClusterType = iota
+	// ClusterTypeAggregate represents an aggregate cluster, which doesn't
+	// own endpoints itself, but references an ordered list of child
+	// clusters via PrioritizedClusterNames instead.
+	ClusterTypeAggregate
+	// ClusterTypeLogicalDNS represents a cluster whose endpoints are
+	// resolved via DNS rather than EDS. Its endpoints are carried inline in
+	// InlineEndpointsUpdate.
+	ClusterTypeLogicalDNS
+	// ClusterTypeStatic represents a cluster with a fixed, statically
+	// configured set of endpoints. Its endpoints are carried inline in
+	// InlineEndpointsUpdate.
+	ClusterTypeStatic
+)
+
 // ClusterUpdate contains information from a received CDS response, which is of
 // interest to the registered CDS watcher.
 type ClusterUpdate struct {
+	// ClusterType is the type of cluster this update describes.
+	ClusterType ClusterType
 	// ServiceName is the service name corresponding to the clusterName which
 	// is being watched for through CDS.
 	ServiceName string
@@ -413,11 +609,82 @@ type ClusterUpdate struct {
 	SecurityCfg *SecurityConfig
 	// MaxRequests for circuit breaking, if any (otherwise nil).
 	MaxRequests *uint32
+	// PrioritizedClusterNames is the ordered list of child cluster names for
+	// an aggregate cluster (ClusterType == ClusterTypeAggregate). It is
+	// unset for all other cluster types.
+	PrioritizedClusterNames []string
+	// InlineEndpointsUpdate holds the endpoints carried inline in the CDS
+	// response's load_assignment field, for cluster types that don't use
+	// EDS (ClusterType == ClusterTypeLogicalDNS or ClusterTypeStatic). It is
+	// nil for all other cluster types.
+	InlineEndpointsUpdate *EndpointsUpdate
+	// EnableHealthCheck indicates whether the cluster resource configured a
+	// gRPC health check (Cluster.health_checks with a grpc_health_check
+	// entry). When set, SubConns for this cluster's endpoints should opt
+	// into gRPC client-side health checking. Note that the health check
+	// service name itself is not plumbed here: this version of gRPC-go only
+	// supports configuring it channel-wide, via the healthCheckConfig field
+	// of the service config, not per cluster.
+	EnableHealthCheck bool
+	// EnableLocalityWeightedLB indicates whether the cluster resource
+	// explicitly enabled locality weighted load balancing, via a
+	// common_lb_config.locality_weighted_lb_config entry. When false, EDS
+	// localities with a weight of 0 should be treated as equally weighted
+	// rather than excluded.
+	EnableLocalityWeightedLB bool
+	// LBPolicy is the load balancing policy configured on the cluster
+	// resource's lb_policy field.
+	LBPolicy ClusterLBPolicy
+	// RingHashConfig carries the ring_hash_lb_config settings. It is only
+	// set when LBPolicy is ClusterLBPolicyRingHash.
+	RingHashConfig *ClusterLBPolicyRingHashConfig
 
 	// Raw is the resource from the xds response.
 	Raw *anypb.Any
 }
 
+// Clone returns a deep copy of u, safe for a caller to mutate without
+// affecting u. Raw is not deep-copied, since it's treated as immutable once
+// constructed.
+func (u ClusterUpdate) Clone() ClusterUpdate {
+	c := u
+	c.SecurityCfg = u.SecurityCfg.clone()
+	if u.MaxRequests != nil {
+		mr := *u.MaxRequests
+		c.MaxRequests = &mr
+	}
+	if u.PrioritizedClusterNames != nil {
+		c.PrioritizedClusterNames = append([]string(nil), u.PrioritizedClusterNames...)
+	}
+	if u.InlineEndpointsUpdate != nil {
+		ieu := u.InlineEndpointsUpdate.Clone()
+		c.InlineEndpointsUpdate = &ieu
+	}
+	if u.RingHashConfig != nil {
+		rhc := *u.RingHashConfig
+		c.RingHashConfig = &rhc
+	}
+	return c
+}
+
+// ClusterLBPolicy identifies the load balancing policy configured on a
+// cluster resource's lb_policy field.
+type ClusterLBPolicy int
+
+const (
+	// ClusterLBPolicyRoundRobin corresponds to Envoy's ROUND_ROBIN lb_policy.
+	ClusterLBPolicyRoundRobin ClusterLBPolicy = iota
+	// ClusterLBPolicyRingHash corresponds to Envoy's RING_HASH lb_policy.
+	ClusterLBPolicyRingHash
+)
+
+// ClusterLBPolicyRingHashConfig carries the settings from a cluster
+// resource's ring_hash_lb_config field.
+type ClusterLBPolicyRingHashConfig struct {
+	MinimumRingSize uint64
+	MaximumRingSize uint64
+}
+
 // OverloadDropConfig contains the config to drop overloads.
 type OverloadDropConfig struct {
 	Category    string
@@ -448,6 +715,17 @@ type Endpoint struct {
 	Address      string
 	HealthStatus EndpointHealthStatus
 	Weight       uint32
+	// AdditionalAddresses holds extra addresses for the same endpoint, for
+	// happy-eyeballs/dual-stack (e.g. an IPv6 address alongside the primary
+	// IPv4 one in Address). The vendored go-control-plane version this
+	// client is built against predates Envoy's EDS additional_addresses
+	// field, so parseEndpoints never populates this today; it's exposed so
+	// that callers constructing an Endpoint directly (e.g. for a resolver
+	// that already knows about multiple addresses) have somewhere to put
+	// them, and so downstream consumers (see SetAdditionalAddresses and
+	// GetAdditionalAddresses in this package) don't need an API change once the
+	// field can be parsed from the wire.
+	AdditionalAddresses []string
 }
 
 // Locality contains information of a locality.
@@ -463,10 +741,115 @@ type EndpointsUpdate struct {
 	Drops      []OverloadDropConfig
 	Localities []Locality
 
+	// OverprovisioningFactor is the percentage of a priority/locality's total
+	// endpoint weight that must be healthy before it's no longer considered
+	// for weighted spill to the next priority/locality: 100 means all-or-
+	// nothing failover (every endpoint must be down before spilling over),
+	// while the default of 140 spills a proportional share of traffic over
+	// before that point. It's always set by parseEDSRespProto, reflecting
+	// either an explicit overprovisioning_factor or the deprecated
+	// disable_overprovisioning flag in the response's policy.
+	OverprovisioningFactor uint32
+
 	// Raw is the resource from the xds response.
 	Raw *anypb.Any
 }
 
+// MergeEndpointsUpdates merges multiple EndpointsUpdate into one, for
+// clusters whose endpoints are sharded across more than one EDS resource.
+// Localities are unioned by LocalityID: a LocalityID appearing in more than
+// one update must carry the same Priority and Weight in all of them (since
+// those are per-locality properties of the cluster as a whole, not of a
+// shard), and their Endpoints are concatenated. Drops from all updates are
+// concatenated. The returned update's Raw field is left unset, since there's
+// no single resource it corresponds to.
+func MergeEndpointsUpdates(updates ...EndpointsUpdate) (EndpointsUpdate, error) {
+	var ret EndpointsUpdate
+	localityIdx := make(map[pkg.LocalityID]int)
+	for i, u := range updates {
+		if i == 0 {
+			ret.OverprovisioningFactor = u.OverprovisioningFactor
+		} else if ret.OverprovisioningFactor != u.OverprovisioningFactor {
+			return EndpointsUpdate{}, fmt.Errorf("mismatching overprovisioning factor across updates: %v and %v", ret.OverprovisioningFactor, u.OverprovisioningFactor)
+		}
+		ret.Drops = append(ret.Drops, u.Drops...)
+		for _, l := range u.Localities {
+			i, ok := localityIdx[l.ID]
+			if !ok {
+				localityIdx[l.ID] = len(ret.Localities)
+				ret.Localities = append(ret.Localities, l)
+				continue
+			}
+			existing := &ret.Localities[i]
+			if existing.Priority != l.Priority || existing.Weight != l.Weight {
+				return EndpointsUpdate{}, fmt.Errorf("locality %+v has mismatching priority/weight across updates: {%v,%v} and {%v,%v}", l.ID, existing.Priority, existing.Weight, l.Priority, l.Weight)
+			}
+			existing.Endpoints = append(existing.Endpoints, l.Endpoints...)
+		}
+	}
+	return ret, nil
+}
+
+// Equal reports whether u and other represent the same EDS update,
+// comparing Drops and Localities by value, element by element in order (a
+// nil and an empty slice count as equal), and Raw by proto equality. It's meant
+// for callers that want to know whether an EDS update actually changed,
+// without caring about the specific diff.
+//
+// Note: this compares field-by-field, rather than via a single
+// cmp.Equal(u, other, ...) call, because go-cmp detects and invokes a
+// type's own Equal method when comparing values of that type, which would
+// make such a call recurse into this method forever.
+func (u EndpointsUpdate) Equal(other EndpointsUpdate) bool {
+	return u.OverprovisioningFactor == other.OverprovisioningFactor &&
+		cmp.Equal(u.Drops, other.Drops, cmpopts.EquateEmpty()) &&
+		cmp.Equal(u.Localities, other.Localities, cmpopts.EquateEmpty()) &&
+		proto.Equal(u.Raw, other.Raw)
+}
+
+// Clone returns a deep copy of u, safe for a caller to mutate (including the
+// Endpoints and AdditionalAddresses slices nested inside Localities) without
+// affecting u. Raw is not deep-copied, since it's treated as immutable once
+// constructed.
+func (u EndpointsUpdate) Clone() EndpointsUpdate {
+	c := u
+	if u.Drops != nil {
+		c.Drops = append([]OverloadDropConfig(nil), u.Drops...)
+	}
+	if u.Localities != nil {
+		c.Localities = make([]Locality, len(u.Localities))
+		for i, l := range u.Localities {
+			lc := l
+			if l.Endpoints != nil {
+				lc.Endpoints = make([]Endpoint, len(l.Endpoints))
+				for j, e := range l.Endpoints {
+					ec := e
+					if e.AdditionalAddresses != nil {
+						ec.AdditionalAddresses = append([]string(nil), e.AdditionalAddresses...)
+					}
+					lc.Endpoints[j] = ec
+				}
+			}
+			c.Localities[i] = lc
+		}
+	}
+	return c
+}
+
+// LocalitiesByPriority groups u's Localities by their Priority field, in the
+// same grouping the eds balancer's handleEDSResponse does internally, so
+// callers that just want "what localities exist at each priority" don't
+// have to re-derive it. Unlike handleEDSResponse, this performs no
+// filtering: localities with a zero Weight are included, since u reflects
+// the cache's pre-filter view of the EDS response.
+func (u EndpointsUpdate) LocalitiesByPriority() map[uint32][]Locality {
+	ret := make(map[uint32][]Locality)
+	for _, l := range u.Localities {
+		ret[l.Priority] = append(ret[l.Priority], l)
+	}
+	return ret
+}
+
 // Function to be overridden in tests.
 var newAPIClient = func(apiVersion version.TransportAPI, cc *grpc.ClientConn, opts BuildOptions) (APIClient, error) {
 	cb := getAPIClientBuilder(apiVersion)
@@ -513,6 +896,11 @@ type clientImpl struct {
 	edsVersion  string // Only used in CSDS.
 	edsCache    map[string]EndpointsUpdate
 	edsMD       map[string]UpdateMetadata
+	// edsCacheDeltaSeen holds the set of EDS resource names returned by the
+	// most recent call to EDSCacheDelta, so the next call can report which of
+	// them are no longer present. It's independent of edsCache itself so that
+	// calling the SotW-style EDSCache doesn't perturb delta tracking.
+	edsCacheDeltaSeen map[string]bool
 
 	// Changes to map lrsClients and the lrsClient inside the map need to be
 	// protected by lrsMu.
@@ -555,20 +943,21 @@ func newWithConfig(config *bootstrap.Config, watchExpiryTimeout time.Duration) (
 		config:             config,
 		watchExpiryTimeout: watchExpiryTimeout,
 
-		updateCh:    buffer.NewUnbounded(),
-		ldsWatchers: make(map[string]map[*watchInfo]bool),
-		ldsCache:    make(map[string]ListenerUpdate),
-		ldsMD:       make(map[string]UpdateMetadata),
-		rdsWatchers: make(map[string]map[*watchInfo]bool),
-		rdsCache:    make(map[string]RouteConfigUpdate),
-		rdsMD:       make(map[string]UpdateMetadata),
-		cdsWatchers: make(map[string]map[*watchInfo]bool),
-		cdsCache:    make(map[string]ClusterUpdate),
-		cdsMD:       make(map[string]UpdateMetadata),
-		edsWatchers: make(map[string]map[*watchInfo]bool),
-		edsCache:    make(map[string]EndpointsUpdate),
-		edsMD:       make(map[string]UpdateMetadata),
-		lrsClients:  make(map[string]*lrsClient),
+		updateCh:          buffer.NewUnbounded(),
+		ldsWatchers:       make(map[string]map[*watchInfo]bool),
+		ldsCache:          make(map[string]ListenerUpdate),
+		ldsMD:             make(map[string]UpdateMetadata),
+		rdsWatchers:       make(map[string]map[*watchInfo]bool),
+		rdsCache:          make(map[string]RouteConfigUpdate),
+		rdsMD:             make(map[string]UpdateMetadata),
+		cdsWatchers:       make(map[string]map[*watchInfo]bool),
+		cdsCache:          make(map[string]ClusterUpdate),
+		cdsMD:             make(map[string]UpdateMetadata),
+		edsWatchers:       make(map[string]map[*watchInfo]bool),
+		edsCache:          make(map[string]EndpointsUpdate),
+		edsMD:             make(map[string]UpdateMetadata),
+		edsCacheDeltaSeen: make(map[string]bool),
+		lrsClients:        make(map[string]*lrsClient),
 	}
 
 	cc, err := grpc.Dial(config.BalancerName, dopts...)
@@ -667,6 +1056,63 @@ func (r ResourceType) String() string {
 	}
 }
 
+// TypeURL returns the xDS type URL (e.g.
+// "type.googleapis.com/envoy.config.listener.v3.Listener") that a
+// DiscoveryRequest/Response uses to identify r on the wire, for the given
+// transport API version. It returns the empty string for UnknownResource or
+// an unrecognized ResourceType.
+func (r ResourceType) TypeURL(v version.TransportAPI) string {
+	switch r {
+	case ListenerResource:
+		if v == version.TransportV2 {
+			return version.V2ListenerURL
+		}
+		return version.V3ListenerURL
+	case HTTPConnManagerResource:
+		if v == version.TransportV2 {
+			return version.V2HTTPConnManagerURL
+		}
+		return version.V3HTTPConnManagerURL
+	case RouteConfigResource:
+		if v == version.TransportV2 {
+			return version.V2RouteConfigURL
+		}
+		return version.V3RouteConfigURL
+	case ClusterResource:
+		if v == version.TransportV2 {
+			return version.V2ClusterURL
+		}
+		return version.V3ClusterURL
+	case EndpointsResource:
+		if v == version.TransportV2 {
+			return version.V2EndpointsURL
+		}
+		return version.V3EndpointsURL
+	default:
+		return ""
+	}
+}
+
+// ResourceTypeFromURL returns the version-agnostic ResourceType that
+// corresponds to the given xDS type URL, for either the v2 or v3 transport
+// API. It returns an error if url doesn't match a known resource type URL.
+func ResourceTypeFromURL(url string) (ResourceType, error) {
+	switch {
+	case IsListenerResource(url):
+		return ListenerResource, nil
+	case IsHTTPConnManagerResource(url):
+		return HTTPConnManagerResource, nil
+	case IsRouteConfigResource(url):
+		return RouteConfigResource, nil
+	case IsClusterResource(url):
+		return ClusterResource, nil
+	case IsEndpointsResource(url):
+		return EndpointsResource, nil
+	default:
+		return UnknownResource, fmt.Errorf("xds: no known ResourceType for type URL %q", url)
+	}
+}
+
 // IsListenerResource returns true if the provider URL corresponds to an xDS
 // Listener resource.
 func IsListenerResource(url string) bool {
@@ -0,0 +1,155 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/grpc/xds/pkg"
+)
+
+func (s) TestEndpointsUpdateClone(t *testing.T) {
+	orig := EndpointsUpdate{
+		Drops: []OverloadDropConfig{{Category: "test", Numerator: 1, Denominator: 2}},
+		Localities: []Locality{{
+			ID:       pkg.LocalityID{SubZone: "sz1"},
+			Priority: 1,
+			Weight:   1,
+			Endpoints: []Endpoint{{
+				Address:             "1.1.1.1:1",
+				Weight:              1,
+				AdditionalAddresses: []string{"1.1.1.1:2"},
+			}},
+		}},
+		OverprovisioningFactor: 140,
+	}
+	clone := orig.Clone()
+	if !cmp.Equal(orig, clone, cmpopts.EquateEmpty()) {
+		t.Fatalf("clone differs from original before mutation: diff (-orig +clone): %v", cmp.Diff(orig, clone, cmpopts.EquateEmpty()))
+	}
+
+	clone.Drops[0].Category = "mutated"
+	clone.Localities[0].ID.SubZone = "mutated"
+	clone.Localities[0].Endpoints[0].Address = "mutated"
+	clone.Localities[0].Endpoints[0].AdditionalAddresses[0] = "mutated"
+
+	if orig.Drops[0].Category == "mutated" {
+		t.Error("mutating clone.Drops affected orig.Drops")
+	}
+	if orig.Localities[0].ID.SubZone == "mutated" {
+		t.Error("mutating clone.Localities affected orig.Localities")
+	}
+	if orig.Localities[0].Endpoints[0].Address == "mutated" {
+		t.Error("mutating clone.Localities[].Endpoints affected orig")
+	}
+	if orig.Localities[0].Endpoints[0].AdditionalAddresses[0] == "mutated" {
+		t.Error("mutating clone.Localities[].Endpoints[].AdditionalAddresses affected orig")
+	}
+}
+
+func (s) TestListenerUpdateClone(t *testing.T) {
+	orig := ListenerUpdate{
+		RouteConfigName: "rc",
+		InboundListenerCfg: &InboundListenerConfig{
+			Address: "0.0.0.0",
+			Port:    "1",
+			FilterChains: []*FilterChain{{
+				Match: &FilterChainMatch{
+					ServerNames: []string{"foo"},
+					SourcePorts: []uint32{1, 2},
+				},
+			}},
+		},
+	}
+	clone := orig.Clone()
+	if !cmp.Equal(orig, clone, cmpopts.EquateEmpty()) {
+		t.Fatalf("clone differs from original before mutation: diff (-orig +clone): %v", cmp.Diff(orig, clone, cmpopts.EquateEmpty()))
+	}
+
+	clone.InboundListenerCfg.Address = "mutated"
+	clone.InboundListenerCfg.FilterChains[0].Match.ServerNames[0] = "mutated"
+	clone.InboundListenerCfg.FilterChains[0].Match.SourcePorts[0] = 99
+
+	if orig.InboundListenerCfg.Address == "mutated" {
+		t.Error("mutating clone.InboundListenerCfg affected orig")
+	}
+	if orig.InboundListenerCfg.FilterChains[0].Match.ServerNames[0] == "mutated" {
+		t.Error("mutating clone's nested FilterChainMatch.ServerNames affected orig")
+	}
+	if orig.InboundListenerCfg.FilterChains[0].Match.SourcePorts[0] == 99 {
+		t.Error("mutating clone's nested FilterChainMatch.SourcePorts affected orig")
+	}
+}
+
+func (s) TestRouteConfigUpdateClone(t *testing.T) {
+	orig := RouteConfigUpdate{
+		VirtualHosts: []*VirtualHost{{
+			Domains: []string{"example.com"},
+			Routes: []*Route{{
+				WeightedClusters: map[string]WeightedCluster{"c1": {Weight: 1}},
+			}},
+		}},
+	}
+	clone := orig.Clone()
+	if !cmp.Equal(orig, clone, cmpopts.EquateEmpty()) {
+		t.Fatalf("clone differs from original before mutation: diff (-orig +clone): %v", cmp.Diff(orig, clone, cmpopts.EquateEmpty()))
+	}
+
+	clone.VirtualHosts[0].Domains[0] = "mutated.com"
+	clone.VirtualHosts[0].Routes[0].WeightedClusters["c1"] = WeightedCluster{Weight: 99}
+
+	if orig.VirtualHosts[0].Domains[0] == "mutated.com" {
+		t.Error("mutating clone.VirtualHosts[].Domains affected orig")
+	}
+	if orig.VirtualHosts[0].Routes[0].WeightedClusters["c1"].Weight == 99 {
+		t.Error("mutating clone's nested WeightedClusters affected orig")
+	}
+}
+
+func (s) TestClusterUpdateClone(t *testing.T) {
+	maxRequests := uint32(10)
+	orig := ClusterUpdate{
+		ServiceName:             "svc",
+		PrioritizedClusterNames: []string{"c1", "c2"},
+		MaxRequests:             &maxRequests,
+		InlineEndpointsUpdate: &EndpointsUpdate{
+			Localities: []Locality{{ID: pkg.LocalityID{SubZone: "sz1"}}},
+		},
+	}
+	clone := orig.Clone()
+	if !cmp.Equal(orig, clone, cmpopts.EquateEmpty()) {
+		t.Fatalf("clone differs from original before mutation: diff (-orig +clone): %v", cmp.Diff(orig, clone, cmpopts.EquateEmpty()))
+	}
+
+	clone.PrioritizedClusterNames[0] = "mutated"
+	*clone.MaxRequests = 99
+	clone.InlineEndpointsUpdate.Localities[0].ID.SubZone = "mutated"
+
+	if orig.PrioritizedClusterNames[0] == "mutated" {
+		t.Error("mutating clone.PrioritizedClusterNames affected orig")
+	}
+	if *orig.MaxRequests == 99 {
+		t.Error("mutating *clone.MaxRequests affected orig")
+	}
+	if orig.InlineEndpointsUpdate.Localities[0].ID.SubZone == "mutated" {
+		t.Error("mutating clone.InlineEndpointsUpdate affected orig")
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+type servicesConnectionsCounter struct {
+	mu       sync.Mutex
+	services map[string]*ServiceConnectionsCounter
+}
+
+var scc = &servicesConnectionsCounter{
+	services: make(map[string]*ServiceConnectionsCounter),
+}
+
+// ServiceConnectionsCounter is used to track the total active connections
+// (SubConns) for a service with the provided name, for max_connections
+// circuit breaking.
+type ServiceConnectionsCounter struct {
+	ServiceName    string
+	numConnections uint32
+	refs           uint32
+}
+
+// GetServiceConnectionsCounter returns the ServiceConnectionsCounter with the
+// provided serviceName. If one does not exist, it creates it. Every call
+// must be matched with a call to ReleaseServiceConnectionsCounter once the
+// caller no longer needs the counter (e.g. on balancer close, or when
+// switching to a different service name), so that a later balancer using
+// the same service name starts from a clean count instead of inheriting
+// whatever connection count the previous user left behind.
+func GetServiceConnectionsCounter(serviceName string) *ServiceConnectionsCounter {
+	scc.mu.Lock()
+	defer scc.mu.Unlock()
+	c, ok := scc.services[serviceName]
+	if !ok {
+		c = &ServiceConnectionsCounter{ServiceName: serviceName}
+		scc.services[serviceName] = c
+	}
+	c.refs++
+	return c
+}
+
+// ReleaseServiceConnectionsCounter releases a reference to the
+// ServiceConnectionsCounter for serviceName previously obtained via
+// GetServiceConnectionsCounter. Once the last reference is released, the
+// counter is removed so that a future GetServiceConnectionsCounter call for
+// the same serviceName starts with a clean count instead of reusing stale
+// state.
+func ReleaseServiceConnectionsCounter(c *ServiceConnectionsCounter) {
+	scc.mu.Lock()
+	defer scc.mu.Unlock()
+	if c.refs > 0 {
+		c.refs--
+	}
+	if c.refs == 0 {
+		delete(scc.services, c.ServiceName)
+	}
+}
+
+// StartConnection starts a connection for a service, incrementing its
+// number of connections by 1. Returns an error if the max number of
+// connections is exceeded.
+func (c *ServiceConnectionsCounter) StartConnection(max uint32) error {
+	if atomic.LoadUint32(&c.numConnections) >= max {
+		return fmt.Errorf("max connections %v exceeded on service %v", max, c.ServiceName)
+	}
+	atomic.AddUint32(&c.numConnections, 1)
+	return nil
+}
+
+// EndConnection ends a connection for a service, decrementing its number of
+// connections by 1.
+func (c *ServiceConnectionsCounter) EndConnection() {
+	atomic.AddUint32(&c.numConnections, ^uint32(0))
+}
+
+// ClearConnectionsCounterForTesting clears the counter for the service. Should be only
+// used in tests.
+func ClearConnectionsCounterForTesting(serviceName string) {
+	scc.mu.Lock()
+	defer scc.mu.Unlock()
+	c, ok := scc.services[serviceName]
+	if !ok {
+		return
+	}
+	c.numConnections = 0
+}
@@ -0,0 +1,91 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func resetServiceConnectionsCounter() {
+	scc = &servicesConnectionsCounter{
+		services: make(map[string]*ServiceConnectionsCounter),
+	}
+}
+
+func startConnections(t *testing.T, n uint32, max uint32, counter *ServiceConnectionsCounter) {
+	for i := uint32(0); i < n; i++ {
+		if err := counter.StartConnection(max); err != nil {
+			t.Fatalf("error starting initial connection: %v", err)
+		}
+	}
+}
+
+func (s) TestGetServiceConnectionsCounter(t *testing.T) {
+	defer resetServiceConnectionsCounter()
+	const serviceName = "get-service-connections-counter"
+	counterA := GetServiceConnectionsCounter(serviceName)
+	counterB := GetServiceConnectionsCounter(serviceName)
+	if counterA != counterB {
+		t.Errorf("counter %v %v != counter %v %v", counterA, *counterA, counterB, *counterB)
+	}
+}
+
+func (s) TestServiceConnectionsCounterExceedsMax(t *testing.T) {
+	defer resetServiceConnectionsCounter()
+	const serviceName = "exceeds-max-connections"
+	var max uint32 = 4
+
+	counter := GetServiceConnectionsCounter(serviceName)
+	startConnections(t, max, max, counter)
+	if err := counter.StartConnection(max); err == nil {
+		t.Fatal("unexpected success on start connection after max met")
+	}
+
+	counter.EndConnection()
+	if err := counter.StartConnection(max); err != nil {
+		t.Fatalf("unexpected error on start connection after one ended: %v", err)
+	}
+}
+
+// TestReleaseServiceConnectionsCounter covers creating a counter, using it,
+// releasing it, and recreating it, asserting that the recreated counter
+// starts with a clean count instead of inheriting the released counter's
+// connection count.
+func (s) TestReleaseServiceConnectionsCounter(t *testing.T) {
+	defer resetServiceConnectionsCounter()
+	const serviceName = "release-and-recreate-connections"
+	var max uint32 = 16
+
+	counter := GetServiceConnectionsCounter(serviceName)
+	startConnections(t, max-1, max, counter)
+	if got, want := atomic.LoadUint32(&counter.numConnections), max-1; got != want {
+		t.Fatalf("counter.numConnections = %v, want %v", got, want)
+	}
+
+	ReleaseServiceConnectionsCounter(counter)
+
+	newCounter := GetServiceConnectionsCounter(serviceName)
+	if got := atomic.LoadUint32(&newCounter.numConnections); got != 0 {
+		t.Errorf("recreated counter.numConnections = %v, want 0", got)
+	}
+	if newCounter == counter {
+		t.Errorf("GetServiceConnectionsCounter() returned the released counter, want a fresh one")
+	}
+}
@@ -43,13 +43,142 @@ func (s) TestEDSParseRespProto(t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name: "missing-priority",
+			// Priorities {0, 2} are sparse (gapped); they should be
+			// compacted to {0, 1} rather than rejected, preserving order.
+			name: "gapped-priority",
 			m: func() *v3endpointpb.ClusterLoadAssignment {
 				clab0 := newClaBuilder("test", nil)
 				clab0.addLocality("locality-1", 1, 0, []string{"addr1:314"}, nil)
 				clab0.addLocality("locality-2", 1, 2, []string{"addr2:159"}, nil)
 				return clab0.Build()
 			}(),
+			want: EndpointsUpdate{
+				OverprovisioningFactor: defaultOverprovisioningFactor,
+				Localities: []Locality{
+					{
+						Endpoints: []Endpoint{{Address: "addr1:314", Weight: 1}},
+						ID:        pkg.LocalityID{SubZone: "locality-1"},
+						Priority:  0,
+						Weight:    1,
+					},
+					{
+						Endpoints: []Endpoint{{Address: "addr2:159", Weight: 1}},
+						ID:        pkg.LocalityID{SubZone: "locality-2"},
+						Priority:  1,
+						Weight:    1,
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			// Priorities {0, 3, 7} should compact to {0, 1, 2}, preserving
+			// the original relative order across more than one gap.
+			name: "multiple-gaps-priority",
+			m: func() *v3endpointpb.ClusterLoadAssignment {
+				clab0 := newClaBuilder("test", nil)
+				clab0.addLocality("locality-1", 1, 7, []string{"addr1:314"}, nil)
+				clab0.addLocality("locality-2", 1, 0, []string{"addr2:159"}, nil)
+				clab0.addLocality("locality-3", 1, 3, []string{"addr3:42"}, nil)
+				return clab0.Build()
+			}(),
+			want: EndpointsUpdate{
+				OverprovisioningFactor: defaultOverprovisioningFactor,
+				Localities: []Locality{
+					{
+						Endpoints: []Endpoint{{Address: "addr1:314", Weight: 1}},
+						ID:        pkg.LocalityID{SubZone: "locality-1"},
+						Priority:  2,
+						Weight:    1,
+					},
+					{
+						Endpoints: []Endpoint{{Address: "addr2:159", Weight: 1}},
+						ID:        pkg.LocalityID{SubZone: "locality-2"},
+						Priority:  0,
+						Weight:    1,
+					},
+					{
+						Endpoints: []Endpoint{{Address: "addr3:42", Weight: 1}},
+						ID:        pkg.LocalityID{SubZone: "locality-3"},
+						Priority:  1,
+						Weight:    1,
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			// A LocalityID repeated across two entries (same priority) has
+			// its endpoints merged into a single Locality rather than
+			// producing two entries that would collide downstream. Each
+			// entry is its own endpoint group with its own
+			// load_balancing_weight, so the merged locality's weight is
+			// their sum (1 + 1 = 2), not just the first group's.
+			name: "duplicate-locality",
+			m: func() *v3endpointpb.ClusterLoadAssignment {
+				clab0 := newClaBuilder("test", nil)
+				clab0.addLocality("locality-1", 1, 0, []string{"addr1:314"}, nil)
+				clab0.addLocality("locality-1", 1, 0, []string{"addr2:159"}, nil)
+				return clab0.Build()
+			}(),
+			want: EndpointsUpdate{
+				OverprovisioningFactor: defaultOverprovisioningFactor,
+				Localities: []Locality{
+					{
+						Endpoints: []Endpoint{
+							{Address: "addr1:314", Weight: 1},
+							{Address: "addr2:159", Weight: 1},
+						},
+						ID:       pkg.LocalityID{SubZone: "locality-1"},
+						Priority: 0,
+						Weight:   2,
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			// The two endpoint groups being merged can carry different
+			// weights (e.g. because they came from two separate EDS
+			// response entries with different load_balancing_weight
+			// values); the merged locality's weight is still their sum
+			// (3 + 5 = 8).
+			name: "duplicate-locality-different-group-weights",
+			m: func() *v3endpointpb.ClusterLoadAssignment {
+				clab0 := newClaBuilder("test", nil)
+				clab0.addLocality("locality-1", 3, 0, []string{"addr1:314"}, nil)
+				clab0.addLocality("locality-1", 5, 0, []string{"addr2:159"}, nil)
+				return clab0.Build()
+			}(),
+			want: EndpointsUpdate{
+				OverprovisioningFactor: defaultOverprovisioningFactor,
+				Localities: []Locality{
+					{
+						Endpoints: []Endpoint{
+							{Address: "addr1:314", Weight: 1},
+							{Address: "addr2:159", Weight: 1},
+						},
+						ID:       pkg.LocalityID{SubZone: "locality-1"},
+						Priority: 0,
+						Weight:   8,
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			// The same LocalityID repeated under two different priorities is
+			// a malformed response: there's no well-defined priority to
+			// assign the merged locality, so it's rejected outright rather
+			// than silently keeping whichever priority happened to be seen
+			// first.
+			name: "duplicate-locality-conflicting-priority",
+			m: func() *v3endpointpb.ClusterLoadAssignment {
+				clab0 := newClaBuilder("test", nil)
+				clab0.addLocality("locality-1", 1, 0, []string{"addr1:314"}, nil)
+				clab0.addLocality("locality-1", 1, 1, []string{"addr2:159"}, nil)
+				return clab0.Build()
+			}(),
 			want:    EndpointsUpdate{},
 			wantErr: true,
 		},
@@ -78,7 +207,8 @@ func (s) TestEDSParseRespProto(t *testing.T) {
 				return clab0.Build()
 			}(),
 			want: EndpointsUpdate{
-				Drops: nil,
+				OverprovisioningFactor: defaultOverprovisioningFactor,
+				Drops:                  nil,
 				Localities: []Locality{
 					{
 						Endpoints: []Endpoint{{
@@ -119,6 +249,146 @@ func (s) TestEDSParseRespProto(t *testing.T) {
 	}
 }
 
+// TestEDSParseRespProtoEndpointWeight verifies that an endpoint's weight is
+// defaulted to 1 when load_balancing_weight is unset, that an explicit
+// weight is passed through unchanged, and that an explicit weight of 0 is
+// distinguishable from the unset case (both parse successfully, but with
+// different resulting weights).
+func (s) TestEDSParseRespProtoEndpointWeight(t *testing.T) {
+	tests := []struct {
+		name   string
+		weight *uint32
+		want   uint32
+	}{
+		{name: "unset", weight: nil, want: 1},
+		{name: "explicit-1", weight: func() *uint32 { v := uint32(1); return &v }(), want: 1},
+		{name: "explicit-0", weight: func() *uint32 { v := uint32(0); return &v }(), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clab0 := newClaBuilder("test", nil)
+			var opts *addLocalityOptions
+			if tt.weight != nil {
+				opts = &addLocalityOptions{Weight: []uint32{*tt.weight}}
+			}
+			clab0.addLocality("locality-1", 1, 0, []string{"addr1:314"}, opts)
+			got, err := parseEDSRespProto(clab0.Build())
+			if err != nil {
+				t.Fatalf("parseEDSRespProto() failed: %v", err)
+			}
+			if len(got.Localities) != 1 || len(got.Localities[0].Endpoints) != 1 {
+				t.Fatalf("parseEDSRespProto() = %+v, want exactly one locality with one endpoint", got)
+			}
+			if gotWeight := got.Localities[0].Endpoints[0].Weight; gotWeight != tt.want {
+				t.Errorf("endpoint weight = %v, want %v", gotWeight, tt.want)
+			}
+		})
+	}
+}
+
+// TestEDSParseRespProtoOverprovisioningFactor verifies that the resulting
+// EndpointsUpdate's OverprovisioningFactor reflects the response's policy: an
+// explicit overprovisioning_factor always wins, the deprecated
+// disable_overprovisioning flag maps to 100 (all-or-nothing failover) when
+// set, and neither being set falls back to the default of 140.
+func (s) TestEDSParseRespProtoOverprovisioningFactor(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *v3endpointpb.ClusterLoadAssignment_Policy
+		want   uint32
+	}{
+		{name: "unset", policy: &v3endpointpb.ClusterLoadAssignment_Policy{}, want: defaultOverprovisioningFactor},
+		{
+			name:   "explicit-factor",
+			policy: &v3endpointpb.ClusterLoadAssignment_Policy{OverprovisioningFactor: &wrapperspb.UInt32Value{Value: 200}},
+			want:   200,
+		},
+		{
+			name:   "disable-overprovisioning",
+			policy: &v3endpointpb.ClusterLoadAssignment_Policy{HiddenEnvoyDeprecatedDisableOverprovisioning: true},
+			want:   100,
+		},
+		{
+			name: "explicit-factor-wins-over-disable-overprovisioning",
+			policy: &v3endpointpb.ClusterLoadAssignment_Policy{
+				OverprovisioningFactor:                       &wrapperspb.UInt32Value{Value: 200},
+				HiddenEnvoyDeprecatedDisableOverprovisioning: true,
+			},
+			want: 200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clab0 := newClaBuilder("test", nil)
+			clab0.v.Policy = tt.policy
+			clab0.addLocality("locality-1", 1, 0, []string{"addr1:314"}, nil)
+			got, err := parseEDSRespProto(clab0.Build())
+			if err != nil {
+				t.Fatalf("parseEDSRespProto() failed: %v", err)
+			}
+			if got.OverprovisioningFactor != tt.want {
+				t.Errorf("OverprovisioningFactor = %v, want %v", got.OverprovisioningFactor, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseClusterLoadAssignment verifies that the exported
+// ParseClusterLoadAssignment, used by production callers outside of a watch
+// callback, produces the same result as the internal parseEDSRespProto it
+// wraps.
+func (s) TestParseClusterLoadAssignment(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       *v3endpointpb.ClusterLoadAssignment
+		want    EndpointsUpdate
+		wantErr bool
+	}{
+		{
+			name: "good",
+			m: func() *v3endpointpb.ClusterLoadAssignment {
+				clab0 := newClaBuilder("test", nil)
+				clab0.addLocality("locality-1", 1, 0, []string{"addr1:314"}, nil)
+				return clab0.Build()
+			}(),
+			want: EndpointsUpdate{
+				OverprovisioningFactor: defaultOverprovisioningFactor,
+				Localities: []Locality{
+					{
+						Endpoints: []Endpoint{{Address: "addr1:314", Weight: 1}},
+						ID:        pkg.LocalityID{SubZone: "locality-1"},
+						Priority:  0,
+						Weight:    1,
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "missing-locality-ID",
+			m: func() *v3endpointpb.ClusterLoadAssignment {
+				clab0 := newClaBuilder("test", nil)
+				clab0.addLocality("", 1, 0, []string{"addr1:314"}, nil)
+				return clab0.Build()
+			}(),
+			want:    EndpointsUpdate{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseClusterLoadAssignment(tt.m)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseClusterLoadAssignment() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if d := cmp.Diff(got, tt.want); d != "" {
+				t.Errorf("ParseClusterLoadAssignment() got = %v, want %v, diff: %v", got, tt.want, d)
+			}
+		})
+	}
+}
+
 func (s) TestUnmarshalEndpoints(t *testing.T) {
 	var v3EndpointsAny = &anypb.Any{
 		TypeUrl: version.V3EndpointsURL,
@@ -184,8 +454,7 @@ func (s) TestUnmarshalEndpoints(t *testing.T) {
 					TypeUrl: version.V3EndpointsURL,
 					Value: func() []byte {
 						clab0 := newClaBuilder("test", nil)
-						clab0.addLocality("locality-1", 1, 0, []string{"addr1:314"}, nil)
-						clab0.addLocality("locality-2", 1, 2, []string{"addr2:159"}, nil)
+						clab0.addLocality("", 1, 0, []string{"addr1:314"}, nil)
 						e := clab0.Build()
 						me, _ := proto.Marshal(e)
 						return me
@@ -208,7 +477,8 @@ func (s) TestUnmarshalEndpoints(t *testing.T) {
 			resources: []*anypb.Any{v3EndpointsAny},
 			wantUpdate: map[string]EndpointsUpdate{
 				"test": {
-					Drops: nil,
+					OverprovisioningFactor: defaultOverprovisioningFactor,
+					Drops:                  nil,
 					Localities: []Locality{
 						{
 							Endpoints: []Endpoint{{
@@ -249,8 +519,7 @@ func (s) TestUnmarshalEndpoints(t *testing.T) {
 					TypeUrl: version.V3EndpointsURL,
 					Value: func() []byte {
 						clab0 := newClaBuilder("bad", nil)
-						clab0.addLocality("locality-1", 1, 0, []string{"addr1:314"}, nil)
-						clab0.addLocality("locality-2", 1, 2, []string{"addr2:159"}, nil)
+						clab0.addLocality("", 1, 0, []string{"addr1:314"}, nil)
 						e := clab0.Build()
 						me, _ := proto.Marshal(e)
 						return me
@@ -259,7 +528,8 @@ func (s) TestUnmarshalEndpoints(t *testing.T) {
 			},
 			wantUpdate: map[string]EndpointsUpdate{
 				"test": {
-					Drops: nil,
+					OverprovisioningFactor: defaultOverprovisioningFactor,
+					Drops:                  nil,
 					Localities: []Locality{
 						{
 							Endpoints: []Endpoint{{
@@ -404,3 +674,178 @@ func (clab *claBuilder) addLocality(subzone string, weight uint32, priority uint
 func (clab *claBuilder) Build() *v3endpointpb.ClusterLoadAssignment {
 	return clab.v
 }
+
+// TestParseDropPolicyUnknownDenominator covers the case that a
+// FractionalPercent with a denominator value outside of the three known
+// enum values doesn't leave OverloadDropConfig.Denominator at 0, which would
+// make newDropper's Denominator-Numerator computation underflow.
+func (s) TestParseDropPolicyUnknownDenominator(t *testing.T) {
+	got := parseDropPolicy(&v3endpointpb.ClusterLoadAssignment_Policy_DropOverload{
+		Category: "test-drop",
+		DropPercentage: &v3typepb.FractionalPercent{
+			Numerator:   5,
+			Denominator: v3typepb.FractionalPercent_DenominatorType(42), // not a known enum value
+		},
+	})
+	want := OverloadDropConfig{Category: "test-drop", Numerator: 5, Denominator: 100}
+	if got != want {
+		t.Errorf("parseDropPolicy() = %+v, want %+v", got, want)
+	}
+}
+
+// TestParseDropPolicyNumeratorGreaterThanDenominator covers the case that a
+// numerator greater than the denominator is clamped to the denominator,
+// rather than underflowing newDropper's Denominator-Numerator computation
+// into never dropping.
+func (s) TestParseDropPolicyNumeratorGreaterThanDenominator(t *testing.T) {
+	got := parseDropPolicy(&v3endpointpb.ClusterLoadAssignment_Policy_DropOverload{
+		Category: "test-drop",
+		DropPercentage: &v3typepb.FractionalPercent{
+			Numerator:   150,
+			Denominator: v3typepb.FractionalPercent_HUNDRED,
+		},
+	})
+	want := OverloadDropConfig{Category: "test-drop", Numerator: 100, Denominator: 100}
+	if got != want {
+		t.Errorf("parseDropPolicy() = %+v, want %+v", got, want)
+	}
+}
+
+// TestMergeEndpointsUpdates covers merging endpoints from two EDS responses
+// for the same cluster (endpoint sharding): localities disjoint between the
+// two updates are unioned, localities present in both have their endpoints
+// concatenated, and drops from both updates are concatenated. It also covers
+// the case where the same locality disagrees on priority/weight across
+// updates, which is rejected as invalid.
+func (s) TestMergeEndpointsUpdates(t *testing.T) {
+	l1 := Locality{
+		Endpoints: []Endpoint{{Address: "addr1:314"}},
+		ID:        pkg.LocalityID{SubZone: "locality-1"},
+		Priority:  0,
+		Weight:    1,
+	}
+	l2Shard1 := Locality{
+		Endpoints: []Endpoint{{Address: "addr2:159"}},
+		ID:        pkg.LocalityID{SubZone: "locality-2"},
+		Priority:  1,
+		Weight:    2,
+	}
+	l2Shard2 := Locality{
+		Endpoints: []Endpoint{{Address: "addr3:271"}},
+		ID:        pkg.LocalityID{SubZone: "locality-2"},
+		Priority:  1,
+		Weight:    2,
+	}
+	drop1 := OverloadDropConfig{Category: "drop1", Numerator: 1, Denominator: 100}
+	drop2 := OverloadDropConfig{Category: "drop2", Numerator: 2, Denominator: 100}
+
+	tests := []struct {
+		name    string
+		updates []EndpointsUpdate
+		want    EndpointsUpdate
+		wantErr bool
+	}{
+		{
+			name: "disjoint localities",
+			updates: []EndpointsUpdate{
+				{Drops: []OverloadDropConfig{drop1}, Localities: []Locality{l1}},
+				{Drops: []OverloadDropConfig{drop2}, Localities: []Locality{l2Shard1}},
+			},
+			want: EndpointsUpdate{
+				Drops:      []OverloadDropConfig{drop1, drop2},
+				Localities: []Locality{l1, l2Shard1},
+			},
+		},
+		{
+			name: "overlapping locality, endpoints concatenated",
+			updates: []EndpointsUpdate{
+				{Localities: []Locality{l1, l2Shard1}},
+				{Localities: []Locality{l2Shard2}},
+			},
+			want: EndpointsUpdate{
+				Localities: []Locality{
+					l1,
+					{
+						Endpoints: append(append([]Endpoint{}, l2Shard1.Endpoints...), l2Shard2.Endpoints...),
+						ID:        l2Shard1.ID,
+						Priority:  l2Shard1.Priority,
+						Weight:    l2Shard1.Weight,
+					},
+				},
+			},
+		},
+		{
+			name: "overlapping locality with mismatching weight is an error",
+			updates: []EndpointsUpdate{
+				{Localities: []Locality{l2Shard1}},
+				{Localities: []Locality{{Endpoints: l2Shard2.Endpoints, ID: l2Shard2.ID, Priority: l2Shard2.Priority, Weight: l2Shard2.Weight + 1}}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergeEndpointsUpdates(tt.updates...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MergeEndpointsUpdates() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("MergeEndpointsUpdates() got unexpected result, diff (-got +want): %v", diff)
+			}
+		})
+	}
+}
+
+// TestLocalitiesByPriority verifies that LocalitiesByPriority groups
+// localities by their Priority field, across multiple priorities, and that
+// a zero-weight locality (which handleEDSResponse would otherwise filter
+// out downstream) is still included, since EndpointsUpdate reflects the
+// cache's pre-filter view.
+func (s) TestLocalitiesByPriority(t *testing.T) {
+	p0l1 := Locality{ID: pkg.LocalityID{SubZone: "p0-l1"}, Priority: 0, Weight: 1}
+	p0l2 := Locality{ID: pkg.LocalityID{SubZone: "p0-l2"}, Priority: 0, Weight: 0}
+	p1l1 := Locality{ID: pkg.LocalityID{SubZone: "p1-l1"}, Priority: 1, Weight: 2}
+
+	u := EndpointsUpdate{Localities: []Locality{p0l1, p0l2, p1l1}}
+	got := u.LocalitiesByPriority()
+	want := map[uint32][]Locality{
+		0: {p0l1, p0l2},
+		1: {p1l1},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("LocalitiesByPriority() got unexpected result, diff (-got +want): %v", diff)
+	}
+}
+
+// TestEndpointsUpdateBuilderEquivalence covers EndpointsUpdateBuilder,
+// introduced so that tests can construct an EndpointsUpdate directly instead
+// of building and parsing a ClusterLoadAssignment proto: building the same
+// update both ways must produce the same result (other than the Raw field,
+// which only the proto-parsing path populates).
+func (s) TestEndpointsUpdateBuilderEquivalence(t *testing.T) {
+	clab0 := newClaBuilder("test", nil)
+	clab0.addLocality("locality-1", 2, 0, []string{"addr1:314"}, &addLocalityOptions{
+		Health: []v3corepb.HealthStatus{v3corepb.HealthStatus_HEALTHY},
+	})
+	clab0.addLocality("locality-2", 1, 1, []string{"addr2:159", "addr3:265"}, nil)
+	want, err := parseEDSRespProto(clab0.Build())
+	if err != nil {
+		t.Fatalf("parseEDSRespProto() failed: %v", err)
+	}
+	want.Raw = nil
+
+	got := NewEndpointsUpdateBuilder().
+		AddLocality("locality-1", 2, 0).
+		AddEndpoint("addr1:314", defaultEndpointWeight, EndpointHealthStatusHealthy).
+		AddLocality("locality-2", 1, 1).
+		AddEndpoint("addr2:159", defaultEndpointWeight, EndpointHealthStatusUnknown).
+		AddEndpoint("addr3:265", defaultEndpointWeight, EndpointHealthStatusUnknown).
+		Build()
+
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("EndpointsUpdateBuilder produced a different result than parsing an equivalent proto, diff (-got +want): %v", diff)
+	}
+}
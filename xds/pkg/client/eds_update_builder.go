@@ -0,0 +1,77 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import "google.golang.org/grpc/xds/pkg"
+
+// EndpointsUpdateBuilder builds an EndpointsUpdate directly, for tests that
+// want to exercise a balancer's reaction to an EDS update without building
+// and parsing a ClusterLoadAssignment proto.
+type EndpointsUpdateBuilder struct {
+	u EndpointsUpdate
+}
+
+// NewEndpointsUpdateBuilder creates an EndpointsUpdateBuilder, defaulting
+// OverprovisioningFactor the same way parseEDSRespProto does for a response
+// whose policy doesn't set one.
+func NewEndpointsUpdateBuilder() *EndpointsUpdateBuilder {
+	return &EndpointsUpdateBuilder{u: EndpointsUpdate{OverprovisioningFactor: defaultOverprovisioningFactor}}
+}
+
+// AddDrop adds an overload drop category to the update being built.
+func (b *EndpointsUpdateBuilder) AddDrop(category string, numerator, denominator uint32) *EndpointsUpdateBuilder {
+	b.u.Drops = append(b.u.Drops, OverloadDropConfig{
+		Category:    category,
+		Numerator:   numerator,
+		Denominator: denominator,
+	})
+	return b
+}
+
+// AddLocality adds a locality with the given subzone, weight and priority to
+// the update being built. Use AddEndpoint to populate its endpoints.
+func (b *EndpointsUpdateBuilder) AddLocality(subzone string, weight, priority uint32) *EndpointsUpdateBuilder {
+	b.u.Localities = append(b.u.Localities, Locality{
+		ID:       pkg.LocalityID{SubZone: subzone},
+		Weight:   weight,
+		Priority: priority,
+	})
+	return b
+}
+
+// AddEndpoint adds an endpoint with the given address, weight and health
+// status to the locality most recently added via AddLocality. It panics if
+// called before any locality has been added.
+func (b *EndpointsUpdateBuilder) AddEndpoint(addr string, weight uint32, health EndpointHealthStatus) *EndpointsUpdateBuilder {
+	if len(b.u.Localities) == 0 {
+		panic("AddEndpoint called before AddLocality")
+	}
+	l := &b.u.Localities[len(b.u.Localities)-1]
+	l.Endpoints = append(l.Endpoints, Endpoint{
+		Address:      addr,
+		Weight:       weight,
+		HealthStatus: health,
+	})
+	return b
+}
+
+// Build returns the EndpointsUpdate constructed so far.
+func (b *EndpointsUpdateBuilder) Build() EndpointsUpdate {
+	return b.u
+}
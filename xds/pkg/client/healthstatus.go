@@ -0,0 +1,51 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import "google.golang.org/grpc/resolver"
+
+// healthStatusKey is the type used as the key to store an Endpoint's
+// HealthStatus in the Attributes field of resolver.Address.
+type healthStatusKey struct{}
+
+// SetHealthStatus returns a copy of addr in which the Attributes field
+// carries status, so that a custom picker or observability tooling can
+// distinguish, e.g., a HEALTHY endpoint from a DEGRADED one even though both
+// are passed through to the child balancer unfiltered.
+//
+// Experimental
+//
+// Notice: This API is EXPERIMENTAL and may be changed or removed in a
+// later release.
+func SetHealthStatus(addr resolver.Address, status EndpointHealthStatus) resolver.Address {
+	addr.Attributes = addr.Attributes.WithValues(healthStatusKey{}, status)
+	return addr
+}
+
+// GetHealthStatus returns the EndpointHealthStatus stored in the Attributes
+// field of addr, or EndpointHealthStatusUnknown if none was set.
+//
+// Experimental
+//
+// Notice: This API is EXPERIMENTAL and may be changed or removed in a
+// later release.
+func GetHealthStatus(addr resolver.Address) EndpointHealthStatus {
+	status, _ := addr.Attributes.Value(healthStatusKey{}).(EndpointHealthStatus)
+	return status
+}
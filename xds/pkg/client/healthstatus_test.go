@@ -0,0 +1,40 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/resolver"
+)
+
+func (s) TestSetGetHealthStatus(t *testing.T) {
+	addr := resolver.Address{Addr: "192.0.2.1:443"}
+	if got := GetHealthStatus(addr); got != EndpointHealthStatusUnknown {
+		t.Fatalf("GetHealthStatus() on unset addr = %v, want %v", got, EndpointHealthStatusUnknown)
+	}
+
+	addr = SetHealthStatus(addr, EndpointHealthStatusHealthy)
+	if got := GetHealthStatus(addr); got != EndpointHealthStatusHealthy {
+		t.Errorf("GetHealthStatus() = %v, want %v", got, EndpointHealthStatusHealthy)
+	}
+	if addr.Addr != "192.0.2.1:443" {
+		t.Errorf("SetHealthStatus() changed Addr to %q", addr.Addr)
+	}
+}
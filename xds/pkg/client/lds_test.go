@@ -1523,12 +1523,17 @@ func (s) TestGetFilterChain(t *testing.T) {
 			},
 		},
 		{
-			desc: "unsupported server names",
+			desc: "server names",
 			inputFilterChain: &v3listenerpb.FilterChain{
 				FilterChainMatch: &v3listenerpb.FilterChainMatch{
 					ServerNames: []string{"example-server"},
 				},
 			},
+			wantFilterChain: &FilterChain{
+				Match: &FilterChainMatch{
+					ServerNames: []string{"example-server"},
+				},
+			},
 		},
 		{
 			desc: "unsupported transport protocol",
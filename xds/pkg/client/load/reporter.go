@@ -18,10 +18,70 @@
 
 package load
 
+import "context"
+
 // PerClusterReporter wraps the methods from the loadStore that are used here.
 type PerClusterReporter interface {
 	CallStarted(locality string)
 	CallFinished(locality string, err error)
 	CallServerLoad(locality, name string, val float64)
-	CallDropped(category string)
+	// CallDropped records a single dropped call in category. ctx and method
+	// are the dropped RPC's context and full method name, passed through so
+	// a reporter that also does tracing/logging can attribute the drop to a
+	// specific RPC; a reporter that only aggregates counts (like the LRS
+	// Store) is free to ignore them.
+	CallDropped(ctx context.Context, method, category string)
+	// Flush forces the reporter to report any pending load data right away,
+	// instead of waiting for its normal reporting interval. Reporters with no
+	// pending buffer of their own (e.g. Store.PerCluster's, whose data
+	// Store.Stats reads directly) treat this as a no-op.
+	Flush()
+}
+
+// MultiReporter is a PerClusterReporter that forwards every call to multiple
+// underlying PerClusterReporters. It's used when load for a cluster needs to
+// be reported to more than one destination, e.g. a local metrics sink in
+// addition to the remote LRS server.
+type MultiReporter []PerClusterReporter
+
+// NewMultiReporter returns a PerClusterReporter that forwards every call to
+// each of reporters, in order.
+func NewMultiReporter(reporters ...PerClusterReporter) MultiReporter {
+	return MultiReporter(reporters)
+}
+
+// CallStarted forwards to the CallStarted method of each wrapped reporter.
+func (mr MultiReporter) CallStarted(locality string) {
+	for _, r := range mr {
+		r.CallStarted(locality)
+	}
+}
+
+// CallFinished forwards to the CallFinished method of each wrapped reporter.
+func (mr MultiReporter) CallFinished(locality string, err error) {
+	for _, r := range mr {
+		r.CallFinished(locality, err)
+	}
+}
+
+// CallServerLoad forwards to the CallServerLoad method of each wrapped
+// reporter.
+func (mr MultiReporter) CallServerLoad(locality, name string, val float64) {
+	for _, r := range mr {
+		r.CallServerLoad(locality, name, val)
+	}
+}
+
+// CallDropped forwards to the CallDropped method of each wrapped reporter.
+func (mr MultiReporter) CallDropped(ctx context.Context, method, category string) {
+	for _, r := range mr {
+		r.CallDropped(ctx, method, category)
+	}
+}
+
+// Flush forwards to the Flush method of each wrapped reporter.
+func (mr MultiReporter) Flush() {
+	for _, r := range mr {
+		r.Flush()
+	}
 }
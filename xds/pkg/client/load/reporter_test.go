@@ -0,0 +1,101 @@
+/*
+ *
+ * Copyright 2020 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package load
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeReporter records every call made to it, for assertions in tests.
+type fakeReporter struct {
+	started      []string
+	finished     []string
+	server       []string
+	dropped      []string
+	droppedCalls []droppedCall
+	flushed      int
+}
+
+// droppedCall records the full argument list of a CallDropped call, so
+// TestMultiReporter can assert that the method name reaches the reporter
+// alongside the category.
+type droppedCall struct {
+	method, category string
+}
+
+func (r *fakeReporter) CallStarted(locality string) {
+	r.started = append(r.started, locality)
+}
+
+func (r *fakeReporter) CallFinished(locality string, err error) {
+	r.finished = append(r.finished, locality)
+}
+
+func (r *fakeReporter) CallServerLoad(locality, name string, val float64) {
+	r.server = append(r.server, locality+"/"+name)
+}
+
+func (r *fakeReporter) CallDropped(ctx context.Context, method, category string) {
+	r.dropped = append(r.dropped, category)
+	r.droppedCalls = append(r.droppedCalls, droppedCall{method: method, category: category})
+}
+
+func (r *fakeReporter) Flush() {
+	r.flushed++
+}
+
+// TestMultiReporter verifies that every call to a MultiReporter is forwarded
+// to each of its wrapped reporters.
+func TestMultiReporter(t *testing.T) {
+	r1, r2 := &fakeReporter{}, &fakeReporter{}
+	mr := NewMultiReporter(r1, r2)
+
+	mr.CallStarted("locality-A")
+	mr.CallServerLoad("locality-A", "cpu", 0.5)
+	mr.CallFinished("locality-A", errTest)
+	mr.CallDropped(context.Background(), "/service/Method", "drop_for_real")
+
+	for _, r := range []*fakeReporter{r1, r2} {
+		if diff := cmp.Diff(r.started, []string{"locality-A"}); diff != "" {
+			t.Errorf("CallStarted forwarded unexpected calls (-got, +want): %s", diff)
+		}
+		if diff := cmp.Diff(r.server, []string{"locality-A/cpu"}); diff != "" {
+			t.Errorf("CallServerLoad forwarded unexpected calls (-got, +want): %s", diff)
+		}
+		if diff := cmp.Diff(r.finished, []string{"locality-A"}); diff != "" {
+			t.Errorf("CallFinished forwarded unexpected calls (-got, +want): %s", diff)
+		}
+		if diff := cmp.Diff(r.dropped, []string{"drop_for_real"}); diff != "" {
+			t.Errorf("CallDropped forwarded unexpected calls (-got, +want): %s", diff)
+		}
+		want := []droppedCall{{method: "/service/Method", category: "drop_for_real"}}
+		if diff := cmp.Diff(r.droppedCalls, want, cmp.AllowUnexported(droppedCall{})); diff != "" {
+			t.Errorf("CallDropped forwarded unexpected method/category (-got, +want): %s", diff)
+		}
+	}
+
+	mr.Flush()
+	for _, r := range []*fakeReporter{r1, r2} {
+		if r.flushed != 1 {
+			t.Errorf("Flush() forwarded to a wrapped reporter %d times, want 1", r.flushed)
+		}
+	}
+}
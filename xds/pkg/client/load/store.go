@@ -18,6 +18,7 @@
 package load
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -148,8 +149,10 @@ type perClusterStore struct {
 // Update functions are called by picker for each RPC. To avoid contention, all
 // updates are done atomically.
 
-// CallDropped adds one drop record with the given category to store.
-func (ls *perClusterStore) CallDropped(category string) {
+// CallDropped adds one drop record with the given category to store. ctx and
+// method are unused: LRS only reports aggregate drop counts per category,
+// with no room for per-call detail.
+func (ls *perClusterStore) CallDropped(ctx context.Context, method, category string) {
 	if ls == nil {
 		return
 	}
@@ -197,6 +200,11 @@ func (ls *perClusterStore) CallFinished(locality string, err error) {
 	}
 }
 
+// Flush is a no-op for perClusterStore: its data is pulled continuously by
+// Store.Stats (e.g. on each LRS reporting interval), so there's no separate
+// buffer that needs to be flushed on demand.
+func (ls *perClusterStore) Flush() {}
+
 // CallServerLoad adds one server load record for the given locality. The
 // load type is specified by desc, and its value by val.
 func (ls *perClusterStore) CallServerLoad(locality, name string, d float64) {
@@ -18,6 +18,7 @@
 package load
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"sync"
@@ -64,7 +65,7 @@ func TestDrops(t *testing.T) {
 		for i := 0; i < count; i++ {
 			wg.Add(1)
 			go func(c string) {
-				ls.CallDropped(c)
+				ls.CallDropped(context.Background(), "", c)
 				wg.Done()
 			}(category)
 		}
@@ -216,7 +217,7 @@ func TestResetAfterStats(t *testing.T) {
 	reportLoad := func(ls *perClusterStore) {
 		for category, count := range drops {
 			for i := 0; i < count; i++ {
-				ls.CallDropped(category)
+				ls.CallDropped(context.Background(), "", category)
 			}
 		}
 		for locality, data := range localityData {
@@ -287,7 +288,7 @@ func TestStoreStats(t *testing.T) {
 		for _, s := range testServices {
 			store.PerCluster(c, s).CallStarted(testLocality)
 			store.PerCluster(c, s).CallServerLoad(testLocality, "abc", 123)
-			store.PerCluster(c, s).CallDropped("dropped")
+			store.PerCluster(c, s).CallDropped(context.Background(), "", "dropped")
 			store.PerCluster(c, s).CallFinished(testLocality, nil)
 		}
 	}
@@ -38,10 +38,16 @@ var src = &servicesRequestsCounter{
 type ServiceRequestsCounter struct {
 	ServiceName string
 	numRequests uint32
+	refs        uint32
 }
 
 // GetServiceRequestsCounter returns the ServiceRequestsCounter with the
-// provided serviceName. If one does not exist, it creates it.
+// provided serviceName. If one does not exist, it creates it. Every call
+// must be matched with a call to ReleaseServiceRequestsCounter once the
+// caller no longer needs the counter (e.g. on balancer close, or when
+// switching to a different service name), so that a later balancer using
+// the same service name starts from a clean count instead of inheriting
+// whatever in-flight count the previous user left behind.
 func GetServiceRequestsCounter(serviceName string) *ServiceRequestsCounter {
 	src.mu.Lock()
 	defer src.mu.Unlock()
@@ -50,9 +56,26 @@ func GetServiceRequestsCounter(serviceName string) *ServiceRequestsCounter {
 		c = &ServiceRequestsCounter{ServiceName: serviceName}
 		src.services[serviceName] = c
 	}
+	c.refs++
 	return c
 }
 
+// ReleaseServiceRequestsCounter releases a reference to the
+// ServiceRequestsCounter for serviceName previously obtained via
+// GetServiceRequestsCounter. Once the last reference is released, the
+// counter is removed so that a future GetServiceRequestsCounter call for the
+// same serviceName starts with a clean count instead of reusing stale state.
+func ReleaseServiceRequestsCounter(c *ServiceRequestsCounter) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	if c.refs > 0 {
+		c.refs--
+	}
+	if c.refs == 0 {
+		delete(src.services, c.ServiceName)
+	}
+}
+
 // StartRequest starts a request for a service, incrementing its number of
 // requests by 1. Returns an error if the max number of requests is exceeded.
 func (c *ServiceRequestsCounter) StartRequest(max uint32) error {
@@ -80,3 +103,45 @@ func ClearCounterForTesting(serviceName string) {
 	}
 	c.numRequests = 0
 }
+
+// globalRequestsCounter is the single process-wide counter returned by
+// GetGlobalRequestsCounter. Unlike ServiceRequestsCounter, there's exactly
+// one of these per process, shared by every xDS-managed cluster that opts in
+// to a global request limit, so there's no name to key it by and no
+// reference counting to release.
+var globalRequestsCounter = &GlobalRequestsCounter{}
+
+// GlobalRequestsCounter tracks the total number of in-flight requests across
+// every xDS-managed cluster in the process, for an optional cap shared by
+// all of them (e.g. to protect a backend resource pool common to more than
+// one service).
+type GlobalRequestsCounter struct {
+	numRequests uint32
+}
+
+// GetGlobalRequestsCounter returns the single process-wide
+// GlobalRequestsCounter.
+func GetGlobalRequestsCounter() *GlobalRequestsCounter {
+	return globalRequestsCounter
+}
+
+// StartRequest starts a request against the global counter, incrementing it
+// by 1. Returns an error if the max number of requests is exceeded.
+func (c *GlobalRequestsCounter) StartRequest(max uint32) error {
+	if atomic.LoadUint32(&c.numRequests) >= max {
+		return fmt.Errorf("max global requests %v exceeded", max)
+	}
+	atomic.AddUint32(&c.numRequests, 1)
+	return nil
+}
+
+// EndRequest ends a request against the global counter, decrementing it by 1.
+func (c *GlobalRequestsCounter) EndRequest() {
+	atomic.AddUint32(&c.numRequests, ^uint32(0))
+}
+
+// ClearGlobalCounterForTesting resets the global counter to 0. Should only
+// be used in tests.
+func ClearGlobalCounterForTesting() {
+	atomic.StoreUint32(&globalRequestsCounter.numRequests, 0)
+}
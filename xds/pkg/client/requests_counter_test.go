@@ -154,3 +154,29 @@ func (s) TestSetMaxRequestsDecreased(t *testing.T) {
 		t.Fatalf("unexpected success on start request after max decreased: %v", err)
 	}
 }
+
+// TestReleaseServiceRequestsCounter covers creating a counter, using it,
+// releasing it, and recreating it, asserting that the recreated counter
+// starts with a clean count instead of inheriting the released counter's
+// in-flight count.
+func (s) TestReleaseServiceRequestsCounter(t *testing.T) {
+	defer resetServiceRequestsCounter()
+	const serviceName string = "release-and-recreate"
+	var max uint32 = 16
+
+	counter := GetServiceRequestsCounter(serviceName)
+	startRequests(t, max-1, max, counter)
+	if got, want := atomic.LoadUint32(&counter.numRequests), max-1; got != want {
+		t.Fatalf("counter.numRequests = %v, want %v", got, want)
+	}
+
+	ReleaseServiceRequestsCounter(counter)
+
+	newCounter := GetServiceRequestsCounter(serviceName)
+	if got := atomic.LoadUint32(&newCounter.numRequests); got != 0 {
+		t.Errorf("recreated counter.numRequests = %v, want 0", got)
+	}
+	if newCounter == counter {
+		t.Errorf("GetServiceRequestsCounter() returned the released counter, want a fresh one")
+	}
+}
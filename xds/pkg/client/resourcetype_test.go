@@ -0,0 +1,74 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/xds/pkg/version"
+)
+
+// TestResourceTypeURLRoundTrip verifies that, for every known ResourceType
+// and both transport API versions, TypeURL and ResourceTypeFromURL are
+// inverses of each other.
+func (s) TestResourceTypeURLRoundTrip(t *testing.T) {
+	resourceTypes := []ResourceType{
+		ListenerResource,
+		HTTPConnManagerResource,
+		RouteConfigResource,
+		ClusterResource,
+		EndpointsResource,
+	}
+	transportVersions := []version.TransportAPI{version.TransportV2, version.TransportV3}
+
+	for _, rt := range resourceTypes {
+		for _, v := range transportVersions {
+			url := rt.TypeURL(v)
+			if url == "" {
+				t.Errorf("%v.TypeURL(%v) = \"\", want a non-empty type URL", rt, v)
+				continue
+			}
+			got, err := ResourceTypeFromURL(url)
+			if err != nil {
+				t.Errorf("ResourceTypeFromURL(%q) failed: %v", url, err)
+				continue
+			}
+			if got != rt {
+				t.Errorf("ResourceTypeFromURL(%q) = %v, want %v", url, got, rt)
+			}
+		}
+	}
+}
+
+// TestResourceTypeFromURLUnknown verifies that ResourceTypeFromURL rejects a
+// type URL that doesn't correspond to any known resource type.
+func (s) TestResourceTypeFromURLUnknown(t *testing.T) {
+	if _, err := ResourceTypeFromURL("type.googleapis.com/not.a.real.Resource"); err == nil {
+		t.Error("ResourceTypeFromURL() with an unknown type URL succeeded, want an error")
+	}
+}
+
+// TestResourceTypeTypeURLUnknownResource verifies that TypeURL returns the
+// empty string for UnknownResource, since it has no corresponding xDS type
+// URL.
+func (s) TestResourceTypeTypeURLUnknownResource(t *testing.T) {
+	if got := UnknownResource.TypeURL(version.TransportV3); got != "" {
+		t.Errorf("UnknownResource.TypeURL() = %q, want \"\"", got)
+	}
+}
@@ -99,7 +99,7 @@ func (s) TestLRSClient(t *testing.T) {
 	if u, err := fs2.LRSRequestChan.Receive(ctx); err != nil {
 		t.Errorf("unexpected timeout: %v, %v, want NewConn", u, err)
 	}
-	store2.PerCluster("cluster", "eds").CallDropped("test")
+	store2.PerCluster("cluster", "eds").CallDropped(context.Background(), "/service/Method", "test")
 
 	// Send one resp to the client.
 	fs2.LRSResponseChan <- &fakeserver.Response{
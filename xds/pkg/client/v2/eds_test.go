@@ -121,9 +121,10 @@ func (s) TestEDSHandleResponse(t *testing.T) {
 			wantErr:     false,
 			wantUpdate: map[string]xdsclient.EndpointsUpdate{
 				"not-goodEDSName": {
+					OverprovisioningFactor: 140,
 					Localities: []xdsclient.Locality{
 						{
-							Endpoints: []xdsclient.Endpoint{{Address: "addr1:314"}},
+							Endpoints: []xdsclient.Endpoint{{Address: "addr1:314", Weight: 1}},
 							ID:        pkg.LocalityID{SubZone: "locality-1"},
 							Priority:  0,
 							Weight:    1,
@@ -144,15 +145,16 @@ func (s) TestEDSHandleResponse(t *testing.T) {
 			wantErr:     false,
 			wantUpdate: map[string]xdsclient.EndpointsUpdate{
 				goodEDSName: {
+					OverprovisioningFactor: 140,
 					Localities: []xdsclient.Locality{
 						{
-							Endpoints: []xdsclient.Endpoint{{Address: "addr1:314"}},
+							Endpoints: []xdsclient.Endpoint{{Address: "addr1:314", Weight: 1}},
 							ID:        pkg.LocalityID{SubZone: "locality-1"},
 							Priority:  1,
 							Weight:    1,
 						},
 						{
-							Endpoints: []xdsclient.Endpoint{{Address: "addr2:159"}},
+							Endpoints: []xdsclient.Endpoint{{Address: "addr2:159", Weight: 1}},
 							ID:        pkg.LocalityID{SubZone: "locality-2"},
 							Priority:  0,
 							Weight:    1,
@@ -22,6 +22,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -32,6 +33,7 @@ import (
 	v3endpointpb "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
 	v3listenerpb "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
 	v3routepb "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	v3aggregateclusterpb "github.com/envoyproxy/go-control-plane/envoy/extensions/clusters/aggregate/v3"
 	v3httppb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	v3tlspb "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	v3typepb "github.com/envoyproxy/go-control-plane/envoy/type/v3"
@@ -300,7 +302,6 @@ func getFilterChain(fc *v3listenerpb.FilterChain) (*FilterChain, error) {
 	// If the match criteria contains unsupported fields, skip the filter chain.
 	fcm := fc.GetFilterChainMatch()
 	if fcm.GetDestinationPort().GetValue() != 0 ||
-		fcm.GetServerNames() != nil ||
 		(fcm.GetTransportProtocol() != "" && fcm.TransportProtocol != "raw_buffer") ||
 		fcm.GetApplicationProtocols() != nil {
 		return nil, nil
@@ -342,6 +343,7 @@ func getFilterChain(fc *v3listenerpb.FilterChain) (*FilterChain, error) {
 			SourceType:         srcType,
 			SourcePrefixRanges: srcPrefixRanges,
 			SourcePorts:        fcm.GetSourcePorts(),
+			ServerNames:        fcm.GetServerNames(),
 		},
 	}
 
@@ -610,24 +612,75 @@ func unmarshalClusterResource(r *anypb.Any, logger *grpclog.PrefixLogger) (strin
 	}
 	cu.Raw = r
 	// If the Cluster message in the CDS response did not contain a
-	// serviceName, we will just use the clusterName for EDS.
-	if cu.ServiceName == "" {
+	// serviceName, we will just use the clusterName for EDS. Aggregate,
+	// LOGICAL_DNS and STATIC clusters don't do EDS themselves, so
+	// ServiceName doesn't apply to them.
+	if cu.ClusterType == ClusterTypeEDS && cu.ServiceName == "" {
 		cu.ServiceName = cluster.GetName()
 	}
 	return cluster.GetName(), cu, nil
 }
 
+// aggregateClusterTypeName is the name the control plane sets on a
+// Cluster's custom cluster_type field to signal that TypedConfig contains an
+// aggregate ClusterConfig.
+const aggregateClusterTypeName = "envoy.clusters.aggregate"
+
+// parseAggregateClusterConfig extracts the ordered list of child cluster
+// names from an aggregate cluster's custom cluster_type TypedConfig.
+func parseAggregateClusterConfig(ct *v3clusterpb.Cluster_CustomClusterType) ([]string, error) {
+	cfg := &v3aggregateclusterpb.ClusterConfig{}
+	if err := ptypes.UnmarshalAny(ct.GetTypedConfig(), cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal resource: %v", err)
+	}
+	if len(cfg.Clusters) == 0 {
+		return nil, errors.New("aggregate cluster has no configured clusters")
+	}
+	return cfg.Clusters, nil
+}
+
 func validateCluster(cluster *v3clusterpb.Cluster) (ClusterUpdate, error) {
 	emptyUpdate := ClusterUpdate{ServiceName: "", EnableLRS: false}
+	if ct := cluster.GetClusterType(); ct != nil && ct.GetName() == aggregateClusterTypeName {
+		names, err := parseAggregateClusterConfig(ct)
+		if err != nil {
+			return emptyUpdate, fmt.Errorf("aggregate cluster %q: %v", cluster.GetName(), err)
+		}
+		return ClusterUpdate{ClusterType: ClusterTypeAggregate, PrioritizedClusterNames: names}, nil
+	}
+	if dt := cluster.GetType(); dt == v3clusterpb.Cluster_LOGICAL_DNS || dt == v3clusterpb.Cluster_STATIC {
+		// LOGICAL_DNS and STATIC clusters carry their endpoints inline in
+		// the load_assignment field, rather than via a separate EDS
+		// resource, so they're parsed the same way an EDS response is.
+		if len(cluster.GetLoadAssignment().GetEndpoints()) == 0 {
+			return emptyUpdate, fmt.Errorf("%v cluster %q has no load assignment endpoints", dt, cluster.GetName())
+		}
+		eu, err := parseEDSRespProto(cluster.GetLoadAssignment())
+		if err != nil {
+			return emptyUpdate, fmt.Errorf("%v cluster %q: %v", dt, cluster.GetName(), err)
+		}
+		clusterType := ClusterTypeStatic
+		if dt == v3clusterpb.Cluster_LOGICAL_DNS {
+			clusterType = ClusterTypeLogicalDNS
+		}
+		return ClusterUpdate{ClusterType: clusterType, InlineEndpointsUpdate: &eu}, nil
+	}
 	switch {
 	case cluster.GetType() != v3clusterpb.Cluster_EDS:
 		return emptyUpdate, fmt.Errorf("unexpected cluster type %v in response: %+v", cluster.GetType(), cluster)
 	case cluster.GetEdsClusterConfig().GetEdsConfig().GetAds() == nil:
 		return emptyUpdate, fmt.Errorf("unexpected edsConfig in response: %+v", cluster)
-	case cluster.GetLbPolicy() != v3clusterpb.Cluster_ROUND_ROBIN:
+	case cluster.GetLbPolicy() != v3clusterpb.Cluster_ROUND_ROBIN && cluster.GetLbPolicy() != v3clusterpb.Cluster_RING_HASH:
 		return emptyUpdate, fmt.Errorf("unexpected lbPolicy %v in response: %+v", cluster.GetLbPolicy(), cluster)
 	}
 
+	lbPolicy := ClusterLBPolicyRoundRobin
+	var ringHashConfig *ClusterLBPolicyRingHashConfig
+	if cluster.GetLbPolicy() == v3clusterpb.Cluster_RING_HASH {
+		lbPolicy = ClusterLBPolicyRingHash
+		ringHashConfig = ringHashConfigFromCluster(cluster)
+	}
+
 	// Process security configuration received from the control plane iff the
 	// corresponding environment variable is set.
 	var sc *SecurityConfig
@@ -639,13 +692,42 @@ func validateCluster(cluster *v3clusterpb.Cluster) (ClusterUpdate, error) {
 	}
 
 	return ClusterUpdate{
-		ServiceName: cluster.GetEdsClusterConfig().GetServiceName(),
-		EnableLRS:   cluster.GetLrsServer().GetSelf() != nil,
-		SecurityCfg: sc,
-		MaxRequests: circuitBreakersFromCluster(cluster),
+		ServiceName:              cluster.GetEdsClusterConfig().GetServiceName(),
+		EnableLRS:                cluster.GetLrsServer().GetSelf() != nil,
+		SecurityCfg:              sc,
+		MaxRequests:              circuitBreakersFromCluster(cluster),
+		EnableHealthCheck:        healthCheckEnabledFromCluster(cluster),
+		EnableLocalityWeightedLB: cluster.GetCommonLbConfig().GetLocalityWeightedLbConfig() != nil,
+		LBPolicy:                 lbPolicy,
+		RingHashConfig:           ringHashConfig,
 	}, nil
 }
 
+// Defaults for a RING_HASH cluster's ring_hash_lb_config, matching Envoy's
+// own defaults for an unset minimum_ring_size/maximum_ring_size.
+const (
+	defaultRingHashMinimumRingSize = 1024
+	defaultRingHashMaximumRingSize = 8 * 1024 * 1024
+)
+
+// ringHashConfigFromCluster extracts the ring_hash_lb_config settings from
+// the cluster resource, falling back to Envoy's defaults for any unset
+// field.
+func ringHashConfigFromCluster(cluster *v3clusterpb.Cluster) *ClusterLBPolicyRingHashConfig {
+	cfg := &ClusterLBPolicyRingHashConfig{
+		MinimumRingSize: defaultRingHashMinimumRingSize,
+		MaximumRingSize: defaultRingHashMaximumRingSize,
+	}
+	rh := cluster.GetRingHashLbConfig()
+	if v := rh.GetMinimumRingSize(); v != nil {
+		cfg.MinimumRingSize = v.GetValue()
+	}
+	if v := rh.GetMaximumRingSize(); v != nil {
+		cfg.MaximumRingSize = v.GetValue()
+	}
+	return cfg
+}
+
 // securityConfigFromCluster extracts the relevant security configuration from
 // the received Cluster resource.
 func securityConfigFromCluster(cluster *v3clusterpb.Cluster) (*SecurityConfig, error) {
@@ -753,6 +835,19 @@ func circuitBreakersFromCluster(cluster *v3clusterpb.Cluster) *uint32 {
 	return nil
 }
 
+// healthCheckEnabledFromCluster reports whether the cluster resource
+// configures a gRPC health check (as opposed to, e.g., an HTTP or TCP one).
+// SubConns for clusters with a gRPC health check should have client-side
+// health checking turned on.
+func healthCheckEnabledFromCluster(cluster *v3clusterpb.Cluster) bool {
+	for _, hc := range cluster.GetHealthChecks() {
+		if hc.GetGrpcHealthCheck() != nil {
+			return true
+		}
+	}
+	return false
+}
+
 // UnmarshalEndpoints processes resources received in an EDS response,
 // validates them, and transforms them into a native struct which contains only
 // fields we are interested in.
@@ -798,6 +893,20 @@ func parseDropPolicy(dropPolicy *v3endpointpb.ClusterLoadAssignment_Policy_DropO
 		denominator = 10000
 	case v3typepb.FractionalPercent_MILLION:
 		denominator = 1000000
+	default:
+		// An unrecognized denominator value would otherwise leave
+		// denominator at 0, making newDropper's Denominator-Numerator
+		// underflow, and any consumer computing numerator/denominator as a
+		// ratio divide by zero. Treat it as FractionalPercent_HUNDRED
+		// instead.
+		logger.Warningf("drop policy %+v has an unrecognized denominator %v, treating it as FractionalPercent_HUNDRED", dropPolicy, percentage.GetDenominator())
+		denominator = 100
+	}
+	if numerator > denominator {
+		// A numerator greater than the denominator would make newDropper's
+		// Denominator-Numerator computation underflow, effectively never
+		// dropping instead of always dropping. Clamp to a 100% drop rate.
+		numerator = denominator
 	}
 	return OverloadDropConfig{
 		Category:    dropPolicy.GetCategory(),
@@ -806,25 +915,69 @@ func parseDropPolicy(dropPolicy *v3endpointpb.ClusterLoadAssignment_Policy_DropO
 	}
 }
 
+// defaultEndpointWeight is the weight given to an endpoint whose
+// load_balancing_weight field is unset. It's distinct from an explicit
+// weight of 0, which excludes the endpoint entirely (see
+// handleEDSResponsePerPriority).
+const defaultEndpointWeight = 1
+
+// defaultOverprovisioningFactor is the factor Envoy applies when a
+// ClusterLoadAssignment's policy leaves overprovisioning_factor unset: a
+// priority/locality is considered healthy enough to not spill over to the
+// next one once this percentage of its total endpoint weight is healthy,
+// rather than requiring 100%.
+// https://www.envoyproxy.io/docs/envoy/latest/api-v3/config/endpoint/v3/endpoint.proto
+const defaultOverprovisioningFactor = 140
+
+// parseOverprovisioningFactor returns the overprovisioning factor to use for
+// a ClusterLoadAssignment, as a percentage. An explicit overprovisioning_factor
+// always wins; otherwise the deprecated disable_overprovisioning flag selects
+// between no overprovisioning (100, i.e. all-or-nothing failover) and the
+// default of 140 (weighted spill before a priority/locality is fully down).
+func parseOverprovisioningFactor(policy *v3endpointpb.ClusterLoadAssignment_Policy) uint32 {
+	if f := policy.GetOverprovisioningFactor(); f != nil {
+		return f.GetValue()
+	}
+	if policy.GetHiddenEnvoyDeprecatedDisableOverprovisioning() {
+		return 100
+	}
+	return defaultOverprovisioningFactor
+}
+
 func parseEndpoints(lbEndpoints []*v3endpointpb.LbEndpoint) []Endpoint {
 	endpoints := make([]Endpoint, 0, len(lbEndpoints))
 	for _, lbEndpoint := range lbEndpoints {
+		weight := uint32(defaultEndpointWeight)
+		if w := lbEndpoint.GetLoadBalancingWeight(); w != nil {
+			weight = w.GetValue()
+		}
 		endpoints = append(endpoints, Endpoint{
 			HealthStatus: EndpointHealthStatus(lbEndpoint.GetHealthStatus()),
 			Address:      parseAddress(lbEndpoint.GetEndpoint().GetAddress().GetSocketAddress()),
-			Weight:       lbEndpoint.GetLoadBalancingWeight().GetValue(),
+			Weight:       weight,
+			// AdditionalAddresses is left unset: this client's vendored
+			// LbEndpoint proto has no additional_addresses field yet, so
+			// there's nothing here to parse it from.
 		})
 	}
 	return endpoints
 }
 
 func parseEDSRespProto(m *v3endpointpb.ClusterLoadAssignment) (EndpointsUpdate, error) {
-	ret := EndpointsUpdate{}
+	ret := EndpointsUpdate{
+		OverprovisioningFactor: parseOverprovisioningFactor(m.GetPolicy()),
+	}
 	for _, dropPolicy := range m.GetPolicy().GetDropOverloads() {
 		ret.Drops = append(ret.Drops, parseDropPolicy(dropPolicy))
 	}
 	priorities := make(map[uint32]struct{})
-	for _, locality := range m.Endpoints {
+	// localityIdx maps a LocalityID to its index in ret.Localities, so that a
+	// LocalityID repeated across multiple entries in the response (which
+	// would otherwise collide on a single bgwc.configs[lid] entry downstream
+	// and silently lose endpoints) has all of its endpoints merged into one
+	// Locality instead.
+	localityIdx := make(map[pkg.LocalityID]int)
+	for _, locality := range m.GetEndpoints() {
 		l := locality.GetLocality()
 		if l == nil {
 			return EndpointsUpdate{}, fmt.Errorf("EDS response contains a locality without ID, locality: %+v", locality)
@@ -836,21 +989,59 @@ func parseEDSRespProto(m *v3endpointpb.ClusterLoadAssignment) (EndpointsUpdate,
 		}
 		priority := locality.GetPriority()
 		priorities[priority] = struct{}{}
+		endpoints := parseEndpoints(locality.GetLbEndpoints())
+		weight := locality.GetLoadBalancingWeight().GetValue()
+		if idx, ok := localityIdx[lid]; ok {
+			if existing := ret.Localities[idx].Priority; existing != priority {
+				return EndpointsUpdate{}, fmt.Errorf("EDS response contains locality %+v under conflicting priorities %d and %d", lid, existing, priority)
+			}
+			ret.Localities[idx].Endpoints = append(ret.Localities[idx].Endpoints, endpoints...)
+			// Each LocalityLbEndpoints entry in the response is its own
+			// endpoint group with its own load_balancing_weight; when two
+			// or more of them share a LocalityID and are merged above, the
+			// locality's effective weight is their sum, not just the first
+			// group's. Dropping the later groups' weights here would make
+			// the locality underweighted relative to its actual endpoint
+			// count.
+			ret.Localities[idx].Weight += weight
+			continue
+		}
+		localityIdx[lid] = len(ret.Localities)
 		ret.Localities = append(ret.Localities, Locality{
 			ID:        lid,
-			Endpoints: parseEndpoints(locality.GetLbEndpoints()),
-			Weight:    locality.GetLoadBalancingWeight().GetValue(),
+			Endpoints: endpoints,
+			Weight:    weight,
 			Priority:  priority,
 		})
 	}
-	for i := 0; i < len(priorities); i++ {
-		if _, ok := priorities[uint32(i)]; !ok {
-			return EndpointsUpdate{}, fmt.Errorf("priority %v missing (with different priorities %v received)", i, priorities)
-		}
+	// Control planes occasionally send sparse priorities during
+	// reconfiguration (e.g. {0, 2, 5}). Rather than rejecting the whole
+	// update, compact the received priorities into a contiguous range
+	// starting at 0 (e.g. {0, 1, 2}), preserving their relative order.
+	sortedPriorities := make([]uint32, 0, len(priorities))
+	for p := range priorities {
+		sortedPriorities = append(sortedPriorities, p)
+	}
+	sort.Slice(sortedPriorities, func(i, j int) bool { return sortedPriorities[i] < sortedPriorities[j] })
+	priorityCompact := make(map[uint32]uint32, len(sortedPriorities))
+	for i, p := range sortedPriorities {
+		priorityCompact[p] = uint32(i)
+	}
+	for i := range ret.Localities {
+		ret.Localities[i].Priority = priorityCompact[ret.Localities[i].Priority]
 	}
 	return ret, nil
 }
 
+// ParseClusterLoadAssignment converts an EDS response proto into the native
+// EndpointsUpdate representation. It's exported for server-side consumers
+// (e.g. those building an UpdateCache) that need to convert a
+// ClusterLoadAssignment obtained outside of a watch callback, such as one
+// embedded inline in a CDS response's load_assignment field.
+func ParseClusterLoadAssignment(m *v3endpointpb.ClusterLoadAssignment) (EndpointsUpdate, error) {
+	return parseEDSRespProto(m)
+}
+
 // processAllResources unmarshals and validates the resources, populates the
 // provided ret (a map), and returns metadata and error.
 //
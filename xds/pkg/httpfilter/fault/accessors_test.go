@@ -0,0 +1,121 @@
+//go:build !386
+// +build !386
+
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package fault
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/xds/pkg/httpfilter"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	cpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/common/fault/v3"
+	fpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/fault/v3"
+	tpb "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+)
+
+func faultConfig(t *testing.T, hf *fpb.HTTPFault) config {
+	t.Helper()
+	any, err := anypb.New(hf)
+	if err != nil {
+		t.Fatalf("anypb.New() failed: %v", err)
+	}
+	cfg, err := parseConfig(any)
+	if err != nil {
+		t.Fatalf("parseConfig() failed: %v", err)
+	}
+	return cfg.(config)
+}
+
+func (s) TestDelayPercentage(t *testing.T) {
+	tests := []struct {
+		name    string
+		hf      *fpb.HTTPFault
+		wantOK  bool
+		wantPct float64
+	}{{
+		name:   "no delay configured",
+		hf:     &fpb.HTTPFault{},
+		wantOK: false,
+	}, {
+		name: "50 percent",
+		hf: &fpb.HTTPFault{
+			Delay: &cpb.FaultDelay{
+				Percentage: &tpb.FractionalPercent{Numerator: 50, Denominator: tpb.FractionalPercent_HUNDRED},
+			},
+		},
+		wantOK:  true,
+		wantPct: 50,
+	}, {
+		name: "ten-thousandths denominator",
+		hf: &fpb.HTTPFault{
+			Delay: &cpb.FaultDelay{
+				Percentage: &tpb.FractionalPercent{Numerator: 2500, Denominator: tpb.FractionalPercent_TEN_THOUSAND},
+			},
+		},
+		wantOK:  true,
+		wantPct: 25,
+	}}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := faultConfig(t, tc.hf)
+			pct, ok := cfg.DelayPercentage()
+			if ok != tc.wantOK || (ok && pct != tc.wantPct) {
+				t.Errorf("DelayPercentage() = (%v, %v), want (%v, %v)", pct, ok, tc.wantPct, tc.wantOK)
+			}
+		})
+	}
+}
+
+func (s) TestAbortPercentage(t *testing.T) {
+	tests := []struct {
+		name    string
+		hf      *fpb.HTTPFault
+		wantOK  bool
+		wantPct float64
+	}{{
+		name:   "no abort configured",
+		hf:     &fpb.HTTPFault{},
+		wantOK: false,
+	}, {
+		name: "million denominator",
+		hf: &fpb.HTTPFault{
+			Abort: &fpb.FaultAbort{
+				Percentage: &tpb.FractionalPercent{Numerator: 100000, Denominator: tpb.FractionalPercent_MILLION},
+			},
+		},
+		wantOK:  true,
+		wantPct: 10,
+	}}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := faultConfig(t, tc.hf)
+			pct, ok := cfg.AbortPercentage()
+			if ok != tc.wantOK || (ok && pct != tc.wantPct) {
+				t.Errorf("AbortPercentage() = (%v, %v), want (%v, %v)", pct, ok, tc.wantPct, tc.wantOK)
+			}
+		})
+	}
+}
+
+func (s) TestConfigImplementsFaultPercentages(t *testing.T) {
+	var _ httpfilter.FaultPercentages = config{}
+}
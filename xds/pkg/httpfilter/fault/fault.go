@@ -104,6 +104,35 @@ func (builder) ParseFilterConfigOverride(override proto.Message) (httpfilter.Fil
 	return parseConfig(override)
 }
 
+// DelayPercentage returns the probability (0-100) that this config's
+// fault delay will be applied to a given RPC, and whether a delay fault is
+// configured at all.
+//
+// It implements httpfilter.FaultPercentages, letting generic consumers (e.g.
+// the resolver, for building a service config) read the delay/abort
+// percentages of whatever FilterConfig they're holding without depending on
+// this package or its underlying xDS proto types.
+func (c config) DelayPercentage() (pct float64, ok bool) {
+	if c.config.GetDelay() == nil {
+		return 0, false
+	}
+	num, den := splitPct(c.config.GetDelay().GetPercentage())
+	return 100 * float64(num) / float64(den), true
+}
+
+// AbortPercentage returns the probability (0-100) that this config's
+// fault abort will be applied to a given RPC, and whether an abort fault is
+// configured at all. See DelayPercentage.
+func (c config) AbortPercentage() (pct float64, ok bool) {
+	if c.config.GetAbort() == nil {
+		return 0, false
+	}
+	num, den := splitPct(c.config.GetAbort().GetPercentage())
+	return 100 * float64(num) / float64(den), true
+}
+
+var _ httpfilter.FaultPercentages = config{}
+
 var _ httpfilter.ClientInterceptorBuilder = builder{}
 
 func (builder) BuildClientInterceptor(cfg, override httpfilter.FilterConfig) (iresolver.ClientInterceptor, error) {
@@ -31,6 +31,16 @@ type FilterConfig interface {
 	isFilterConfig()
 }
 
+// FaultPercentages is implemented by a FilterConfig that wants to expose
+// fault-injection-style delay/abort percentages to generic consumers (e.g.
+// the resolver, for building a service config) without those consumers
+// depending on the filter's own package. ok is false from either method if
+// that fault type isn't configured.
+type FaultPercentages interface {
+	DelayPercentage() (pct float64, ok bool)
+	AbortPercentage() (pct float64, ok bool)
+}
+
 // Filter defines the parsing functionality of an HTTP filter.  A Filter may
 // optionally implement either ClientInterceptorBuilder or
 // ServerInterceptorBuilder or both, indicating it is capable of working on the
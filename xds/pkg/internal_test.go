@@ -93,6 +93,11 @@ func TestLocalityToAndFromJSON(t *testing.T) {
 			localityID: LocalityID{Region: "r:r"},
 			str:        `{"region":"r:r"}`,
 		},
+		{
+			name:       "empty",
+			localityID: LocalityID{},
+			str:        `{}`,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,48 @@
+/*
+ *
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package resolver
+
+import "time"
+
+// clock creates the timer serviceUpdateWatcher uses to detect an RDS
+// resource that an LDS response referenced but that never arrived. It's
+// created via newClock (see serviceUpdateWatcher), defaulting to
+// systemClock, so that tests can inject a fake implementation that fires
+// deterministically instead of depending on real sleeps.
+type clock interface {
+	// NewTimer arms a timer that calls f, on its own goroutine, once d
+	// elapses, mirroring time.AfterFunc. The returned clockTimer can cancel
+	// the call via Stop, same as *time.Timer.
+	NewTimer(d time.Duration, f func()) clockTimer
+}
+
+// clockTimer is the subset of *time.Timer's behavior that
+// serviceUpdateWatcher relies on.
+type clockTimer interface {
+	// Stop prevents the timer from firing, returning true if it did so
+	// before the timer had already fired or been stopped.
+	Stop() bool
+}
+
+// systemClock is the default clock, backed by time.AfterFunc.
+type systemClock struct{}
+
+func (systemClock) NewTimer(d time.Duration, f func()) clockTimer {
+	return time.AfterFunc(d, f)
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package resolver
+
+import (
+	"sync"
+
+	xdsclient "google.golang.org/grpc/xds/pkg/client"
+)
+
+var (
+	fallbackVirtualHostMu sync.RWMutex
+	fallbackVirtualHost   *xdsclient.VirtualHost
+)
+
+// SetFallbackVirtualHost configures a virtual host (routes and associated
+// clusters) to fall back to when an RDS response's VirtualHosts contains no
+// domain matching the xds:// resolver's target, instead of failing the
+// service update with "no matching virtual host found". Passing nil (the
+// default) restores that fail-closed behavior.
+//
+// This is a process-wide setting rather than a per-channel option: the xds
+// resolver builder is registered once via resolver.Register and has no
+// per-dial extension point of its own for it to hang off of. It takes
+// effect for xds:// resolvers built after the call returns; it does not
+// affect resolvers already running.
+func SetFallbackVirtualHost(vh *xdsclient.VirtualHost) {
+	fallbackVirtualHostMu.Lock()
+	defer fallbackVirtualHostMu.Unlock()
+	fallbackVirtualHost = vh
+}
+
+// getFallbackVirtualHost returns the virtual host most recently configured
+// via SetFallbackVirtualHost, or nil if none was.
+func getFallbackVirtualHost() *xdsclient.VirtualHost {
+	fallbackVirtualHostMu.RLock()
+	defer fallbackVirtualHostMu.RUnlock()
+	return fallbackVirtualHost
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright 2021 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package resolver
+
+import (
+	"testing"
+
+	xdsclient "google.golang.org/grpc/xds/pkg/client"
+)
+
+func (s) TestSetFallbackVirtualHost(t *testing.T) {
+	defer SetFallbackVirtualHost(nil)
+
+	if got := getFallbackVirtualHost(); got != nil {
+		t.Fatalf("getFallbackVirtualHost() = %+v before any SetFallbackVirtualHost call, want nil", got)
+	}
+
+	vh := &xdsclient.VirtualHost{Domains: []string{"*"}}
+	SetFallbackVirtualHost(vh)
+	if got := getFallbackVirtualHost(); got != vh {
+		t.Fatalf("getFallbackVirtualHost() = %+v, want %+v", got, vh)
+	}
+
+	SetFallbackVirtualHost(nil)
+	if got := getFallbackVirtualHost(); got != nil {
+		t.Fatalf("getFallbackVirtualHost() = %+v after SetFallbackVirtualHost(nil), want nil", got)
+	}
+}
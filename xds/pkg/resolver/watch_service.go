@@ -19,13 +19,17 @@
 package resolver
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"google.golang.org/grpc/internal/grpclog"
 	xdsclient "google.golang.org/grpc/xds/pkg/client"
+	"google.golang.org/grpc/xds/pkg/httpfilter"
+	"google.golang.org/protobuf/proto"
 )
 
 // serviceUpdate contains information received from the LDS/RDS responses which
@@ -47,18 +51,76 @@ type ldsConfig struct {
 	httpFilterConfig  []xdsclient.HTTPFilter
 }
 
+// effectiveDeadline returns the deadline an RPC governed by this
+// serviceUpdate should use for a call starting at now: whichever is sooner
+// between ctx's own deadline (if any) and now+max_stream_duration. A
+// max_stream_duration of zero means "no limit", in which case ctx's deadline
+// (if any) is returned unchanged. ok is false only when neither ctx nor
+// max_stream_duration impose a deadline.
+func (su serviceUpdate) effectiveDeadline(ctx context.Context, now time.Time) (deadline time.Time, ok bool) {
+	ctxDeadline, ctxOK := ctx.Deadline()
+	msd := su.ldsConfig.maxStreamDuration
+	if msd == 0 {
+		return ctxDeadline, ctxOK
+	}
+	streamDeadline := now.Add(msd)
+	if !ctxOK || streamDeadline.Before(ctxDeadline) {
+		return streamDeadline, true
+	}
+	return ctxDeadline, true
+}
+
+// FaultInjectionPercentages scans su's configured HTTP filters for one whose
+// FilterConfig implements httpfilter.FaultPercentages (e.g. the fault
+// injection filter) and, if found, returns the percentage (0-100) chance of
+// a delay and/or abort fault being applied to an RPC governed by su.
+// haveDelay/haveAbort report whether that filter actually configures that
+// fault type; delayPct/abortPct are meaningless when the corresponding have*
+// is false.
+func (su serviceUpdate) FaultInjectionPercentages() (delayPct float64, haveDelay bool, abortPct float64, haveAbort bool) {
+	for _, filter := range su.ldsConfig.httpFilterConfig {
+		fp, ok := filter.Config.(httpfilter.FaultPercentages)
+		if !ok {
+			continue
+		}
+		if d, ok := fp.DelayPercentage(); ok {
+			delayPct, haveDelay = d, true
+		}
+		if a, ok := fp.AbortPercentage(); ok {
+			abortPct, haveAbort = a, true
+		}
+	}
+	return delayPct, haveDelay, abortPct, haveAbort
+}
+
+// defaultRDSWatchTimeout bounds how long serviceUpdateWatcher waits for an
+// RDS response after an LDS response references a route config name, before
+// treating it as a version-skewed control plane (LDS referencing a route
+// config the control plane never sends) and reporting an error via
+// serviceCb. Matches the xds client's own default watch expiry timeout
+// (see defaultWatchExpiryTimeout in xds/pkg/client/singleton.go).
+const defaultRDSWatchTimeout = 15 * time.Second
+
+// newClock creates the clock used to schedule the RDS watch timeout above.
+// Overridden in tests to fire deterministically.
+var newClock = func() clock { return systemClock{} }
+
 // watchService uses LDS and RDS to discover information about the provided
-// serviceName.
+// serviceName. fallback, if non-nil, is used in place of failing the update
+// when no virtual host in an RDS response matches serviceName; see
+// serviceUpdateWatcher.fallback.
 //
 // Note that during race (e.g. an xDS response is received while the user is
 // calling cancel()), there's a small window where the callback can be called
 // after the watcher is canceled. The caller needs to handle this case.
-func watchService(c xdsClientInterface, serviceName string, cb func(serviceUpdate, error), logger *grpclog.PrefixLogger) (cancel func()) {
+func watchService(c xdsClientInterface, serviceName string, fallback *xdsclient.VirtualHost, cb func(serviceUpdate, error), logger *grpclog.PrefixLogger) (cancel func()) {
 	w := &serviceUpdateWatcher{
 		logger:      logger,
 		c:           c,
 		serviceName: serviceName,
+		fallback:    fallback,
 		serviceCb:   cb,
+		clock:       newClock(),
 	}
 	w.ldsCancel = c.WatchListener(serviceName, w.handleLDSResp)
 
@@ -71,14 +133,34 @@ type serviceUpdateWatcher struct {
 	logger      *grpclog.PrefixLogger
 	c           xdsClientInterface
 	serviceName string
+	// fallback is used as the virtual host for a service update when an RDS
+	// response's VirtualHosts contain no domain matching serviceName,
+	// instead of failing the update with "no matching virtual host found".
+	// nil (the default) preserves that fail-closed behavior; see
+	// SetFallbackVirtualHost.
+	fallback    *xdsclient.VirtualHost
 	ldsCancel   func()
 	serviceCb   func(serviceUpdate, error)
 	lastUpdate  serviceUpdate
+	clock       clock
 
 	mu        sync.Mutex
 	closed    bool
 	rdsName   string
 	rdsCancel func()
+	// rdsTimer fires if the RDS resource named rdsName doesn't arrive within
+	// defaultRDSWatchTimeout of the watch being started, and is stopped as
+	// soon as the first response (success or error) for it arrives.
+	rdsTimer clockTimer
+	// rdsWatchGeneration is bumped every time a new RDS watch is started. A
+	// handleRDSResp callback captures the generation of the watch it was
+	// registered for, and is dropped if it's no longer current. This guards
+	// against a route config name flipping A->B->A in quick succession: a
+	// late callback for the superseded B watch would otherwise pass the
+	// w.rdsCancel != nil check (since A's second watch has since set
+	// rdsCancel to a non-nil value again) and be mistaken for a response to
+	// the current A watch.
+	rdsWatchGeneration int
 }
 
 func (w *serviceUpdateWatcher) handleLDSResp(update xdsclient.ListenerUpdate, err error) {
@@ -98,6 +180,10 @@ func (w *serviceUpdateWatcher) handleLDSResp(update xdsclient.ListenerUpdate, er
 			w.rdsName = ""
 			w.rdsCancel = nil
 			w.lastUpdate = serviceUpdate{}
+			if w.rdsTimer != nil {
+				w.rdsTimer.Stop()
+				w.rdsTimer = nil
+			}
 		}
 		// The other error cases still return early without canceling the
 		// existing RDS watch.
@@ -123,10 +209,35 @@ func (w *serviceUpdateWatcher) handleLDSResp(update xdsclient.ListenerUpdate, er
 	if w.rdsCancel != nil {
 		w.rdsCancel()
 	}
-	w.rdsCancel = w.c.WatchRouteConfig(update.RouteConfigName, w.handleRDSResp)
+	if w.rdsTimer != nil {
+		w.rdsTimer.Stop()
+	}
+	w.rdsWatchGeneration++
+	gen := w.rdsWatchGeneration
+	w.rdsCancel = w.c.WatchRouteConfig(update.RouteConfigName, func(update xdsclient.RouteConfigUpdate, err error) {
+		w.handleRDSResp(gen, update, err)
+	})
+	w.rdsTimer = w.clock.NewTimer(defaultRDSWatchTimeout, func() {
+		w.handleRDSTimeout(gen)
+	})
 }
 
-func (w *serviceUpdateWatcher) handleRDSResp(update xdsclient.RouteConfigUpdate, err error) {
+// handleRDSTimeout fires when the RDS resource referenced by the most
+// recent LDS response doesn't arrive within defaultRDSWatchTimeout,
+// indicating a version-skewed control plane: the LDS resource points at a
+// route config name that's never going to show up in an RDS response.
+// Without this, serviceCb would simply never fire again for this watcher.
+func (w *serviceUpdateWatcher) handleRDSTimeout(gen int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed || w.rdsCancel == nil || gen != w.rdsWatchGeneration {
+		// Superseded by a newer RDS watch, or already canceled/resolved.
+		return
+	}
+	w.serviceCb(serviceUpdate{}, fmt.Errorf("xds: RDS resource %q referenced by LDS resource %q did not arrive within %v", w.rdsName, w.serviceName, defaultRDSWatchTimeout))
+}
+
+func (w *serviceUpdateWatcher) handleRDSResp(gen int, update xdsclient.RouteConfigUpdate, err error) {
 	w.logger.Infof("received RDS update: %+v, err: %v", update, err)
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -138,113 +249,253 @@ func (w *serviceUpdateWatcher) handleRDSResp(update xdsclient.RouteConfigUpdate,
 		// resource is removed.
 		return
 	}
+	if gen != w.rdsWatchGeneration {
+		// This callback is for an RDS watch that's since been superseded by
+		// a newer one (e.g. the route config name flipped A->B->A and this
+		// is B's late callback). Drop it rather than apply it to the
+		// current watch's state.
+		return
+	}
+	if w.rdsTimer != nil {
+		w.rdsTimer.Stop()
+		w.rdsTimer = nil
+	}
 	if err != nil {
 		w.serviceCb(serviceUpdate{}, err)
 		return
 	}
 
-	matchVh := findBestMatchingVirtualHost(w.serviceName, update.VirtualHosts)
+	matchVh, matchDomain, matchType := findBestMatchingVirtualHost(w.serviceName, update.VirtualHosts)
 	if matchVh == nil {
-		// No matching virtual host found.
-		w.serviceCb(serviceUpdate{}, fmt.Errorf("no matching virtual host found for %q", w.serviceName))
+		if w.fallback == nil {
+			w.serviceCb(serviceUpdate{}, fmt.Errorf("no matching virtual host found for %q", w.serviceName))
+			return
+		}
+		w.logger.Warningf("no matching virtual host found for %q, using configured fallback", w.serviceName)
+		w.lastUpdate.virtualHost = w.fallback
+		w.serviceCb(w.lastUpdate, nil)
 		return
 	}
+	w.logger.Infof("best virtual host match for %q: domain %q (%v match)", w.serviceName, matchDomain, matchType)
 
 	w.lastUpdate.virtualHost = matchVh
 	w.serviceCb(w.lastUpdate, nil)
 }
 
+// serviceUpdateDiff reports which parts of a serviceUpdate changed relative
+// to a previously delivered one. It lets consumers of the diff-aware watch
+// callback react only to meaningful changes, instead of re-processing an
+// identical re-delivery (e.g. an RDS re-ACK of unchanged content).
+type serviceUpdateDiff struct {
+	// VirtualHostChanged is true if the matched virtual host (routes,
+	// domains, weighted clusters) changed.
+	VirtualHostChanged bool
+	// MaxStreamDurationChanged is true if the HTTP connection manager's
+	// max stream duration changed.
+	MaxStreamDurationChanged bool
+	// HTTPFilterConfigChanged is true if the set of configured HTTP filters
+	// changed.
+	HTTPFilterConfigChanged bool
+}
+
+// hasChange returns true if any field in the diff indicates a change.
+func (d serviceUpdateDiff) hasChange() bool {
+	return d.VirtualHostChanged || d.MaxStreamDurationChanged || d.HTTPFilterConfigChanged
+}
+
+// diffServiceUpdate computes a serviceUpdateDiff between old and new. It's
+// used by watchServiceWithDiff to suppress callbacks for updates that carry
+// no meaningful change, e.g. when RDS re-ACKs identical content.
+func diffServiceUpdate(old, new serviceUpdate) serviceUpdateDiff {
+	return serviceUpdateDiff{
+		VirtualHostChanged:       !cmp.Equal(old.virtualHost, new.virtualHost, cmp.Comparer(proto.Equal)),
+		MaxStreamDurationChanged: old.ldsConfig.maxStreamDuration != new.ldsConfig.maxStreamDuration,
+		HTTPFilterConfigChanged:  !cmp.Equal(old.ldsConfig.httpFilterConfig, new.ldsConfig.httpFilterConfig),
+	}
+}
+
+// watchServiceWithDiff is like watchService, but cb is only invoked for
+// updates that differ from the last delivered update (as reported by
+// diffServiceUpdate). Errors are always delivered.
+func watchServiceWithDiff(c xdsClientInterface, serviceName string, fallback *xdsclient.VirtualHost, cb func(serviceUpdate, error), logger *grpclog.PrefixLogger) (cancel func()) {
+	var (
+		haveUpdate bool
+		last       serviceUpdate
+	)
+	return watchService(c, serviceName, fallback, func(update serviceUpdate, err error) {
+		if err != nil {
+			cb(update, err)
+			return
+		}
+		if haveUpdate && !diffServiceUpdate(last, update).hasChange() {
+			return
+		}
+		haveUpdate = true
+		last = update
+		cb(update, nil)
+	}, logger)
+}
+
 func (w *serviceUpdateWatcher) close() {
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
 	w.closed = true
 	w.ldsCancel()
 	if w.rdsCancel != nil {
 		w.rdsCancel()
 		w.rdsCancel = nil
 	}
+	if w.rdsTimer != nil {
+		w.rdsTimer.Stop()
+		w.rdsTimer = nil
+	}
 }
 
-type domainMatchType int
+// MatchType identifies which of the 4 domain matching pattern kinds
+// (see MatchDomain) a virtual host's domain matched with, or
+// MatchTypeInvalid if it matched none of them. It's exported, along with
+// MatchDomain and MatchTypeForDomain, so other packages (e.g. xds/cache)
+// needing the same domain matching semantics don't have to duplicate them.
+type MatchType int
 
 const (
-	domainMatchTypeInvalid domainMatchType = iota
-	domainMatchTypeUniversal
-	domainMatchTypePrefix
-	domainMatchTypeSuffix
-	domainMatchTypeExact
+	MatchTypeInvalid MatchType = iota
+	MatchTypeUniversal
+	MatchTypePrefix
+	MatchTypeSuffix
+	MatchTypeExact
 )
 
 // Exact > Suffix > Prefix > Universal > Invalid.
-func (t domainMatchType) betterThan(b domainMatchType) bool {
+func (t MatchType) betterThan(b MatchType) bool {
 	return t > b
 }
 
-func matchTypeForDomain(d string) domainMatchType {
+func (t MatchType) String() string {
+	switch t {
+	case MatchTypeUniversal:
+		return "universal"
+	case MatchTypePrefix:
+		return "prefix"
+	case MatchTypeSuffix:
+		return "suffix"
+	case MatchTypeExact:
+		return "exact"
+	default:
+		return "invalid"
+	}
+}
+
+// MatchTypeForDomain classifies a virtual host domain pattern d into one of
+// the 4 supported kinds (exact, prefix "abc*", suffix "*abc", or universal
+// "*"), or MatchTypeInvalid if d is empty or has a "*" anywhere other than
+// as a single leading or trailing character.
+func MatchTypeForDomain(d string) MatchType {
 	if d == "" {
-		return domainMatchTypeInvalid
+		return MatchTypeInvalid
 	}
 	if d == "*" {
-		return domainMatchTypeUniversal
+		return MatchTypeUniversal
 	}
 	if strings.HasPrefix(d, "*") {
-		return domainMatchTypeSuffix
+		return MatchTypeSuffix
 	}
 	if strings.HasSuffix(d, "*") {
-		return domainMatchTypePrefix
+		return MatchTypePrefix
 	}
 	if strings.Contains(d, "*") {
-		return domainMatchTypeInvalid
+		return MatchTypeInvalid
 	}
-	return domainMatchTypeExact
+	return MatchTypeExact
 }
 
-func match(domain, host string) (domainMatchType, bool) {
-	switch typ := matchTypeForDomain(domain); typ {
-	case domainMatchTypeInvalid:
+// MatchDomain reports whether host matches the virtual host domain pattern
+// domain, along with the MatchType domain was classified as by
+// MatchTypeForDomain. An invalid domain pattern never matches.
+func MatchDomain(domain, host string) (MatchType, bool) {
+	switch typ := MatchTypeForDomain(domain); typ {
+	case MatchTypeInvalid:
 		return typ, false
-	case domainMatchTypeUniversal:
+	case MatchTypeUniversal:
 		return typ, true
-	case domainMatchTypePrefix:
+	case MatchTypePrefix:
 		// abc.*
 		return typ, strings.HasPrefix(host, strings.TrimSuffix(domain, "*"))
-	case domainMatchTypeSuffix:
+	case MatchTypeSuffix:
 		// *.123
 		return typ, strings.HasSuffix(host, strings.TrimPrefix(domain, "*"))
-	case domainMatchTypeExact:
+	case MatchTypeExact:
 		return typ, domain == host
 	default:
-		return domainMatchTypeInvalid, false
+		return MatchTypeInvalid, false
+	}
+}
+
+// FindBestMatchingVirtualHost returns the virtual host from vHosts whose
+// domains field best matches host, using the same precedence
+// findBestMatchingVirtualHost applies when resolving the xds:// scheme. It's
+// exported for other packages (e.g. xds/cache) that need to resolve a host
+// to a virtual host without duplicating the matching logic. An error is
+// returned if no domain across any virtual host matches host.
+func FindBestMatchingVirtualHost(host string, vHosts []*xdsclient.VirtualHost) (*xdsclient.VirtualHost, error) {
+	vh, _, _ := findBestMatchingVirtualHost(host, vHosts)
+	if vh == nil {
+		return nil, fmt.Errorf("no matching virtual host found for %q", host)
 	}
+	return vh, nil
 }
 
 // findBestMatchingVirtualHost returns the virtual host whose domains field best
-// matches host
+// matches host, along with the domain string and match type that won, so a
+// caller can log which pattern was responsible for the match.
 //
 // The domains field support 4 different matching pattern types:
-//  - Exact match
-//  - Suffix match (e.g. “*ABC”)
-//  - Prefix match (e.g. “ABC*)
-//  - Universal match (e.g. “*”)
+//   - Exact match
+//   - Suffix match (e.g. “*ABC”)
+//   - Prefix match (e.g. “ABC*)
+//   - Universal match (e.g. “*”)
 //
 // The best match is defined as:
-//  - A match is better if it’s matching pattern type is better
-//    - Exact match > suffix match > prefix match > universal match
-//  - If two matches are of the same pattern type, the longer match is better
-//    - This is to compare the length of the matching pattern, e.g. “*ABCDE” >
-//    “*ABC”
-func findBestMatchingVirtualHost(host string, vHosts []*xdsclient.VirtualHost) *xdsclient.VirtualHost {
+//   - A match is better if it’s matching pattern type is better
+//   - Exact match > suffix match > prefix match > universal match
+//   - If two matches are of the same pattern type, the longer match is better
+//   - This is to compare the length of the matching pattern, e.g. “*ABCDE” >
+//     “*ABC”
+//
+// A domain that matches none of the 4 patterns above (e.g. one with a “*” in
+// the middle) is invalid, but it only rules out that one domain rather than
+// the whole RDS response: it's logged and skipped, so a valid match
+// elsewhere in vHosts still wins. nil, "", MatchTypeInvalid is only
+// returned when no domain across all virtual hosts matches host.
+//
+// Comparing match type before match length (see the loop below) means an
+// exact/suffix/prefix match always outranks a universal match regardless of
+// how the two domain strings compare in length; length only breaks ties
+// between two domains of the same match type.
+//
+// As a fast path, an RDS response with a single virtual host whose only
+// domain is "*" always wins, so that common case skips the per-domain
+// matching loop entirely.
+func findBestMatchingVirtualHost(host string, vHosts []*xdsclient.VirtualHost) (*xdsclient.VirtualHost, string, MatchType) {
+	if len(vHosts) == 1 && len(vHosts[0].Domains) == 1 && vHosts[0].Domains[0] == "*" {
+		return vHosts[0], "*", MatchTypeUniversal
+	}
+
 	var (
-		matchVh   *xdsclient.VirtualHost
-		matchType = domainMatchTypeInvalid
-		matchLen  int
+		matchVh     *xdsclient.VirtualHost
+		matchDomain string
+		matchType   = MatchTypeInvalid
+		matchLen    int
 	)
 	for _, vh := range vHosts {
 		for _, domain := range vh.Domains {
-			typ, matched := match(domain, host)
-			if typ == domainMatchTypeInvalid {
-				// The rds response is invalid.
-				return nil
+			typ, matched := MatchDomain(domain, host)
+			if typ == MatchTypeInvalid {
+				logger.Warningf("xds: skipping invalid domain %q in virtual host %v", domain, vh.Domains)
+				continue
 			}
 			if matchType.betterThan(typ) || matchType == typ && matchLen >= len(domain) || !matched {
 				// The previous match has better type, or the previous match has
@@ -252,9 +503,10 @@ func findBestMatchingVirtualHost(host string, vHosts []*xdsclient.VirtualHost) *
 				continue
 			}
 			matchVh = vh
+			matchDomain = domain
 			matchType = typ
 			matchLen = len(domain)
 		}
 	}
-	return matchVh
+	return matchVh, matchDomain, matchType
 }
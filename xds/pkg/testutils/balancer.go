@@ -79,6 +79,12 @@ type TestClientConn struct {
 	NewPickerCh chan balancer.Picker    // the last picker updated.
 	NewStateCh  chan connectivity.State // the last state.
 
+	ResolveNowCh chan resolver.ResolveNowOptions // up to 10 unread ResolveNow calls; later ones are dropped while it's full.
+
+	// NewSubConnError, if set, is returned by NewSubConn instead of creating
+	// a SubConn, to test a balancer's handling of SubConn creation failures.
+	NewSubConnError error
+
 	subConnIdx int
 }
 
@@ -94,11 +100,18 @@ func NewTestClientConn(t *testing.T) *TestClientConn {
 
 		NewPickerCh: make(chan balancer.Picker, 1),
 		NewStateCh:  make(chan connectivity.State, 1),
+
+		ResolveNowCh: make(chan resolver.ResolveNowOptions, 10),
 	}
 }
 
 // NewSubConn creates a new SubConn.
 func (tcc *TestClientConn) NewSubConn(a []resolver.Address, o balancer.NewSubConnOptions) (balancer.SubConn, error) {
+	if tcc.NewSubConnError != nil {
+		tcc.logger.Logf("testClientConn: NewSubConn(%v, %+v) => %v", a, o, tcc.NewSubConnError)
+		return nil, tcc.NewSubConnError
+	}
+
 	sc := TestSubConns[tcc.subConnIdx]
 	tcc.subConnIdx++
 
@@ -150,9 +163,13 @@ func (tcc *TestClientConn) UpdateState(bs balancer.State) {
 	tcc.NewPickerCh <- bs.Picker
 }
 
-// ResolveNow panics.
-func (tcc *TestClientConn) ResolveNow(resolver.ResolveNowOptions) {
-	panic("not implemented")
+// ResolveNow records the call on ResolveNowCh.
+func (tcc *TestClientConn) ResolveNow(o resolver.ResolveNowOptions) {
+	tcc.logger.Logf("testClientConn: ResolveNow(%+v)", o)
+	select {
+	case tcc.ResolveNowCh <- o:
+	default:
+	}
 }
 
 // Target panics.
@@ -119,6 +119,15 @@ func (xdsC *Client) WaitForCancelRouteConfigWatch(ctx context.Context) error {
 	return err
 }
 
+// CurrentRouteConfigCallback returns the most recently registered
+// WatchRouteConfig callback. It's meant for tests that need to hang onto a
+// superseded watch's callback (e.g. to simulate a late response arriving
+// after a newer watch has replaced it), since InvokeWatchRouteConfigCallback
+// always invokes the latest one.
+func (xdsC *Client) CurrentRouteConfigCallback() func(xdsclient.RouteConfigUpdate, error) {
+	return xdsC.rdsCb
+}
+
 // WatchCluster registers a CDS watch.
 func (xdsC *Client) WatchCluster(clusterName string, callback func(xdsclient.ClusterUpdate, error)) func() {
 	xdsC.cdsCb = callback